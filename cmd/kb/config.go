@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultServer is the URL of a server running locally with the default settings
+const defaultServer = "http://localhost:10000"
+
+// Config is the configuration of the client
+type Config struct {
+	Server    string `yaml:"server"`
+	APIKey    string `yaml:"api_key,omitempty"`
+	Workspace string `yaml:"workspace,omitempty"`
+	Output    string `yaml:"output,omitempty"`
+}
+
+// configPath returns the path of the config file
+func configPath() (string, error) {
+	if path := os.Getenv("KB_CONFIG"); path != "" {
+		return path, nil
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "kb", "config.yaml"), nil
+}
+
+// readConfig reads the config file, a missing file leaving the defaults
+func readConfig(path string) (Config, error) {
+	config := Config{Server: defaultServer, Output: formatTable}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return config, err
+	}
+
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return config, nil
+}
+
+// applyEnv overrides the configuration with the environment variables
+func (c *Config) applyEnv(getenv func(string) string) {
+	for name, field := range map[string]*string{
+		"KB_SERVER":    &c.Server,
+		"KB_API_KEY":   &c.APIKey,
+		"KB_WORKSPACE": &c.Workspace,
+	} {
+		if value := getenv(name); value != "" {
+			*field = value
+		}
+	}
+}
+
+// set changes a setting by its name in the config file
+func (c *Config) set(key, value string) error {
+	switch key {
+	case "server":
+		c.Server = value
+	case "api_key":
+		c.APIKey = value
+	case "workspace":
+		c.Workspace = value
+	case "output":
+		if err := checkFormat(value); err != nil {
+			return err
+		}
+		c.Output = value
+	default:
+		return fmt.Errorf("unknown setting: '%s', settings are server, api_key, workspace and output", key)
+	}
+
+	return nil
+}
+
+// write writes the config file, readable by the user only as it holds the API key
+func (c Config) write(path string) error {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0o600)
+}
+
+// configCommand shows or changes the settings of the config file
+func (a *app) configCommand(path string, args []string) error {
+	fs := flag.NewFlagSet("kb config", flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: kb config show\n       kb config set <setting> <value>\n\nThe config file is %s\n", path)
+	}
+
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case len(args) == 1 && args[0] == "show":
+		shown := a.config
+		if shown.APIKey != "" {
+			shown.APIKey = "[REDACTED]"
+		}
+		return yaml.NewEncoder(a.stdout).Encode(shown)
+	case len(args) == 3 && args[0] == "set":
+		config, err := readConfig(path)
+		if err != nil {
+			return err
+		}
+
+		if err := config.set(args[1], args[2]); err != nil {
+			return err
+		}
+
+		return config.write(path)
+	}
+
+	fs.Usage()
+	return flag.ErrHelp
+}
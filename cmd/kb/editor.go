@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// errEmptyEdit is returned when a document was left unchanged in the editor
+var errEmptyEdit = errors.New("no changes were made")
+
+// openEditor opens a file in $VISUAL, $EDITOR or vi
+func openEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	// The editor may come with arguments, such as "code --wait"
+	args := append(strings.Fields(editor), path)
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	return cmd.Run()
+}
+
+// editDocument opens a document in the editor of the user and returns it
+// as saved, failing with errEmptyEdit when it was not changed
+func (a *app) editDocument(doc []byte) ([]byte, error) {
+	file, err := os.CreateTemp("", "kb-*.yaml")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(doc); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+
+	if err := a.edit(file.Name()); err != nil {
+		return nil, err
+	}
+
+	edited, err := os.ReadFile(file.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.Equal(edited, doc) {
+		return nil, errEmptyEdit
+	}
+
+	return edited, nil
+}
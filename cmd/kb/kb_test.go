@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jvmistica/knowledge-base-go/pkg/record"
+	"github.com/stretchr/testify/assert"
+)
+
+var testNotes = []record.Note{
+	{ID: 1, Title: "Groceries", Content: "Milk\nEggs\n", Ownership: record.Ownership{Visibility: "private"}},
+	{ID: 2, Title: "Packing list", Content: "Passport\n", Ownership: record.Ownership{Visibility: "team"}},
+}
+
+// testAPI is a fake API serving the test notes and recording the bodies of the changes
+type testAPI struct {
+	*httptest.Server
+	created []map[string]any
+	updated []map[string]any
+}
+
+func newTestAPI(t *testing.T) *testAPI {
+	api := &testAPI{}
+	api.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer kbk_test", r.Header.Get("Authorization"))
+
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+
+		w.Header().Set("content-type", "application/json")
+		switch r.URL.Path {
+		case "/api/v1/notes/list":
+			w.Header().Set("X-Total-Count", strconv.Itoa(len(testNotes)))
+			json.NewEncoder(w).Encode(testNotes)
+		case "/api/v1/recipes/list", "/api/v1/scripts/list":
+			w.Header().Set("X-Total-Count", "0")
+			w.Write([]byte("[]"))
+		case "/api/v1/notes":
+			for _, note := range testNotes {
+				if r.URL.Query().Get("id") == strconv.FormatUint(uint64(note.ID), 10) {
+					json.NewEncoder(w).Encode(note)
+					return
+				}
+			}
+			w.WriteHeader(http.StatusNotFound)
+		case "/api/v1/notes/new":
+			api.created = append(api.created, body)
+			body["id"] = 3
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(body)
+		case "/api/v1/notes/update":
+			api.updated = append(api.updated, body)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(api.Close)
+
+	return api
+}
+
+// newTestApp returns an app using the fake API, and its standard output
+func newTestApp(t *testing.T, api *testAPI) (*app, *bytes.Buffer) {
+	t.Setenv("KB_CONFIG", filepath.Join(t.TempDir(), "config.yaml"))
+	t.Setenv("KB_SERVER", api.URL)
+	t.Setenv("KB_API_KEY", "kbk_test")
+	t.Setenv("KB_WORKSPACE", "")
+
+	stdout := &bytes.Buffer{}
+	a := &app{
+		ctx:    context.Background(),
+		stdin:  strings.NewReader(""),
+		stdout: stdout,
+		stderr: &bytes.Buffer{},
+		edit: func(string) error {
+			t.Error("the editor was opened")
+			return nil
+		},
+	}
+
+	return a, stdout
+}
+
+func TestNotesList(t *testing.T) {
+	api := newTestAPI(t)
+
+	t.Run("table", func(t *testing.T) {
+		a, stdout := newTestApp(t, api)
+		assert.Nil(t, a.run([]string{"notes", "list"}))
+
+		lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+		if assert.Len(t, lines, 3) {
+			assert.Regexp(t, `^ID\s+TITLE\s+VISIBILITY\s+UPDATED$`, lines[0])
+			assert.Regexp(t, `^2\s+Packing list\s+team`, lines[2])
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		a, stdout := newTestApp(t, api)
+		assert.Nil(t, a.run([]string{"notes", "list", "-o", "json"}))
+
+		var notes []record.Note
+		assert.Nil(t, json.Unmarshal(stdout.Bytes(), &notes))
+		assert.Equal(t, testNotes[1].Title, notes[1].Title)
+	})
+
+	t.Run("yaml", func(t *testing.T) {
+		a, stdout := newTestApp(t, api)
+		assert.Nil(t, a.run([]string{"-o", "yaml", "notes", "get", "1"}))
+
+		assert.Contains(t, stdout.String(), "title: Groceries\n")
+		assert.Contains(t, stdout.String(), "content: |\n  Milk\n  Eggs\n")
+	})
+
+	t.Run("error: not found", func(t *testing.T) {
+		a, _ := newTestApp(t, api)
+		err := a.run([]string{"notes", "get", "9"})
+		assert.ErrorContains(t, err, "note 9: 404 Not Found")
+	})
+
+	t.Run("error: invalid format", func(t *testing.T) {
+		a, _ := newTestApp(t, api)
+		assert.ErrorContains(t, a.run([]string{"notes", "list", "-o", "xml"}), "invalid output format")
+	})
+}
+
+func TestNotesEdit(t *testing.T) {
+	api := newTestAPI(t)
+	a, _ := newTestApp(t, api)
+	a.edit = func(path string) error {
+		doc, err := os.ReadFile(path)
+		assert.Nil(t, err)
+		assert.Contains(t, string(doc), "# Editing note 1")
+
+		doc = bytes.Replace(doc, []byte("title: Groceries"), []byte("title: Shopping"), 1)
+		return os.WriteFile(path, doc, 0o600)
+	}
+
+	assert.Nil(t, a.run([]string{"notes", "edit", "1"}))
+
+	// Only the changed fields are sent
+	assert.Equal(t, []map[string]any{{"id": float64(1), "title": "Shopping"}}, api.updated)
+}
+
+func TestNotesNew(t *testing.T) {
+	api := newTestAPI(t)
+	a, stdout := newTestApp(t, api)
+	a.stdin = strings.NewReader("title: Recipes to try\ncontent: |\n  Ramen\n")
+
+	assert.Nil(t, a.run([]string{"notes", "new", "-f", "-", "-o", "json"}))
+
+	if assert.Len(t, api.created, 1) {
+		assert.Equal(t, "Recipes to try", api.created[0]["title"])
+		assert.Equal(t, "Ramen\n", api.created[0]["content"])
+	}
+	assert.Contains(t, stdout.String(), `"id": 3`)
+}
+
+func TestSearch(t *testing.T) {
+	api := newTestAPI(t)
+	a, stdout := newTestApp(t, api)
+
+	assert.Nil(t, a.run([]string{"search", "passport"}))
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if assert.Len(t, lines, 2) {
+		assert.Regexp(t, `^note\s+2\s+Packing list$`, lines[1])
+	}
+
+	assert.ErrorContains(t, a.run([]string{"search", "-type", "songs", "passport"}), "unknown record type")
+}
+
+func TestConfig(t *testing.T) {
+	api := newTestAPI(t)
+	a, stdout := newTestApp(t, api)
+
+	assert.Nil(t, a.run([]string{"config", "set", "workspace", "acme"}))
+
+	path := os.Getenv("KB_CONFIG")
+	config, err := readConfig(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "acme", config.Workspace)
+	assert.Equal(t, defaultServer, config.Server)
+
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	// The environment overrides the file, and the API key is not shown
+	assert.Nil(t, a.run([]string{"config", "show"}))
+	assert.Contains(t, stdout.String(), "server: "+api.URL)
+	assert.Contains(t, stdout.String(), "workspace: acme")
+	assert.Contains(t, stdout.String(), "api_key: '[REDACTED]'")
+
+	assert.ErrorContains(t, a.run([]string{"config", "set", "colour", "blue"}), "unknown setting")
+}
@@ -0,0 +1,141 @@
+// Command kb is a command-line client of the knowledge base
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/jvmistica/knowledge-base-go/pkg/client"
+)
+
+const usage = `Usage: kb [flags] <command> [arguments]
+
+Commands:
+  notes list|get|new|edit|rm      Manage notes
+  recipes list|get|new|edit|rm    Manage recipes
+  scripts list|get|new|edit|rm    Manage scripts
+  search <query>                  Search notes, recipes and scripts
+  config show|set                 Show or change the configuration
+
+The server URL and API key are read from the config file (KB_CONFIG, by
+default kb/config.yaml in the user config directory), then from the
+KB_SERVER, KB_API_KEY and KB_WORKSPACE environment variables, then from
+the flags.
+
+Flags:
+`
+
+// app is the state shared by the commands
+type app struct {
+	ctx    context.Context
+	config Config
+	client *client.Client
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	// edit opens a file in the editor of the user and waits for it to be closed
+	edit func(path string) error
+}
+
+func main() {
+	a := &app{
+		ctx:    context.Background(),
+		stdin:  os.Stdin,
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+		edit:   openEditor,
+	}
+
+	if err := a.run(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(2)
+		}
+		fmt.Fprintf(os.Stderr, "kb: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// run parses the global flags and runs a command
+func (a *app) run(args []string) error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+
+	config, err := readConfig(path)
+	if err != nil {
+		return err
+	}
+	config.applyEnv(os.Getenv)
+
+	fs := flag.NewFlagSet("kb", flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	fs.StringVar(&config.Server, "server", config.Server, "URL of the knowledge base server")
+	fs.StringVar(&config.APIKey, "api-key", config.APIKey, "API key or access token")
+	fs.StringVar(&config.Workspace, "workspace", config.Workspace, "slug of the workspace")
+	fs.StringVar(&config.Output, "o", config.Output, "output format: table, json or yaml")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	a.config = config
+	a.client = client.New(config.Server, client.WithToken(config.APIKey), client.WithWorkspace(config.Workspace))
+
+	command, args := fs.Arg(0), fs.Args()[1:]
+	switch command {
+	case "search":
+		return a.search(args)
+	case "config":
+		return a.configCommand(path, args)
+	}
+
+	for _, r := range resources {
+		if r.command() == command {
+			return r.run(a, args)
+		}
+	}
+
+	return fmt.Errorf("unknown command: '%s', run 'kb -h' for the list of commands", command)
+}
+
+// parseFlags parses the flags of a command, which may follow its arguments,
+// and returns its arguments
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// parseID parses the ID of a record
+func parseID(arg string) (uint, error) {
+	id, err := strconv.ParseUint(arg, 10, 64)
+	if err != nil || id == 0 {
+		return 0, fmt.Errorf("invalid id: '%s'", arg)
+	}
+
+	return uint(id), nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatYAML  = "yaml"
+)
+
+// checkFormat checks an output format
+func checkFormat(format string) error {
+	switch format {
+	case formatTable, formatJSON, formatYAML:
+		return nil
+	}
+
+	return fmt.Errorf("invalid output format: '%s', supported formats are %s, %s, %s", format, formatTable, formatJSON, formatYAML)
+}
+
+// writeValue writes a value as JSON or YAML, following its JSON encoding
+func writeValue(w io.Writer, format string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if format == formatJSON {
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	}
+
+	data, err = toYAML(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+// toYAML converts JSON to YAML, keeping the order of the fields
+func toYAML(data []byte) ([]byte, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	blockStyle(&node)
+
+	var out strings.Builder
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+
+	return []byte(out.String()), nil
+}
+
+// blockStyle clears the JSON flow style of the nodes of a document so it
+// is written in the block style, with multi-line strings as literals
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+// fromYAML decodes YAML into a value, following its JSON encoding
+func fromYAML(data []byte, v any) error {
+	var doc any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	if doc == nil {
+		doc = map[string]any{}
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// writeTable writes rows aligned in columns under a header
+func writeTable(w io.Writer, header []string, rows [][]string) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+
+	return tw.Flush()
+}
+
+// oneLine shortens a text to its first line, for the columns of a table
+func oneLine(text string, max int) string {
+	text, _, cut := strings.Cut(strings.TrimSpace(text), "\n")
+	if runes := []rune(text); len(runes) > max {
+		return string(runes[:max-1]) + "…"
+	} else if cut {
+		return text + " …"
+	}
+
+	return text
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/jvmistica/knowledge-base-go/pkg/client"
+	"github.com/jvmistica/knowledge-base-go/pkg/record"
+)
+
+// titleWidth is the width of the title columns of the tables
+const titleWidth = 50
+
+// noteDoc are the editable fields of a note
+type noteDoc struct {
+	Title      string `json:"title"`
+	Visibility string `json:"visibility,omitempty"`
+	Encrypted  bool   `json:"encrypted,omitempty"`
+	Content    string `json:"content"`
+}
+
+// recipeDoc are the editable fields of a recipe
+type recipeDoc struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Category    string `json:"category"`
+	Servings    int    `json:"servings"`
+	Visibility  string `json:"visibility,omitempty"`
+	Ingredients string `json:"ingredients"`
+	Instruction string `json:"instruction"`
+}
+
+// scriptDoc are the editable fields of a script
+type scriptDoc struct {
+	Name        string                   `json:"name"`
+	Description string                   `json:"description"`
+	Language    string                   `json:"language"`
+	Version     string                   `json:"version,omitempty"`
+	Visibility  string                   `json:"visibility,omitempty"`
+	Encrypted   bool                     `json:"encrypted,omitempty"`
+	Parameters  []record.ScriptParameter `json:"parameters,omitempty"`
+	Body        string                   `json:"body"`
+}
+
+// changed returns the new value of a field, or nil when it did not change
+func changed[V any](before, after V) *V {
+	if reflect.DeepEqual(before, after) {
+		return nil
+	}
+
+	return &after
+}
+
+// updatedAt formats the time a record was last updated
+func updatedAt(t time.Time) string {
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+var notes = &kind[record.Note, noteDoc]{
+	name:   "note",
+	plural: "notes",
+	header: []string{"ID", "TITLE", "VISIBILITY", "UPDATED"},
+	row: func(n record.Note) []string {
+		return []string{fmt.Sprint(n.ID), oneLine(n.Title, titleWidth), n.Visibility, updatedAt(n.UpdatedAt)}
+	},
+	id:    func(n record.Note) uint { return n.ID },
+	title: func(n record.Note) string { return n.Title },
+	text:  func(n record.Note) string { return n.Content },
+	doc: func(n record.Note) noteDoc {
+		return noteDoc{Title: n.Title, Visibility: n.Visibility, Encrypted: n.Encrypted, Content: n.Content}
+	},
+	record: func(d noteDoc) record.Note {
+		return record.Note{Title: d.Title, Content: d.Content, Encrypted: d.Encrypted, Ownership: record.Ownership{Visibility: d.Visibility}}
+	},
+	iterate: func(c *client.Client, ctx context.Context) *client.Iterator[record.Note] {
+		return c.Notes(ctx, listPageSize)
+	},
+	get:    (*client.Client).GetNote,
+	create: (*client.Client).CreateNote,
+	update: func(c *client.Client, ctx context.Context, id uint, before, after noteDoc) error {
+		return c.UpdateNote(ctx, id, client.NoteUpdate{
+			Title:      changed(before.Title, after.Title),
+			Content:    changed(before.Content, after.Content),
+			Encrypted:  changed(before.Encrypted, after.Encrypted),
+			Visibility: changed(before.Visibility, after.Visibility),
+		})
+	},
+	remove: (*client.Client).DeleteNote,
+}
+
+var recipes = &kind[record.Recipe, recipeDoc]{
+	name:   "recipe",
+	plural: "recipes",
+	header: []string{"ID", "NAME", "CATEGORY", "SERVINGS", "UPDATED"},
+	row: func(r record.Recipe) []string {
+		return []string{fmt.Sprint(r.ID), oneLine(r.Name, titleWidth), r.Category, strconv.Itoa(r.Servings), updatedAt(r.UpdatedAt)}
+	},
+	id:    func(r record.Recipe) uint { return r.ID },
+	title: func(r record.Recipe) string { return r.Name },
+	text: func(r record.Recipe) string {
+		return r.Description + "\n\n" + r.Ingredients + "\n\n" + r.Instruction
+	},
+	doc: func(r record.Recipe) recipeDoc {
+		return recipeDoc{
+			Name: r.Name, Description: r.Description, Category: r.Category, Servings: r.Servings,
+			Visibility: r.Visibility, Ingredients: r.Ingredients, Instruction: r.Instruction,
+		}
+	},
+	record: func(d recipeDoc) record.Recipe {
+		return record.Recipe{
+			Name: d.Name, Description: d.Description, Category: d.Category, Servings: d.Servings,
+			Ingredients: d.Ingredients, Instruction: d.Instruction, Ownership: record.Ownership{Visibility: d.Visibility},
+		}
+	},
+	iterate: func(c *client.Client, ctx context.Context) *client.Iterator[record.Recipe] {
+		return c.Recipes(ctx, listPageSize)
+	},
+	get:    (*client.Client).GetRecipe,
+	create: (*client.Client).CreateRecipe,
+	update: func(c *client.Client, ctx context.Context, id uint, before, after recipeDoc) error {
+		return c.UpdateRecipe(ctx, id, client.RecipeUpdate{
+			Name:        changed(before.Name, after.Name),
+			Description: changed(before.Description, after.Description),
+			Instruction: changed(before.Instruction, after.Instruction),
+			Category:    changed(before.Category, after.Category),
+			Ingredients: changed(before.Ingredients, after.Ingredients),
+			Servings:    changed(before.Servings, after.Servings),
+			Visibility:  changed(before.Visibility, after.Visibility),
+		})
+	},
+	remove: (*client.Client).DeleteRecipe,
+}
+
+var scripts = &kind[record.Script, scriptDoc]{
+	name:   "script",
+	plural: "scripts",
+	header: []string{"ID", "NAME", "LANGUAGE", "VERSION", "UPDATED"},
+	row: func(s record.Script) []string {
+		return []string{fmt.Sprint(s.ID), oneLine(s.Name, titleWidth), s.Language, s.Version, updatedAt(s.UpdatedAt)}
+	},
+	id:    func(s record.Script) uint { return s.ID },
+	title: func(s record.Script) string { return s.Name },
+	text:  func(s record.Script) string { return s.Body },
+	doc: func(s record.Script) scriptDoc {
+		doc := scriptDoc{
+			Name: s.Name, Description: s.Description, Language: s.Language, Version: s.Version,
+			Visibility: s.Visibility, Encrypted: s.Encrypted, Body: s.Body,
+		}
+		// An empty list reads back as nil from the document
+		if len(s.Parameters) > 0 {
+			doc.Parameters = s.Parameters
+		}
+		return doc
+	},
+	record: func(d scriptDoc) record.Script {
+		return record.Script{
+			Name: d.Name, Description: d.Description, Language: d.Language, Version: d.Version, Encrypted: d.Encrypted,
+			Parameters: d.Parameters, Body: d.Body, Ownership: record.Ownership{Visibility: d.Visibility},
+		}
+	},
+	iterate: func(c *client.Client, ctx context.Context) *client.Iterator[record.Script] {
+		return c.Scripts(ctx, listPageSize)
+	},
+	get:    (*client.Client).GetScript,
+	create: (*client.Client).CreateScript,
+	update: func(c *client.Client, ctx context.Context, id uint, before, after scriptDoc) error {
+		_, err := c.UpdateScript(ctx, id, client.ScriptUpdate{
+			Name:        changed(before.Name, after.Name),
+			Description: changed(before.Description, after.Description),
+			Body:        changed(before.Body, after.Body),
+			Encrypted:   changed(before.Encrypted, after.Encrypted),
+			Language:    changed(before.Language, after.Language),
+			Version:     changed(before.Version, after.Version),
+			Parameters:  changed(before.Parameters, after.Parameters),
+			Visibility:  changed(before.Visibility, after.Visibility),
+		})
+		return err
+	},
+	remove: (*client.Client).DeleteScript,
+}
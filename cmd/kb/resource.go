@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/jvmistica/knowledge-base-go/pkg/client"
+)
+
+// listPageSize is the number of records fetched per request by list and search
+const listPageSize = 100
+
+// resource is a record type managed with the list, get, new, edit and rm commands
+type resource interface {
+	command() string
+	run(a *app, args []string) error
+	search(a *app, query string) ([]match, error)
+}
+
+// resources are the record types of the commands
+var resources = []resource{notes, recipes, scripts}
+
+// kind describes a record type T, edited as a document D
+type kind[T, D any] struct {
+	name   string
+	plural string
+	header []string
+	row    func(T) []string
+	// id and title identify a record, text is its main content
+	id    func(T) uint
+	title func(T) string
+	text  func(T) string
+	// doc returns the editable fields of a record, and record a new record from them
+	doc    func(T) D
+	record func(D) T
+
+	iterate func(*client.Client, context.Context) *client.Iterator[T]
+	get     func(*client.Client, context.Context, uint) (*T, error)
+	create  func(*client.Client, context.Context, T) (*T, error)
+	update  func(c *client.Client, ctx context.Context, id uint, before, after D) error
+	remove  func(*client.Client, context.Context, uint) error
+}
+
+// command implements resource
+func (k *kind[T, D]) command() string {
+	return k.plural
+}
+
+// run implements resource
+func (k *kind[T, D]) run(a *app, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing command, run 'kb %s list|get|new|edit|rm'", k.plural)
+	}
+
+	fs := flag.NewFlagSet("kb "+k.plural+" "+args[0], flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	format := fs.String("o", a.config.Output, "output format: table, json or yaml")
+
+	var file *string
+	if args[0] == "new" {
+		file = fs.String("f", "", "read the new "+k.name+" from a YAML or JSON file, - for stdin, instead of the editor")
+	}
+
+	positional, err := parseFlags(fs, args[1:])
+	if err != nil {
+		return err
+	}
+
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		return k.list(a, *format)
+	case "get":
+		return k.forEach(positional, func(id uint) error { return k.show(a, *format, id) })
+	case "new":
+		return k.add(a, *format, *file)
+	case "edit":
+		if len(positional) != 1 {
+			return fmt.Errorf("usage: kb %s edit <id>", k.plural)
+		}
+		id, err := parseID(positional[0])
+		if err != nil {
+			return err
+		}
+		return k.edit(a, id)
+	case "rm":
+		return k.forEach(positional, func(id uint) error {
+			if err := k.remove(a.client, a.ctx, id); err != nil {
+				return err
+			}
+			fmt.Fprintf(a.stderr, "Deleted %s %d\n", k.name, id)
+			return nil
+		})
+	}
+
+	return fmt.Errorf("unknown command: '%s', run 'kb %s list|get|new|edit|rm'", args[0], k.plural)
+}
+
+// forEach runs a command on the records whose IDs are given
+func (k *kind[T, D]) forEach(args []string, fn func(id uint) error) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing %s id", k.name)
+	}
+
+	for _, arg := range args {
+		id, err := parseID(arg)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(id); err != nil {
+			return fmt.Errorf("%s %d: %w", k.name, id, err)
+		}
+	}
+
+	return nil
+}
+
+// all fetches all the records
+func (k *kind[T, D]) all(a *app) ([]T, error) {
+	items := []T{}
+	it := k.iterate(a.client, a.ctx)
+	for it.Next() {
+		items = append(items, it.Value())
+	}
+
+	return items, it.Err()
+}
+
+// list writes all the records
+func (k *kind[T, D]) list(a *app, format string) error {
+	items, err := k.all(a)
+	if err != nil {
+		return err
+	}
+
+	if format != formatTable {
+		return writeValue(a.stdout, format, items)
+	}
+
+	rows := make([][]string, len(items))
+	for i, item := range items {
+		rows[i] = k.row(item)
+	}
+
+	return writeTable(a.stdout, k.header, rows)
+}
+
+// show writes a record, followed by its content in the table format
+func (k *kind[T, D]) show(a *app, format string, id uint) error {
+	item, err := k.get(a.client, a.ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if format != formatTable {
+		return writeValue(a.stdout, format, item)
+	}
+
+	if err := writeTable(a.stdout, k.header, [][]string{k.row(*item)}); err != nil {
+		return err
+	}
+
+	if text := strings.TrimRight(k.text(*item), "\n"); text != "" {
+		_, err = fmt.Fprintf(a.stdout, "\n%s\n", text)
+	}
+	return err
+}
+
+// add creates a record from a file, or from a document written in the editor
+func (k *kind[T, D]) add(a *app, format, file string) error {
+	var data []byte
+	var err error
+	switch file {
+	case "":
+		var empty D
+		data, err = k.document(empty, "Write the new "+k.name+", then save and quit to create it.")
+		if err != nil {
+			return err
+		}
+		data, err = a.editDocument(data)
+	case "-":
+		data, err = io.ReadAll(a.stdin)
+	default:
+		data, err = os.ReadFile(file)
+	}
+	if errors.Is(err, errEmptyEdit) {
+		return fmt.Errorf("the %s was not created: %w", k.name, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	var doc D
+	if err := fromYAML(data, &doc); err != nil {
+		return fmt.Errorf("invalid %s: %w", k.name, err)
+	}
+
+	created, err := k.create(a.client, a.ctx, k.record(doc))
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(a.stderr, "Created %s %d\n", k.name, k.id(*created))
+	if format != formatTable {
+		return writeValue(a.stdout, format, created)
+	}
+
+	return nil
+}
+
+// edit opens a record in the editor and saves the changed fields
+func (k *kind[T, D]) edit(a *app, id uint) error {
+	item, err := k.get(a.client, a.ctx, id)
+	if err != nil {
+		return err
+	}
+
+	before := k.doc(*item)
+	data, err := k.document(before, fmt.Sprintf("Editing %s %d, save and quit to update it.", k.name, id))
+	if err != nil {
+		return err
+	}
+
+	data, err = a.editDocument(data)
+	if errors.Is(err, errEmptyEdit) {
+		fmt.Fprintf(a.stderr, "The %s %d was not changed\n", k.name, id)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var after D
+	if err := fromYAML(data, &after); err != nil {
+		return fmt.Errorf("invalid %s: %w", k.name, err)
+	}
+
+	if err := k.update(a.client, a.ctx, id, before, after); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(a.stderr, "Updated %s %d\n", k.name, id)
+	return nil
+}
+
+// document returns the YAML document of the editable fields of a record, with a heading comment
+func (k *kind[T, D]) document(doc D, heading string) ([]byte, error) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = toYAML(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte("# "+heading+"\n"), data...), nil
+}
+
+// match is a record found by a search
+type match struct {
+	Type  string `json:"type"`
+	ID    uint   `json:"id"`
+	Title string `json:"title"`
+}
+
+// search implements resource, matching the title and the content of the records
+func (k *kind[T, D]) search(a *app, query string) ([]match, error) {
+	items, err := k.all(a)
+	if err != nil {
+		return nil, err
+	}
+
+	query = strings.ToLower(query)
+	var matches []match
+	for _, item := range items {
+		if strings.Contains(strings.ToLower(k.title(item)), query) || strings.Contains(strings.ToLower(k.text(item)), query) {
+			matches = append(matches, match{Type: k.name, ID: k.id(item), Title: k.title(item)})
+		}
+	}
+
+	return matches, nil
+}
+
+// search searches the records of all or some types for a text
+func (a *app) search(args []string) error {
+	fs := flag.NewFlagSet("kb search", flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	format := fs.String("o", a.config.Output, "output format: table, json or yaml")
+	types := fs.String("type", "", "comma-separated record types to search: notes, recipes, scripts")
+
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		return errors.New("usage: kb search [-type notes,recipes,scripts] <query>")
+	}
+	query := strings.Join(args, " ")
+
+	searched := resources
+	if *types != "" {
+		searched = nil
+		for _, name := range strings.Split(*types, ",") {
+			i := slices.IndexFunc(resources, func(r resource) bool { return r.command() == strings.TrimSpace(name) })
+			if i < 0 {
+				return fmt.Errorf("unknown record type: '%s'", name)
+			}
+			searched = append(searched, resources[i])
+		}
+	}
+
+	matches := []match{}
+	for _, r := range searched {
+		found, err := r.search(a, query)
+		if err != nil {
+			return err
+		}
+		matches = append(matches, found...)
+	}
+
+	if *format != formatTable {
+		return writeValue(a.stdout, *format, matches)
+	}
+
+	rows := make([][]string, len(matches))
+	for i, m := range matches {
+		rows[i] = []string{m.Type, fmt.Sprint(m.ID), oneLine(m.Title, titleWidth)}
+	}
+
+	return writeTable(a.stdout, []string{"TYPE", "ID", "TITLE"}, rows)
+}
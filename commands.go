@@ -0,0 +1,441 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"gorm.io/gorm"
+
+	"github.com/jvmistica/knowledge-base-go/pkg/config"
+	"github.com/jvmistica/knowledge-base-go/pkg/record"
+)
+
+// openOutput opens the file a command writes to, the standard output for "" or "-"
+func openOutput(path string) (io.WriteCloser, error) {
+	if path == "" || path == "-" {
+		return os.Stdout, nil
+	}
+
+	return os.Create(path)
+}
+
+// openInput opens the file a command reads from, the standard input for "" or "-"
+func openInput(path string) (io.ReadCloser, error) {
+	if path == "" || path == "-" {
+		return os.Stdin, nil
+	}
+
+	return os.Open(path)
+}
+
+// inputArg returns the only argument of a command naming its input file, if any
+func inputArg(args []string) (string, error) {
+	switch len(args) {
+	case 0:
+		return "", nil
+	case 1:
+		return args[0], nil
+	}
+
+	return "", fmt.Errorf("unexpected arguments: %v", args[1:])
+}
+
+// findWorkspace returns a workspace by its slug
+func findWorkspace(db *gorm.DB, slug string) (*record.Workspace, error) {
+	var workspace record.Workspace
+	result := db.Where("slug = ?", slug).Limit(1).Find(&workspace)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return nil, fmt.Errorf("workspace not found: '%s'", slug)
+	}
+
+	return &workspace, nil
+}
+
+// migrate creates or updates the tables of the database
+func migrate(args []string) error {
+	fs := newFlagSet("migrate", "")
+	loader := config.NewLoader(fs)
+	var admin = fs.String("admin", "", "username of a registered user to make an admin of the default workspace")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(loader)
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB(cfg.Database)
+	if err != nil {
+		return err
+	}
+
+	if err := record.Migrate(db); err != nil {
+		return err
+	}
+	log.Print("database migrated")
+
+	if *admin != "" {
+		if err := record.AddDefaultAdmin(db, *admin); err != nil {
+			return err
+		}
+		log.Printf("%s is an admin of the default workspace", *admin)
+	}
+
+	return nil
+}
+
+// seed adds the sample records to the default workspace
+func seed(args []string) error {
+	fs := newFlagSet("seed", "")
+	loader := config.NewLoader(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(loader)
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB(cfg.Database)
+	if err != nil {
+		return err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, records := range []any{&record.Notes, &record.Recipes, &record.Scripts} {
+			if result := tx.Create(records); result.Error != nil {
+				return result.Error
+			}
+		}
+
+		// The records are created without a workspace, then moved to the default one
+		_, err := record.EnsureDefaultWorkspace(tx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("added %d notes, %d recipes and %d scripts", len(record.Notes), len(record.Recipes), len(record.Scripts))
+	return nil
+}
+
+// backup writes all the tables to a JSON backup
+func backup(args []string) error {
+	fs := newFlagSet("backup", "")
+	loader := config.NewLoader(fs)
+	var output = fs.String("o", "", "file to write the backup to, defaults to the standard output")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(loader)
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB(cfg.Database)
+	if err != nil {
+		return err
+	}
+
+	w, err := openOutput(*output)
+	if err != nil {
+		return err
+	}
+
+	n, err := record.Backup(db, w)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Printf("backed up %d rows", n)
+	return nil
+}
+
+// restore restores a JSON backup into the database
+func restore(args []string) error {
+	fs := newFlagSet("restore", "[backup.json]")
+	loader := config.NewLoader(fs)
+	var replace = fs.Bool("replace", false, "set to true to delete the rows of the tables before restoring")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	path, err := inputArg(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(loader)
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB(cfg.Database)
+	if err != nil {
+		return err
+	}
+
+	// The tables are created, but not the default workspace which is in the backup
+	if err := db.AutoMigrate(record.Models...); err != nil {
+		return err
+	}
+
+	r, err := openInput(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	n, err := record.Restore(db, r, *replace)
+	if err != nil {
+		return err
+	}
+
+	// The default workspace is created if it was not in the backup, and the schema version recorded
+	if err := record.Migrate(db); err != nil {
+		return err
+	}
+
+	log.Printf("restored %d rows", n)
+	return nil
+}
+
+// export writes the notes, recipes and scripts of a workspace as JSON
+func export(args []string) error {
+	fs := newFlagSet("export", "")
+	loader := config.NewLoader(fs)
+	var slug = fs.String("workspace", record.DefaultWorkspace, "slug of the workspace to export")
+	var output = fs.String("o", "", "file to write the export to, defaults to the standard output")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(loader)
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB(cfg.Database)
+	if err != nil {
+		return err
+	}
+
+	workspace, err := findWorkspace(db, *slug)
+	if err != nil {
+		return err
+	}
+
+	exported, err := record.ExportRecords(db, workspace)
+	if err != nil {
+		return err
+	}
+
+	w, err := openOutput(*output)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(exported)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Printf("exported %d notes, %d recipes and %d scripts", len(exported.Notes), len(exported.Recipes), len(exported.Scripts))
+	return nil
+}
+
+// importRecords adds the records of an export to a workspace
+func importRecords(args []string) error {
+	fs := newFlagSet("import", "[export.json]")
+	loader := config.NewLoader(fs)
+	var slug = fs.String("workspace", record.DefaultWorkspace, "slug of the workspace to import into")
+	var owner = fs.String("owner", "", "username of the owner of the imported records")
+	loader.RegisterFlags("keyfile")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *owner == "" {
+		return errors.New("missing flag -owner")
+	}
+
+	path, err := inputArg(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	r, err := openInput(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	var exported record.Export
+	if err := json.NewDecoder(r).Decode(&exported); err != nil {
+		return fmt.Errorf("invalid export: %w", err)
+	}
+
+	cfg, err := loadConfig(loader)
+	if err != nil {
+		return err
+	}
+
+	keys, err := loadKeys(cfg.Features.Encryption)
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB(cfg.Database)
+	if err != nil {
+		return err
+	}
+
+	workspace, err := findWorkspace(db, *slug)
+	if err != nil {
+		return err
+	}
+
+	var user record.User
+	result := db.Where("username = ?", *owner).Limit(1).Find(&user)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("user not found: '%s'", *owner)
+	}
+
+	n, err := record.ImportRecords(db, keys, workspace, &user, &exported)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("imported %d records into workspace %s", n, workspace.Slug)
+	return nil
+}
+
+// rotateKeys rewraps all the encrypted fields with the primary master key
+func rotateKeys(args []string) error {
+	fs := newFlagSet("rotate-keys", "")
+	loader := config.NewLoader(fs)
+	loader.RegisterFlags("keyfile")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(loader)
+	if err != nil {
+		return err
+	}
+
+	keys, err := loadKeys(cfg.Features.Encryption)
+	if err != nil {
+		return err
+	}
+	if keys == nil {
+		return errors.New("missing master keys to rotate")
+	}
+
+	db, err := openDB(cfg.Database)
+	if err != nil {
+		return err
+	}
+
+	n, err := record.RotateKeys(db, keys)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("rewrapped %d encrypted fields with key %s", n, keys.Primary())
+	return nil
+}
+
+// checkConfig checks the configuration of the server and the files it
+// refers to, and optionally the connection to the database
+func checkConfig(args []string) error {
+	fs := newFlagSet("check-config", "")
+	loader := config.NewLoader(fs)
+	loader.RegisterFlags()
+	var connect = fs.Bool("connect", false, "set to true to also connect to the database")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(loader)
+	if err != nil {
+		return err
+	}
+
+	if _, err := cfg.TLS.Config(); err != nil {
+		return err
+	}
+
+	if _, err := configureRecord(nil, cfg); err != nil {
+		return err
+	}
+
+	if *connect {
+		db, err := openDB(cfg.Database)
+		if err != nil {
+			return err
+		}
+
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		defer sqlDB.Close()
+
+		if err := sqlDB.Ping(); err != nil {
+			return err
+		}
+	}
+
+	log.Print("configuration is valid")
+	return nil
+}
+
+// dumpConfig prints the configuration as a YAML configuration file with its
+// secrets redacted, then reports whether it is valid
+func dumpConfig(args []string) error {
+	fs := newFlagSet("config", "")
+	loader := config.NewLoader(fs)
+	loader.RegisterFlags()
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := loader.Load()
+	if err != nil {
+		return err
+	}
+
+	if err := cfg.Dump(os.Stdout); err != nil {
+		return err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+
+	return nil
+}
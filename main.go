@@ -1,103 +1,127 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"log"
-	"net/http"
 	"os"
+	"strings"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 
+	"github.com/jvmistica/knowledge-base-go/pkg/config"
 	"github.com/jvmistica/knowledge-base-go/pkg/record"
+	"github.com/jvmistica/knowledge-base-go/pkg/tenant"
 )
 
 const apiVersion = "/api/v1"
 
-var (
-	db  *gorm.DB
-	err error
-)
-
-func init() {
-	host := os.Getenv("POSTGRES_HOST")
-	if host == "" {
-		log.Fatal("missing environment variable POSTGRES_HOST")
-	}
+// command is a subcommand of the server
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
 
-	port := os.Getenv("POSTGRES_PORT")
-	if port == "" {
-		log.Fatal("missing environment variable POSTGRES_PORT")
-	}
+// commands are the subcommands of the server, serve being the default
+var commands = []command{
+	{"serve", "Migrate the database and serve the API", serve},
+	{"migrate", "Create or update the tables of the database", migrate},
+	{"seed", "Add the sample notes, recipes and scripts to the database", seed},
+	{"backup", "Write all the tables to a JSON backup", backup},
+	{"restore", "Restore a JSON backup into the database", restore},
+	{"export", "Export the notes, recipes and scripts of a workspace", export},
+	{"import", "Import notes, recipes and scripts into a workspace", importRecords},
+	{"rotate-keys", "Rewrap all encrypted fields with the primary master key", rotateKeys},
+	{"check-config", "Check the configuration without starting the server", checkConfig},
+	{"config", "Print the configuration with its secrets redacted", dumpConfig},
+}
 
-	user := os.Getenv("POSTGRES_USER")
-	if user == "" {
-		log.Fatal("missing environment variable POSTGRES_USER")
+func main() {
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
 	}
 
-	password := os.Getenv("POSTGRES_PASS")
-	if password == "" {
-		log.Fatal("missing environment variable POSTGRES_PASS")
+	if name == "help" {
+		usage()
+		return
 	}
 
-	database := os.Getenv("POSTGRES_DB")
-	if database == "" {
-		log.Fatal("missing environment variable POSTGRES_DB")
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+
+		if err := cmd.run(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				os.Exit(2)
+			}
+			log.Fatal(err)
+		}
+		return
 	}
 
-	// Connect to the database
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s",
-		host, user, password, database, port)
-
-	db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
-	if err != nil {
-		log.Fatal(err)
-	}
+	usage()
+	os.Exit(2)
+}
 
-	// Migrate the tables
-	if err := db.AutoMigrate(&record.Note{}, &record.Recipe{}, &record.Script{}); err != nil {
-		log.Fatal(err)
+// usage prints the list of commands
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags]\n\nCommands:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-14s %s\n", cmd.name, cmd.summary)
 	}
+	fmt.Fprintf(os.Stderr, "\nRun '%s <command> -h' for the flags of a command.\n", os.Args[0])
 }
 
-func main() {
-	var seed = flag.Bool("seed", false, "set to true if you want to seed the database")
-	flag.Parse()
-
-	// Seed database
-	if *seed {
-		db.Create(&record.Notes)
-		db.Create(&record.Recipes)
-		db.Create(&record.Scripts)
+// newFlagSet returns the flag set of a command
+func newFlagSet(name, arguments string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s [flags] %s\n\nFlags:\n", os.Args[0], name, arguments)
+		fs.PrintDefaults()
 	}
 
-	handleRequests()
+	return fs
 }
 
-// handleRequests handles all the request to the APIs
-func handleRequests() {
-	r := record.NewRecord(db)
+// loadConfig loads the configuration of a command once its flags are
+// parsed, and validates it
+func loadConfig(loader *config.Loader) (*config.Config, error) {
+	cfg, err := loader.Load()
+	if err != nil {
+		return nil, err
+	}
 
-	http.HandleFunc(apiVersion+"/notes/list", r.ListNotes)
-	http.HandleFunc(apiVersion+"/recipes/list", r.ListRecipes)
-	http.HandleFunc(apiVersion+"/scripts/list", r.ListScripts)
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
 
-	http.HandleFunc(apiVersion+"/notes/new", r.CreateNote)
-	http.HandleFunc(apiVersion+"/recipes/new", r.CreateRecipe)
-	http.HandleFunc(apiVersion+"/scripts/new", r.CreateScript)
+	return cfg, nil
+}
 
-	http.HandleFunc(apiVersion+"/notes/delete", r.DeleteNote)
-	http.HandleFunc(apiVersion+"/recipes/delete", r.DeleteRecipe)
-	http.HandleFunc(apiVersion+"/scripts/delete", r.DeleteScript)
+// openDB connects to the database, isolating the records of each workspace
+func openDB(settings config.Database) (*gorm.DB, error) {
+	db, err := gorm.Open(postgres.Open(settings.ConnectionString()), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
 
-	http.HandleFunc(apiVersion+"/notes", r.GetNote)
-	http.HandleFunc(apiVersion+"/recipes", r.GetRecipe)
-	http.HandleFunc(apiVersion+"/scripts", r.GetScript)
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(settings.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(settings.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(settings.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(settings.ConnMaxIdleTime)
 
-	http.HandleFunc(apiVersion+"/notes/update", r.UpdateNote)
-	http.HandleFunc(apiVersion+"/recipes/update", r.UpdateRecipe)
-	http.HandleFunc(apiVersion+"/scripts/update", r.UpdateScript)
+	if err := tenant.Register(db, record.TenantTables...); err != nil {
+		return nil, err
+	}
 
-	log.Fatal(http.ListenAndServe(":10000", nil))
+	return db, nil
 }
@@ -0,0 +1,156 @@
+package analysis
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Severities of a finding
+const (
+	SeverityInfo    = "info"
+	SeverityWarning = "warning"
+	SeverityError   = "error"
+)
+
+// Categories of a finding
+const (
+	CategoryLanguage  = "language"
+	CategorySyntax    = "syntax"
+	CategorySecret    = "secret"
+	CategoryDangerous = "dangerous"
+)
+
+// Finding is a problem found in the body of a script
+type Finding struct {
+	Rule     string `json:"rule"`
+	Category string `json:"category"`
+	Severity string `json:"severity"`
+	Line     int    `json:"line,omitempty"`
+	Message  string `json:"message"`
+	Match    string `json:"match,omitempty"`
+}
+
+// Report is the outcome of analyzing a script
+type Report struct {
+	// Language is the language detected from the shebang or file extension,
+	// empty if it could not be detected
+	Language string    `json:"language"`
+	Findings []Finding `json:"findings"`
+}
+
+// Analyze detects the language of a script and checks its body for syntax
+// errors, hard-coded secrets and dangerous patterns. The name is used to
+// detect the language from its extension, and language is the declared
+// language, if any, which takes precedence over the detected one.
+func Analyze(name, language, body string) *Report {
+	report := &Report{
+		Language: DetectLanguage(name, body),
+		Findings: []Finding{},
+	}
+
+	lang := language
+	if lang == "" {
+		lang = report.Language
+	} else if report.Language != "" && !compatible(lang, report.Language) {
+		report.Findings = append(report.Findings, Finding{
+			Rule:     "language-mismatch",
+			Category: CategoryLanguage,
+			Severity: SeverityWarning,
+			Line:     1,
+			Message:  fmt.Sprintf("declared language %s does not match detected language %s", lang, report.Language),
+		})
+	}
+
+	if check, ok := syntaxCheckers[lang]; ok {
+		report.Findings = append(report.Findings, check(body)...)
+	}
+
+	report.Findings = append(report.Findings, scan(lang, body)...)
+
+	return report
+}
+
+// compatible reports whether a declared language can run a script detected as another
+func compatible(declared, detected string) bool {
+	if declared == detected {
+		return true
+	}
+
+	// A POSIX shell script is valid bash and zsh
+	return detected == "sh" && (declared == "bash" || declared == "zsh")
+}
+
+// interpreters map shebang interpreters to languages
+var interpreters = map[string]string{
+	"sh":      "sh",
+	"dash":    "sh",
+	"ash":     "sh",
+	"bash":    "bash",
+	"zsh":     "zsh",
+	"python":  "python",
+	"python2": "python",
+	"python3": "python",
+	"ruby":    "ruby",
+	"perl":    "perl",
+	"node":    "javascript",
+	"nodejs":  "javascript",
+	"pwsh":    "powershell",
+}
+
+// extensions map file extensions to languages
+var extensions = map[string]string{
+	".sh":   "bash",
+	".bash": "bash",
+	".zsh":  "zsh",
+	".py":   "python",
+	".rb":   "ruby",
+	".pl":   "perl",
+	".js":   "javascript",
+	".mjs":  "javascript",
+	".go":   "go",
+	".sql":  "sql",
+	".ps1":  "powershell",
+	".psm1": "powershell",
+}
+
+var versionSuffix = regexp.MustCompile(`[0-9.]+$`)
+
+// DetectLanguage detects the language of a script from the shebang of its
+// body or the extension of its name
+func DetectLanguage(name, body string) string {
+	if strings.HasPrefix(body, "#!") {
+		line, _, _ := strings.Cut(body[2:], "\n")
+		fields := strings.Fields(line)
+		if len(fields) > 0 {
+			interpreter := path.Base(fields[0])
+			if interpreter == "env" {
+				interpreter = ""
+				for _, f := range fields[1:] {
+					if !strings.HasPrefix(f, "-") {
+						interpreter = f
+						break
+					}
+				}
+			}
+
+			if lang, ok := interpreters[interpreter]; ok {
+				return lang
+			}
+			if lang, ok := interpreters[versionSuffix.ReplaceAllString(interpreter, "")]; ok {
+				return lang
+			}
+		}
+	}
+
+	if lang, ok := extensions[strings.ToLower(path.Ext(name))]; ok {
+		return lang
+	}
+
+	if strings.HasPrefix(strings.TrimSpace(body), "package ") {
+		return "go"
+	}
+
+	return ""
+}
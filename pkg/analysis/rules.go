@@ -0,0 +1,190 @@
+package analysis
+
+import (
+	"regexp"
+	"strings"
+)
+
+// rule is a pattern checked against every line of a script
+type rule struct {
+	id        string
+	category  string
+	severity  string
+	message   string
+	pattern   *regexp.Regexp
+	languages []string
+}
+
+// rules are the secret and dangerous pattern checks. Rules without languages
+// apply to every script.
+var rules = []rule{
+	{
+		id:       "aws-access-key-id",
+		category: CategorySecret,
+		severity: SeverityError,
+		message:  "hard-coded AWS access key ID",
+		pattern:  regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`),
+	},
+	{
+		id:       "aws-secret-access-key",
+		category: CategorySecret,
+		severity: SeverityError,
+		message:  "hard-coded AWS secret access key",
+		pattern:  regexp.MustCompile(`(?i)aws_?secret_?access_?key\s*[:=]\s*["']?[A-Za-z0-9/+=]{40}\b`),
+	},
+	{
+		id:       "private-key",
+		category: CategorySecret,
+		severity: SeverityError,
+		message:  "embedded private key",
+		pattern:  regexp.MustCompile(`-----BEGIN ((RSA|DSA|EC|OPENSSH|PGP) )?PRIVATE KEY( BLOCK)?-----`),
+	},
+	{
+		id:       "github-token",
+		category: CategorySecret,
+		severity: SeverityError,
+		message:  "hard-coded GitHub token",
+		pattern:  regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{36}|github_pat_[A-Za-z0-9_]{22,})\b`),
+	},
+	{
+		id:       "slack-token",
+		category: CategorySecret,
+		severity: SeverityError,
+		message:  "hard-coded Slack token",
+		pattern:  regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}\b`),
+	},
+	{
+		id:       "bearer-token",
+		category: CategorySecret,
+		severity: SeverityWarning,
+		message:  "hard-coded bearer token",
+		pattern:  regexp.MustCompile(`(?i)authorization:\s*bearer\s+[A-Za-z0-9._~+/-]{20,}=*`),
+	},
+	{
+		id:       "password-assignment",
+		category: CategorySecret,
+		severity: SeverityWarning,
+		message:  "hard-coded password, token or API key",
+		pattern:  regexp.MustCompile(`(?i)\b[a-z_]*(password|passwd|pwd|secret|token|api_?key)[a-z_]*\s*[:=]\s*["'][^"'\s${}]{6,}["']`),
+	},
+	{
+		id:       "url-credentials",
+		category: CategorySecret,
+		severity: SeverityWarning,
+		message:  "credentials embedded in URL",
+		pattern:  regexp.MustCompile(`[a-z][a-z0-9+.-]*://[^/\s:@$]+:[^/\s@${}]{3,}@`),
+	},
+	{
+		id:        "rm-rf-root",
+		category:  CategoryDangerous,
+		severity:  SeverityError,
+		message:   "recursive removal of the root or home directory",
+		pattern:   regexp.MustCompile(`\brm\s+(-[a-zA-Z]*[rR][a-zA-Z]*\s+|-[a-zA-Z]*f[a-zA-Z]*\s+|--[a-z-]+\s+)*(/|/\*|~|~/|\$HOME/?)(\s|;|$)`),
+		languages: []string{"sh", "bash", "zsh", ""},
+	},
+	{
+		id:        "pipe-to-shell",
+		category:  CategoryDangerous,
+		severity:  SeverityWarning,
+		message:   "downloaded content piped into a shell",
+		pattern:   regexp.MustCompile(`\b(curl|wget)\b[^|]*\|\s*(sudo\s+)?(ba|z|da)?sh\b`),
+		languages: []string{"sh", "bash", "zsh", ""},
+	},
+	{
+		id:        "fork-bomb",
+		category:  CategoryDangerous,
+		severity:  SeverityError,
+		message:   "fork bomb",
+		pattern:   regexp.MustCompile(`:\(\)\s*\{\s*:\s*\|\s*:\s*&\s*\}\s*;\s*:`),
+		languages: []string{"sh", "bash", "zsh", ""},
+	},
+	{
+		id:        "disk-overwrite",
+		category:  CategoryDangerous,
+		severity:  SeverityError,
+		message:   "raw write or format of a block device",
+		pattern:   regexp.MustCompile(`\b(dd\b.*\bof=/dev/(sd|hd|nvme|vd|xvd|disk)|mkfs(\.\w+)?\s+/dev/)`),
+		languages: []string{"sh", "bash", "zsh", ""},
+	},
+	{
+		id:        "world-writable",
+		category:  CategoryDangerous,
+		severity:  SeverityWarning,
+		message:   "world-writable permissions",
+		pattern:   regexp.MustCompile(`\bchmod\s+(-R\s+)?(0?777|a\+w|o\+w)\b`),
+		languages: []string{"sh", "bash", "zsh", ""},
+	},
+	{
+		id:        "sql-drop",
+		category:  CategoryDangerous,
+		severity:  SeverityWarning,
+		message:   "drops or truncates a database object",
+		pattern:   regexp.MustCompile(`(?i)\b(drop\s+(database|schema|table)|truncate\s+(table\s+)?\w+)`),
+		languages: []string{"sql"},
+	},
+	{
+		id:        "python-shell-injection",
+		category:  CategoryDangerous,
+		severity:  SeverityWarning,
+		message:   "command run through a shell",
+		pattern:   regexp.MustCompile(`\b(os\.system\(|subprocess\.\w+\(.*shell\s*=\s*True)`),
+		languages: []string{"python"},
+	},
+}
+
+// appliesTo reports whether the rule applies to scripts of the given language
+func (r rule) appliesTo(language string) bool {
+	if len(r.languages) == 0 {
+		return true
+	}
+
+	for _, lang := range r.languages {
+		if lang == language {
+			return true
+		}
+	}
+
+	return false
+}
+
+// scan checks every line of a script against the rules of its language
+func scan(language, body string) []Finding {
+	var findings []Finding
+	for i, line := range strings.Split(body, "\n") {
+		for _, r := range rules {
+			if !r.appliesTo(language) {
+				continue
+			}
+
+			match := r.pattern.FindString(line)
+			if match == "" {
+				continue
+			}
+
+			if r.category == CategorySecret {
+				match = redact(match)
+			}
+
+			findings = append(findings, Finding{
+				Rule:     r.id,
+				Category: r.category,
+				Severity: r.severity,
+				Line:     i + 1,
+				Message:  r.message,
+				Match:    match,
+			})
+		}
+	}
+
+	return findings
+}
+
+// redact hides all but the first characters of a secret
+func redact(s string) string {
+	const visible = 4
+	if len(s) <= visible {
+		return strings.Repeat("*", len(s))
+	}
+
+	return s[:visible] + strings.Repeat("*", min(len(s)-visible, 16))
+}
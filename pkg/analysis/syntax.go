@@ -0,0 +1,72 @@
+package analysis
+
+import (
+	"errors"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// syntaxCheckers are the Go-native parsers used to validate the syntax of a
+// script, by language
+var syntaxCheckers = map[string]func(body string) []Finding{
+	"sh":   shellChecker(syntax.LangPOSIX),
+	"bash": shellChecker(syntax.LangBash),
+	"go":   checkGo,
+}
+
+// syntaxError returns a finding for a syntax error
+func syntaxError(line int, message string) Finding {
+	return Finding{
+		Rule:     "syntax-error",
+		Category: CategorySyntax,
+		Severity: SeverityError,
+		Line:     line,
+		Message:  message,
+	}
+}
+
+// shellChecker returns a syntax checker for the given shell variant
+func shellChecker(variant syntax.LangVariant) func(string) []Finding {
+	return func(body string) []Finding {
+		parser := syntax.NewParser(syntax.Variant(variant))
+		_, err := parser.Parse(strings.NewReader(body), "")
+		if err == nil {
+			return nil
+		}
+
+		var parseErr syntax.ParseError
+		if errors.As(err, &parseErr) {
+			return []Finding{syntaxError(int(parseErr.Pos.Line()), parseErr.Text)}
+		}
+
+		var langErr syntax.LangError
+		if errors.As(err, &langErr) {
+			return []Finding{syntaxError(int(langErr.Pos.Line()), langErr.Error())}
+		}
+
+		return []Finding{syntaxError(0, err.Error())}
+	}
+}
+
+// checkGo validates the syntax of a Go source file
+func checkGo(body string) []Finding {
+	_, err := parser.ParseFile(token.NewFileSet(), "", body, parser.AllErrors)
+	if err == nil {
+		return nil
+	}
+
+	var list scanner.ErrorList
+	if errors.As(err, &list) {
+		findings := make([]Finding, 0, len(list))
+		for _, e := range list {
+			findings = append(findings, syntaxError(e.Pos.Line, e.Msg))
+		}
+		return findings
+	}
+
+	return []Finding{syntaxError(0, err.Error())}
+}
@@ -0,0 +1,22 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrNotFound is returned when a blob does not exist
+var ErrNotFound = errors.New("blob not found")
+
+// Store is a content store for attachment blobs, addressed by key
+type Store interface {
+	// Put stores the content of r under the given key
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get returns the content stored under the given key, or ErrNotFound
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Exists reports whether content is stored under the given key
+	Exists(ctx context.Context, key string) (bool, error)
+	// Delete deletes the content stored under the given key, if any
+	Delete(ctx context.Context, key string) error
+}
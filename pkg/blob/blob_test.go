@@ -0,0 +1,130 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeS3 is a local stand-in for an S3-compatible object store
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	types   map[string]string
+	auth    []string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.auth = append(f.auth, r.Header.Get("Authorization"))
+
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		f.objects[r.URL.Path] = body
+		f.types[r.URL.Path] = r.Header.Get("Content-Type")
+	case http.MethodGet, http.MethodHead:
+		body, ok := f.objects[r.URL.Path]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodGet {
+			w.Write(body)
+		}
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// testStore runs the behaviour every Store must have
+func testStore(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	ok, err := s.Exists(ctx, "ab/cdef")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	_, err = s.Get(ctx, "ab/cdef")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	assert.Nil(t, s.Put(ctx, "ab/cdef", strings.NewReader("hello"), 5, "text/plain"))
+
+	ok, err = s.Exists(ctx, "ab/cdef")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	rc, err := s.Get(ctx, "ab/cdef")
+	assert.Nil(t, err)
+	body, _ := io.ReadAll(rc)
+	rc.Close()
+	assert.Equal(t, "hello", string(body))
+
+	assert.Nil(t, s.Delete(ctx, "ab/cdef"))
+	assert.Nil(t, s.Delete(ctx, "ab/cdef"))
+
+	ok, err = s.Exists(ctx, "ab/cdef")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func TestFileStore(t *testing.T) {
+	s, err := NewFileStore(t.TempDir())
+	assert.Nil(t, err)
+
+	testStore(t, s)
+
+	t.Run("invalid key", func(t *testing.T) {
+		for _, key := range []string{"", "../escape", "/etc/passwd"} {
+			err := s.Put(context.Background(), key, strings.NewReader("x"), 1, "")
+			assert.NotNil(t, err, key)
+		}
+	})
+}
+
+func TestS3Store(t *testing.T) {
+	fake := &fakeS3{objects: map[string][]byte{}, types: map[string]string{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	s, err := NewS3Store(S3Config{
+		Endpoint:  srv.URL,
+		Bucket:    "attachments",
+		AccessKey: "AKIDEXAMPLE",
+		SecretKey: "secret",
+		Prefix:    "kb/",
+	})
+	assert.Nil(t, err)
+
+	testStore(t, s)
+
+	t.Run("path style keys", func(t *testing.T) {
+		assert.Nil(t, s.Put(context.Background(), "a b/c", strings.NewReader("x"), 1, "image/png"))
+		assert.Equal(t, "image/png", fake.types["/attachments/kb/a b/c"])
+	})
+
+	t.Run("signed requests", func(t *testing.T) {
+		for _, auth := range fake.auth {
+			assert.True(t, strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/"), auth)
+			assert.Contains(t, auth, "/us-east-1/s3/aws4_request")
+			assert.Contains(t, auth, "SignedHeaders=host;x-amz-content-sha256;x-amz-date")
+		}
+	})
+
+	t.Run("missing bucket", func(t *testing.T) {
+		_, err := NewS3Store(S3Config{Endpoint: srv.URL})
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,73 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+
+	"github.com/jvmistica/knowledge-base-go/pkg/record"
+)
+
+// ListAttachments lists the attachments of a record of the given type, such as record.TypeNote
+func (c *Client) ListAttachments(ctx context.Context, typ string, id uint) ([]record.Attachment, error) {
+	path, err := resource(typ)
+	if err != nil {
+		return nil, err
+	}
+
+	var attachments []record.Attachment
+	_, err = c.do(ctx, http.MethodGet, path+"/attachments", byID(id), nil, &attachments)
+	return attachments, err
+}
+
+// UploadAttachment attaches a file to a record of the given type. Uploading
+// a file already attached to the record returns the existing attachment.
+func (c *Client) UploadAttachment(ctx context.Context, typ string, id uint, filename string, file io.Reader) (*record.Attachment, error) {
+	path, err := resource(typ)
+	if err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", filename)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		return nil, err
+	}
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.send(ctx, http.MethodPost, path+"/attachments/new", byID(id), body.Bytes(), form.FormDataContentType())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var attachment record.Attachment
+	if err := decode(resp, &attachment); err != nil {
+		return nil, err
+	}
+
+	return &attachment, nil
+}
+
+// DownloadAttachment fetches the content of an attachment, to be closed by the caller
+func (c *Client) DownloadAttachment(ctx context.Context, id uint) (io.ReadCloser, error) {
+	resp, err := c.send(ctx, http.MethodGet, "/attachments", byID(id), nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+// DeleteAttachment deletes an attachment
+func (c *Client) DeleteAttachment(ctx context.Context, id uint) error {
+	return c.delete(ctx, "/attachments", id)
+}
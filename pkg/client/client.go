@@ -0,0 +1,259 @@
+// Package client is a typed Go client of the knowledge base API. Requests
+// take a context, idempotent requests failing with a transient error are
+// retried with an exponential backoff, and error responses are returned as
+// *Error values comparable with errors.Is to ErrNotFound and the other
+// sentinel errors.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiPrefix is the path the API is served under
+const apiPrefix = "/api/v1"
+
+// Client calls the knowledge base API
+type Client struct {
+	baseURL    string
+	token      string
+	workspace  string
+	httpClient *http.Client
+	retry      RetryPolicy
+}
+
+// RetryPolicy is how idempotent requests failing with a network error or a
+// 429, 502, 503 or 504 response are retried
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first attempt, 0 disables retries
+	MaxRetries int
+	// MinBackoff is the delay before the first retry, doubled for every next retry
+	MinBackoff time.Duration
+	// MaxBackoff caps the delay between two attempts
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy is the retry policy of new clients
+var DefaultRetryPolicy = RetryPolicy{MaxRetries: 3, MinBackoff: 200 * time.Millisecond, MaxBackoff: 5 * time.Second}
+
+// Option configures a client
+type Option func(*Client)
+
+// WithToken authenticates the requests with an access token or an API key
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithWorkspace sends the requests to the workspace with the given slug
+func WithWorkspace(slug string) Option {
+	return func(c *Client) {
+		c.workspace = slug
+	}
+}
+
+// WithHTTPClient sends the requests with the given HTTP client
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithRetryPolicy replaces the default retry policy
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = policy
+	}
+}
+
+// New returns a client of the API served at baseURL, such as http://localhost:10000
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		retry:      DefaultRetryPolicy,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// do sends a request with a JSON body, if any, and decodes the JSON
+// response into out, if not nil. It returns the headers of the response.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body any, out any) (http.Header, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := c.send(ctx, method, path, query, payload, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := decode(resp, out); err != nil {
+		return nil, err
+	}
+
+	return resp.Header, nil
+}
+
+// decode decodes the JSON body of a response into out, if not nil
+func decode(resp *http.Response, out any) error {
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// text sends a request with a JSON body, if any, and returns the text of the response
+func (c *Client) text(ctx context.Context, method, path string, query url.Values, body any) (string, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return "", err
+		}
+	}
+
+	resp, err := c.send(ctx, method, path, query, payload, "application/json")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	text, err := io.ReadAll(resp.Body)
+	return string(text), err
+}
+
+// send sends a request, retrying idempotent requests that fail with a
+// transient error. Error responses are returned as *Error.
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, body []byte, contentType string) (*http.Response, error) {
+	retries := 0
+	if idempotent(method) {
+		retries = c.retry.MaxRetries
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := c.newRequest(ctx, method, path, query, body, contentType)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if attempt < retries && ctx.Err() == nil && retryable(resp, err) {
+			delay := c.retry.backoff(attempt, resp)
+			if resp != nil {
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(delay):
+			}
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode >= http.StatusBadRequest {
+			defer resp.Body.Close()
+			return nil, errorFrom(resp)
+		}
+
+		return resp, nil
+	}
+}
+
+// newRequest builds an authenticated request of the API
+func (c *Client) newRequest(ctx context.Context, method, path string, query url.Values, body []byte, contentType string) (*http.Request, error) {
+	u := c.baseURL + apiPrefix + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.workspace != "" {
+		req.Header.Set("X-Workspace", c.workspace)
+	}
+
+	return req, nil
+}
+
+// idempotent reports whether a request with the given method can be sent twice
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	return false
+}
+
+// retryable reports whether an attempt failed with a transient error
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
+
+// backoff returns the delay before the retry following the given attempt,
+// honouring the Retry-After header of the response
+func (p RetryPolicy) backoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			return min(time.Duration(seconds)*time.Second, p.MaxBackoff)
+		}
+	}
+
+	delay := p.MinBackoff << attempt
+	if delay <= 0 || delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+
+	// Full jitter in the upper half spreads the retries of concurrent clients
+	return delay/2 + rand.N(delay/2+1)
+}
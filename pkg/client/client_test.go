@@ -0,0 +1,256 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jvmistica/knowledge-base-go/pkg/record"
+	mocket "github.com/selvatico/go-mocket"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// testToken is the session token the mocked sessions table accepts
+const testToken = "test-token"
+
+// testRetry retries without waiting in the tests
+var testRetry = RetryPolicy{MaxRetries: 3, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+var testNotes = []map[string]interface{}{
+	{"id": 1, "title": "Sample note #1", "content": "Sample content #1", "owner_id": 1, "visibility": "private"},
+	{"id": 2, "title": "Sample note #2", "content": "Sample content #2", "owner_id": 1, "visibility": "private"},
+	{"id": 3, "title": "Sample note #3", "content": "Sample content #3", "owner_id": 1, "visibility": "private"},
+}
+
+// newTestHandler routes the handlers of the API on a mocked database the
+// way the server does
+func newTestHandler(t *testing.T) http.Handler {
+	mocket.Catcher.Register()
+	db, err := gorm.Open(postgres.New(postgres.Config{
+		DriverName: mocket.DriverName,
+		DSN:        "user:test@tcp(127.0.0.1:3306)",
+	}), &gorm.Config{})
+	assert.Nil(t, err)
+
+	r := record.NewRecord(db)
+	api := http.NewServeMux()
+	for _, route := range r.Routes() {
+		api.HandleFunc(route.Pattern, route.Handler)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(apiPrefix+"/", r.Authenticate(r.Workspace(api)))
+	return mux
+}
+
+// newTestServer serves the handlers of the API on a mocked database
+func newTestServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(newTestHandler(t))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// mockAuth resets the mocked database to a valid session of user 1 in the default workspace
+func mockAuth() {
+	mocket.Catcher.Reset()
+	mocket.Catcher.NewMock().WithQuery(`SELECT * FROM "sessions"`).WithReply([]map[string]interface{}{
+		{"id": 1, "user_id": 1, "expires_at": time.Now().Add(time.Hour)},
+	})
+	mocket.Catcher.NewMock().WithQuery(`SELECT * FROM "users"`).WithReply([]map[string]interface{}{{"id": 1, "username": "tester"}})
+	mocket.Catcher.NewMock().WithQuery(`SELECT * FROM "workspaces"`).WithReply([]map[string]interface{}{{"id": 1, "slug": record.DefaultWorkspace}})
+}
+
+func TestNotes(t *testing.T) {
+	server := newTestServer(t)
+	c := New(server.URL, WithToken(testToken), WithRetryPolicy(testRetry))
+	ctx := context.Background()
+
+	t.Run("list", func(t *testing.T) {
+		mockAuth()
+		mocket.Catcher.NewMock().WithQuery(`SELECT * FROM "notes"`).WithReply(testNotes)
+
+		notes, err := c.ListNotes(ctx)
+		assert.Nil(t, err)
+		if assert.Len(t, notes, 3) {
+			assert.Equal(t, "Sample note #2", notes[1].Title)
+		}
+	})
+
+	t.Run("get", func(t *testing.T) {
+		mockAuth()
+		mocket.Catcher.NewMock().WithQuery(`SELECT * FROM "notes"`).WithReply(testNotes[:1])
+
+		note, err := c.GetNote(ctx, 1)
+		assert.Nil(t, err)
+		assert.Equal(t, "Sample content #1", note.Content)
+	})
+
+	t.Run("get not found", func(t *testing.T) {
+		mockAuth()
+
+		_, err := c.GetNote(ctx, 42)
+		assert.True(t, errors.Is(err, ErrNotFound), err)
+	})
+
+	t.Run("create", func(t *testing.T) {
+		mockAuth()
+
+		note, err := c.CreateNote(ctx, record.Note{Title: "Groceries", Content: "Milk"})
+		assert.Nil(t, err)
+		assert.Equal(t, "Groceries", note.Title)
+		assert.Equal(t, uint(1), note.OwnerID)
+	})
+
+	t.Run("create invalid", func(t *testing.T) {
+		mockAuth()
+
+		_, err := c.CreateNote(ctx, record.Note{Title: "Groceries", Ownership: record.Ownership{Visibility: "everyone"}})
+		var apiErr *Error
+		if assert.True(t, errors.As(err, &apiErr)) {
+			assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+			assert.NotEmpty(t, apiErr.Message)
+		}
+	})
+
+	t.Run("unauthorized", func(t *testing.T) {
+		mocket.Catcher.Reset()
+
+		_, err := New(server.URL).ListNotes(ctx)
+		assert.True(t, errors.Is(err, ErrUnauthorized), err)
+	})
+}
+
+func TestIterator(t *testing.T) {
+	server := newTestServer(t)
+	c := New(server.URL, WithToken(testToken), WithRetryPolicy(testRetry))
+
+	mockAuth()
+	mocket.Catcher.NewMock().WithQuery(`SELECT count(*) FROM "notes"`).WithReply([]map[string]interface{}{{"count": 3}})
+	mocket.Catcher.NewMock().WithQuery(`SELECT * FROM "notes"`).WithReply(testNotes[:2]).OneTime()
+	mocket.Catcher.NewMock().WithQuery(`SELECT * FROM "notes"`).WithReply(testNotes[2:]).OneTime()
+
+	var titles []string
+	it := c.Notes(context.Background(), 2)
+	for it.Next() {
+		titles = append(titles, it.Value().Title)
+	}
+
+	assert.Nil(t, it.Err())
+	assert.Equal(t, 3, it.Total())
+	assert.Equal(t, []string{"Sample note #1", "Sample note #2", "Sample note #3"}, titles)
+}
+
+func TestRenderScript(t *testing.T) {
+	server := newTestServer(t)
+	c := New(server.URL, WithToken(testToken), WithRetryPolicy(testRetry))
+
+	params, err := json.Marshal([]record.ScriptParameter{{Name: "host", Required: true}, {Name: "port", Type: record.ParamInt}})
+	assert.Nil(t, err)
+	scripts := []map[string]interface{}{
+		{"id": 7, "language": "bash", "body": "ssh {{ host }} -p {{ port }}", "parameters": string(params), "owner_id": 1},
+	}
+
+	t.Run("rendered", func(t *testing.T) {
+		mockAuth()
+		mocket.Catcher.NewMock().WithQuery(`SELECT * FROM "scripts"`).WithReply(scripts)
+
+		body, err := c.RenderScript(context.Background(), 7, map[string]any{"host": "example.com", "port": 2222})
+		assert.Nil(t, err)
+		assert.Equal(t, "ssh example.com -p 2222", body)
+	})
+
+	t.Run("invalid values", func(t *testing.T) {
+		mockAuth()
+		mocket.Catcher.NewMock().WithQuery(`SELECT * FROM "scripts"`).WithReply(scripts)
+
+		_, err := c.RenderScript(context.Background(), 7, map[string]any{"port": "ssh"})
+		assert.True(t, errors.Is(err, ErrBadRequest), err)
+
+		var apiErr *Error
+		if assert.True(t, errors.As(err, &apiErr)) {
+			assert.Contains(t, apiErr.Problems, "host")
+			assert.Contains(t, apiErr.Problems, "port")
+		}
+	})
+}
+
+func TestUpdateNote(t *testing.T) {
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		assert.Equal(t, apiPrefix+"/notes/update", r.URL.Path)
+		json.NewDecoder(r.Body).Decode(&body)
+	}))
+	t.Cleanup(server.Close)
+
+	c := New(server.URL, WithToken(testToken))
+	err := c.UpdateNote(context.Background(), 4, NoteUpdate{Title: Ptr("Groceries"), Encrypted: Ptr(false)})
+
+	// Only the given fields are sent, even when set to their zero value
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]any{"id": float64(4), "title": "Groceries", "encrypted": false}, body)
+}
+
+func TestRetry(t *testing.T) {
+	// The first two attempts of every request fail
+	var attempts atomic.Int32
+	handler := newTestHandler(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1)%3 != 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	t.Run("idempotent request retried", func(t *testing.T) {
+		mockAuth()
+		mocket.Catcher.NewMock().WithQuery(`SELECT * FROM "notes"`).WithReply(testNotes)
+		attempts.Store(0)
+		c := New(server.URL, WithToken(testToken), WithRetryPolicy(testRetry))
+
+		notes, err := c.ListNotes(context.Background())
+		assert.Nil(t, err)
+		assert.Len(t, notes, 3)
+		assert.Equal(t, int32(3), attempts.Load())
+	})
+
+	t.Run("retries exhausted", func(t *testing.T) {
+		attempts.Store(0)
+		c := New(server.URL, WithToken(testToken), WithRetryPolicy(RetryPolicy{MaxRetries: 1, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}))
+
+		_, err := c.ListNotes(context.Background())
+		var apiErr *Error
+		if assert.True(t, errors.As(err, &apiErr)) {
+			assert.Equal(t, http.StatusServiceUnavailable, apiErr.StatusCode)
+		}
+		assert.Equal(t, int32(2), attempts.Load())
+	})
+
+	t.Run("create not retried", func(t *testing.T) {
+		attempts.Store(0)
+		c := New(server.URL, WithToken(testToken), WithRetryPolicy(testRetry))
+
+		_, err := c.CreateNote(context.Background(), record.Note{Title: "Groceries", Content: "Milk"})
+		assert.NotNil(t, err)
+		assert.Equal(t, int32(1), attempts.Load())
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		attempts.Store(0)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		c := New(server.URL, WithToken(testToken), WithRetryPolicy(testRetry))
+
+		_, err := c.ListNotes(ctx)
+		assert.True(t, errors.Is(err, context.Canceled), err)
+	})
+}
@@ -0,0 +1,88 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// maxErrorSize is the number of bytes read of an error response
+const maxErrorSize = 64 << 10
+
+// Error is an error response of the API. The API answers with the message
+// as plain text, and with the problems per parameter when the values of the
+// parameters of a script are invalid.
+type Error struct {
+	StatusCode int
+	Message    string
+	Problems   map[string]string
+}
+
+// Sentinel errors matching the error responses with their status code
+var (
+	ErrBadRequest      = &Error{StatusCode: http.StatusBadRequest}
+	ErrUnauthorized    = &Error{StatusCode: http.StatusUnauthorized}
+	ErrForbidden       = &Error{StatusCode: http.StatusForbidden}
+	ErrNotFound        = &Error{StatusCode: http.StatusNotFound}
+	ErrConflict        = &Error{StatusCode: http.StatusConflict}
+	ErrTooLarge        = &Error{StatusCode: http.StatusRequestEntityTooLarge}
+	ErrUnsupportedType = &Error{StatusCode: http.StatusUnsupportedMediaType}
+	ErrUnprocessable   = &Error{StatusCode: http.StatusUnprocessableEntity}
+	ErrNotImplemented  = &Error{StatusCode: http.StatusNotImplemented}
+)
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	message := e.Message
+	if len(e.Problems) > 0 {
+		names := make([]string, 0, len(e.Problems))
+		for name := range e.Problems {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		problems := make([]string, len(names))
+		for i, name := range names {
+			problems[i] = fmt.Sprintf("%s: %s", name, e.Problems[name])
+		}
+		message = "invalid parameters: " + strings.Join(problems, "; ")
+	}
+
+	if message == "" {
+		return fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), message)
+}
+
+// Is reports whether the target is the sentinel error of the status code of the error
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Message == "" && t.Problems == nil && t.StatusCode == e.StatusCode
+}
+
+// errorFrom returns the error of an error response
+func errorFrom(resp *http.Response) error {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorSize))
+	if err != nil {
+		return err
+	}
+
+	e := &Error{StatusCode: resp.StatusCode}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType == "application/json" {
+		var paramErr struct {
+			Problems map[string]string `json:"errors"`
+		}
+		if json.Unmarshal(body, &paramErr) == nil && len(paramErr.Problems) > 0 {
+			e.Problems = paramErr.Problems
+			return e
+		}
+	}
+
+	e.Message = strings.TrimSpace(string(body))
+	return e
+}
@@ -0,0 +1,98 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Iterator iterates over a paginated list, fetching the pages as needed
+//
+//	it := c.Notes(ctx, 100)
+//	for it.Next() {
+//		fmt.Println(it.Value().Title)
+//	}
+//	if err := it.Err(); err != nil {
+//		return err
+//	}
+type Iterator[T any] struct {
+	fetch   func(page int) ([]T, int, error)
+	perPage int
+	page    int
+	items   []T
+	index   int
+	seen    int
+	total   int
+	done    bool
+	err     error
+}
+
+// paginate returns an iterator over the list served at path
+func paginate[T any](ctx context.Context, c *Client, path string, perPage int) *Iterator[T] {
+	fetch := func(page int) ([]T, int, error) {
+		query := url.Values{"page": {strconv.Itoa(page)}}
+		if perPage > 0 {
+			query.Set("per_page", strconv.Itoa(perPage))
+		}
+
+		var items []T
+		header, err := c.do(ctx, http.MethodGet, path, query, nil, &items)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		total, err := strconv.Atoi(header.Get("X-Total-Count"))
+		if err != nil {
+			total = -1
+		}
+
+		return items, total, nil
+	}
+
+	return &Iterator[T]{fetch: fetch, perPage: perPage, index: -1, total: -1}
+}
+
+// Next advances to the next item, fetching the next page when needed. It
+// returns false at the end of the list or on an error.
+func (it *Iterator[T]) Next() bool {
+	if it.err != nil {
+		return false
+	}
+
+	it.index++
+	for it.index >= len(it.items) {
+		if it.done {
+			return false
+		}
+
+		it.page++
+		items, total, err := it.fetch(it.page)
+		if err != nil {
+			it.err = err
+			return false
+		}
+
+		it.items, it.index, it.total = items, 0, total
+		it.seen += len(items)
+		// A short page or the total count ends the list
+		it.done = len(items) == 0 || (it.perPage > 0 && len(items) < it.perPage) || (total >= 0 && it.seen >= total)
+	}
+
+	return true
+}
+
+// Value returns the current item
+func (it *Iterator[T]) Value() T {
+	return it.items[it.index]
+}
+
+// Err returns the error that stopped the iteration, if any
+func (it *Iterator[T]) Err() error {
+	return it.err
+}
+
+// Total returns the number of items in the list, or -1 before the first page is fetched
+func (it *Iterator[T]) Total() int {
+	return it.total
+}
@@ -0,0 +1,295 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/jvmistica/knowledge-base-go/pkg/record"
+)
+
+// NoteUpdate are the fields of a note to change, nil fields are left unchanged
+type NoteUpdate struct {
+	Title      *string `json:"title,omitempty"`
+	Content    *string `json:"content,omitempty"`
+	Encrypted  *bool   `json:"encrypted,omitempty"`
+	Visibility *string `json:"visibility,omitempty"`
+}
+
+// RecipeUpdate are the fields of a recipe to change, nil fields are left unchanged
+type RecipeUpdate struct {
+	Name        *string `json:"name,omitempty"`
+	Description *string `json:"description,omitempty"`
+	Instruction *string `json:"instruction,omitempty"`
+	Category    *string `json:"category,omitempty"`
+	Ingredients *string `json:"ingredients,omitempty"`
+	Servings    *int    `json:"servings,omitempty"`
+	Visibility  *string `json:"visibility,omitempty"`
+}
+
+// ScriptUpdate are the fields of a script to change, nil fields are left unchanged
+type ScriptUpdate struct {
+	Name        *string                   `json:"name,omitempty"`
+	Description *string                   `json:"description,omitempty"`
+	Body        *string                   `json:"body,omitempty"`
+	Encrypted   *bool                     `json:"encrypted,omitempty"`
+	Language    *string                   `json:"language,omitempty"`
+	Version     *string                   `json:"version,omitempty"`
+	Parameters  *[]record.ScriptParameter `json:"parameters,omitempty"`
+	Visibility  *string                   `json:"visibility,omitempty"`
+}
+
+// Ptr returns a pointer to a value, for the fields of the updates
+func Ptr[T any](v T) *T {
+	return &v
+}
+
+// resources are the paths of the record types
+var resources = map[string]string{
+	record.TypeNote:   "/notes",
+	record.TypeRecipe: "/recipes",
+	record.TypeScript: "/scripts",
+}
+
+// byID returns the query selecting a record by its ID
+func byID(id uint) url.Values {
+	return url.Values{"id": {strconv.FormatUint(uint64(id), 10)}}
+}
+
+// resource returns the path of a record type
+func resource(typ string) (string, error) {
+	path, ok := resources[typ]
+	if !ok {
+		return "", fmt.Errorf("unknown record type: '%s'", typ)
+	}
+
+	return path, nil
+}
+
+// get fetches a record by its ID
+func get[T any](ctx context.Context, c *Client, path string, id uint) (*T, error) {
+	var v T
+	if _, err := c.do(ctx, http.MethodGet, path, byID(id), nil, &v); err != nil {
+		return nil, err
+	}
+
+	return &v, nil
+}
+
+// create creates a record and returns it as stored
+func create[T any](ctx context.Context, c *Client, path string, v T) (*T, error) {
+	var created T
+	if _, err := c.do(ctx, http.MethodPost, path+"/new", nil, v, &created); err != nil {
+		return nil, err
+	}
+
+	return &created, nil
+}
+
+// update sends the ID and the fields to change of a record
+func (c *Client) update(ctx context.Context, path string, body any, out any) error {
+	_, err := c.do(ctx, http.MethodPut, path+"/update", nil, body, out)
+	return err
+}
+
+// delete deletes a record by its ID
+func (c *Client) delete(ctx context.Context, path string, id uint) error {
+	_, err := c.do(ctx, http.MethodDelete, path+"/delete", byID(id), nil, nil)
+	return err
+}
+
+// ListNotes lists all the notes readable by the user
+func (c *Client) ListNotes(ctx context.Context) ([]record.Note, error) {
+	var notes []record.Note
+	_, err := c.do(ctx, http.MethodGet, "/notes/list", nil, nil, &notes)
+	return notes, err
+}
+
+// Notes iterates over the notes readable by the user, fetching perPage notes at a time
+func (c *Client) Notes(ctx context.Context, perPage int) *Iterator[record.Note] {
+	return paginate[record.Note](ctx, c, "/notes/list", perPage)
+}
+
+// GetNote fetches a note
+func (c *Client) GetNote(ctx context.Context, id uint) (*record.Note, error) {
+	return get[record.Note](ctx, c, "/notes", id)
+}
+
+// CreateNote creates a note and returns it as stored
+func (c *Client) CreateNote(ctx context.Context, note record.Note) (*record.Note, error) {
+	return create(ctx, c, "/notes", note)
+}
+
+// UpdateNote changes the given fields of a note
+func (c *Client) UpdateNote(ctx context.Context, id uint, update NoteUpdate) error {
+	return c.update(ctx, "/notes", struct {
+		ID uint `json:"id"`
+		NoteUpdate
+	}{id, update}, nil)
+}
+
+// DeleteNote deletes a note
+func (c *Client) DeleteNote(ctx context.Context, id uint) error {
+	return c.delete(ctx, "/notes", id)
+}
+
+// ListRecipes lists all the recipes readable by the user
+func (c *Client) ListRecipes(ctx context.Context) ([]record.Recipe, error) {
+	var recipes []record.Recipe
+	_, err := c.do(ctx, http.MethodGet, "/recipes/list", nil, nil, &recipes)
+	return recipes, err
+}
+
+// Recipes iterates over the recipes readable by the user, fetching perPage recipes at a time
+func (c *Client) Recipes(ctx context.Context, perPage int) *Iterator[record.Recipe] {
+	return paginate[record.Recipe](ctx, c, "/recipes/list", perPage)
+}
+
+// GetRecipe fetches a recipe
+func (c *Client) GetRecipe(ctx context.Context, id uint) (*record.Recipe, error) {
+	return get[record.Recipe](ctx, c, "/recipes", id)
+}
+
+// CreateRecipe creates a recipe and returns it as stored
+func (c *Client) CreateRecipe(ctx context.Context, recipe record.Recipe) (*record.Recipe, error) {
+	return create(ctx, c, "/recipes", recipe)
+}
+
+// UpdateRecipe changes the given fields of a recipe
+func (c *Client) UpdateRecipe(ctx context.Context, id uint, update RecipeUpdate) error {
+	return c.update(ctx, "/recipes", struct {
+		ID uint `json:"id"`
+		RecipeUpdate
+	}{id, update}, nil)
+}
+
+// DeleteRecipe deletes a recipe
+func (c *Client) DeleteRecipe(ctx context.Context, id uint) error {
+	return c.delete(ctx, "/recipes", id)
+}
+
+// ListScripts lists all the scripts readable by the user
+func (c *Client) ListScripts(ctx context.Context) ([]record.Script, error) {
+	var scripts []record.Script
+	_, err := c.do(ctx, http.MethodGet, "/scripts/list", nil, nil, &scripts)
+	return scripts, err
+}
+
+// Scripts iterates over the scripts readable by the user, fetching perPage scripts at a time
+func (c *Client) Scripts(ctx context.Context, perPage int) *Iterator[record.Script] {
+	return paginate[record.Script](ctx, c, "/scripts/list", perPage)
+}
+
+// GetScript fetches a script
+func (c *Client) GetScript(ctx context.Context, id uint) (*record.Script, error) {
+	return get[record.Script](ctx, c, "/scripts", id)
+}
+
+// CreateScript creates a script and returns it as stored, with the findings of its analysis
+func (c *Client) CreateScript(ctx context.Context, script record.Script) (*record.Script, error) {
+	return create(ctx, c, "/scripts", script)
+}
+
+// UpdateScript changes the given fields of a script and returns the
+// changed fields, with the findings of the analysis of a new body
+func (c *Client) UpdateScript(ctx context.Context, id uint, update ScriptUpdate) (*record.Script, error) {
+	var script record.Script
+	body := struct {
+		ID uint `json:"id"`
+		ScriptUpdate
+	}{id, update}
+	if err := c.update(ctx, "/scripts", body, &script); err != nil {
+		return nil, err
+	}
+
+	return &script, nil
+}
+
+// DeleteScript deletes a script, with its runs and secrets
+func (c *Client) DeleteScript(ctx context.Context, id uint) error {
+	return c.delete(ctx, "/scripts", id)
+}
+
+// ScriptBody fetches the raw body of a script
+func (c *Client) ScriptBody(ctx context.Context, id uint) (string, error) {
+	return c.text(ctx, http.MethodGet, fmt.Sprintf("/scripts/%d/raw", id), nil, nil)
+}
+
+// RenderScript renders the body of a script with the values of its
+// parameters. Invalid values fail with an *Error listing the problems.
+func (c *Client) RenderScript(ctx context.Context, id uint, values map[string]any) (string, error) {
+	return c.text(ctx, http.MethodPost, fmt.Sprintf("/scripts/%d/render", id), nil, record.RenderRequest{Values: values})
+}
+
+// RunScript starts a run of a script and returns its pending execution
+func (c *Client) RunScript(ctx context.Context, id uint, run record.RunRequest) (*record.Execution, error) {
+	var execution record.Execution
+	if _, err := c.do(ctx, http.MethodPost, fmt.Sprintf("/scripts/%d/run", id), nil, run, &execution); err != nil {
+		return nil, err
+	}
+
+	return &execution, nil
+}
+
+// ListScriptRuns lists the executions of a script, most recent first
+func (c *Client) ListScriptRuns(ctx context.Context, id uint) ([]record.Execution, error) {
+	var executions []record.Execution
+	_, err := c.do(ctx, http.MethodGet, fmt.Sprintf("/scripts/%d/runs", id), nil, nil, &executions)
+	return executions, err
+}
+
+// GetScriptRun fetches an execution of a script
+func (c *Client) GetScriptRun(ctx context.Context, id uint) (*record.Execution, error) {
+	return get[record.Execution](ctx, c, "/scripts/runs", id)
+}
+
+// Backlinks lists the links to a record of the given type, such as record.TypeNote
+func (c *Client) Backlinks(ctx context.Context, typ string, id uint) ([]record.Link, error) {
+	path, err := resource(typ)
+	if err != nil {
+		return nil, err
+	}
+
+	var links []record.Link
+	_, err = c.do(ctx, http.MethodGet, path+"/backlinks", byID(id), nil, &links)
+	return links, err
+}
+
+// ListSecrets lists the secrets of a script, or of the workspace when scriptID is 0
+func (c *Client) ListSecrets(ctx context.Context, scriptID uint) ([]record.Secret, error) {
+	var query url.Values
+	if scriptID != 0 {
+		query = url.Values{"script_id": {strconv.FormatUint(uint64(scriptID), 10)}}
+	}
+
+	var secrets []record.Secret
+	_, err := c.do(ctx, http.MethodGet, "/secrets/list", query, nil, &secrets)
+	return secrets, err
+}
+
+// CreateSecret stores a secret of a script, or of the workspace when its script ID is nil
+func (c *Client) CreateSecret(ctx context.Context, secret record.SecretInput) (*record.Secret, error) {
+	var created record.Secret
+	if _, err := c.do(ctx, http.MethodPost, "/secrets/new", nil, secret, &created); err != nil {
+		return nil, err
+	}
+
+	return &created, nil
+}
+
+// UpdateSecret replaces the value of a secret
+func (c *Client) UpdateSecret(ctx context.Context, id uint, value string) (*record.Secret, error) {
+	var secret record.Secret
+	if _, err := c.do(ctx, http.MethodPut, "/secrets/update", nil, record.SecretInput{ID: id, Value: value}, &secret); err != nil {
+		return nil, err
+	}
+
+	return &secret, nil
+}
+
+// DeleteSecret deletes a secret
+func (c *Client) DeleteSecret(ctx context.Context, id uint) error {
+	return c.delete(ctx, "/secrets", id)
+}
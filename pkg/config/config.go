@@ -0,0 +1,346 @@
+// Package config loads the configuration of the server from defaults, a
+// YAML file, environment variables and flags, each overriding the previous
+// ones.
+package config
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Config is the configuration of the server. Each setting is named by its
+// key in a configuration file, and may be set by an environment variable
+// (env tag) and a flag (flag tag). Secrets are redacted from dumps.
+type Config struct {
+	Server   Server   `yaml:"server"`
+	Database Database `yaml:"database"`
+	TLS      TLS      `yaml:"tls"`
+	Auth     Auth     `yaml:"auth"`
+	CORS     CORS     `yaml:"cors"`
+	Features Features `yaml:"features"`
+}
+
+// Server are the settings of the HTTP server
+type Server struct {
+	Listen     string `yaml:"listen" env:"KB_LISTEN" flag:"listen" help:"address to listen on"`
+	TrustProxy bool   `yaml:"trust_proxy" env:"KB_TRUST_PROXY" flag:"trust-proxy" help:"set to true to take client IPs from the X-Forwarded-For header of a reverse proxy"`
+	// Timeouts of the requests, 0 for no limit, and of the graceful shutdown
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"KB_READ_HEADER_TIMEOUT" help:"maximum duration to read the headers of a request"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"KB_READ_TIMEOUT" flag:"read-timeout" help:"maximum duration to read a request, including its body"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" env:"KB_WRITE_TIMEOUT" flag:"write-timeout" help:"maximum duration to write a response"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"KB_IDLE_TIMEOUT" help:"maximum duration a keep-alive connection waits for the next request"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout" env:"KB_SHUTDOWN_TIMEOUT" flag:"shutdown-timeout" help:"maximum duration to finish the requests in flight and the script runs on shutdown"`
+	ShutdownDelay     time.Duration `yaml:"shutdown_delay" env:"KB_SHUTDOWN_DELAY" flag:"shutdown-delay" help:"duration the readiness probe fails before the server stops accepting connections on shutdown"`
+}
+
+// Database are the settings of the connection to the database, either a
+// DSN or discrete settings. The DSN takes precedence when set.
+type Database struct {
+	DSN             string        `yaml:"dsn" env:"KB_DATABASE_DSN" secret:"true"`
+	Host            string        `yaml:"host" env:"POSTGRES_HOST"`
+	Port            int           `yaml:"port" env:"POSTGRES_PORT"`
+	User            string        `yaml:"user" env:"POSTGRES_USER"`
+	Password        string        `yaml:"password" env:"POSTGRES_PASS" secret:"true"`
+	Name            string        `yaml:"name" env:"POSTGRES_DB"`
+	SSLMode         string        `yaml:"sslmode" env:"POSTGRES_SSLMODE"`
+	ConnectTimeout  time.Duration `yaml:"connect_timeout" env:"KB_DATABASE_CONNECT_TIMEOUT"`
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"KB_DATABASE_MAX_OPEN_CONNS" flag:"db-max-open-conns" help:"maximum number of open connections to the database, 0 for no limit"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"KB_DATABASE_MAX_IDLE_CONNS" flag:"db-max-idle-conns" help:"maximum number of idle connections to the database"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"KB_DATABASE_CONN_MAX_LIFETIME" help:"maximum duration a connection is reused, 0 for no limit"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env:"KB_DATABASE_CONN_MAX_IDLE_TIME" help:"maximum duration a connection stays idle, 0 for no limit"`
+}
+
+// TLS are the certificate and key serving the API over HTTPS, disabled if unset
+type TLS struct {
+	CertFile   string `yaml:"cert_file" env:"KB_TLS_CERT_FILE" flag:"tls-cert" help:"path to a PEM certificate, enables HTTPS"`
+	KeyFile    string `yaml:"key_file" env:"KB_TLS_KEY_FILE" flag:"tls-key" help:"path to the PEM private key of the certificate"`
+	MinVersion string `yaml:"min_version" env:"KB_TLS_MIN_VERSION" help:"minimum TLS version: 1.2 or 1.3"`
+}
+
+// Auth are the settings of the sessions and the registration of users
+type Auth struct {
+	AccessTokenTTL    time.Duration `yaml:"access_token_ttl" env:"KB_ACCESS_TOKEN_TTL" help:"lifetime of access tokens"`
+	RefreshTokenTTL   time.Duration `yaml:"refresh_token_ttl" env:"KB_REFRESH_TOKEN_TTL" help:"lifetime of refresh tokens"`
+	AllowRegistration bool          `yaml:"allow_registration" env:"KB_ALLOW_REGISTRATION" flag:"allow-registration" help:"set to false to reject the registration of new users"`
+}
+
+// CORS are the origins allowed to call the API from a browser, disabled if none
+type CORS struct {
+	AllowedOrigins   []string      `yaml:"allowed_origins" env:"KB_CORS_ORIGINS" flag:"cors-origins" help:"comma-separated list of origins allowed to call the API from a browser, * for any"`
+	AllowedMethods   []string      `yaml:"allowed_methods" env:"KB_CORS_METHODS"`
+	AllowedHeaders   []string      `yaml:"allowed_headers" env:"KB_CORS_HEADERS"`
+	AllowCredentials bool          `yaml:"allow_credentials" env:"KB_CORS_CREDENTIALS"`
+	MaxAge           time.Duration `yaml:"max_age" env:"KB_CORS_MAX_AGE"`
+}
+
+// Features are the optional modules of the server
+type Features struct {
+	Nutrition   Nutrition   `yaml:"nutrition"`
+	Scripts     Scripts     `yaml:"scripts"`
+	Attachments Attachments `yaml:"attachments"`
+	Encryption  Encryption  `yaml:"encryption"`
+}
+
+// Nutrition enables the nutrition facts of recipes
+type Nutrition struct {
+	Enabled bool   `yaml:"enabled" env:"KB_NUTRITION" flag:"nutrition" help:"set to true to compute the nutrition facts of recipes"`
+	Foods   string `yaml:"foods" env:"KB_FOODS" flag:"foods" help:"path to a food composition CSV file, defaults to the bundled dataset"`
+}
+
+// Scripts enables running scripts in sandboxed subprocesses
+type Scripts struct {
+	Run       bool          `yaml:"run" env:"KB_RUN" flag:"run" help:"set to true to allow running scripts in sandboxed subprocesses"`
+	Languages []string      `yaml:"languages" env:"KB_RUN_LANGUAGES" flag:"run-languages" help:"comma-separated list of languages allowed to run"`
+	Timeout   time.Duration `yaml:"timeout" env:"KB_RUN_TIMEOUT" flag:"run-timeout" help:"maximum duration of a script run"`
+	Env       []string      `yaml:"env" env:"KB_RUN_ENV" flag:"run-env" help:"comma-separated list of environment variables passed to scripts"`
+	// Unprivileged user and group scripts run as, the user of the server if unset
+	UID int `yaml:"uid" env:"KB_RUN_UID" flag:"run-uid" help:"unprivileged user ID scripts run as, lets users other than administrators run scripts"`
+	GID int `yaml:"gid" env:"KB_RUN_GID" flag:"run-gid" help:"group ID scripts run as, required with the user ID"`
+}
+
+// Attachments enables attachments, stored in a directory or an S3 bucket
+type Attachments struct {
+	Dir           string   `yaml:"dir" env:"KB_ATTACHMENTS_DIR" flag:"attachments-dir" help:"directory to store attachments in, enables attachments"`
+	MaxUploadSize int64    `yaml:"max_upload_size" env:"KB_MAX_UPLOAD_SIZE" flag:"max-upload-size" help:"maximum size of an attachment in bytes"`
+	UploadTypes   []string `yaml:"upload_types" env:"KB_UPLOAD_TYPES" flag:"upload-types" help:"comma-separated list of content types accepted for attachments"`
+	S3            S3       `yaml:"s3"`
+}
+
+// S3 is an S3-compatible service storing attachments
+type S3 struct {
+	Endpoint  string `yaml:"endpoint" env:"S3_ENDPOINT" flag:"s3-endpoint" help:"URL of an S3-compatible service to store attachments in, enables attachments"`
+	Bucket    string `yaml:"bucket" env:"S3_BUCKET" flag:"s3-bucket" help:"bucket to store attachments in"`
+	Region    string `yaml:"region" env:"S3_REGION" flag:"s3-region" help:"region of the S3 bucket"`
+	AccessKey string `yaml:"access_key" env:"S3_ACCESS_KEY" secret:"true"`
+	SecretKey string `yaml:"secret_key" env:"S3_SECRET_KEY" secret:"true"`
+}
+
+// Encryption enables the encryption of notes and scripts with master keys,
+// read from a keyfile or given inline
+type Encryption struct {
+	Keyfile string `yaml:"keyfile" env:"KB_KEYFILE" flag:"keyfile" help:"path to a file of master keys, enables encryption of notes and scripts"`
+	Keys    string `yaml:"keys" env:"KB_MASTER_KEYS" secret:"true"`
+}
+
+// Default lifetimes of the tokens of a session
+const (
+	DefaultAccessTokenTTL  = time.Hour
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// DefaultMaxUploadSize is the maximum size of an attachment in bytes by default
+const DefaultMaxUploadSize = 10 << 20
+
+// DefaultUploadTypes are the content types accepted for attachments by default
+var DefaultUploadTypes = []string{
+	"image/jpeg", "image/png", "image/gif", "image/webp",
+	"application/pdf",
+	"text/plain", "text/markdown", "text/csv",
+	"application/json", "application/yaml", "application/toml", "application/xml", "text/xml",
+}
+
+// DefaultCORSMethods are the methods allowed to cross-origin requests by default
+var DefaultCORSMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// DefaultCORSHeaders are the request headers allowed to cross-origin
+// requests by default, including the workspace and request ID headers
+var DefaultCORSHeaders = []string{"Authorization", "Content-Type", "X-Workspace", "X-Request-ID"}
+
+// DefaultInterpreters are the commands used to run scripts of each language.
+// The script file is appended as the last argument.
+var DefaultInterpreters = map[string][]string{
+	"bash":       {"bash"},
+	"sh":         {"sh"},
+	"zsh":        {"zsh"},
+	"python":     {"python3"},
+	"ruby":       {"ruby"},
+	"perl":       {"perl"},
+	"javascript": {"node"},
+	"powershell": {"pwsh", "-NoProfile", "-NonInteractive", "-File"},
+}
+
+// DefaultEnv are the environment variables passed through to scripts by default
+var DefaultEnv = []string{"PATH", "LANG", "LC_ALL", "TZ"}
+
+// Default returns the default configuration
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Listen:            ":10000",
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       time.Minute,
+			WriteTimeout:      2 * time.Minute,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownTimeout:   30 * time.Second,
+		},
+		Database: Database{
+			Port:            5432,
+			ConnectTimeout:  10 * time.Second,
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+		},
+		TLS: TLS{MinVersion: "1.2"},
+		Auth: Auth{
+			AccessTokenTTL:    DefaultAccessTokenTTL,
+			RefreshTokenTTL:   DefaultRefreshTokenTTL,
+			AllowRegistration: true,
+		},
+		CORS: CORS{
+			AllowedMethods: DefaultCORSMethods,
+			AllowedHeaders: DefaultCORSHeaders,
+			MaxAge:         10 * time.Minute,
+		},
+		Features: Features{
+			Scripts: Scripts{
+				Languages: []string{"bash", "sh", "python"},
+				Timeout:   30 * time.Second,
+				Env:       DefaultEnv,
+			},
+			Attachments: Attachments{
+				MaxUploadSize: DefaultMaxUploadSize,
+				UploadTypes:   DefaultUploadTypes,
+				S3:            S3{Region: "us-east-1"},
+			},
+		},
+	}
+}
+
+// sslModes are the values of the sslmode setting of PostgreSQL
+var sslModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+// tlsVersions are the supported minimum TLS versions
+var tlsVersions = map[string]uint16{"1.2": tls.VersionTLS12, "1.3": tls.VersionTLS13}
+
+// Validate checks the settings, returning all the problems found
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	if _, _, err := net.SplitHostPort(c.Server.Listen); err != nil {
+		errs = append(errs, fmt.Errorf("server.listen: %w", err))
+	}
+	server := c.Server
+	check(server.ReadHeaderTimeout >= 0 && server.ReadTimeout >= 0 && server.WriteTimeout >= 0 && server.IdleTimeout >= 0, "server: timeouts must not be negative")
+	check(server.ShutdownTimeout > 0, "server.shutdown_timeout: must be positive")
+	check(server.ShutdownDelay >= 0, "server.shutdown_delay: must not be negative")
+
+	db := c.Database
+	if db.DSN == "" {
+		var missing []string
+		for _, setting := range []struct{ name, env, value string }{
+			{"database.host", "POSTGRES_HOST", db.Host},
+			{"database.user", "POSTGRES_USER", db.User},
+			{"database.name", "POSTGRES_DB", db.Name},
+		} {
+			if setting.value == "" {
+				missing = append(missing, fmt.Sprintf("%s (%s)", setting.name, setting.env))
+			}
+		}
+		check(len(missing) == 0, "missing database settings %s, or database.dsn", strings.Join(missing, ", "))
+		check(db.Port > 0 && db.Port < 65536, "database.port: must be between 1 and 65535")
+		check(db.SSLMode == "" || slices.Contains(sslModes, db.SSLMode), "database.sslmode: must be one of %s", strings.Join(sslModes, ", "))
+	}
+	check(db.MaxOpenConns >= 0 && db.MaxIdleConns >= 0, "database: pool sizes must not be negative")
+	check(db.MaxOpenConns == 0 || db.MaxIdleConns <= db.MaxOpenConns, "database.max_idle_conns: must not exceed database.max_open_conns")
+	check(db.ConnectTimeout >= 0 && db.ConnMaxLifetime >= 0 && db.ConnMaxIdleTime >= 0, "database: timeouts must not be negative")
+
+	check((c.TLS.CertFile == "") == (c.TLS.KeyFile == ""), "tls: cert_file and key_file must be set together")
+	_, ok := tlsVersions[c.TLS.MinVersion]
+	check(ok, "tls.min_version: must be 1.2 or 1.3")
+
+	check(c.Auth.AccessTokenTTL > 0, "auth.access_token_ttl: must be positive")
+	check(c.Auth.RefreshTokenTTL >= c.Auth.AccessTokenTTL, "auth.refresh_token_ttl: must not be shorter than auth.access_token_ttl")
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		check(origin == "*" || validOrigin(origin), "cors.allowed_origins: invalid origin '%s', must be a scheme and host such as https://app.example.com", origin)
+	}
+	check(!c.CORS.AllowCredentials || !slices.Contains(c.CORS.AllowedOrigins, "*"), "cors.allow_credentials: cannot be set for any origin")
+	check(c.CORS.MaxAge >= 0, "cors.max_age: must not be negative")
+
+	scripts := c.Features.Scripts
+	if scripts.Run {
+		check(len(scripts.Languages) > 0, "features.scripts.languages: must not be empty")
+		for _, lang := range scripts.Languages {
+			_, ok := DefaultInterpreters[lang]
+			check(ok, "features.scripts.languages: unknown language '%s'", lang)
+		}
+		check(scripts.Timeout > 0, "features.scripts.timeout: must be positive")
+		check(scripts.UID >= 0 && scripts.GID >= 0, "features.scripts: uid and gid must not be negative")
+		check((scripts.UID == 0) == (scripts.GID == 0), "features.scripts: uid and gid must be set together")
+	}
+
+	attachments := c.Features.Attachments
+	check(attachments.Dir == "" || attachments.S3.Endpoint == "", "features.attachments: set either dir or s3.endpoint")
+	check(attachments.S3.Endpoint == "" || attachments.S3.Bucket != "", "features.attachments.s3.bucket: required with s3.endpoint")
+	check(attachments.MaxUploadSize > 0, "features.attachments.max_upload_size: must be positive")
+
+	check(c.Features.Encryption.Keyfile == "" || c.Features.Encryption.Keys == "", "features.encryption: set either keyfile or keys")
+
+	return errors.Join(errs...)
+}
+
+// validOrigin returns whether an origin is a scheme and a host, without a path
+func validOrigin(origin string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" &&
+		u.Path == "" && u.RawQuery == "" && u.User == nil
+}
+
+// ConnectionString returns the connection string of the database
+func (d Database) ConnectionString() string {
+	if d.DSN != "" {
+		return d.DSN
+	}
+
+	settings := []string{
+		"host=" + quoteDSN(d.Host),
+		fmt.Sprintf("port=%d", d.Port),
+		"user=" + quoteDSN(d.User),
+		"password=" + quoteDSN(d.Password),
+		"dbname=" + quoteDSN(d.Name),
+	}
+	if d.SSLMode != "" {
+		settings = append(settings, "sslmode="+d.SSLMode)
+	}
+	if d.ConnectTimeout > 0 {
+		settings = append(settings, fmt.Sprintf("connect_timeout=%d", int(d.ConnectTimeout.Seconds())))
+	}
+
+	return strings.Join(settings, " ")
+}
+
+// quoteDSN quotes a value of a connection string if needed
+func quoteDSN(value string) string {
+	if value != "" && !strings.ContainsAny(value, ` '\`) {
+		return value
+	}
+
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+// Config returns the TLS configuration of the server, nil if HTTPS is disabled
+func (t TLS) Config() (*tls.Config, error) {
+	if t.CertFile == "" {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("tls: %w", err)
+	}
+
+	return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tlsVersions[t.MinVersion]}, nil
+}
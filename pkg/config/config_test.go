@@ -0,0 +1,231 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// validConfig returns the default configuration with the database settings
+func validConfig() *Config {
+	c := Default()
+	c.Database.Host, c.Database.User, c.Database.Password, c.Database.Name = "localhost", "kb", "secret", "kb"
+	return c
+}
+
+// writeFile writes a file in a temporary directory and returns its path
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	assert.Nil(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoader(t *testing.T) {
+	yamlFile := writeFile(t, "kb.yaml", `
+server:
+  listen: ":8080"
+database:
+  host: db.internal
+  max_open_conns: 50
+features:
+  scripts:
+    run: true
+    languages: [bash]
+    timeout: 10s
+`)
+
+	load := func(env map[string]string, args ...string) (*Config, error) {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		l := NewLoader(fs)
+		l.RegisterFlags()
+		l.lookupEnv = func(name string) (string, bool) {
+			value, ok := env[name]
+			return value, ok
+		}
+
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		return l.Load()
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		c, err := load(nil)
+		assert.Nil(t, err)
+		assert.Equal(t, Default(), c)
+	})
+
+	t.Run("file", func(t *testing.T) {
+		c, err := load(nil, "-config", yamlFile)
+		assert.Nil(t, err)
+		assert.Equal(t, ":8080", c.Server.Listen)
+		assert.Equal(t, "db.internal", c.Database.Host)
+		assert.Equal(t, 50, c.Database.MaxOpenConns)
+		assert.Equal(t, 5432, c.Database.Port)
+		assert.True(t, c.Features.Scripts.Run)
+		assert.Equal(t, []string{"bash"}, c.Features.Scripts.Languages)
+		assert.Equal(t, 10*time.Second, c.Features.Scripts.Timeout)
+	})
+
+	t.Run("file from the environment", func(t *testing.T) {
+		c, err := load(map[string]string{FileEnv: yamlFile})
+		assert.Nil(t, err)
+		assert.Equal(t, ":8080", c.Server.Listen)
+	})
+
+	t.Run("environment overrides the file", func(t *testing.T) {
+		c, err := load(map[string]string{"POSTGRES_HOST": "db.env", "POSTGRES_PORT": "6432", "KB_RUN_LANGUAGES": "python, sh", "KB_LISTEN": ""}, "-config", yamlFile)
+		assert.Nil(t, err)
+		assert.Equal(t, "db.env", c.Database.Host)
+		assert.Equal(t, 6432, c.Database.Port)
+		assert.Equal(t, []string{"python", "sh"}, c.Features.Scripts.Languages)
+		assert.Equal(t, ":8080", c.Server.Listen)
+	})
+
+	t.Run("flags override the environment", func(t *testing.T) {
+		c, err := load(map[string]string{"KB_LISTEN": ":9090", "KB_RUN": "true"}, "-config", yamlFile, "-listen", ":7070", "-run=false", "-run-timeout", "1m")
+		assert.Nil(t, err)
+		assert.Equal(t, ":7070", c.Server.Listen)
+		assert.False(t, c.Features.Scripts.Run)
+		assert.Equal(t, time.Minute, c.Features.Scripts.Timeout)
+	})
+
+	t.Run("invalid environment variable", func(t *testing.T) {
+		_, err := load(map[string]string{"POSTGRES_PORT": "five"})
+		assert.ErrorContains(t, err, "POSTGRES_PORT")
+	})
+
+	t.Run("invalid flag", func(t *testing.T) {
+		_, err := load(nil, "-run-timeout", "soon")
+		assert.ErrorContains(t, err, "-run-timeout")
+	})
+
+	t.Run("only some flags", func(t *testing.T) {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		NewLoader(fs).RegisterFlags("keyfile")
+		assert.NotNil(t, fs.Lookup("config"))
+		assert.NotNil(t, fs.Lookup("keyfile"))
+		assert.Nil(t, fs.Lookup("listen"))
+	})
+}
+
+func TestLoadFile(t *testing.T) {
+	t.Run("yaml", func(t *testing.T) {
+		c := Default()
+		err := c.LoadFile(writeFile(t, "kb.yml", `
+database:
+  dsn: postgres://kb@db/kb
+cors:
+  allowed_origins: [https://app.example.com]
+  allow_credentials: true
+`))
+		assert.Nil(t, err)
+		assert.Equal(t, "postgres://kb@db/kb", c.Database.DSN)
+		assert.Equal(t, []string{"https://app.example.com"}, c.CORS.AllowedOrigins)
+		assert.True(t, c.CORS.AllowCredentials)
+	})
+
+	for name, content := range map[string]string{
+		"unknown setting": "database:\n  hots: db\n",
+		"wrong type":      "database:\n  port: five\n",
+		"bad duration":    "auth:\n  access_token_ttl: 15\n",
+		"bad list":        "cors:\n  allowed_origins: [1, 2]\n",
+		"invalid yaml":    "server: [\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.NotNil(t, Default().LoadFile(writeFile(t, "kb.yaml", content)))
+		})
+	}
+
+	t.Run("unsupported format", func(t *testing.T) {
+		assert.ErrorContains(t, Default().LoadFile(writeFile(t, "kb.toml", "")), "unsupported")
+	})
+}
+
+func TestValidate(t *testing.T) {
+	assert.Nil(t, validConfig().Validate())
+
+	dsn := Default()
+	dsn.Database.DSN = "postgres://kb@db/kb"
+	assert.Nil(t, dsn.Validate())
+
+	for name, change := range map[string]func(c *Config){
+		"listen address":       func(c *Config) { c.Server.Listen = "10000" },
+		"write timeout":        func(c *Config) { c.Server.WriteTimeout = -time.Second },
+		"shutdown timeout":     func(c *Config) { c.Server.ShutdownTimeout = 0 },
+		"missing database":     func(c *Config) { c.Database.Host = "" },
+		"database port":        func(c *Config) { c.Database.Port = 0 },
+		"sslmode":              func(c *Config) { c.Database.SSLMode = "always" },
+		"idle connections":     func(c *Config) { c.Database.MaxIdleConns = 100 },
+		"tls key":              func(c *Config) { c.TLS.CertFile = "cert.pem" },
+		"tls version":          func(c *Config) { c.TLS.MinVersion = "1.0" },
+		"token lifetimes":      func(c *Config) { c.Auth.RefreshTokenTTL = time.Minute },
+		"cors origin":          func(c *Config) { c.CORS.AllowedOrigins = []string{"app.example.com"} },
+		"cors any credentials": func(c *Config) { c.CORS.AllowedOrigins, c.CORS.AllowCredentials = []string{"*"}, true },
+		"script language": func(c *Config) {
+			c.Features.Scripts.Run, c.Features.Scripts.Languages = true, []string{"cobol"}
+		},
+		"script user without group": func(c *Config) {
+			c.Features.Scripts.Run, c.Features.Scripts.UID = true, 65534
+		},
+		"attachment stores": func(c *Config) {
+			c.Features.Attachments.Dir, c.Features.Attachments.S3.Endpoint = "/tmp", "http://s3"
+		},
+		"encryption keys": func(c *Config) {
+			c.Features.Encryption.Keyfile, c.Features.Encryption.Keys = "keys", "1:abc"
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := validConfig()
+			change(c)
+			assert.NotNil(t, c.Validate())
+		})
+	}
+
+	t.Run("all problems", func(t *testing.T) {
+		c := Default()
+		c.Server.Listen, c.TLS.MinVersion = "", "1.1"
+		err := c.Validate()
+		assert.ErrorContains(t, err, "server.listen")
+		assert.ErrorContains(t, err, "POSTGRES_HOST")
+		assert.ErrorContains(t, err, "tls.min_version")
+	})
+}
+
+func TestConnectionString(t *testing.T) {
+	c := validConfig()
+	c.Database.Password = "it's secret"
+	assert.Equal(t, `host=localhost port=5432 user=kb password='it\'s secret' dbname=kb connect_timeout=10`, c.Database.ConnectionString())
+
+	c.Database.DSN = "postgres://kb@db/kb"
+	assert.Equal(t, "postgres://kb@db/kb", c.Database.ConnectionString())
+}
+
+func TestDump(t *testing.T) {
+	c := validConfig()
+	c.Features.Attachments.S3.SecretKey = "hunter2"
+	var buf bytes.Buffer
+	assert.Nil(t, c.Dump(&buf))
+
+	out := buf.String()
+	assert.Contains(t, out, "listen: :10000 # env KB_LISTEN, flag -listen")
+	assert.Contains(t, out, "password: REDACTED")
+	assert.Contains(t, out, "access_token_ttl: 1h")
+	assert.Contains(t, out, "secret_key: REDACTED")
+	assert.Contains(t, out, `access_key: ""`)
+	assert.NotContains(t, out, "hunter2")
+
+	// A dump is a valid configuration file
+	loaded := Default()
+	assert.Nil(t, loaded.LoadFile(writeFile(t, "dump.yaml", out)))
+	assert.Equal(t, c.Server, loaded.Server)
+	assert.Equal(t, c.Auth, loaded.Auth)
+	assert.Equal(t, c.Features.Scripts, loaded.Features.Scripts)
+}
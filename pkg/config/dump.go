@@ -0,0 +1,95 @@
+package config
+
+import (
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces the secrets of a dump
+const redacted = "REDACTED"
+
+// formatDuration formats a duration without its trailing zero units, such as 1h for 1h0m0s
+func formatDuration(d time.Duration) string {
+	text := d.String()
+	if strings.HasSuffix(text, "m0s") {
+		text = strings.TrimSuffix(text, "0s")
+	}
+	if strings.HasSuffix(text, "h0m") {
+		text = strings.TrimSuffix(text, "0m")
+	}
+
+	return text
+}
+
+// Dump writes a configuration as a YAML configuration file, with the
+// secrets redacted and the environment variable and flag of each setting
+// in a comment
+func (c *Config) Dump(w io.Writer) error {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	tables := map[string]*yaml.Node{"": root}
+
+	for _, s := range settings(c) {
+		// Add the tables of the setting
+		table, parts := root, strings.Split(s.path, ".")
+		for i, part := range parts[:len(parts)-1] {
+			path := strings.Join(parts[:i+1], ".")
+			next, ok := tables[path]
+			if !ok {
+				next = &yaml.Node{Kind: yaml.MappingNode}
+				tables[path] = next
+				table.Content = append(table.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: part}, next)
+			}
+			table = next
+		}
+
+		value := dumpValue(s)
+		key := &yaml.Node{Kind: yaml.ScalarNode, Value: parts[len(parts)-1]}
+		table.Content = append(table.Content, key, value)
+
+		var sources []string
+		if env := s.field.Tag.Get("env"); env != "" {
+			sources = append(sources, "env "+env)
+		}
+		if flag := s.field.Tag.Get("flag"); flag != "" {
+			sources = append(sources, "flag -"+flag)
+		}
+		value.LineComment = strings.Join(sources, ", ")
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(root); err != nil {
+		return err
+	}
+
+	return enc.Close()
+}
+
+// dumpValue returns the YAML node of the value of a setting, redacted if it
+// is a secret that is set
+func dumpValue(s setting) *yaml.Node {
+	v := s.value
+	switch {
+	case s.field.Tag.Get("secret") == "true" && !v.IsZero():
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: redacted}
+	case v.Type() == durationType:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: formatDuration(time.Duration(v.Int()))}
+	case v.Kind() == reflect.Slice:
+		list := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+		for _, item := range v.Interface().([]string) {
+			list.Content = append(list.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: item})
+		}
+		return list
+	case v.Kind() == reflect.Bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(v.Bool())}
+	case v.Kind() == reflect.Int || v.Kind() == reflect.Int64:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.FormatInt(v.Int(), 10)}
+	}
+
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v.String()}
+}
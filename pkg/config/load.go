@@ -0,0 +1,329 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileEnv is the environment variable of the path of the configuration
+// file, when the -config flag is not set
+const FileEnv = "KB_SERVER_CONFIG"
+
+// setting is a leaf of the configuration
+type setting struct {
+	path  string
+	value reflect.Value
+	field reflect.StructField
+}
+
+// settings returns the leaves of a configuration, in the order of their fields
+func settings(c *Config) []setting {
+	var leaves []setting
+	var walk func(v reflect.Value, prefix string)
+	walk = func(v reflect.Value, prefix string) {
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			path := prefix + field.Tag.Get("yaml")
+			if field.Type.Kind() == reflect.Struct {
+				walk(v.Field(i), path+".")
+				continue
+			}
+			leaves = append(leaves, setting{path: path, value: v.Field(i), field: field})
+		}
+	}
+	walk(reflect.ValueOf(c).Elem(), "")
+
+	return leaves
+}
+
+// find returns a leaf of a configuration by its path
+func find(c *Config, path string) (setting, bool) {
+	leaves := settings(c)
+	i := slices.IndexFunc(leaves, func(s setting) bool { return s.path == path })
+	if i < 0 {
+		return setting{}, false
+	}
+
+	return leaves[i], true
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// parse sets a setting from the text of an environment variable or a flag,
+// lists being comma-separated
+func (s setting) parse(text string) error {
+	v := s.value
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(text)
+		if err != nil {
+			return fmt.Errorf("invalid duration '%s', such as 30s or 5m", text)
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(text)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return fmt.Errorf("invalid boolean '%s'", text)
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Int || v.Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(text, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid integer '%s'", text)
+		}
+		v.SetInt(n)
+	case v.Kind() == reflect.Slice:
+		v.Set(reflect.ValueOf(splitList(text)))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	return nil
+}
+
+// set sets a setting from a value decoded from a configuration file
+func (s setting) set(value any) error {
+	v := s.value
+	switch {
+	case v.Type() == durationType:
+		text, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("must be a duration such as 30s or 5m")
+		}
+		return s.parse(text)
+	case v.Kind() == reflect.String:
+		text, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("must be a string")
+		}
+		v.SetString(text)
+	case v.Kind() == reflect.Bool:
+		b, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("must be a boolean")
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Int || v.Kind() == reflect.Int64:
+		var n int64
+		switch number := value.(type) {
+		case int:
+			n = int64(number)
+		case int64:
+			n = number
+		case uint64:
+			n = int64(number)
+		default:
+			return fmt.Errorf("must be an integer")
+		}
+		if v.OverflowInt(n) {
+			return fmt.Errorf("integer out of range")
+		}
+		v.SetInt(n)
+	case v.Kind() == reflect.Slice:
+		if text, ok := value.(string); ok {
+			return s.parse(text)
+		}
+		items, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("must be a list of strings")
+		}
+		list := make([]string, len(items))
+		for i, item := range items {
+			if list[i], ok = item.(string); !ok {
+				return fmt.Errorf("must be a list of strings")
+			}
+		}
+		v.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	return nil
+}
+
+// splitList splits a comma-separated list, dropping empty items
+func splitList(text string) []string {
+	list := []string{}
+	for _, item := range strings.Split(text, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
+
+// LoadFile applies the settings of a YAML file to a configuration
+func (c *Config) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if ext := filepath.Ext(path); ext != ".yaml" && ext != ".yml" {
+		return fmt.Errorf("unsupported configuration file '%s', must be .yaml or .yml", path)
+	}
+
+	values := map[string]any{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	if err := c.apply(values, ""); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	return nil
+}
+
+// apply sets the settings of a table of a configuration file
+func (c *Config) apply(values map[string]any, prefix string) error {
+	for key, value := range values {
+		path := prefix + key
+		if table, ok := value.(map[string]any); ok {
+			if err := c.apply(table, path+"."); err != nil {
+				return err
+			}
+			continue
+		}
+
+		s, ok := find(c, path)
+		if !ok {
+			return fmt.Errorf("unknown setting '%s'", path)
+		}
+		if err := s.set(value); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+// LoadEnv applies the settings of the environment variables to a
+// configuration, ignoring those that are empty
+func (c *Config) LoadEnv(lookup func(string) (string, bool)) error {
+	for _, s := range settings(c) {
+		name := s.field.Tag.Get("env")
+		if name == "" {
+			continue
+		}
+
+		if text, ok := lookup(name); ok && text != "" {
+			if err := s.parse(text); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// listValue is the flag of a list setting
+type listValue []string
+
+// String implements flag.Value
+func (l *listValue) String() string {
+	if l == nil {
+		return ""
+	}
+
+	return strings.Join(*l, ",")
+}
+
+// Set implements flag.Value
+func (l *listValue) Set(text string) error {
+	*l = splitList(text)
+	return nil
+}
+
+// Loader loads the configuration of a command from its flags
+type Loader struct {
+	fs   *flag.FlagSet
+	file *string
+	// flags holds the values of the flags, applied over the file and
+	// environment when they are set
+	flags *Config
+	// lookupEnv reads the environment variables, os.LookupEnv by default
+	lookupEnv func(string) (string, bool)
+}
+
+// NewLoader adds the -config flag of the configuration file to a flag set
+func NewLoader(fs *flag.FlagSet) *Loader {
+	return &Loader{
+		fs:        fs,
+		file:      fs.String("config", "", "path to a YAML configuration file, defaults to the "+FileEnv+" environment variable"),
+		flags:     Default(),
+		lookupEnv: os.LookupEnv,
+	}
+}
+
+// RegisterFlags adds the flags of the settings to the flag set, or only
+// those named
+func (l *Loader) RegisterFlags(names ...string) {
+	for _, s := range settings(l.flags) {
+		name := s.field.Tag.Get("flag")
+		if name == "" || (len(names) > 0 && !slices.Contains(names, name)) {
+			continue
+		}
+
+		help := s.field.Tag.Get("help")
+		switch p := s.value.Addr().Interface().(type) {
+		case *string:
+			l.fs.StringVar(p, name, *p, help)
+		case *bool:
+			l.fs.BoolVar(p, name, *p, help)
+		case *int:
+			l.fs.IntVar(p, name, *p, help)
+		case *int64:
+			l.fs.Int64Var(p, name, *p, help)
+		case *time.Duration:
+			l.fs.DurationVar(p, name, *p, help)
+		case *[]string:
+			l.fs.Var((*listValue)(p), name, strings.Replace(help, "list", "`list`", 1))
+		}
+	}
+}
+
+// Load returns the configuration from the defaults, overridden by the
+// configuration file, the environment variables, then the flags set. The
+// flag set must be parsed, and the configuration is not validated.
+func (l *Loader) Load() (*Config, error) {
+	c := Default()
+
+	path := *l.file
+	if path == "" {
+		path, _ = l.lookupEnv(FileEnv)
+	}
+	if path != "" {
+		if err := c.LoadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.LoadEnv(l.lookupEnv); err != nil {
+		return nil, err
+	}
+
+	set := map[string]bool{}
+	l.fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	flags := settings(l.flags)
+	for i, s := range settings(c) {
+		if name := s.field.Tag.Get("flag"); name != "" && set[name] {
+			s.value.Set(flags[i].value)
+		}
+	}
+
+	return c, nil
+}
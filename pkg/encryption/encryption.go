@@ -0,0 +1,298 @@
+// Package encryption seals record fields at rest with envelope encryption.
+// Every value is encrypted with its own random data key using AES-GCM, and
+// the data key is wrapped with a master key of a keyring. Rotating the master
+// key only rewraps the data keys, the values themselves are never re-encrypted.
+package encryption
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// KeySize is the size in bytes of master and data keys (AES-256)
+const KeySize = 32
+
+// prefix marks a sealed value and the version of its format
+const prefix = "kb1:"
+
+var (
+	// ErrUnknownKey is returned when a value is sealed with a master key missing from the keyring
+	ErrUnknownKey = errors.New("unknown master key")
+	// ErrInvalid is returned when a value is not sealed or was tampered with
+	ErrInvalid = errors.New("invalid sealed value")
+)
+
+var validKeyID = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// Keyring holds the master keys by ID. The primary key seals new values,
+// the other keys only open values sealed before a rotation.
+type Keyring struct {
+	keys    map[string]cipher.AEAD
+	primary string
+}
+
+// NewKeyring returns an empty keyring
+func NewKeyring() *Keyring {
+	return &Keyring{keys: map[string]cipher.AEAD{}}
+}
+
+// Add adds a master key to the keyring and makes it the primary key
+func (k *Keyring) Add(id string, key []byte) error {
+	if !validKeyID.MatchString(id) {
+		return fmt.Errorf("invalid key ID: '%s'", id)
+	}
+
+	if len(key) != KeySize {
+		return fmt.Errorf("key '%s' is %d bytes, expected %d", id, len(key), KeySize)
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	k.keys[id] = aead
+	k.primary = id
+	return nil
+}
+
+// Primary returns the ID of the primary key
+func (k *Keyring) Primary() string {
+	return k.primary
+}
+
+// Len returns the number of master keys
+func (k *Keyring) Len() int {
+	return len(k.keys)
+}
+
+// ParseKeys parses master keys given as "id=base64key" entries separated by
+// newlines or commas. Blank lines and lines starting with '#' are ignored. The
+// last key is the primary key, so a key is rotated by appending a new one.
+func ParseKeys(text string) (*Keyring, error) {
+	k := NewKeyring()
+
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		for _, entry := range strings.Split(line, ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+
+			id, encoded, ok := strings.Cut(entry, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid key entry, expected id=base64key")
+			}
+
+			key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+			if err != nil {
+				return nil, fmt.Errorf("key '%s': %w", id, err)
+			}
+
+			if err := k.Add(strings.TrimSpace(id), key); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if k.Len() == 0 {
+		return nil, errors.New("no master keys")
+	}
+
+	return k, nil
+}
+
+// LoadKeyfile reads the master keys of a keyfile in the format of ParseKeys
+func LoadKeyfile(path string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseKeys(string(data))
+}
+
+// GenerateKey returns a new random master key encoded in base64
+func GenerateKey() (string, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// IsSealed reports whether a value is sealed
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// Seal encrypts a value with a new data key wrapped by the primary key. The
+// additional data binds the sealed value to where it is stored, such as a
+// field of a record, it must be given again to open it.
+func (k *Keyring) Seal(plaintext string, additionalData string) (string, error) {
+	dataKey := make([]byte, KeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+
+	wrapped, err := seal(k.keys[k.primary], dataKey, []byte(k.primary))
+	if err != nil {
+		return "", err
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	ciphertext, err := seal(aead, []byte(plaintext), []byte(additionalData))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Join([]string{prefix + k.primary, encode(wrapped), encode(ciphertext)}, ":"), nil
+}
+
+// Open decrypts a sealed value
+func (k *Keyring) Open(sealed string, additionalData string) (string, error) {
+	id, wrapped, ciphertext, err := parse(sealed)
+	if err != nil {
+		return "", err
+	}
+
+	dataKey, err := k.unwrap(id, wrapped)
+	if err != nil {
+		return "", err
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := open(aead, ciphertext, []byte(additionalData))
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+// Rewrap wraps the data key of a sealed value with the primary key. It
+// reports whether the value changed, values already wrapped with the primary
+// key are returned as is.
+func (k *Keyring) Rewrap(sealed string) (string, bool, error) {
+	id, wrapped, ciphertext, err := parse(sealed)
+	if err != nil {
+		return "", false, err
+	}
+
+	if id == k.primary {
+		return sealed, false, nil
+	}
+
+	dataKey, err := k.unwrap(id, wrapped)
+	if err != nil {
+		return "", false, err
+	}
+
+	wrapped, err = seal(k.keys[k.primary], dataKey, []byte(k.primary))
+	if err != nil {
+		return "", false, err
+	}
+
+	return strings.Join([]string{prefix + k.primary, encode(wrapped), encode(ciphertext)}, ":"), true, nil
+}
+
+// unwrap decrypts a data key with the master key of the given ID
+func (k *Keyring) unwrap(id string, wrapped []byte) ([]byte, error) {
+	master, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: '%s'", ErrUnknownKey, id)
+	}
+
+	return open(master, wrapped, []byte(id))
+}
+
+// parse splits a sealed value into its key ID, wrapped data key and ciphertext
+func parse(sealed string) (string, []byte, []byte, error) {
+	if !IsSealed(sealed) {
+		return "", nil, nil, ErrInvalid
+	}
+
+	parts := strings.Split(strings.TrimPrefix(sealed, prefix), ":")
+	if len(parts) != 3 {
+		return "", nil, nil, ErrInvalid
+	}
+
+	wrapped, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, nil, ErrInvalid
+	}
+
+	ciphertext, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, nil, ErrInvalid
+	}
+
+	return parts[0], wrapped, ciphertext, nil
+}
+
+// newAEAD returns an AES-GCM cipher for the given key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts a plaintext with a random nonce prepended to the ciphertext
+func seal(aead cipher.AEAD, plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// open decrypts a ciphertext sealed by seal
+func open(aead cipher.AEAD, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, ErrInvalid
+	}
+
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+
+	return plaintext, nil
+}
+
+// encode encodes binary data in the sealed format
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
@@ -0,0 +1,111 @@
+package encryption
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testKeyring(t *testing.T, ids ...string) *Keyring {
+	var entries []string
+	for _, id := range ids {
+		key, err := GenerateKey()
+		assert.Nil(t, err)
+		entries = append(entries, fmt.Sprintf("%s=%s", id, key))
+	}
+
+	k, err := ParseKeys(strings.Join(entries, "\n"))
+	assert.Nil(t, err)
+	return k
+}
+
+func TestParseKeys(t *testing.T) {
+	key, _ := GenerateKey()
+
+	k, err := ParseKeys("# keys\nold=" + key + "\n\nnew=" + key)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, k.Len())
+	assert.Equal(t, "new", k.Primary())
+
+	k, err = ParseKeys("a=" + key + ",b=" + key)
+	assert.Nil(t, err)
+	assert.Equal(t, "b", k.Primary())
+
+	tests := map[string]string{
+		"no keys":        "# empty",
+		"missing id":     key,
+		"invalid id":     "a:b=" + key,
+		"invalid base64": "a=not base64",
+		"short key":      "a=c2hvcnQ=",
+	}
+
+	for testName, text := range tests {
+		t.Run(testName, func(t *testing.T) {
+			_, err := ParseKeys(text)
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	k := testKeyring(t, "k1")
+
+	sealed, err := k.Seal("db password: hunter2", "note.content")
+	assert.Nil(t, err)
+	assert.True(t, IsSealed(sealed))
+	assert.NotContains(t, sealed, "hunter2")
+
+	plaintext, err := k.Open(sealed, "note.content")
+	assert.Nil(t, err)
+	assert.Equal(t, "db password: hunter2", plaintext)
+
+	t.Run("other field", func(t *testing.T) {
+		_, err := k.Open(sealed, "script.body")
+		assert.ErrorIs(t, err, ErrInvalid)
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		_, err := k.Open(sealed[:len(sealed)-2]+"AA", "note.content")
+		assert.ErrorIs(t, err, ErrInvalid)
+	})
+
+	t.Run("not sealed", func(t *testing.T) {
+		_, err := k.Open("plain text", "note.content")
+		assert.ErrorIs(t, err, ErrInvalid)
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		_, err := testKeyring(t, "k2").Open(sealed, "note.content")
+		assert.ErrorIs(t, err, ErrUnknownKey)
+	})
+}
+
+func TestRewrap(t *testing.T) {
+	k1, _ := GenerateKey()
+	k2, _ := GenerateKey()
+
+	old, err := ParseKeys("k1=" + k1)
+	assert.Nil(t, err)
+
+	sealed, err := old.Seal("secret", "script.body")
+	assert.Nil(t, err)
+
+	// Rotate by appending a new primary key
+	rotated, err := ParseKeys("k1=" + k1 + "\nk2=" + k2)
+	assert.Nil(t, err)
+
+	rewrapped, changed, err := rotated.Rewrap(sealed)
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	assert.True(t, strings.HasPrefix(rewrapped, prefix+"k2:"))
+
+	plaintext, err := rotated.Open(rewrapped, "script.body")
+	assert.Nil(t, err)
+	assert.Equal(t, "secret", plaintext)
+
+	_, changed, err = rotated.Rewrap(rewrapped)
+	assert.Nil(t, err)
+	assert.False(t, changed)
+}
@@ -0,0 +1,157 @@
+// Package health serves the liveness and readiness probes of the server and
+// its build information
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+// checkTimeout bounds the checks of a readiness probe
+const checkTimeout = 2 * time.Second
+
+// BuildTime is the time the server was built, set with
+// -ldflags "-X github.com/jvmistica/knowledge-base-go/pkg/health.BuildTime=..."
+var BuildTime string
+
+// Check is a dependency the server needs to serve requests
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Health reports whether the server is alive and ready to serve requests
+type Health struct {
+	checks   []Check
+	stopping atomic.Bool
+}
+
+// New returns the health of a server depending on the given checks
+func New(checks ...Check) *Health {
+	return &Health{checks: checks}
+}
+
+// Shutdown fails the readiness probe from now on, for the server to be
+// taken out of the load balancers while it shuts down
+func (h *Health) Shutdown() {
+	h.stopping.Store(true)
+}
+
+// Status is the response of a probe, with the outcome of each check
+type Status struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Statuses of a probe and of its checks
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+	StatusStopping    = "shutting down"
+)
+
+// Live responds to the liveness probe, successful as long as the process serves requests
+func (h *Health) Live(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, Status{Status: StatusOK})
+}
+
+// Ready responds to the readiness probe, successful when all the checks
+// pass and the server is not shutting down
+func (h *Health) Ready(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.stopping.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, Status{Status: StatusStopping})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+	defer cancel()
+
+	status, code := Status{Status: StatusOK, Checks: map[string]string{}}, http.StatusOK
+	for _, check := range h.checks {
+		if err := check.Run(ctx); err != nil {
+			status.Status, status.Checks[check.Name], code = StatusUnavailable, err.Error(), http.StatusServiceUnavailable
+			continue
+		}
+		status.Checks[check.Name] = StatusOK
+	}
+
+	writeJSON(w, code, status)
+}
+
+// Build is the build information of the server
+type Build struct {
+	// Version is the version of the module, (devel) when built from a checkout
+	Version string `json:"version"`
+	// Commit and CommitTime identify the commit built, and Modified tells
+	// whether the checkout had uncommitted changes
+	Commit     string `json:"commit,omitempty"`
+	CommitTime string `json:"commit_time,omitempty"`
+	Modified   bool   `json:"modified,omitempty"`
+	BuildTime  string `json:"build_time,omitempty"`
+	GoVersion  string `json:"go_version"`
+}
+
+// ReadBuild returns the build information embedded in the binary
+func ReadBuild() Build {
+	build := Build{Version: "(devel)", BuildTime: BuildTime, GoVersion: runtime.Version()}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return build
+	}
+
+	if info.Main.Version != "" {
+		build.Version = info.Main.Version
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			build.Commit = setting.Value
+		case "vcs.time":
+			build.CommitTime = setting.Value
+		case "vcs.modified":
+			build.Modified = setting.Value == "true"
+		}
+	}
+
+	return build
+}
+
+// Version responds with the build information of the server
+func Version(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ReadBuild())
+}
+
+// writeJSON writes a response that is never cached
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	details, err := json.Marshal(v)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.Header().Add("cache-control", "no-store")
+	w.WriteHeader(status)
+	w.Write(details)
+}
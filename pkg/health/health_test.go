@@ -0,0 +1,93 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLive(t *testing.T) {
+	h := New(Check{"database", func(context.Context) error { return errors.New("down") }})
+
+	t.Run("invalid method", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		h.Live(rw, httptest.NewRequest(http.MethodPost, "/healthz", nil))
+
+		assert.Equal(t, http.StatusMethodNotAllowed, rw.Code)
+	})
+
+	t.Run("alive despite failing checks", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		h.Live(rw, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.JSONEq(t, `{"status": "ok"}`, rw.Body.String())
+	})
+}
+
+func TestReady(t *testing.T) {
+	var dbErr error
+	h := New(
+		Check{"database", func(context.Context) error { return dbErr }},
+		Check{"migrations", func(ctx context.Context) error {
+			_, ok := ctx.Deadline()
+			assert.True(t, ok)
+			return nil
+		}},
+	)
+
+	probe := func() (int, Status) {
+		rw := httptest.NewRecorder()
+		h.Ready(rw, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+		var status Status
+		assert.Nil(t, json.Unmarshal(rw.Body.Bytes(), &status))
+		assert.Equal(t, "no-store", rw.Header().Get("cache-control"))
+		return rw.Code, status
+	}
+
+	t.Run("ready", func(t *testing.T) {
+		code, status := probe()
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, Status{StatusOK, map[string]string{"database": StatusOK, "migrations": StatusOK}}, status)
+	})
+
+	t.Run("failing check", func(t *testing.T) {
+		dbErr = errors.New("connection refused")
+		defer func() { dbErr = nil }()
+
+		code, status := probe()
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, StatusUnavailable, status.Status)
+		assert.Equal(t, "connection refused", status.Checks["database"])
+		assert.Equal(t, StatusOK, status.Checks["migrations"])
+	})
+
+	t.Run("shutting down", func(t *testing.T) {
+		h.Shutdown()
+
+		code, status := probe()
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, StatusStopping, status.Status)
+	})
+}
+
+func TestVersion(t *testing.T) {
+	BuildTime = "2026-01-02T03:04:05Z"
+	defer func() { BuildTime = "" }()
+
+	rw := httptest.NewRecorder()
+	Version(rw, httptest.NewRequest(http.MethodGet, "/version", nil))
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	var build Build
+	assert.Nil(t, json.Unmarshal(rw.Body.Bytes(), &build))
+	assert.NotEmpty(t, build.Version)
+	assert.NotEmpty(t, build.GoVersion)
+	assert.Equal(t, "2026-01-02T03:04:05Z", build.BuildTime)
+}
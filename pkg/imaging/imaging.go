@@ -0,0 +1,127 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"sort"
+)
+
+// Formats of a photo
+const (
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+)
+
+// MaxPixels is the largest number of pixels of a photo that is decoded, so
+// that a small file cannot claim huge dimensions and exhaust the memory
+const MaxPixels = 50_000_000
+
+// jpegQuality is the quality of the JPEG images that are encoded
+const jpegQuality = 85
+
+var (
+	// ErrUnsupportedFormat is returned for images that are not JPEG or PNG
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	// ErrTooLarge is returned for images with more than MaxPixels pixels
+	ErrTooLarge = errors.New("image dimensions are too large")
+)
+
+// Photo is a photo without metadata and its thumbnails
+type Photo struct {
+	Format string
+	// Original is the photo without its metadata
+	Original []byte
+	// Thumbnails are the encoded thumbnails by width
+	Thumbnails map[int][]byte
+}
+
+// Process strips the metadata of a JPEG or PNG photo and generates a
+// thumbnail for each width smaller than the photo. A photo with an EXIF
+// orientation is rotated first, as the orientation is lost with the metadata.
+func Process(data []byte, widths []int) (*Photo, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	if format != FormatJPEG && format != FormatPNG {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+	}
+
+	if config.Width*config.Height > MaxPixels {
+		return nil, fmt.Errorf("%w: %dx%d", ErrTooLarge, config.Width, config.Height)
+	}
+
+	photo := &Photo{Format: format, Thumbnails: map[int][]byte{}}
+
+	original, err := StripMetadata(data, format)
+	if err != nil {
+		return nil, err
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	img := toRGBA(decoded)
+	if orientation := Orientation(data); orientation > 1 {
+		img = orient(img, orientation)
+		if original, err = encode(img, format); err != nil {
+			return nil, err
+		}
+	}
+	photo.Original = original
+
+	sorted := append([]int(nil), widths...)
+	sort.Ints(sorted)
+	for _, width := range sorted {
+		if width <= 0 || width >= img.Bounds().Dx() {
+			continue
+		}
+
+		thumbnail, err := encode(Resize(img, width), format)
+		if err != nil {
+			return nil, err
+		}
+		photo.Thumbnails[width] = thumbnail
+	}
+
+	return photo, nil
+}
+
+// toRGBA converts an image to RGBA with its origin at 0,0
+func toRGBA(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+	return rgba
+}
+
+// encode encodes an image in the given format
+func encode(img image.Image, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, img, format); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Encode writes an image to w in the given format
+func Encode(w io.Writer, img image.Image, format string) error {
+	switch format {
+	case FormatJPEG:
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: jpegQuality})
+	case FormatPNG:
+		return png.Encode(w, img)
+	}
+
+	return fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+}
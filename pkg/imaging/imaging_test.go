@@ -0,0 +1,137 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testImage returns a w x h image, red on the left half and blue on the right
+func testImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= w/2 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// exifSegment returns an APP1 segment with a big-endian EXIF orientation tag
+func exifSegment(orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	tiff = binary.BigEndian.AppendUint16(tiff, 1)
+	tiff = append(tiff, 0x01, 0x12, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01)
+	tiff = binary.BigEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// testJPEG returns a JPEG image with an EXIF segment
+func testJPEG(t *testing.T, w, h int, orientation uint16) []byte {
+	var buf bytes.Buffer
+	assert.Nil(t, jpeg.Encode(&buf, testImage(w, h), nil))
+	data := buf.Bytes()
+
+	out := append([]byte{}, data[:2]...)
+	out = append(out, exifSegment(orientation)...)
+	return append(out, data[2:]...)
+}
+
+// testPNG returns a PNG image with a tEXt chunk
+func testPNG(t *testing.T, w, h int) []byte {
+	var buf bytes.Buffer
+	assert.Nil(t, png.Encode(&buf, testImage(w, h)))
+	data := buf.Bytes()
+
+	body := []byte("tEXtComment\x00taken at home")
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(body)-4))
+	chunk = append(chunk, body...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(body))
+
+	// After the signature and the IHDR chunk
+	out := append([]byte{}, data[:33]...)
+	out = append(out, chunk...)
+	return append(out, data[33:]...)
+}
+
+func TestStripMetadata(t *testing.T) {
+	t.Run("jpeg", func(t *testing.T) {
+		data := testJPEG(t, 8, 8, 1)
+		assert.Equal(t, 1, Orientation(data))
+
+		stripped, err := StripMetadata(data, FormatJPEG)
+		assert.Nil(t, err)
+		assert.False(t, bytes.Contains(stripped, []byte("Exif")))
+		assert.Equal(t, len(data)-len(exifSegment(1)), len(stripped))
+
+		_, err = jpeg.Decode(bytes.NewReader(stripped))
+		assert.Nil(t, err)
+	})
+
+	t.Run("png", func(t *testing.T) {
+		data := testPNG(t, 8, 8)
+		stripped, err := StripMetadata(data, FormatPNG)
+		assert.Nil(t, err)
+		assert.False(t, bytes.Contains(stripped, []byte("taken at home")))
+
+		_, err = png.Decode(bytes.NewReader(stripped))
+		assert.Nil(t, err)
+	})
+
+	t.Run("corrupt", func(t *testing.T) {
+		_, err := StripMetadata([]byte{0xFF, 0xD8, 0xFF, 0xE1, 0xFF}, FormatJPEG)
+		assert.NotNil(t, err)
+	})
+}
+
+func TestProcess(t *testing.T) {
+	t.Run("thumbnails", func(t *testing.T) {
+		photo, err := Process(testPNG(t, 400, 200), []int{320, 100, 800})
+		assert.Nil(t, err)
+		assert.Equal(t, FormatPNG, photo.Format)
+		assert.Len(t, photo.Thumbnails, 2)
+
+		thumb, err := png.Decode(bytes.NewReader(photo.Thumbnails[100]))
+		assert.Nil(t, err)
+		assert.Equal(t, image.Rect(0, 0, 100, 50), thumb.Bounds())
+
+		r, _, b, _ := thumb.At(10, 10).RGBA()
+		assert.Equal(t, uint32(0xffff), r)
+		assert.Equal(t, uint32(0), b)
+	})
+
+	t.Run("orientation", func(t *testing.T) {
+		photo, err := Process(testJPEG(t, 64, 32, 6), []int{16})
+		assert.Nil(t, err)
+		assert.False(t, bytes.Contains(photo.Original, []byte("Exif")))
+
+		original, err := jpeg.Decode(bytes.NewReader(photo.Original))
+		assert.Nil(t, err)
+		assert.Equal(t, image.Rect(0, 0, 32, 64), original.Bounds())
+
+		thumb, err := jpeg.Decode(bytes.NewReader(photo.Thumbnails[16]))
+		assert.Nil(t, err)
+		assert.Equal(t, image.Rect(0, 0, 16, 32), thumb.Bounds())
+	})
+
+	t.Run("unsupported format", func(t *testing.T) {
+		_, err := Process([]byte("GIF89a"), []int{100})
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,172 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var (
+	jpegSOI      = []byte{0xFF, 0xD8}
+	pngSignature = []byte("\x89PNG\r\n\x1a\n")
+	exifHeader   = []byte("Exif\x00\x00")
+
+	errCorrupt = errors.New("corrupt image")
+)
+
+// JPEG markers dropped when stripping metadata: APP1 holds EXIF and XMP,
+// APP13 holds IPTC and COM holds comments. APP0, the APP2 colour profile and
+// APP14 are kept as they change how the image is decoded.
+var strippedMarkers = map[byte]bool{0xE1: true, 0xED: true, 0xFE: true}
+
+// PNG chunks dropped when stripping metadata
+var strippedChunks = map[string]bool{"eXIf": true, "tEXt": true, "zTXt": true, "iTXt": true, "tIME": true}
+
+// StripMetadata removes the EXIF, XMP, IPTC and text metadata of a JPEG or PNG
+// image without re-encoding it
+func StripMetadata(data []byte, format string) ([]byte, error) {
+	switch format {
+	case FormatJPEG:
+		return stripJPEG(data)
+	case FormatPNG:
+		return stripPNG(data)
+	}
+
+	return nil, ErrUnsupportedFormat
+}
+
+// jpegSegments calls fn with the marker and bytes of each segment of a JPEG
+// image up to the start of scan, and returns the offset of the start of scan
+func jpegSegments(data []byte, fn func(marker byte, segment []byte)) (int, error) {
+	if !bytes.HasPrefix(data, jpegSOI) {
+		return 0, errCorrupt
+	}
+
+	i := len(jpegSOI)
+	for {
+		if i+1 >= len(data) || data[i] != 0xFF {
+			return 0, errCorrupt
+		}
+
+		marker := data[i+1]
+		switch {
+		case marker == 0xFF:
+			// Fill byte
+			i++
+			continue
+		case marker == 0xDA:
+			return i, nil
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7):
+			fn(marker, data[i:i+2])
+			i += 2
+			continue
+		}
+
+		if i+4 > len(data) {
+			return 0, errCorrupt
+		}
+
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:i+4]))
+		if end > len(data) {
+			return 0, errCorrupt
+		}
+
+		fn(marker, data[i:end])
+		i = end
+	}
+}
+
+// stripJPEG removes the metadata segments of a JPEG image
+func stripJPEG(data []byte) ([]byte, error) {
+	out := append(make([]byte, 0, len(data)), jpegSOI...)
+	sos, err := jpegSegments(data, func(marker byte, segment []byte) {
+		if !strippedMarkers[marker] {
+			out = append(out, segment...)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return append(out, data[sos:]...), nil
+}
+
+// stripPNG removes the metadata chunks of a PNG image
+func stripPNG(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, errCorrupt
+	}
+
+	out := append(make([]byte, 0, len(data)), pngSignature...)
+	for i := len(pngSignature); i < len(data); {
+		if i+8 > len(data) {
+			return nil, errCorrupt
+		}
+
+		// Length, type, data and CRC
+		end := i + 12 + int(binary.BigEndian.Uint32(data[i:i+4]))
+		if end > len(data) || end < i {
+			return nil, errCorrupt
+		}
+
+		if !strippedChunks[string(data[i+4:i+8])] {
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+
+	return out, nil
+}
+
+// Orientation returns the EXIF orientation of a JPEG image, from 1 to 8, or
+// 1 if it has none
+func Orientation(data []byte) int {
+	orientation := 1
+	jpegSegments(data, func(marker byte, segment []byte) {
+		if marker != 0xE1 || len(segment) < 4 || !bytes.HasPrefix(segment[4:], exifHeader) {
+			return
+		}
+
+		if o := exifOrientation(segment[4+len(exifHeader):]); o >= 1 && o <= 8 {
+			orientation = o
+		}
+	})
+
+	return orientation
+}
+
+// exifOrientation reads the orientation tag from the first IFD of EXIF data
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	offset := int(order.Uint32(tiff[4:8]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 0
+	}
+
+	entries := int(order.Uint16(tiff[offset : offset+2]))
+	for n := 0; n < entries; n++ {
+		entry := offset + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+
+		if order.Uint16(tiff[entry:entry+2]) == 0x0112 {
+			return int(order.Uint16(tiff[entry+8 : entry+10]))
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,94 @@
+package markdown
+
+import (
+	"bytes"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// Heading is an entry of a document's table of contents
+type Heading struct {
+	Level int    `json:"level"`
+	Text  string `json:"text"`
+	ID    string `json:"id"`
+}
+
+// Document is a rendered Markdown document
+type Document struct {
+	HTML string    `json:"html"`
+	TOC  []Heading `json:"toc"`
+}
+
+// converter renders GitHub Flavored Markdown (tables, strikethrough, autolinks
+// and task lists) with an id on every heading. Raw HTML is omitted and
+// dangerous link schemes such as javascript: are dropped, so the output is
+// safe to embed.
+var converter = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+)
+
+// Render converts CommonMark/GFM source to sanitized HTML and extracts its
+// table of contents
+func Render(source string) (*Document, error) {
+	src := []byte(source)
+	root := converter.Parser().Parse(text.NewReader(src))
+
+	doc := &Document{TOC: []Heading{}}
+	err := ast.Walk(root, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := n.(*ast.Heading)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+
+		var id string
+		if v, ok := heading.AttributeString("id"); ok {
+			if b, ok := v.([]byte); ok {
+				id = string(b)
+			}
+		}
+
+		doc.TOC = append(doc.TOC, Heading{
+			Level: heading.Level,
+			Text:  plainText(heading, src),
+			ID:    id,
+		})
+
+		return ast.WalkSkipChildren, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := converter.Renderer().Render(&buf, src, root); err != nil {
+		return nil, err
+	}
+	doc.HTML = buf.String()
+
+	return doc, nil
+}
+
+// plainText returns the text content of a node without any formatting
+func plainText(n ast.Node, src []byte) string {
+	var buf bytes.Buffer
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		switch t := c.(type) {
+		case *ast.Text:
+			buf.Write(t.Segment.Value(src))
+			if t.SoftLineBreak() || t.HardLineBreak() {
+				buf.WriteByte(' ')
+			}
+		case *ast.String:
+			buf.Write(t.Value)
+		default:
+			buf.WriteString(plainText(c, src))
+		}
+	}
+
+	return buf.String()
+}
@@ -0,0 +1,42 @@
+package markdown
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender(t *testing.T) {
+	source := "# Deploy *the* API\n\n" +
+		"## Steps\n\n" +
+		"- [x] Build\n- [ ] Release\n\n" +
+		"```bash\nmake deploy\n```\n\n" +
+		"| Env | URL |\n|-----|-----|\n| prod | https://example.com |\n\n" +
+		"## Steps\n\n" +
+		"~~old~~ <script>alert(1)</script> [click](javascript:alert(1))\n"
+
+	doc, err := Render(source)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []Heading{
+		{Level: 1, Text: "Deploy the API", ID: "deploy-the-api"},
+		{Level: 2, Text: "Steps", ID: "steps"},
+		{Level: 2, Text: "Steps", ID: "steps-1"},
+	}, doc.TOC)
+
+	assert.Contains(t, doc.HTML, `<h1 id="deploy-the-api">Deploy <em>the</em> API</h1>`)
+	assert.Contains(t, doc.HTML, `<input checked="" disabled="" type="checkbox"> Build`)
+	assert.Contains(t, doc.HTML, `<code class="language-bash">make deploy`)
+	assert.Contains(t, doc.HTML, `<table>`)
+	assert.Contains(t, doc.HTML, `<a href="https://example.com">https://example.com</a>`)
+	assert.Contains(t, doc.HTML, `<del>old</del>`)
+	assert.NotContains(t, doc.HTML, `<script>`)
+	assert.NotContains(t, doc.HTML, `javascript:`)
+}
+
+func TestRenderEmpty(t *testing.T) {
+	doc, err := Render("")
+	assert.Nil(t, err)
+	assert.Equal(t, "", doc.HTML)
+	assert.Empty(t, doc.TOC)
+}
@@ -0,0 +1,282 @@
+package nutrition
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Facts is the nutritional breakdown of a recipe
+type Facts struct {
+	Servings   int                   `json:"servings"`
+	PerServing Nutrients             `json:"per_serving"`
+	Total      Nutrients             `json:"total"`
+	Matched    []MatchedIngredient   `json:"matched"`
+	Unmatched  []UnmatchedIngredient `json:"unmatched,omitempty"`
+}
+
+// MatchedIngredient is an ingredient line that was matched against a food
+type MatchedIngredient struct {
+	Ingredient string  `json:"ingredient"`
+	Food       string  `json:"food"`
+	Grams      float64 `json:"grams"`
+}
+
+// UnmatchedIngredient is an ingredient line that could not be accounted for
+type UnmatchedIngredient struct {
+	Ingredient string `json:"ingredient"`
+	Reason     string `json:"reason"`
+}
+
+const (
+	reasonUnknownFood   = "no matching food"
+	reasonNoQuantity    = "missing quantity"
+	reasonUnknownWeight = "cannot convert unit to grams"
+)
+
+// massUnits are units converted directly to grams
+var massUnits = map[string]float64{
+	"g": 1, "gram": 1, "grams": 1,
+	"kg": 1000, "kilogram": 1000, "kilograms": 1000,
+	"mg": 0.001,
+	"oz": 28.35, "ounce": 28.35, "ounces": 28.35,
+	"lb": 453.6, "lbs": 453.6, "pound": 453.6, "pounds": 453.6,
+}
+
+// volumeUnits are units converted to milliliters, then to grams by density
+var volumeUnits = map[string]float64{
+	"ml": 1, "milliliter": 1, "milliliters": 1,
+	"l": 1000, "liter": 1000, "liters": 1000,
+	"tsp": 5, "teaspoon": 5, "teaspoons": 5,
+	"tbsp": 15, "tablespoon": 15, "tablespoons": 15,
+	"cup": 240, "cups": 240,
+}
+
+// pieceUnits are counted units converted to grams by the food's piece weight
+var pieceUnits = map[string]bool{
+	"piece": true, "pieces": true, "pc": true, "pcs": true,
+	"clove": true, "cloves": true, "whole": true,
+	"sheet": true, "sheets": true, "leaf": true, "leaves": true,
+}
+
+// Compute calculates the nutrition facts of the given ingredient lines, one
+// ingredient per line such as "500 g chicken thigh" or "1/2 cup soy sauce".
+// Mappings link normalized ingredient names to food names and take precedence
+// over automatic matching.
+func (db *Database) Compute(ingredients string, servings int, mappings map[string]string) *Facts {
+	if servings < 1 {
+		servings = 1
+	}
+
+	facts := &Facts{
+		Servings: servings,
+		Matched:  []MatchedIngredient{},
+	}
+
+	for _, line := range strings.Split(ingredients, "\n") {
+		line = strings.TrimSpace(strings.TrimLeft(line, "-*• \t"))
+		if line == "" {
+			continue
+		}
+
+		qty, unit, name := parseIngredient(line)
+
+		food, ok := db.lookup(name, mappings)
+		if !ok {
+			facts.Unmatched = append(facts.Unmatched, UnmatchedIngredient{Ingredient: line, Reason: reasonUnknownFood})
+			continue
+		}
+
+		if qty == 0 {
+			facts.Unmatched = append(facts.Unmatched, UnmatchedIngredient{Ingredient: line, Reason: reasonNoQuantity})
+			continue
+		}
+
+		grams, ok := food.grams(qty, unit)
+		if !ok {
+			facts.Unmatched = append(facts.Unmatched, UnmatchedIngredient{Ingredient: line, Reason: reasonUnknownWeight})
+			continue
+		}
+
+		facts.Total.add(food.Per100g, grams/100)
+		facts.Matched = append(facts.Matched, MatchedIngredient{Ingredient: line, Food: food.Name, Grams: round(grams)})
+	}
+
+	facts.PerServing.add(facts.Total, 1/float64(servings))
+	facts.Total.round()
+	facts.PerServing.round()
+
+	return facts
+}
+
+// Normalize returns the canonical form of an ingredient or food name, as used
+// for manual mappings
+func Normalize(name string) string {
+	_, _, name = parseIngredient(name)
+	return name
+}
+
+// lookup resolves an ingredient name using the manual mappings first
+func (db *Database) lookup(name string, mappings map[string]string) (*Food, bool) {
+	if name == "" {
+		return nil, false
+	}
+
+	if mapped, ok := mappings[name]; ok {
+		if food, ok := db.Food(mapped); ok {
+			return food, true
+		}
+	}
+
+	return db.match(name)
+}
+
+// grams converts a quantity in the given unit to grams of the food
+func (f *Food) grams(qty float64, unit string) (float64, bool) {
+	if unit == "" {
+		if f.PieceGram > 0 {
+			return qty * f.PieceGram, true
+		}
+		return 0, false
+	}
+
+	if factor, ok := massUnits[unit]; ok {
+		return qty * factor, true
+	}
+
+	if factor, ok := volumeUnits[unit]; ok {
+		density := f.DensityML
+		if density == 0 {
+			density = 1
+		}
+		return qty * factor * density, true
+	}
+
+	if pieceUnits[unit] && f.PieceGram > 0 {
+		return qty * f.PieceGram, true
+	}
+
+	return 0, false
+}
+
+// parseIngredient splits an ingredient line into quantity, unit and the
+// normalized ingredient name
+func parseIngredient(line string) (float64, string, string) {
+	// Drop preparation notes such as "(chopped)" or ", diced"
+	if i := strings.Index(line, "("); i >= 0 {
+		if j := strings.Index(line[i:], ")"); j >= 0 {
+			line = line[:i] + line[i+j+1:]
+		}
+	}
+	if i := strings.Index(line, ","); i >= 0 {
+		line = line[:i]
+	}
+
+	fields := strings.Fields(strings.ToLower(line))
+
+	var qty float64
+	for len(fields) > 0 {
+		v, ok := parseQuantity(fields[0])
+		if !ok {
+			break
+		}
+		qty += v
+		fields = fields[1:]
+	}
+
+	var unit string
+	if qty > 0 && len(fields) > 1 {
+		u := strings.TrimSuffix(fields[0], ".")
+		if _, ok := massUnits[u]; ok {
+			unit = u
+		} else if _, ok := volumeUnits[u]; ok {
+			unit = u
+		} else if pieceUnits[u] {
+			unit = u
+		}
+
+		if unit != "" {
+			fields = fields[1:]
+			if len(fields) > 1 && fields[0] == "of" {
+				fields = fields[1:]
+			}
+		}
+	}
+
+	return qty, unit, normalize(strings.Join(fields, " "))
+}
+
+// parseQuantity parses integers, decimals, fractions and unicode vulgar fractions
+func parseQuantity(s string) (float64, bool) {
+	switch s {
+	case "½":
+		return 0.5, true
+	case "⅓":
+		return 1.0 / 3, true
+	case "¼":
+		return 0.25, true
+	case "¾":
+		return 0.75, true
+	}
+
+	if num, den, ok := strings.Cut(s, "/"); ok {
+		n, err1 := strconv.ParseFloat(num, 64)
+		d, err2 := strconv.ParseFloat(den, 64)
+		if err1 != nil || err2 != nil || d == 0 {
+			return 0, false
+		}
+		return n / d, true
+	}
+
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 {
+		return 0, false
+	}
+
+	return v, true
+}
+
+// normalize lowercases a name and strips everything but letters, digits and
+// single spaces
+func normalize(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return ' '
+	}, s)
+
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// singular returns a naive singular form of a plural name
+func singular(s string) string {
+	switch {
+	case strings.HasSuffix(s, "oes"):
+		return strings.TrimSuffix(s, "es")
+	case strings.HasSuffix(s, "s") && !strings.HasSuffix(s, "ss"):
+		return strings.TrimSuffix(s, "s")
+	}
+	return s
+}
+
+// round rounds to two decimal places
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// round rounds all nutrients to two decimal places
+func (nu *Nutrients) round() {
+	nu.Calories = round(nu.Calories)
+	nu.Protein = round(nu.Protein)
+	nu.Fat = round(nu.Fat)
+	nu.Carbs = round(nu.Carbs)
+	nu.Fiber = round(nu.Fiber)
+	nu.Sugar = round(nu.Sugar)
+	nu.Sodium = round(nu.Sodium)
+	nu.Calcium = round(nu.Calcium)
+	nu.Iron = round(nu.Iron)
+	nu.Potassium = round(nu.Potassium)
+	nu.VitaminC = round(nu.VitaminC)
+}
@@ -0,0 +1,224 @@
+package nutrition
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+//go:embed data/foods.csv
+var bundledFoods string
+
+// Nutrients holds the nutritional values of a food or a recipe
+type Nutrients struct {
+	Calories  float64 `json:"calories"`
+	Protein   float64 `json:"protein_g"`
+	Fat       float64 `json:"fat_g"`
+	Carbs     float64 `json:"carbs_g"`
+	Fiber     float64 `json:"fiber_g"`
+	Sugar     float64 `json:"sugar_g"`
+	Sodium    float64 `json:"sodium_mg"`
+	Calcium   float64 `json:"calcium_mg"`
+	Iron      float64 `json:"iron_mg"`
+	Potassium float64 `json:"potassium_mg"`
+	VitaminC  float64 `json:"vitamin_c_mg"`
+}
+
+// add adds the nutrients of n scaled by factor
+func (nu *Nutrients) add(n Nutrients, factor float64) {
+	nu.Calories += n.Calories * factor
+	nu.Protein += n.Protein * factor
+	nu.Fat += n.Fat * factor
+	nu.Carbs += n.Carbs * factor
+	nu.Fiber += n.Fiber * factor
+	nu.Sugar += n.Sugar * factor
+	nu.Sodium += n.Sodium * factor
+	nu.Calcium += n.Calcium * factor
+	nu.Iron += n.Iron * factor
+	nu.Potassium += n.Potassium * factor
+	nu.VitaminC += n.VitaminC * factor
+}
+
+// Food is an entry of the food composition dataset, with nutrients per 100 grams
+type Food struct {
+	Name      string
+	Aliases   []string
+	Per100g   Nutrients
+	DensityML float64
+	PieceGram float64
+}
+
+// Database is a food composition dataset indexed by food name and alias
+type Database struct {
+	foods map[string]*Food
+	names map[string]*Food
+}
+
+var columns = []string{
+	"name", "aliases", "kcal", "protein_g", "fat_g", "carbs_g", "fiber_g", "sugar_g",
+	"sodium_mg", "calcium_mg", "iron_mg", "potassium_mg", "vitamin_c_mg", "density_g_ml", "piece_g",
+}
+
+// LoadBundled loads the food composition dataset shipped with the package
+func LoadBundled() (*Database, error) {
+	return Load(strings.NewReader(bundledFoods))
+}
+
+// LoadFile loads a food composition dataset from a CSV file
+func LoadFile(path string) (*Database, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Load(f)
+}
+
+// Load reads a food composition dataset in CSV format
+func Load(r io.Reader) (*Database, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(columns)
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+
+	for i, col := range columns {
+		if strings.TrimSpace(header[i]) != col {
+			return nil, fmt.Errorf("unexpected column %q at position %d, want %q", header[i], i+1, col)
+		}
+	}
+
+	db := &Database{
+		foods: map[string]*Food{},
+		names: map[string]*Food{},
+	}
+
+	for {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		food, err := parseFood(row)
+		if err != nil {
+			line, _ := cr.FieldPos(0)
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		db.foods[food.Name] = food
+		db.names[food.Name] = food
+		for _, alias := range food.Aliases {
+			if _, ok := db.names[alias]; !ok {
+				db.names[alias] = food
+			}
+		}
+	}
+
+	if len(db.foods) == 0 {
+		return nil, errors.New("food composition dataset is empty")
+	}
+
+	return db, nil
+}
+
+// parseFood converts a CSV row into a food
+func parseFood(row []string) (*Food, error) {
+	name := normalize(row[0])
+	if name == "" {
+		return nil, errors.New("missing food name")
+	}
+
+	values := make([]float64, len(row)-2)
+	for i, v := range row[2:] {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", columns[i+2], err)
+		}
+		values[i] = f
+	}
+
+	food := &Food{
+		Name: name,
+		Per100g: Nutrients{
+			Calories:  values[0],
+			Protein:   values[1],
+			Fat:       values[2],
+			Carbs:     values[3],
+			Fiber:     values[4],
+			Sugar:     values[5],
+			Sodium:    values[6],
+			Calcium:   values[7],
+			Iron:      values[8],
+			Potassium: values[9],
+			VitaminC:  values[10],
+		},
+		DensityML: values[11],
+		PieceGram: values[12],
+	}
+
+	for _, alias := range strings.Split(row[1], "|") {
+		if alias = normalize(alias); alias != "" {
+			food.Aliases = append(food.Aliases, alias)
+		}
+	}
+
+	return food, nil
+}
+
+// Food returns the food with the given name or alias
+func (db *Database) Food(name string) (*Food, bool) {
+	food, ok := db.names[normalize(name)]
+	return food, ok
+}
+
+// Len returns the number of foods in the database
+func (db *Database) Len() int {
+	return len(db.foods)
+}
+
+// match finds the food that best matches an ingredient name. The exact name
+// or alias wins, otherwise the longest name or alias contained in the
+// ingredient as whole words is used.
+func (db *Database) match(ingredient string) (*Food, bool) {
+	if food, ok := db.names[ingredient]; ok {
+		return food, true
+	}
+
+	if food, ok := db.names[singular(ingredient)]; ok {
+		return food, true
+	}
+
+	var (
+		best     *Food
+		bestName string
+	)
+
+	padded := " " + ingredient + " "
+	for name, food := range db.names {
+		if len(name) < len(bestName) || (len(name) == len(bestName) && name > bestName) {
+			continue
+		}
+
+		if strings.Contains(padded, " "+name+" ") || strings.Contains(padded, " "+name+"s ") {
+			best, bestName = food, name
+		}
+	}
+
+	return best, best != nil
+}
@@ -0,0 +1,100 @@
+package nutrition
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	t.Run("bundled dataset", func(t *testing.T) {
+		db, err := LoadBundled()
+		assert.Nil(t, err)
+		assert.Greater(t, db.Len(), 0)
+
+		food, ok := db.Food("Soya Sauce")
+		assert.True(t, ok)
+		assert.Equal(t, "soy sauce", food.Name)
+	})
+
+	t.Run("invalid header", func(t *testing.T) {
+		_, err := Load(strings.NewReader("food,kcal\nrice,130\n"))
+		assert.NotNil(t, err)
+	})
+
+	t.Run("invalid value", func(t *testing.T) {
+		csv := strings.Join(columns, ",") + "\nrice,,abc,0,0,0,0,0,0,0,0,0,0,0,0\n"
+		_, err := Load(strings.NewReader(csv))
+		assert.NotNil(t, err)
+	})
+
+	t.Run("empty dataset", func(t *testing.T) {
+		_, err := Load(strings.NewReader(strings.Join(columns, ",") + "\n"))
+		assert.NotNil(t, err)
+	})
+}
+
+func TestParseIngredient(t *testing.T) {
+	tests := map[string]struct {
+		qty  float64
+		unit string
+		name string
+	}{
+		"500 g chicken thigh":     {500, "g", "chicken thigh"},
+		"1 1/2 cups of rice":      {1.5, "cups", "rice"},
+		"½ tsp salt":              {0.5, "tsp", "salt"},
+		"3 eggs":                  {3, "", "eggs"},
+		"2 cloves garlic, minced": {2, "cloves", "garlic"},
+		"1 onion (chopped)":       {1, "", "onion"},
+		"salt to taste":           {0, "", "salt to taste"},
+		"2 Tbsp. Vegetable Oil":   {2, "tbsp", "vegetable oil"},
+	}
+
+	for line, want := range tests {
+		t.Run(line, func(t *testing.T) {
+			qty, unit, name := parseIngredient(line)
+			assert.InDelta(t, want.qty, qty, 0.001)
+			assert.Equal(t, want.unit, unit)
+			assert.Equal(t, want.name, name)
+		})
+	}
+}
+
+func TestCompute(t *testing.T) {
+	db, err := LoadBundled()
+	assert.Nil(t, err)
+
+	t.Run("matched and unmatched ingredients", func(t *testing.T) {
+		facts := db.Compute("200 g chicken breast\n2 eggs\n1 tbsp dragon fruit jam\nsalt to taste", 2, nil)
+
+		assert.Equal(t, 2, facts.Servings)
+		assert.Len(t, facts.Matched, 2)
+		assert.Equal(t, "chicken", facts.Matched[0].Food)
+		assert.Equal(t, 200.0, facts.Matched[0].Grams)
+		assert.Equal(t, 100.0, facts.Matched[1].Grams)
+
+		assert.Equal(t, []UnmatchedIngredient{
+			{Ingredient: "1 tbsp dragon fruit jam", Reason: reasonUnknownFood},
+			{Ingredient: "salt to taste", Reason: reasonNoQuantity},
+		}, facts.Unmatched)
+
+		assert.InDelta(t, 380+143, facts.Total.Calories, 0.01)
+		assert.InDelta(t, (380+143)/2.0, facts.PerServing.Calories, 0.01)
+	})
+
+	t.Run("manual mapping", func(t *testing.T) {
+		mappings := map[string]string{"dragon fruit jam": "honey"}
+		facts := db.Compute("1 tbsp dragon fruit jam", 0, mappings)
+
+		assert.Equal(t, 1, facts.Servings)
+		assert.Empty(t, facts.Unmatched)
+		assert.Equal(t, "honey", facts.Matched[0].Food)
+		assert.InDelta(t, 15*1.42, facts.Matched[0].Grams, 0.01)
+	})
+
+	t.Run("unit without weight", func(t *testing.T) {
+		facts := db.Compute("2 pork", 1, nil)
+		assert.Equal(t, reasonUnknownWeight, facts.Unmatched[0].Reason)
+	})
+}
@@ -0,0 +1,246 @@
+package record
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// apiKeyPrefix tells API keys apart from session tokens
+const apiKeyPrefix = "kbk_"
+
+// Access levels of a scope
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+	ScopeRun   = "run"
+)
+
+// scopeResources are the resources API keys can be scoped to, named after
+// the first segment of the path of their routes
+var scopeResources = []string{"notes", "recipes", "scripts", "relations", "links", "attachments", "audit"}
+
+// Scopes returns every scope an API key can be given, such as notes:read
+func Scopes() []string {
+	var scopes []string
+	for _, resource := range scopeResources {
+		scopes = append(scopes, resource+":"+ScopeRead, resource+":"+ScopeWrite)
+	}
+
+	return append(scopes, "scripts:"+ScopeRun)
+}
+
+// requiredScope returns the scope needed by an API key to access the route
+// of a request, or an empty scope if API keys cannot access it. Reads need
+// the read scope, other methods the write scope, and running a script its
+// own run scope.
+func requiredScope(r *http.Request) string {
+	_, path := splitWorkspacePath(r.URL.Path)
+	resource, rest, _ := strings.Cut(strings.TrimPrefix(path, apiPrefix+"/"), "/")
+	if !slices.Contains(scopeResources, resource) {
+		return ""
+	}
+
+	switch {
+	case resource == "scripts" && strings.HasSuffix(rest, "/run"):
+		return resource + ":" + ScopeRun
+	case resource == "scripts" && strings.HasSuffix(rest, "/render"):
+		return resource + ":" + ScopeRead
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		return resource + ":" + ScopeRead
+	}
+
+	return resource + ":" + ScopeWrite
+}
+
+// APIKey is the structure of the api_keys table, a personal key used by
+// scripts and CI jobs instead of a session. Only the hash of the key is stored.
+type APIKey struct {
+	ID          uint       `json:"id"`
+	UserID      uint       `json:"user_id" gorm:"index"`
+	WorkspaceID uint       `json:"workspace_id"`
+	Name        string     `json:"name"`
+	Prefix      string     `json:"prefix"`
+	KeyHash     string     `json:"-" gorm:"uniqueIndex"`
+	Scopes      []string   `json:"scopes" gorm:"serializer:json"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// NewAPIKey is the response of a create request, the only time the key
+// itself is returned
+type NewAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// validate checks the name, scopes and expiry of a new API key
+func (k *APIKey) validate() error {
+	if strings.TrimSpace(k.Name) == "" {
+		return errors.New("Missing API key name")
+	}
+
+	if len(k.Scopes) == 0 {
+		return errors.New("Missing API key scopes")
+	}
+
+	valid := Scopes()
+	for _, scope := range k.Scopes {
+		if !slices.Contains(valid, scope) {
+			return fmt.Errorf("Invalid scope: '%s', supported scopes are %s", scope, strings.Join(valid, ", "))
+		}
+	}
+
+	if k.ExpiresAt != nil && !k.ExpiresAt.After(time.Now()) {
+		return errors.New("Invalid expiry: must be in the future")
+	}
+
+	return nil
+}
+
+// allows reports whether an API key has the given scope
+func (k *APIKey) allows(scope string) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+// findAPIKey returns the valid API key matching a key, or nil if it does not
+// exist, expired or was revoked
+func (re *Record) findAPIKey(key string) (*APIKey, error) {
+	var apiKey APIKey
+	result := re.DB.Where("key_hash = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)",
+		hashToken(key), time.Now()).Limit(1).Find(&apiKey)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+
+	return &apiKey, nil
+}
+
+// touchAPIKey records that an API key was just used
+func (re *Record) touchAPIKey(key *APIKey) error {
+	now := time.Now()
+	key.LastUsedAt = &now
+	return re.DB.Model(&APIKey{}).Where(filterByID, key.ID).UpdateColumn("last_used_at", now).Error
+}
+
+// CreateAPIKey creates a new API key for the authenticated user
+func (re *Record) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		unauthorized(w, "Not logged in")
+		return
+	}
+
+	var apiKey APIKey
+	if err := decodeBody(r, &apiKey); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := apiKey.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	key, err := newToken(apiKeyPrefix)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Keys are limited to the workspace they are created in
+	var workspaceID uint
+	if workspace, ok := workspaceFromContext(r.Context()); ok {
+		workspaceID = workspace.ID
+	}
+
+	created := NewAPIKey{
+		APIKey: APIKey{
+			UserID:      user.ID,
+			WorkspaceID: workspaceID,
+			Name:        apiKey.Name,
+			Prefix:      key[:len(apiKeyPrefix)+6],
+			KeyHash:     hashToken(key),
+			Scopes:      apiKey.Scopes,
+			ExpiresAt:   apiKey.ExpiresAt,
+		},
+		Key: key,
+	}
+
+	if result := re.DB.Create(&created.APIKey); result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, created)
+}
+
+// ListAPIKeys lists the API keys of the authenticated user
+func (re *Record) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		unauthorized(w, "Not logged in")
+		return
+	}
+
+	var apiKeys []APIKey
+	if result := re.DB.Where("user_id = ?", user.ID).Order("id").Find(&apiKeys); result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, apiKeys)
+}
+
+// RevokeAPIKey revokes an API key of the authenticated user
+func (re *Record) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		unauthorized(w, "Not logged in")
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "Missing query parameter: 'id'", http.StatusBadRequest)
+		return
+	}
+
+	result := re.DB.Model(&APIKey{}).Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, user.ID).
+		UpdateColumn("revoked_at", time.Now())
+	if result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
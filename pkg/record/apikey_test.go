@@ -0,0 +1,167 @@
+package record
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	mocket "github.com/selvatico/go-mocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequiredScope(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		scope  string
+	}{
+		{http.MethodGet, "/api/v1/notes/list", "notes:read"},
+		{http.MethodPost, "/api/v1/notes/new", "notes:write"},
+		{http.MethodDelete, "/api/v1/recipes/delete", "recipes:write"},
+		{http.MethodPost, "/api/v1/recipes/ingredients/map", "recipes:write"},
+		{http.MethodGet, "/api/v1/scripts/3/raw", "scripts:read"},
+		{http.MethodPost, "/api/v1/scripts/3/render", "scripts:read"},
+		{http.MethodPost, "/api/v1/scripts/3/run", "scripts:run"},
+		{http.MethodGet, "/api/v1/attachments", "attachments:read"},
+		{http.MethodGet, "/api/v1/links/broken", "links:read"},
+		{http.MethodPost, "/api/v1/apikeys/new", ""},
+		{http.MethodGet, "/api/v1/auth/me", ""},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.scope, requiredScope(httptest.NewRequest(test.method, test.path, nil)), test.path)
+	}
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db}
+	alice := &User{ID: 1, Username: "alice"}
+
+	t.Run(errInvalidMethod, func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		r.CreateAPIKey(rw, withUser(&http.Request{Method: http.MethodGet}, testUser))
+
+		assert.Equal(t, http.StatusMethodNotAllowed, rw.Code)
+	})
+
+	for name, body := range map[string]string{
+		"missing name":   `{"scopes": ["notes:read"]}`,
+		"missing scopes": `{"name": "ci"}`,
+		"invalid scope":  `{"name": "ci", "scopes": ["notes:admin"]}`,
+		"expired":        `{"name": "ci", "scopes": ["notes:read"], "expires_at": "2001-01-01T00:00:00Z"}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			r.CreateAPIKey(rw, withUser(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)), alice))
+
+			assert.Equal(t, http.StatusBadRequest, rw.Code)
+		})
+	}
+
+	t.Run(successOneRecord, func(t *testing.T) {
+		mocket.Catcher.Reset()
+		expiry := time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339)
+		body := `{"name": "ci", "scopes": ["notes:read", "scripts:run"], "expires_at": "` + expiry + `"}`
+		rw := httptest.NewRecorder()
+		r.CreateAPIKey(rw, withUser(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)), alice))
+		assert.Equal(t, http.StatusCreated, rw.Code)
+
+		var created NewAPIKey
+		assert.Nil(t, json.Unmarshal(rw.Body.Bytes(), &created))
+		assert.True(t, strings.HasPrefix(created.Key, apiKeyPrefix))
+		assert.True(t, strings.HasPrefix(created.Key, created.Prefix))
+		assert.Equal(t, uint(1), created.UserID)
+		assert.Equal(t, []string{"notes:read", "scripts:run"}, created.Scopes)
+		assert.NotContains(t, rw.Body.String(), hashToken(created.Key))
+	})
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db}
+	alice := &User{ID: 1, Username: "alice"}
+
+	t.Run(errMissingParam, func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		r.RevokeAPIKey(rw, withUser(httptest.NewRequest(http.MethodDelete, "/", nil), alice))
+
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+
+	t.Run(errRecordNotFound, func(t *testing.T) {
+		mocket.Catcher.Reset().NewMock().WithQuery(`UPDATE "api_keys"`).WithRowsNum(0)
+		rw := httptest.NewRecorder()
+		r.RevokeAPIKey(rw, withUser(httptest.NewRequest(http.MethodDelete, "/?id=9", nil), alice))
+
+		assert.Equal(t, http.StatusNotFound, rw.Code)
+	})
+
+	t.Run(successRecordDeleted, func(t *testing.T) {
+		mocket.Catcher.Reset().NewMock().WithQuery(`UPDATE "api_keys"`).WithRowsNum(1)
+		rw := httptest.NewRecorder()
+		r.RevokeAPIKey(rw, withUser(httptest.NewRequest(http.MethodDelete, "/?id=2", nil), alice))
+
+		assert.Equal(t, http.StatusOK, rw.Code)
+	})
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db}
+	handler := r.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := UserFromContext(r.Context())
+		key, _ := apiKeyFromContext(r.Context())
+		w.Write([]byte(user.Username + " " + key.Name))
+	}))
+
+	request := func(method, path string) *http.Request {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+apiKeyPrefix+"secret")
+		return req
+	}
+
+	mockKey := func() {
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`FROM "api_keys"`).WithReply([]map[string]interface{}{
+			{"id": 2, "user_id": 1, "name": "ci", "scopes": `["notes:read"]`},
+		})
+		mocket.Catcher.NewMock().WithQuery(`FROM "users"`).WithReply([]map[string]interface{}{{"id": 1, "username": "alice"}})
+	}
+
+	t.Run("invalid key", func(t *testing.T) {
+		mocket.Catcher.Reset().NewMock().WithQuery(`FROM "api_keys"`).WithRowsNum(0)
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, request(http.MethodGet, "/api/v1/notes/list"))
+
+		assert.Equal(t, http.StatusUnauthorized, rw.Code)
+	})
+
+	t.Run("insufficient scope", func(t *testing.T) {
+		mockKey()
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, request(http.MethodPost, "/api/v1/notes/new"))
+
+		assert.Equal(t, http.StatusForbidden, rw.Code)
+	})
+
+	t.Run("unscoped route", func(t *testing.T) {
+		mockKey()
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, request(http.MethodPost, "/api/v1/apikeys/new"))
+
+		assert.Equal(t, http.StatusForbidden, rw.Code)
+	})
+
+	t.Run(successRecordFound, func(t *testing.T) {
+		mockKey()
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, request(http.MethodGet, "/api/v1/notes/list"))
+
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, "alice ci", rw.Body.String())
+	})
+}
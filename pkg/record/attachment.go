@@ -0,0 +1,808 @@
+package record
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm/clause"
+
+	"github.com/jvmistica/knowledge-base-go/pkg/blob"
+	"github.com/jvmistica/knowledge-base-go/pkg/imaging"
+)
+
+const (
+	// multipartOverhead is the room left for the multipart headers and
+	// boundaries on top of the maximum size of the file itself
+	multipartOverhead = 64 << 10
+
+	// sniffLen is the number of bytes used to detect the content type
+	sniffLen = 512
+
+	// attachmentsPath is the path the attachment endpoints are served under
+	attachmentsPath = apiPrefix + "/attachments"
+)
+
+// ThumbnailWidths are the widths of the thumbnails generated for recipe photos
+var ThumbnailWidths = []int{160, 320, 640}
+
+// photoTypes are the content types of the attachments thumbnails are generated for
+var photoTypes = []string{"image/jpeg", "image/png"}
+
+// textTypes map the extensions of text files to a more specific content type
+// than the text/plain that is detected from their content
+var textTypes = map[string]string{
+	".md":   "text/markdown",
+	".csv":  "text/csv",
+	".json": "application/json",
+	".yaml": "application/yaml",
+	".yml":  "application/yaml",
+	".toml": "application/toml",
+	".xml":  "application/xml",
+}
+
+var (
+	errUploadTooLarge      = errors.New("File is too large")
+	errUnsupportedFileType = errors.New("Unsupported file type")
+	errInvalidImage        = errors.New("Invalid image")
+)
+
+// UploadLimits are the limits applied to uploaded attachments
+type UploadLimits struct {
+	// MaxSize is the maximum size of a file in bytes
+	MaxSize int64
+	// Types are the accepted content types, as detected from the content
+	Types []string
+}
+
+// Attachment is the structure of the attachments table, a file attached to a
+// record. The content is stored once per hash in the blob store and shared
+// by every attachment with the same content.
+type Attachment struct {
+	ID          uint   `json:"id"`
+	RecordType  string `json:"record_type" gorm:"index:idx_attachments_record"`
+	RecordID    uint   `json:"record_id" gorm:"index:idx_attachments_record"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	Hash        string `json:"hash" gorm:"index"`
+	// Thumbnails are the widths of the thumbnails generated for a recipe photo
+	Thumbnails  []int     `json:"thumbnails,omitempty" gorm:"serializer:json"`
+	WorkspaceID uint      `json:"-" gorm:"index;not null;default:0"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Thumbnail is a resized version of a recipe photo
+type Thumbnail struct {
+	Width int    `json:"width"`
+	URL   string `json:"url"`
+}
+
+// Photo is an image attached to a recipe
+type Photo struct {
+	ID         uint        `json:"id"`
+	Filename   string      `json:"filename"`
+	URL        string      `json:"url"`
+	Thumbnails []Thumbnail `json:"thumbnails"`
+}
+
+// blobKey returns the key of the content with the given SHA-256 hash in the blob store
+func blobKey(hash string) string {
+	return "sha256/" + hash[:2] + "/" + hash
+}
+
+// thumbnailKey returns the key of a thumbnail of the content with the given
+// SHA-256 hash in the blob store
+func thumbnailKey(hash string, width int) string {
+	return "thumbnails/" + hash[:2] + "/" + hash + "/" + strconv.Itoa(width)
+}
+
+// attachmentName returns the base name of an uploaded file
+func attachmentName(filename string) string {
+	name := path.Base(strings.ReplaceAll(filename, `\`, "/"))
+	if name == "." || name == "/" || name == "" {
+		return "attachment"
+	}
+
+	return name
+}
+
+// detectContentType detects the content type of a file from its first bytes.
+// The extension of the file only refines text content, so a file cannot
+// claim to be an image or a PDF by its name alone.
+func detectContentType(filename string, head []byte) string {
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if contentType == "text/plain" {
+		if t, ok := textTypes[strings.ToLower(path.Ext(filename))]; ok {
+			return t
+		}
+	}
+
+	return contentType
+}
+
+// upload is an uploaded file staged in a temporary file, with the attachment
+// to create for it
+type upload struct {
+	attachment *Attachment
+	file       *os.File
+	// content is the content stored, the file or the photo without its metadata
+	content io.ReadSeeker
+	photo   *imaging.Photo
+}
+
+// Close removes the temporary file of an upload
+func (u *upload) Close() error {
+	u.file.Close()
+	return os.Remove(u.file.Name())
+}
+
+// stageUpload writes an uploaded file to a temporary file and hashes it. A
+// file already attached to the record is not attached twice, and the
+// existing attachment is returned instead.
+func (re *Record) stageUpload(typ string, id uint, filename string, content io.Reader) (*upload, *Attachment, error) {
+	tmp, err := os.CreateTemp("", "kb-upload-*")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	u := &upload{file: tmp, content: tmp}
+	staged := false
+	defer func() {
+		if !staged {
+			u.Close()
+		}
+	}()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(content, re.Uploads.MaxSize+1))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if size > re.Uploads.MaxSize {
+		return nil, nil, errUploadTooLarge
+	}
+
+	head := make([]byte, sniffLen)
+	n, err := tmp.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+
+	attachment := &Attachment{
+		RecordType:  typ,
+		RecordID:    id,
+		Filename:    attachmentName(filename),
+		ContentType: detectContentType(filename, head[:n]),
+		Size:        size,
+		Hash:        hex.EncodeToString(hash.Sum(nil)),
+	}
+	u.attachment = attachment
+
+	if !slices.Contains(re.Uploads.Types, attachment.ContentType) {
+		return nil, nil, fmt.Errorf("%w: '%s'", errUnsupportedFileType, attachment.ContentType)
+	}
+
+	if typ == TypeRecipe && slices.Contains(photoTypes, attachment.ContentType) {
+		data, err := os.ReadFile(tmp.Name())
+		if err != nil {
+			return nil, nil, err
+		}
+
+		u.photo, err = imaging.Process(data, ThumbnailWidths)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %s", errInvalidImage, err)
+		}
+
+		// The photo is stored without its metadata, so it is hashed again
+		sum := sha256.Sum256(u.photo.Original)
+		attachment.Hash = hex.EncodeToString(sum[:])
+		attachment.Size = int64(len(u.photo.Original))
+		u.content = bytes.NewReader(u.photo.Original)
+
+		for _, width := range ThumbnailWidths {
+			if _, ok := u.photo.Thumbnails[width]; ok {
+				attachment.Thumbnails = append(attachment.Thumbnails, width)
+			}
+		}
+	}
+
+	var existing Attachment
+	result := re.DB.Where("record_type = ? AND record_id = ? AND hash = ?", typ, id, attachment.Hash).Limit(1).Find(&existing)
+	if result.Error != nil {
+		return nil, nil, result.Error
+	}
+
+	if result.RowsAffected > 0 {
+		return nil, &existing, nil
+	}
+
+	staged = true
+	return u, nil, nil
+}
+
+// storeUpload stores the content of an upload and its thumbnails in the blob
+// store, unless the content is already stored
+func (re *Record) storeUpload(ctx context.Context, u *upload) error {
+	key := blobKey(u.attachment.Hash)
+	stored, err := re.Blobs.Exists(ctx, key)
+	if err != nil || stored {
+		return err
+	}
+
+	if _, err := u.content.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if err := re.Blobs.Put(ctx, key, u.content, u.attachment.Size, u.attachment.ContentType); err != nil {
+		return err
+	}
+
+	for _, width := range u.attachment.Thumbnails {
+		thumbnail := u.photo.Thumbnails[width]
+		err := re.Blobs.Put(ctx, thumbnailKey(u.attachment.Hash, width), bytes.NewReader(thumbnail), int64(len(thumbnail)), u.attachment.ContentType)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// BlobLock is the structure of the blob_locks table, a row per content in
+// the blob store locked by the transactions attaching or releasing it, so
+// that a content is not deleted as it is attached again
+type BlobLock struct {
+	Hash string `gorm:"primaryKey"`
+}
+
+// lockBlob locks the content with the given hash until the end of the
+// transaction, waiting for the transactions holding it
+func (re *Record) lockBlob(hash string) error {
+	return re.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "hash"}},
+		DoUpdates: clause.AssignmentColumns([]string{"hash"}),
+	}).Create(&BlobLock{Hash: hash}).Error
+}
+
+// attachUpload creates the attachment of a stored upload, storing its
+// content again if it was released since
+func (re *Record) attachUpload(r *http.Request, u *upload) error {
+	return re.transaction(func(tx *Record) error {
+		if err := tx.lockBlob(u.attachment.Hash); err != nil {
+			return err
+		}
+
+		if err := tx.storeUpload(r.Context(), u); err != nil {
+			return err
+		}
+
+		if result := tx.DB.Create(u.attachment); result.Error != nil {
+			return result.Error
+		}
+		return tx.audit(r, AuditCreate, resourceAttachment, u.attachment.ID, nil, u.attachment)
+	})
+}
+
+// releaseBlob deletes the content with the given hash from the blob store
+// once no attachment refers to it anymore
+func (re *Record) releaseBlob(ctx context.Context, hash string) error {
+	if re.Blobs == nil {
+		return nil
+	}
+
+	// The content is shared by the attachments of every workspace
+	shared := *re
+	shared.DB = re.DB.WithContext(context.Background())
+	return shared.transaction(func(tx *Record) error {
+		if err := tx.lockBlob(hash); err != nil {
+			return err
+		}
+
+		var count int64
+		if result := tx.DB.Model(&Attachment{}).Where("hash = ?", hash).Count(&count); result.Error != nil || count > 0 {
+			return result.Error
+		}
+
+		for _, width := range ThumbnailWidths {
+			if err := tx.Blobs.Delete(ctx, thumbnailKey(hash, width)); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Blobs.Delete(ctx, blobKey(hash)); err != nil {
+			return err
+		}
+
+		return tx.DB.Delete(&BlobLock{Hash: hash}).Error
+	})
+}
+
+// recipePhotos returns the photos attached to the given recipes, by recipe
+func (re *Record) recipePhotos(ids ...uint) (map[uint][]Photo, error) {
+	var attachments []Attachment
+	result := re.DB.Where("record_type = ? AND record_id IN ? AND content_type IN ?", TypeRecipe, ids, photoTypes).
+		Order("id").Find(&attachments)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	photos := map[uint][]Photo{}
+	for _, attachment := range attachments {
+		photo := Photo{
+			ID:         attachment.ID,
+			Filename:   attachment.Filename,
+			URL:        fmt.Sprintf("%s?id=%d", attachmentsPath, attachment.ID),
+			Thumbnails: []Thumbnail{},
+		}
+
+		for _, width := range attachment.Thumbnails {
+			photo.Thumbnails = append(photo.Thumbnails, Thumbnail{
+				Width: width,
+				URL:   fmt.Sprintf("%s/thumbnail?id=%d&width=%d", attachmentsPath, attachment.ID, width),
+			})
+		}
+
+		photos[attachment.RecordID] = append(photos[attachment.RecordID], photo)
+	}
+
+	return photos, nil
+}
+
+// deleteAttachments deletes the attachments of a deleted record, and returns
+// the hashes of their content for releaseBlobs
+func (re *Record) deleteAttachments(typ string, id string) ([]string, error) {
+	var attachments []Attachment
+	if result := re.DB.Where("record_type = ? AND record_id = ?", typ, id).Find(&attachments); result.Error != nil {
+		return nil, result.Error
+	}
+
+	if len(attachments) == 0 {
+		return nil, nil
+	}
+
+	if result := re.DB.Where("record_type = ? AND record_id = ?", typ, id).Delete(&Attachment{}); result.Error != nil {
+		return nil, result.Error
+	}
+
+	hashes := make([]string, 0, len(attachments))
+	for _, attachment := range attachments {
+		hashes = append(hashes, attachment.Hash)
+	}
+
+	return hashes, nil
+}
+
+// releaseBlobs deletes the content of deleted attachments that is not shared
+// with other attachments, once their deletion is committed
+func (re *Record) releaseBlobs(ctx context.Context, hashes []string) {
+	for _, hash := range hashes {
+		if err := re.releaseBlob(ctx, hash); err != nil {
+			log.Printf("failed to delete blob %s: %s", hash, err)
+		}
+	}
+}
+
+// UploadNoteAttachment attaches a file to a specific note
+func (re *Record) UploadNoteAttachment(w http.ResponseWriter, r *http.Request) {
+	re.uploadAttachment(w, r, TypeNote)
+}
+
+// UploadRecipeAttachment attaches a file to a specific recipe
+func (re *Record) UploadRecipeAttachment(w http.ResponseWriter, r *http.Request) {
+	re.uploadAttachment(w, r, TypeRecipe)
+}
+
+// UploadScriptAttachment attaches a file to a specific script
+func (re *Record) UploadScriptAttachment(w http.ResponseWriter, r *http.Request) {
+	re.uploadAttachment(w, r, TypeScript)
+}
+
+// uploadAttachment attaches the file of a multipart upload, in the form
+// field "file", to a specific record of the given type
+func (re *Record) uploadAttachment(w http.ResponseWriter, r *http.Request, typ string) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	re = re.inWorkspace(r)
+
+	if re.Blobs == nil {
+		http.Error(w, "Attachments are disabled", http.StatusNotImplemented)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "Missing query parameter: 'id'", http.StatusBadRequest)
+		return
+	}
+
+	recordID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid id: '%s'", id), http.StatusBadRequest)
+		return
+	}
+
+	ok, err = re.can(user, typ, recordID, ActionEdit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	// Uploads are limited to the storage left in the workspace
+	if workspace, ok := workspaceFromContext(r.Context()); ok && workspace.Settings.MaxStorage > 0 {
+		used, err := re.storageUsed()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		left := workspace.Settings.MaxStorage - used
+		if left <= 0 {
+			http.Error(w, fmt.Sprintf("%s: at most %d bytes of attachments", errQuotaExceeded, workspace.Settings.MaxStorage), http.StatusForbidden)
+			return
+		}
+		re.Uploads.MaxSize = min(re.Uploads.MaxSize, left)
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, re.Uploads.MaxSize+multipartOverhead)
+	defer r.Body.Close()
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			http.Error(w, "Missing form file: 'file'", http.StatusBadRequest)
+			return
+		}
+
+		if err != nil {
+			writeUploadError(w, err)
+			return
+		}
+
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+
+		u, attachment, err := re.stageUpload(typ, uint(recordID), part.FileName(), part)
+		part.Close()
+		if err != nil {
+			writeUploadError(w, err)
+			return
+		}
+
+		created := u != nil
+		if created {
+			// The file is stored before the transaction, which only holds a
+			// connection for as long as the attachment takes to insert
+			err = re.storeUpload(r.Context(), u)
+			if err == nil {
+				err = re.attachUpload(r, u)
+			}
+			u.Close()
+			if err != nil {
+				re.releaseBlobs(context.WithoutCancel(r.Context()), []string{u.attachment.Hash})
+				writeUploadError(w, err)
+				return
+			}
+			attachment = u.attachment
+		}
+
+		details, err := json.Marshal(attachment)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("content-type", "application/json")
+		if created {
+			w.WriteHeader(http.StatusCreated)
+		}
+		w.Write(details)
+		return
+	}
+}
+
+// writeUploadError writes the status matching an error of an upload
+func writeUploadError(w http.ResponseWriter, err error) {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.Is(err, errUploadTooLarge), errors.As(err, &maxBytesErr):
+		http.Error(w, errUploadTooLarge.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, errUnsupportedFileType):
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+	case errors.Is(err, errInvalidImage):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// ListNoteAttachments lists the attachments of a specific note
+func (re *Record) ListNoteAttachments(w http.ResponseWriter, r *http.Request) {
+	re.listAttachments(w, r, TypeNote)
+}
+
+// ListRecipeAttachments lists the attachments of a specific recipe
+func (re *Record) ListRecipeAttachments(w http.ResponseWriter, r *http.Request) {
+	re.listAttachments(w, r, TypeRecipe)
+}
+
+// ListScriptAttachments lists the attachments of a specific script
+func (re *Record) ListScriptAttachments(w http.ResponseWriter, r *http.Request) {
+	re.listAttachments(w, r, TypeScript)
+}
+
+// listAttachments lists the attachments of a specific record of the given type
+func (re *Record) listAttachments(w http.ResponseWriter, r *http.Request, typ string) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	re = re.inWorkspace(r)
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "Missing query parameter: 'id'", http.StatusBadRequest)
+		return
+	}
+
+	var attachments []Attachment
+	result := re.DB.Where("record_type = ? AND record_id = ? AND record_id IN (?)", typ, id, re.authorizedIDs(user, typ, ActionRead)).Order("id").Find(&attachments)
+	if result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	attachmentsList, err := json.Marshal(attachments)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.Write(attachmentsList)
+}
+
+// GetAttachment downloads the content of a specific attachment
+func (re *Record) GetAttachment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	re = re.inWorkspace(r)
+
+	if re.Blobs == nil {
+		http.Error(w, "Attachments are disabled", http.StatusNotImplemented)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "Missing query parameter: 'id'", http.StatusBadRequest)
+		return
+	}
+
+	var attachment Attachment
+	result := re.DB.Where(filterByID, id).Find(&attachment)
+	if result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	allowed, err := re.can(user, attachment.RecordType, attachment.RecordID, ActionRead)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !allowed {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("content-length", strconv.FormatInt(attachment.Size, 10))
+	re.serveBlob(w, r, blobKey(attachment.Hash), strconv.Quote(attachment.Hash), attachment.ContentType,
+		mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}))
+}
+
+// GetThumbnail downloads a thumbnail of a specific recipe photo
+func (re *Record) GetThumbnail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	re = re.inWorkspace(r)
+
+	if re.Blobs == nil {
+		http.Error(w, "Attachments are disabled", http.StatusNotImplemented)
+		return
+	}
+
+	query := r.URL.Query()
+	id, width := query.Get("id"), query.Get("width")
+	if id == "" || width == "" {
+		http.Error(w, "Missing query parameters: 'id' and 'width'", http.StatusBadRequest)
+		return
+	}
+
+	thumbnailWidth, err := strconv.Atoi(width)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid width: '%s'", width), http.StatusBadRequest)
+		return
+	}
+
+	var attachment Attachment
+	result := re.DB.Where(filterByID, id).Find(&attachment)
+	if result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	if result.RowsAffected == 0 || !slices.Contains(attachment.Thumbnails, thumbnailWidth) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	allowed, err := re.can(user, attachment.RecordType, attachment.RecordID, ActionRead)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !allowed {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	re.serveBlob(w, r, thumbnailKey(attachment.Hash, thumbnailWidth),
+		strconv.Quote(attachment.Hash+"-"+width), attachment.ContentType,
+		mime.FormatMediaType("inline", map[string]string{"filename": attachment.Filename}))
+}
+
+// serveBlob writes the content stored under a key in the blob store, or
+// Not Modified if the client already has the version with the given ETag
+func (re *Record) serveBlob(w http.ResponseWriter, r *http.Request, key, etag, contentType, disposition string) {
+	if r.Header.Get("If-None-Match") == etag {
+		w.Header().Del("content-length")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	content, err := re.Blobs.Get(r.Context(), key)
+	if errors.Is(err, blob.ErrNotFound) {
+		w.Header().Del("content-length")
+		http.Error(w, "Attachment content is missing", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		w.Header().Del("content-length")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer content.Close()
+
+	w.Header().Set("content-type", contentType)
+	w.Header().Set("content-disposition", disposition)
+	w.Header().Set("x-content-type-options", "nosniff")
+	w.Header().Set("etag", etag)
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, content)
+}
+
+// DeleteAttachment deletes a specific attachment
+func (re *Record) DeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	re = re.inWorkspace(r)
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "Missing query parameter: 'id'", http.StatusBadRequest)
+		return
+	}
+
+	var attachment Attachment
+	result := re.DB.Where(filterByID, id).Find(&attachment)
+	if result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	allowed, err := re.can(user, attachment.RecordType, attachment.RecordID, ActionEdit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !allowed {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	err = re.transaction(func(tx *Record) error {
+		if result := tx.DB.Where(filterByID, id).Delete(&Attachment{}); result.Error != nil {
+			return result.Error
+		}
+		return tx.audit(r, AuditDelete, resourceAttachment, attachment.ID, attachment, nil)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	re.releaseBlobs(r.Context(), []string{attachment.Hash})
+
+	w.WriteHeader(http.StatusOK)
+}
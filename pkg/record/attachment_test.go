@@ -0,0 +1,429 @@
+package record
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	mocket "github.com/selvatico/go-mocket"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jvmistica/knowledge-base-go/pkg/blob"
+)
+
+// pngHeader is the signature of a PNG image
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+// uploadRequest returns a multipart upload request of a file
+func uploadRequest(query, filename string, content []byte) *http.Request {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("comment", "ignored")
+	fw, _ := mw.CreateFormFile("file", filename)
+	fw.Write(content)
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/?"+query, &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestDetectContentType(t *testing.T) {
+	assert.Equal(t, "image/png", detectContentType("photo.png", pngHeader))
+	assert.Equal(t, "application/pdf", detectContentType("manual.pdf", []byte("%PDF-1.7\n")))
+	assert.Equal(t, "application/yaml", detectContentType("config.yml", []byte("port: 80\n")))
+	assert.Equal(t, "text/plain", detectContentType("nginx.conf", []byte("server {}\n")))
+	// The extension does not override binary content
+	assert.Equal(t, "application/octet-stream", detectContentType("evil.yaml", []byte{0x00, 0x01, 0x02}))
+}
+
+func TestAttachmentName(t *testing.T) {
+	assert.Equal(t, "photo.png", attachmentName("photo.png"))
+	assert.Equal(t, "passwd", attachmentName("../../etc/passwd"))
+	assert.Equal(t, "report.pdf", attachmentName(`C:\Users\me\report.pdf`))
+	assert.Equal(t, "attachment", attachmentName(""))
+}
+
+func TestUploadAttachment(t *testing.T) {
+	db := setupTestDB()
+	store, err := blob.NewFileStore(t.TempDir())
+	assert.Nil(t, err)
+
+	r := NewRecord(db)
+	r.Blobs = store
+
+	t.Run(errInvalidMethod, func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		r.UploadNoteAttachment(rw, withUser(&http.Request{Method: http.MethodGet}, testUser))
+
+		assert.Equal(t, http.StatusMethodNotAllowed, rw.Code)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		(&Record{DB: db}).UploadNoteAttachment(rw, withUser(uploadRequest("id=1", "a.txt", []byte("hi")), testUser))
+
+		assert.Equal(t, http.StatusNotImplemented, rw.Code)
+	})
+
+	t.Run(errMissingParam, func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		r.UploadNoteAttachment(rw, withUser(uploadRequest("", "a.txt", []byte("hi")), testUser))
+
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+
+	t.Run(errRecordNotFound, func(t *testing.T) {
+		mocket.Catcher.Reset().NewMock().WithQuery(`SELECT count(*) FROM "notes"`).WithReply([]map[string]interface{}{{"count": 0}})
+		rw := httptest.NewRecorder()
+		r.UploadNoteAttachment(rw, withUser(uploadRequest("id=9", "a.txt", []byte("hi")), testUser))
+
+		assert.Equal(t, http.StatusNotFound, rw.Code)
+	})
+
+	t.Run("unsupported type", func(t *testing.T) {
+		mocket.Catcher.Reset().NewMock().WithQuery(`SELECT count(*) FROM "recipes"`).WithReply([]map[string]interface{}{{"count": 1}})
+		rw := httptest.NewRecorder()
+		r.UploadRecipeAttachment(rw, withUser(uploadRequest("id=1", "tool.exe", []byte("MZ\x90\x00\x03\x00\x00\x00")), testUser))
+
+		assert.Equal(t, http.StatusUnsupportedMediaType, rw.Code)
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		mocket.Catcher.Reset().NewMock().WithQuery(`SELECT count(*) FROM "recipes"`).WithReply([]map[string]interface{}{{"count": 1}})
+		small := NewRecord(db)
+		small.Blobs = store
+		small.Uploads.MaxSize = 4
+		rw := httptest.NewRecorder()
+		small.UploadRecipeAttachment(rw, withUser(uploadRequest("id=1", "a.txt", []byte("hello")), testUser))
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rw.Code)
+	})
+
+	t.Run(successOneRecord, func(t *testing.T) {
+		mocket.Catcher.Reset().NewMock().WithQuery(`SELECT count(*) FROM "notes"`).WithReply([]map[string]interface{}{{"count": 1}})
+		content := append(append([]byte{}, pngHeader...), "image data"...)
+		rw := httptest.NewRecorder()
+		r.UploadNoteAttachment(rw, withUser(uploadRequest("id=1", "diagram.png", content), testUser))
+		assert.Equal(t, http.StatusCreated, rw.Code)
+
+		var attachment Attachment
+		assert.Nil(t, json.Unmarshal(rw.Body.Bytes(), &attachment))
+		assert.Equal(t, TypeNote, attachment.RecordType)
+		assert.Equal(t, uint(1), attachment.RecordID)
+		assert.Equal(t, "diagram.png", attachment.Filename)
+		assert.Equal(t, "image/png", attachment.ContentType)
+		assert.Equal(t, int64(len(content)), attachment.Size)
+		assert.Empty(t, attachment.Thumbnails)
+
+		stored, err := store.Get(context.Background(), blobKey(attachment.Hash))
+		assert.Nil(t, err)
+		data, _ := io.ReadAll(stored)
+		stored.Close()
+		assert.Equal(t, content, data)
+	})
+
+	t.Run("recipe photo", func(t *testing.T) {
+		mocket.Catcher.Reset().NewMock().WithQuery(`SELECT count(*) FROM "recipes"`).WithReply([]map[string]interface{}{{"count": 1}})
+		var content bytes.Buffer
+		assert.Nil(t, png.Encode(&content, image.NewRGBA(image.Rect(0, 0, 400, 300))))
+		rw := httptest.NewRecorder()
+		r.UploadRecipeAttachment(rw, withUser(uploadRequest("id=1", "adobo.png", content.Bytes()), testUser))
+		assert.Equal(t, http.StatusCreated, rw.Code)
+
+		var attachment Attachment
+		assert.Nil(t, json.Unmarshal(rw.Body.Bytes(), &attachment))
+		assert.Equal(t, []int{160, 320}, attachment.Thumbnails)
+
+		stored, err := store.Get(context.Background(), thumbnailKey(attachment.Hash, 160))
+		assert.Nil(t, err)
+		thumbnail, err := png.Decode(stored)
+		stored.Close()
+		assert.Nil(t, err)
+		assert.Equal(t, image.Rect(0, 0, 160, 120), thumbnail.Bounds())
+	})
+
+	t.Run("invalid image", func(t *testing.T) {
+		mocket.Catcher.Reset().NewMock().WithQuery(`SELECT count(*) FROM "recipes"`).WithReply([]map[string]interface{}{{"count": 1}})
+		rw := httptest.NewRecorder()
+		r.UploadRecipeAttachment(rw, withUser(uploadRequest("id=1", "adobo.png", pngHeader), testUser))
+
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+
+	t.Run("content released on failure", func(t *testing.T) {
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`SELECT count(*) FROM "notes"`).WithReply([]map[string]interface{}{{"count": 1}})
+		mocket.Catcher.NewMock().WithQuery(`INSERT INTO "attachments"`).WithQueryException()
+		rw := httptest.NewRecorder()
+		r.UploadNoteAttachment(rw, withUser(uploadRequest("id=1", "lost.txt", []byte("lost")), testUser))
+		assert.Equal(t, http.StatusInternalServerError, rw.Code)
+
+		sum := sha256.Sum256([]byte("lost"))
+		ok, err := store.Exists(context.Background(), blobKey(hex.EncodeToString(sum[:])))
+		assert.Nil(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("content released while attached", func(t *testing.T) {
+		content := []byte("released")
+		sum := sha256.Sum256(content)
+		key := blobKey(hex.EncodeToString(sum[:]))
+
+		// A concurrent release deletes the content before the lock is taken
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`SELECT count(*) FROM "notes"`).WithReply([]map[string]interface{}{{"count": 1}})
+		mocket.Catcher.NewMock().WithQuery(`INSERT INTO "blob_locks"`).WithCallback(func(string, []driver.NamedValue) {
+			store.Delete(context.Background(), key)
+		})
+		rw := httptest.NewRecorder()
+		r.UploadNoteAttachment(rw, withUser(uploadRequest("id=1", "released.txt", content), testUser))
+		assert.Equal(t, http.StatusCreated, rw.Code)
+
+		ok, err := store.Exists(context.Background(), key)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("duplicate", func(t *testing.T) {
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`SELECT count(*) FROM "notes"`).WithReply([]map[string]interface{}{{"count": 1}})
+		mocket.Catcher.NewMock().WithQuery(`FROM "attachments"`).WithReply([]map[string]interface{}{
+			{"id": 4, "record_type": TypeNote, "record_id": 2, "filename": "list.txt", "content_type": "text/plain", "size": 5},
+		})
+		rw := httptest.NewRecorder()
+		r.UploadNoteAttachment(rw, withUser(uploadRequest("id=2", "copy.txt", []byte("hello")), testUser))
+		assert.Equal(t, http.StatusOK, rw.Code)
+
+		var attachment Attachment
+		assert.Nil(t, json.Unmarshal(rw.Body.Bytes(), &attachment))
+		assert.Equal(t, uint(4), attachment.ID)
+	})
+}
+
+func TestListAttachments(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db}
+
+	t.Run(errMissingParam, func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		r.ListScriptAttachments(rw, withUser(&http.Request{Method: http.MethodGet, URL: &url.URL{}}, testUser))
+
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+
+	t.Run(successMultRecords, func(t *testing.T) {
+		records := []map[string]interface{}{
+			{"id": 1, "record_type": TypeScript, "record_id": 3, "filename": "nginx.conf"},
+			{"id": 2, "record_type": TypeScript, "record_id": 3, "filename": "manual.pdf"},
+		}
+		mocket.Catcher.Reset().NewMock().WithQuery(`FROM "attachments"`).WithReply(records)
+		rw := httptest.NewRecorder()
+		r.ListScriptAttachments(rw, withUser(&http.Request{Method: http.MethodGet, URL: &url.URL{RawQuery: "id=3"}}, testUser))
+		assert.Equal(t, http.StatusOK, rw.Code)
+
+		var attachments []Attachment
+		assert.Nil(t, json.Unmarshal(rw.Body.Bytes(), &attachments))
+		assert.Len(t, attachments, 2)
+		assert.Equal(t, "manual.pdf", attachments[1].Filename)
+	})
+}
+
+func TestGetAttachment(t *testing.T) {
+	db := setupTestDB()
+	store, err := blob.NewFileStore(t.TempDir())
+	assert.Nil(t, err)
+
+	hash := strings.Repeat("ab", 32)
+	assert.Nil(t, store.Put(context.Background(), blobKey(hash), strings.NewReader("port: 80\n"), 9, ""))
+
+	r := &Record{DB: db, Blobs: store}
+	row := []map[string]interface{}{
+		{"id": 1, "record_type": TypeScript, "record_id": 3, "filename": "app config.yml", "content_type": "application/yaml", "size": 9, "hash": hash},
+	}
+
+	t.Run(errRecordNotFound, func(t *testing.T) {
+		mocket.Catcher.Reset().NewMock().WithQuery(`FROM "attachments"`).WithRowsNum(0)
+		rw := httptest.NewRecorder()
+		r.GetAttachment(rw, withUser(httptest.NewRequest(http.MethodGet, "/?id=5", nil), testUser))
+
+		assert.Equal(t, http.StatusNotFound, rw.Code)
+	})
+
+	t.Run(successRecordFound, func(t *testing.T) {
+		mocket.Catcher.Reset().NewMock().WithQuery(`FROM "attachments"`).WithReply(row)
+		mocket.Catcher.NewMock().WithQuery(`SELECT count(*) FROM "scripts"`).WithReply([]map[string]interface{}{{"count": 1}})
+		rw := httptest.NewRecorder()
+		r.GetAttachment(rw, withUser(httptest.NewRequest(http.MethodGet, "/?id=1", nil), testUser))
+
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, "port: 80\n", rw.Body.String())
+		assert.Equal(t, "application/yaml", rw.Header().Get("content-type"))
+		assert.Equal(t, `attachment; filename="app config.yml"`, rw.Header().Get("content-disposition"))
+		assert.Equal(t, "nosniff", rw.Header().Get("x-content-type-options"))
+	})
+
+	t.Run("not modified", func(t *testing.T) {
+		mocket.Catcher.Reset().NewMock().WithQuery(`FROM "attachments"`).WithReply(row)
+		mocket.Catcher.NewMock().WithQuery(`SELECT count(*) FROM "scripts"`).WithReply([]map[string]interface{}{{"count": 1}})
+		req := httptest.NewRequest(http.MethodGet, "/?id=1", nil)
+		req.Header.Set("If-None-Match", `"`+hash+`"`)
+		rw := httptest.NewRecorder()
+		r.GetAttachment(rw, withUser(req, testUser))
+
+		assert.Equal(t, http.StatusNotModified, rw.Code)
+	})
+}
+
+func TestDeleteAttachment(t *testing.T) {
+	db := setupTestDB()
+	store, err := blob.NewFileStore(t.TempDir())
+	assert.Nil(t, err)
+
+	hash := strings.Repeat("cd", 32)
+	assert.Nil(t, store.Put(context.Background(), blobKey(hash), strings.NewReader("x"), 1, ""))
+
+	r := &Record{DB: db, Blobs: store}
+
+	t.Run(errInvalidMethod, func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		r.DeleteAttachment(rw, withUser(&http.Request{Method: http.MethodGet}, testUser))
+
+		assert.Equal(t, http.StatusMethodNotAllowed, rw.Code)
+	})
+
+	t.Run(errRecordNotFound, func(t *testing.T) {
+		mocket.Catcher.Reset().NewMock().WithQuery(`FROM "attachments"`).WithRowsNum(0)
+		rw := httptest.NewRecorder()
+		r.DeleteAttachment(rw, withUser(httptest.NewRequest(http.MethodDelete, "/?id=5", nil), testUser))
+
+		assert.Equal(t, http.StatusNotFound, rw.Code)
+	})
+
+	t.Run("content locked before it is counted", func(t *testing.T) {
+		var queries []string
+		record := func(query string, _ []driver.NamedValue) { queries = append(queries, query) }
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`INSERT INTO "blob_locks"`).WithCallback(record)
+		mocket.Catcher.NewMock().WithQuery(`SELECT count(*) FROM "attachments"`).WithCallback(record).WithReply([]map[string]interface{}{{"count": 1}})
+		assert.Nil(t, r.releaseBlob(context.Background(), hash))
+
+		assert.Len(t, queries, 2)
+		assert.Contains(t, queries[0], `ON CONFLICT ("hash") DO UPDATE`)
+		assert.Contains(t, queries[1], `WHERE hash = $1`)
+	})
+
+	t.Run("shared content is kept", func(t *testing.T) {
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`SELECT count(*) FROM "attachments"`).WithReply([]map[string]interface{}{{"count": 1}})
+		mocket.Catcher.NewMock().WithQuery(`SELECT * FROM "attachments"`).WithReply([]map[string]interface{}{{"id": 1, "record_type": TypeNote, "record_id": 2, "hash": hash}})
+		mocket.Catcher.NewMock().WithQuery(`SELECT count(*) FROM "notes"`).WithReply([]map[string]interface{}{{"count": 1}})
+		rw := httptest.NewRecorder()
+		r.DeleteAttachment(rw, withUser(httptest.NewRequest(http.MethodDelete, "/?id=1", nil), testUser))
+		assert.Equal(t, http.StatusOK, rw.Code)
+
+		ok, _ := store.Exists(context.Background(), blobKey(hash))
+		assert.True(t, ok)
+	})
+
+	t.Run(successRecordDeleted, func(t *testing.T) {
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`SELECT count(*) FROM "attachments"`).WithReply([]map[string]interface{}{{"count": 0}})
+		mocket.Catcher.NewMock().WithQuery(`SELECT * FROM "attachments"`).WithReply([]map[string]interface{}{{"id": 1, "record_type": TypeNote, "record_id": 2, "hash": hash}})
+		mocket.Catcher.NewMock().WithQuery(`SELECT count(*) FROM "notes"`).WithReply([]map[string]interface{}{{"count": 1}})
+		rw := httptest.NewRecorder()
+		r.DeleteAttachment(rw, withUser(httptest.NewRequest(http.MethodDelete, "/?id=1", nil), testUser))
+		assert.Equal(t, http.StatusOK, rw.Code)
+
+		ok, _ := store.Exists(context.Background(), blobKey(hash))
+		assert.False(t, ok)
+	})
+}
+
+func TestGetThumbnail(t *testing.T) {
+	db := setupTestDB()
+	store, err := blob.NewFileStore(t.TempDir())
+	assert.Nil(t, err)
+
+	hash := strings.Repeat("ef", 32)
+	assert.Nil(t, store.Put(context.Background(), thumbnailKey(hash, 160), strings.NewReader("thumbnail"), 9, ""))
+
+	r := &Record{DB: db, Blobs: store}
+	row := []map[string]interface{}{
+		{"id": 1, "record_type": TypeRecipe, "record_id": 3, "filename": "adobo.jpg", "content_type": "image/jpeg", "hash": hash, "thumbnails": "[160]"},
+	}
+
+	t.Run(errMissingParam, func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		r.GetThumbnail(rw, withUser(httptest.NewRequest(http.MethodGet, "/?id=1", nil), testUser))
+
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+
+	t.Run(errRecordNotFound, func(t *testing.T) {
+		mocket.Catcher.Reset().NewMock().WithQuery(`FROM "attachments"`).WithReply(row)
+		rw := httptest.NewRecorder()
+		r.GetThumbnail(rw, withUser(httptest.NewRequest(http.MethodGet, "/?id=1&width=640", nil), testUser))
+
+		assert.Equal(t, http.StatusNotFound, rw.Code)
+	})
+
+	t.Run(successRecordFound, func(t *testing.T) {
+		mocket.Catcher.Reset().NewMock().WithQuery(`FROM "attachments"`).WithReply(row)
+		mocket.Catcher.NewMock().WithQuery(`SELECT count(*) FROM "recipes"`).WithReply([]map[string]interface{}{{"count": 1}})
+		rw := httptest.NewRecorder()
+		r.GetThumbnail(rw, withUser(httptest.NewRequest(http.MethodGet, "/?id=1&width=160", nil), testUser))
+
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, "thumbnail", rw.Body.String())
+		assert.Equal(t, "image/jpeg", rw.Header().Get("content-type"))
+	})
+}
+
+func TestRecipePhotos(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db, Blobs: &blob.FileStore{}}
+
+	mocket.Catcher.Reset()
+	mocket.Catcher.NewMock().WithQuery(`FROM "recipes"`).WithReply([]map[string]interface{}{{"id": 3, "name": "Adobo"}})
+	mocket.Catcher.NewMock().WithQuery(`FROM "attachments"`).WithReply([]map[string]interface{}{
+		{"id": 7, "record_type": TypeRecipe, "record_id": 3, "filename": "adobo.jpg", "thumbnails": "[160,320]"},
+	})
+
+	rw := httptest.NewRecorder()
+	r.GetRecipe(rw, withUser(httptest.NewRequest(http.MethodGet, "/?id=3", nil), testUser))
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	var recipe Recipe
+	assert.Nil(t, json.Unmarshal(rw.Body.Bytes(), &recipe))
+	assert.Equal(t, []Photo{{
+		ID:       7,
+		Filename: "adobo.jpg",
+		URL:      "/api/v1/attachments?id=7",
+		Thumbnails: []Thumbnail{
+			{Width: 160, URL: "/api/v1/attachments/thumbnail?id=7&width=160"},
+			{Width: 320, URL: "/api/v1/attachments/thumbnail?id=7&width=320"},
+		},
+	}}, recipe.Photos)
+
+	rw = httptest.NewRecorder()
+	r.ListRecipes(rw, withUser(httptest.NewRequest(http.MethodGet, "/", nil), testUser))
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	var recipes []Recipe
+	assert.Nil(t, json.Unmarshal(rw.Body.Bytes(), &recipes))
+	assert.Len(t, recipes, 1)
+	assert.Len(t, recipes[0].Photos, 1)
+}
@@ -0,0 +1,382 @@
+package record
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Actions of an audit event
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+)
+
+// Resource types of the audit events of mutations other than those of records
+const (
+	resourceAttachment = "attachment"
+	resourceRelation   = "relation"
+	resourceSecret     = "secret"
+	resourceShare      = "share"
+)
+
+const (
+	requestIDHeader      = "X-Request-ID"
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 500
+	auditExportBatch     = 500
+)
+
+// validRequestID matches the request IDs accepted from clients
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// auditFilters are the query parameters audit events can be filtered by and their columns
+var auditFilters = []struct{ param, column string }{
+	{"actor_id", "actor_id"},
+	{"action", "action"},
+	{"type", "resource_type"},
+	{"id", "resource_id"},
+	{"request_id", "request_id"},
+}
+
+// ignoredFields are left out of the changes of an audit event
+var ignoredFields = []string{"updated_at"}
+
+// redactedFields are the encryptable fields whose values are never kept in
+// an audit event, only that they changed
+var redactedFields = []string{"content", "body"}
+
+// errAppendOnly is returned when an audit event would be changed or deleted
+var errAppendOnly = errors.New("audit events are append-only")
+
+// errNotFound rolls back a transaction whose resource does not exist or
+// cannot be changed by the user
+var errNotFound = errors.New("not found")
+
+// Change is the value of a field before and after a mutation
+type Change struct {
+	Before any `json:"before,omitempty"`
+	After  any `json:"after,omitempty"`
+}
+
+// AuditEvent is the structure of the audit_events table, one append-only
+// row per mutation of a resource
+type AuditEvent struct {
+	ID           uint              `json:"id"`
+	WorkspaceID  uint              `json:"workspace_id" gorm:"index;not null;default:0"`
+	ActorID      uint              `json:"actor_id" gorm:"index"`
+	Actor        string            `json:"actor"`
+	APIKeyID     *uint             `json:"api_key_id,omitempty"`
+	Action       string            `json:"action" gorm:"index"`
+	ResourceType string            `json:"resource_type" gorm:"index:idx_audit_events_resource"`
+	ResourceID   uint              `json:"resource_id" gorm:"index:idx_audit_events_resource"`
+	Changes      map[string]Change `json:"changes" gorm:"serializer:json"`
+	ClientIP     string            `json:"client_ip"`
+	RequestID    string            `json:"request_id" gorm:"index"`
+	CreatedAt    time.Time         `json:"created_at" gorm:"index"`
+}
+
+// BeforeUpdate keeps audit events from being changed
+func (*AuditEvent) BeforeUpdate(*gorm.DB) error {
+	return errAppendOnly
+}
+
+// BeforeDelete keeps audit events from being deleted
+func (*AuditEvent) BeforeDelete(*gorm.DB) error {
+	return errAppendOnly
+}
+
+// RequestID adds an ID to the context of every request, taken from the
+// X-Request-ID header or generated, and returns it with the response
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID.MatchString(id) {
+			b := make([]byte, 16)
+			rand.Read(b)
+			id = hex.EncodeToString(b)
+		}
+
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey, id)))
+	})
+}
+
+// RequestIDFromContext returns the ID of a request
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// clientIP returns the address of the client of a request. The
+// X-Forwarded-For header is only trusted behind a proxy.
+func (re *Record) clientIP(r *http.Request) string {
+	if re.TrustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			ip, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(ip)
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// redact returns the change with its values replaced by a placeholder
+func (c Change) redact() Change {
+	if c.Before != nil {
+		c.Before = redacted
+	}
+	if c.After != nil {
+		c.After = redacted
+	}
+
+	return c
+}
+
+// fields returns the JSON fields of a resource, or none for nil
+func fields(v any) (map[string]any, error) {
+	m := map[string]any{}
+	if v == nil {
+		return m, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, json.Unmarshal(data, &m)
+}
+
+// diff returns the fields that differ between two versions of a resource.
+// Either version is nil for a creation or a deletion.
+func diff(before, after any) (map[string]Change, error) {
+	b, err := fields(before)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := fields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]Change{}
+	for k, v := range b {
+		if w, ok := a[k]; !ok || !reflect.DeepEqual(v, w) {
+			changes[k] = Change{Before: v, After: a[k]}
+		}
+	}
+
+	for k, w := range a {
+		if _, ok := b[k]; !ok {
+			changes[k] = Change{After: w}
+		}
+	}
+
+	for _, k := range ignoredFields {
+		delete(changes, k)
+	}
+
+	for _, k := range redactedFields {
+		if c, ok := changes[k]; ok {
+			changes[k] = c.redact()
+		}
+	}
+
+	return changes, nil
+}
+
+// transaction runs fn with a copy of the record whose queries all run in a
+// single transaction, for a mutation to be committed with its audit event
+func (re *Record) transaction(fn func(tx *Record) error) error {
+	return re.DB.Transaction(func(db *gorm.DB) error {
+		tx := *re
+		tx.DB = db
+		return fn(&tx)
+	})
+}
+
+// writeTransactionError writes the status matching the error of a transaction
+func writeTransactionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errNotFound):
+		w.WriteHeader(http.StatusNotFound)
+	case errors.Is(err, errEncryptionDisabled):
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// audit records the mutation of a resource by the authenticated user of a
+// request, in the transaction of the mutation
+func (re *Record) audit(r *http.Request, action, typ string, id uint, before, after any) error {
+	changes, err := diff(before, after)
+	if err != nil {
+		return err
+	}
+
+	event := AuditEvent{
+		Action:       action,
+		ResourceType: typ,
+		ResourceID:   id,
+		Changes:      changes,
+		ClientIP:     re.clientIP(r),
+		RequestID:    RequestIDFromContext(r.Context()),
+	}
+
+	if user, ok := UserFromContext(r.Context()); ok {
+		event.ActorID, event.Actor = user.ID, user.Username
+	}
+
+	if key, ok := apiKeyFromContext(r.Context()); ok {
+		event.APIKeyID = &key.ID
+	}
+
+	return re.DB.Create(&event).Error
+}
+
+// auditFilter limits a query on audit events to the ones matching the
+// query parameters of a request that a user can see: their own and the
+// ones of the records they can read
+func (re *Record) auditFilter(r *http.Request, user *User) (func(*gorm.DB) *gorm.DB, error) {
+	query := r.URL.Query()
+
+	var times [2]time.Time
+	for i, param := range []string{"since", "until"} {
+		if v := query.Get(param); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid %s: '%s', must be an RFC 3339 time", param, v)
+			}
+			times[i] = t
+		}
+	}
+
+	return func(db *gorm.DB) *gorm.DB {
+		db = db.Where(re.DB.Session(&gorm.Session{NewDB: true}).Where("actor_id = ?", user.ID).
+			Or(re.readableRecords(user, "resource_type", "resource_id")))
+
+		for _, f := range auditFilters {
+			if v := query.Get(f.param); v != "" {
+				db = db.Where(f.column+" = ?", v)
+			}
+		}
+
+		if !times[0].IsZero() {
+			db = db.Where("created_at >= ?", times[0])
+		}
+
+		if !times[1].IsZero() {
+			db = db.Where("created_at < ?", times[1])
+		}
+
+		return db
+	}, nil
+}
+
+// ListAuditEvents lists the audit events the authenticated user can see,
+// most recent first, filtered by actor_id, action, type, id, request_id,
+// since and until, and paginated with page and per_page. The total number
+// of matching events is returned in the X-Total-Count header.
+func (re *Record) ListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	re = re.inWorkspace(r)
+
+	filter, err := re.auditFilter(r, user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, perPage, err := parsePage(r, defaultAuditPageSize, maxAuditPageSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var total int64
+	if result := re.DB.Model(&AuditEvent{}).Scopes(filter).Count(&total); result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	events := []AuditEvent{}
+	result := re.DB.Scopes(filter).Order("id desc").Limit(perPage).Offset((page - 1) * perPage).Find(&events)
+	if result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+	writeJSON(w, http.StatusOK, events)
+}
+
+// ExportAuditEvents exports the audit events the authenticated user can
+// see as JSON Lines, oldest first, with the same filters as ListAuditEvents
+func (re *Record) ExportAuditEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	re = re.inWorkspace(r)
+
+	filter, err := re.auditFilter(r, user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("content-type", "application/x-ndjson")
+	w.Header().Set("content-disposition", `attachment; filename="audit.jsonl"`)
+
+	enc := json.NewEncoder(w)
+	var batch []AuditEvent
+	result := re.DB.Scopes(filter).Order("id").FindInBatches(&batch, auditExportBatch, func(*gorm.DB, int) error {
+		for _, event := range batch {
+			if err := enc.Encode(event); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	// Errors after the first event cannot change the status anymore
+	if result.Error != nil && result.RowsAffected == 0 {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,197 @@
+package record
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	mocket "github.com/selvatico/go-mocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	before := Note{ID: 1, Title: "Runbook", Content: "old"}
+	after := Note{ID: 1, Title: "Runbook v2", Content: "new"}
+	after.UpdatedAt = before.UpdatedAt.Add(1)
+
+	t.Run("create", func(t *testing.T) {
+		changes, err := diff(nil, before)
+		assert.Nil(t, err)
+		assert.Equal(t, Change{After: "Runbook"}, changes["title"])
+	})
+
+	t.Run("update", func(t *testing.T) {
+		changes, err := diff(before, after)
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]Change{
+			"title":   {Before: "Runbook", After: "Runbook v2"},
+			"content": {Before: redacted, After: redacted},
+		}, changes)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		changes, err := diff(before, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, Change{Before: redacted}, changes["content"])
+		assert.NotContains(t, changes, "updated_at")
+	})
+}
+
+func TestRequestID(t *testing.T) {
+	var got string
+	handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = RequestIDFromContext(r.Context())
+	}))
+
+	t.Run("generated", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		assert.Len(t, got, 32)
+		assert.Equal(t, got, rw.Header().Get(requestIDHeader))
+	})
+
+	t.Run("from the client", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(requestIDHeader, "abc-123")
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+
+		assert.Equal(t, "abc-123", got)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(requestIDHeader, "abc\n123")
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+
+		assert.NotEqual(t, "abc\n123", got)
+		assert.Len(t, got, 32)
+	})
+}
+
+func TestClientIP(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:51234"
+	req.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.1")
+
+	assert.Equal(t, "10.0.0.1", (&Record{}).clientIP(req))
+	assert.Equal(t, "203.0.113.7", (&Record{TrustProxy: true}).clientIP(req))
+}
+
+func TestAuditEventAppendOnly(t *testing.T) {
+	db := setupTestDB()
+
+	assert.ErrorIs(t, db.Model(&AuditEvent{ID: 1}).Update("action", AuditDelete).Error, errAppendOnly)
+	assert.ErrorIs(t, db.Delete(&AuditEvent{ID: 1}).Error, errAppendOnly)
+}
+
+func TestAuditMutation(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db}
+
+	var values []driver.Value
+	mocket.Catcher.Reset().NewMock().WithQuery(`INSERT INTO "audit_events"`).WithCallback(func(_ string, args []driver.NamedValue) {
+		for _, a := range args {
+			values = append(values, a.Value)
+		}
+	})
+
+	req := withUser(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"title": "Runbook"}`)), testUser)
+	rw := httptest.NewRecorder()
+	RequestID(http.HandlerFunc(r.CreateNote)).ServeHTTP(rw, req)
+
+	assert.Equal(t, http.StatusCreated, rw.Code)
+	assert.Contains(t, values, testUser.Username)
+	assert.Contains(t, values, AuditCreate)
+	assert.Contains(t, values, TypeNote)
+	assert.Contains(t, values, rw.Header().Get(requestIDHeader))
+	assert.Contains(t, values, "192.0.2.1")
+}
+
+func TestAuditRollback(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db}
+
+	var committed, rolledBack bool
+	mocket.HookBadCommit = func() bool { committed = true; return false }
+	mocket.HookBadRollback = func() bool { rolledBack = true; return false }
+	defer func() { mocket.HookBadCommit, mocket.HookBadRollback = nil, nil }()
+
+	// The note is not created without its audit event
+	mocket.Catcher.Reset().NewMock().WithQuery(`INSERT INTO "audit_events"`).WithQueryException()
+	rw := httptest.NewRecorder()
+	r.CreateNote(rw, withUser(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"title": "Runbook"}`)), testUser))
+
+	assert.Equal(t, http.StatusInternalServerError, rw.Code)
+	assert.True(t, rolledBack)
+	assert.False(t, committed)
+}
+
+func TestListAuditEvents(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db}
+
+	t.Run(errInvalidMethod, func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		r.ListAuditEvents(rw, withUser(httptest.NewRequest(http.MethodPost, "/", nil), testUser))
+
+		assert.Equal(t, http.StatusMethodNotAllowed, rw.Code)
+	})
+
+	for _, query := range []string{"since=yesterday", "page=0", "per_page=1000"} {
+		t.Run("invalid "+query, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			r.ListAuditEvents(rw, withUser(httptest.NewRequest(http.MethodGet, "/?"+query, nil), testUser))
+
+			assert.Equal(t, http.StatusBadRequest, rw.Code)
+		})
+	}
+
+	t.Run(successMultRecords, func(t *testing.T) {
+		var query string
+		var args []driver.NamedValue
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`SELECT count(*) FROM "audit_events"`).WithReply([]map[string]interface{}{{"count": 12}})
+		mocket.Catcher.NewMock().WithQuery(`SELECT * FROM "audit_events"`).WithCallback(func(q string, a []driver.NamedValue) {
+			query, args = q, a
+		}).WithReply([]map[string]interface{}{
+			{"id": 12, "actor_id": 1, "actor": "tester", "action": "update", "resource_type": "note", "resource_id": 3},
+			{"id": 11, "actor_id": 1, "actor": "tester", "action": "create", "resource_type": "note", "resource_id": 3},
+		})
+		rw := httptest.NewRecorder()
+		r.ListAuditEvents(rw, withUser(httptest.NewRequest(http.MethodGet, "/?type=note&id=3&page=2&per_page=10", nil), testUser))
+
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, "12", rw.Header().Get("X-Total-Count"))
+		assert.Contains(t, rw.Body.String(), `"action":"update"`)
+		assert.Contains(t, query, "resource_type = $")
+		assert.Contains(t, query, "ORDER BY id desc LIMIT")
+		if assert.GreaterOrEqual(t, len(args), 2) {
+			assert.Equal(t, int64(10), args[len(args)-2].Value)
+			assert.Equal(t, int64(10), args[len(args)-1].Value)
+		}
+	})
+}
+
+func TestExportAuditEvents(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db}
+
+	mocket.Catcher.Reset().NewMock().WithQuery(`SELECT * FROM "audit_events"`).WithReply([]map[string]interface{}{
+		{"id": 1, "actor_id": 1, "action": "create", "resource_type": "note", "resource_id": 3},
+		{"id": 2, "actor_id": 1, "action": "delete", "resource_type": "note", "resource_id": 3},
+	}).OneTime()
+	rw := httptest.NewRecorder()
+	r.ExportAuditEvents(rw, withUser(httptest.NewRequest(http.MethodGet, "/", nil), testUser))
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "application/x-ndjson", rw.Header().Get("content-type"))
+
+	lines := strings.Split(strings.TrimSpace(rw.Body.String()), "\n")
+	assert.Len(t, lines, 2)
+	assert.Contains(t, lines[1], `"action":"delete"`)
+}
@@ -0,0 +1,152 @@
+package record
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// contextKey is the type of the keys of the values stored in a request context
+type contextKey int
+
+const (
+	userKey contextKey = iota
+	sessionKey
+	apiKeyKey
+	requestIDKey
+	workspaceKey
+)
+
+// newToken returns a random token with the given prefix
+func newToken(prefix string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return prefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the hash a token is stored as
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// bearerToken returns the bearer token of the Authorization header of a request
+func bearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+
+	return strings.TrimSpace(token)
+}
+
+// UserFromContext returns the authenticated user of a request context
+func UserFromContext(ctx context.Context) (*User, bool) {
+	user, ok := ctx.Value(userKey).(*User)
+	return user, ok
+}
+
+// apiKeyFromContext returns the API key a request was authenticated with
+func apiKeyFromContext(ctx context.Context) (*APIKey, bool) {
+	key, ok := ctx.Value(apiKeyKey).(*APIKey)
+	return key, ok
+}
+
+// sessionFromContext returns the session of a request context
+func sessionFromContext(ctx context.Context) (*Session, bool) {
+	session, ok := ctx.Value(sessionKey).(*Session)
+	return session, ok
+}
+
+// unauthorized writes an Unauthorized response with a bearer challenge
+func unauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("www-authenticate", `Bearer realm="knowledge-base"`)
+	http.Error(w, message, http.StatusUnauthorized)
+}
+
+// Authenticate rejects the requests without a valid bearer token, either
+// a session token or an API key, and adds the authenticated user to the
+// context of the others. API keys are only accepted on the routes their
+// scopes cover.
+func (re *Record) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+		if token == "" {
+			unauthorized(w, "Missing bearer token")
+			return
+		}
+
+		var userID uint
+		ctx := r.Context()
+		if strings.HasPrefix(token, apiKeyPrefix) {
+			key, err := re.findAPIKey(token)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			if key == nil {
+				unauthorized(w, "Invalid, expired or revoked API key")
+				return
+			}
+
+			scope := requiredScope(r)
+			if scope == "" {
+				http.Error(w, "API keys cannot be used on this route", http.StatusForbidden)
+				return
+			}
+
+			if !key.allows(scope) {
+				http.Error(w, fmt.Sprintf("Insufficient scope: '%s' is required", scope), http.StatusForbidden)
+				return
+			}
+
+			if err := re.touchAPIKey(key); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			userID = key.UserID
+			ctx = context.WithValue(ctx, apiKeyKey, key)
+		} else {
+			var session Session
+			result := re.DB.Where("token_hash = ? AND expires_at > ?", hashToken(token), time.Now()).Limit(1).Find(&session)
+			if result.Error != nil {
+				http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+				return
+			}
+
+			if result.RowsAffected == 0 {
+				unauthorized(w, "Invalid or expired token")
+				return
+			}
+
+			userID = session.UserID
+			ctx = context.WithValue(ctx, sessionKey, &session)
+		}
+
+		var user User
+		result := re.DB.Where(filterByID, userID).Find(&user)
+		if result.Error != nil {
+			http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+			return
+		}
+
+		if result.RowsAffected == 0 {
+			unauthorized(w, "Invalid or expired token")
+			return
+		}
+
+		ctx = context.WithValue(ctx, userKey, &user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
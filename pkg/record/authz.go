@@ -0,0 +1,157 @@
+package record
+
+import (
+	"slices"
+
+	"gorm.io/gorm"
+)
+
+// Actions on a record
+const (
+	ActionRead   = "read"
+	ActionEdit   = "edit"
+	ActionManage = "manage"
+)
+
+// Roles of a team member. Viewers can read the records of their teammates
+// visible to the team, editors can also edit them and admins can also
+// delete and share them and manage the members of the team.
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+)
+
+// roles are the supported roles, from the least to the most privileged
+var roles = []string{RoleViewer, RoleEditor, RoleAdmin}
+
+// rolesFor returns the team roles allowed to perform an action
+func rolesFor(action string) []string {
+	switch action {
+	case ActionRead:
+		return roles
+	case ActionEdit:
+		return []string{RoleEditor, RoleAdmin}
+	default:
+		return []string{RoleAdmin}
+	}
+}
+
+// levelsFor returns the share levels allowing an action. Managing a record
+// is never shared.
+func levelsFor(action string) []string {
+	switch action {
+	case ActionRead:
+		return accessLevels
+	case ActionEdit:
+		return []string{AccessEdit}
+	default:
+		return nil
+	}
+}
+
+// memberTeams is the subquery of the teams a user is a member of, with one
+// of the given roles if any
+func (re *Record) memberTeams(user *User, roles ...string) *gorm.DB {
+	query := re.DB.Session(&gorm.Session{NewDB: true}).Model(&TeamMember{}).Select("team_id").Where("user_id = ?", user.ID)
+	if len(roles) > 0 {
+		query = query.Where("role IN ?", roles)
+	}
+
+	return query
+}
+
+// teammates is the subquery of the users sharing a team in which a user has one of the given roles
+func (re *Record) teammates(user *User, roles ...string) *gorm.DB {
+	return re.DB.Session(&gorm.Session{NewDB: true}).Model(&TeamMember{}).Select("user_id").
+		Where("team_id IN (?)", re.memberTeams(user, roles...))
+}
+
+// adminWorkspaces is the subquery of the workspaces a user is an admin of
+func (re *Record) adminWorkspaces(user *User) *gorm.DB {
+	return re.DB.Session(&gorm.Session{NewDB: true}).Model(&WorkspaceMember{}).Select("workspace_id").
+		Where("user_id = ? AND role = ?", user.ID, WorkspaceRoleAdmin)
+}
+
+// sharedWith is the subquery of the records of a type shared with a user,
+// directly or through a team, allowing an action
+func (re *Record) sharedWith(user *User, typ, action string) *gorm.DB {
+	return re.DB.Session(&gorm.Session{NewDB: true}).Model(&Share{}).Select("record_id").
+		Where("record_type = ? AND level IN ? AND (user_id = ? OR team_id IN (?))",
+			typ, levelsFor(action), user.ID, re.memberTeams(user, rolesFor(action)...))
+}
+
+// authorize limits a query on the table of a record type to the records a
+// user is allowed to perform an action on. It is the single place where
+// ownership, visibility, shares and team roles are combined:
+//   - owners can do anything with their records
+//   - records without an owner and public records can be read by everyone
+//   - records without an owner, created before ownership or seeded, can be
+//     edited, deleted and shared by the admins of their workspace
+//   - team records are available to the owner's teammates according to
+//     their role in the team they share
+//   - shared records can be read, or edited at the edit level, by the user
+//     or the members of the team they are shared with, according to their role
+func (re *Record) authorize(user *User, typ, action string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		cond := re.DB.Session(&gorm.Session{NewDB: true}).Where("owner_id = ?", user.ID)
+		if action == ActionRead {
+			cond = cond.Or("owner_id = 0").Or("visibility = ?", VisibilityPublic)
+		} else {
+			cond = cond.Or("owner_id = 0 AND workspace_id IN (?)", re.adminWorkspaces(user))
+		}
+
+		cond = cond.Or("visibility = ? AND owner_id IN (?)", VisibilityTeam, re.teammates(user, rolesFor(action)...))
+		if len(levelsFor(action)) > 0 {
+			cond = cond.Or("id IN (?)", re.sharedWith(user, typ, action))
+		}
+
+		return db.Where(cond)
+	}
+}
+
+// authorizedIDs is the subquery of the IDs of the records of a type a user
+// is allowed to perform an action on
+func (re *Record) authorizedIDs(user *User, typ, action string) *gorm.DB {
+	return re.DB.Session(&gorm.Session{NewDB: true}).Table(recordTables[typ].table).Select("id").
+		Scopes(re.authorize(user, typ, action))
+}
+
+// can reports whether a specific record exists and a user is allowed to perform an action on it
+func (re *Record) can(user *User, typ string, id any, action string) (bool, error) {
+	t, ok := recordTables[typ]
+	if !ok {
+		return false, nil
+	}
+
+	var count int64
+	result := re.DB.Table(t.table).Scopes(re.authorize(user, typ, action)).Where(filterByID, id).Count(&count)
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return count > 0, nil
+}
+
+// validRole reports whether a role is supported
+func validRole(role string) bool {
+	return slices.Contains(roles, role)
+}
+
+// readableRecords is the condition matching the rows of a table whose
+// record, given by a type and an ID column, a user can read
+func (re *Record) readableRecords(user *User, typeColumn, idColumn string) *gorm.DB {
+	cond := re.DB.Session(&gorm.Session{NewDB: true})
+	for _, typ := range recordTypes {
+		cond = cond.Or(typeColumn+" = ? AND "+idColumn+" IN (?)", typ, re.authorizedIDs(user, typ, ActionRead))
+	}
+
+	return cond
+}
+
+// readableSources limits a query on links to the ones found in records a user can read
+func (re *Record) readableSources(user *User) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(re.readableRecords(user, "source_type", "source_id"))
+	}
+}
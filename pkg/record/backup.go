@@ -0,0 +1,313 @@
+package record
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// backupVersion is the version of the format of the backups
+const backupVersion = 1
+
+// backupBatchSize is the number of rows read or written at a time by backups and restores
+const backupBatchSize = 500
+
+// errNotEmpty is returned when restoring into a table that has rows
+var errNotEmpty = errors.New("is not empty, restore into a new database or replace its rows")
+
+// Models are the models of the tables of the database
+var Models = []any{
+	&Workspace{}, &WorkspaceMember{}, &User{}, &Session{}, &APIKey{}, &Team{}, &TeamMember{},
+	&Note{}, &Recipe{}, &Script{}, &Secret{}, &Execution{}, &IngredientMapping{}, &Link{},
+	&Relation{}, &Attachment{}, &Share{}, &AuditEvent{}, &BlobLock{},
+}
+
+// SchemaVersion is the version of the schema of the tables, incremented
+// with the changes of the models
+const SchemaVersion = 3
+
+// SchemaMigration is the structure of the schema_migrations table, one row
+// per version of the schema migrated to
+type SchemaMigration struct {
+	Version    int       `gorm:"primaryKey;autoIncrement:false" json:"version"`
+	MigratedAt time.Time `json:"migrated_at"`
+}
+
+// Migrate creates or updates the tables of the database, moves the records
+// without a workspace to the default workspace, and records the version of
+// the schema
+func Migrate(db *gorm.DB) error {
+	if err := db.AutoMigrate(append(Models, &SchemaMigration{})...); err != nil {
+		return err
+	}
+
+	// Ingredient mappings are unique per workspace since version 2
+	if m := db.Migrator(); m.HasIndex(&IngredientMapping{}, "idx_ingredient_mappings_ingredient") {
+		if err := m.DropIndex(&IngredientMapping{}, "idx_ingredient_mappings_ingredient"); err != nil {
+			return err
+		}
+	}
+
+	if _, err := EnsureDefaultWorkspace(db); err != nil {
+		return err
+	}
+
+	migration := SchemaMigration{Version: SchemaVersion, MigratedAt: time.Now()}
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&migration).Error
+}
+
+// CheckSchema returns an error unless the database is migrated to the
+// version of the schema of the models
+func CheckSchema(db *gorm.DB) error {
+	var version int
+	if result := db.Model(&SchemaMigration{}).Select("COALESCE(MAX(version), 0)").Scan(&version); result.Error != nil {
+		return result.Error
+	}
+
+	switch {
+	case version < SchemaVersion:
+		return fmt.Errorf("database schema is at version %d, migrate it to version %d", version, SchemaVersion)
+	case version > SchemaVersion:
+		return fmt.Errorf("database schema is at version %d, newer than version %d of this server", version, SchemaVersion)
+	}
+
+	return nil
+}
+
+// backupTable is a table of a backup with the columns of its primary key
+type backupTable struct {
+	name        string
+	primaryKeys []string
+}
+
+// backupTables returns the tables of the models, but the sessions since
+// their tokens are better renewed by a login than restored
+func backupTables(db *gorm.DB) ([]backupTable, error) {
+	var tables []backupTable
+	for _, model := range Models {
+		if _, ok := model.(*Session); ok {
+			continue
+		}
+
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return nil, err
+		}
+
+		tables = append(tables, backupTable{name: stmt.Schema.Table, primaryKeys: stmt.Schema.PrimaryFieldDBNames})
+	}
+
+	return tables, nil
+}
+
+// Backup writes the rows of all the tables as a JSON document, from a
+// consistent snapshot of the database, and returns the number of rows written
+func Backup(db *gorm.DB, w io.Writer) (int, error) {
+	count := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		count, err = backup(tx, w)
+		return err
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+
+	return count, err
+}
+
+// backup writes the rows of all the tables as a JSON document
+func backup(tx *gorm.DB, w io.Writer) (int, error) {
+	tables, err := backupTables(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := fmt.Fprintf(w, `{"version":%d,"created_at":%q,"tables":{`, backupVersion, time.Now().UTC().Format(time.RFC3339)); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i, table := range tables {
+		if i > 0 {
+			io.WriteString(w, ",")
+		}
+		if _, err := fmt.Fprintf(w, "\n%q:[", table.name); err != nil {
+			return count, err
+		}
+
+		for offset := 0; ; offset += backupBatchSize {
+			rows, err := scanRows(tx.Table(table.name).Order(strings.Join(table.primaryKeys, ", ")).
+				Limit(backupBatchSize).Offset(offset))
+			if err != nil {
+				return count, err
+			}
+
+			for j, row := range rows {
+				line, err := json.Marshal(row)
+				if err != nil {
+					return count, err
+				}
+
+				if offset+j > 0 {
+					io.WriteString(w, ",")
+				}
+				if _, err := fmt.Fprintf(w, "\n%s", line); err != nil {
+					return count, err
+				}
+			}
+			count += len(rows)
+
+			if len(rows) < backupBatchSize {
+				break
+			}
+		}
+
+		io.WriteString(w, "]")
+	}
+
+	_, err = io.WriteString(w, "}}\n")
+	return count, err
+}
+
+// scanRows returns the rows of a query as maps of their columns
+func scanRows(query *gorm.DB) ([]map[string]any, error) {
+	rows, err := query.Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []map[string]any
+	for rows.Next() {
+		values := make([]any, len(columns))
+		pointers := make([]any, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+
+		row := make(map[string]any, len(columns))
+		for i, column := range columns {
+			// Text may be scanned as bytes, which JSON would encode in base64
+			if b, ok := values[i].([]byte); ok {
+				values[i] = string(b)
+			}
+			row[column] = values[i]
+		}
+		result = append(result, row)
+	}
+
+	return result, rows.Err()
+}
+
+// backupDocument is the JSON document of a backup
+type backupDocument struct {
+	Version   int                         `json:"version"`
+	CreatedAt time.Time                   `json:"created_at"`
+	Tables    map[string][]map[string]any `json:"tables"`
+}
+
+// Restore inserts the rows of a backup in a single transaction, and returns
+// the number of rows inserted. The tables must be empty, unless replace is
+// set to delete their rows first.
+func Restore(db *gorm.DB, r io.Reader, replace bool) (int, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	var doc backupDocument
+	if err := dec.Decode(&doc); err != nil {
+		return 0, fmt.Errorf("invalid backup: %w", err)
+	}
+
+	if doc.Version != backupVersion {
+		return 0, fmt.Errorf("unsupported backup version: %d", doc.Version)
+	}
+
+	// Numbers are passed as written, for the database to parse them into
+	// the type of their column without rounding large IDs
+	for _, rows := range doc.Tables {
+		for _, row := range rows {
+			for column, value := range row {
+				if n, ok := value.(json.Number); ok {
+					row[column] = n.String()
+				}
+			}
+		}
+	}
+
+	tables, err := backupTables(db)
+	if err != nil {
+		return 0, err
+	}
+
+	for name := range doc.Tables {
+		known := false
+		for _, table := range tables {
+			known = known || table.name == name
+		}
+		if !known {
+			return 0, fmt.Errorf("unknown table in backup: '%s'", name)
+		}
+	}
+
+	count := 0
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// The sessions of replaced users would outlive them
+		if replace {
+			if result := tx.Exec(`DELETE FROM "sessions"`); result.Error != nil {
+				return result.Error
+			}
+		}
+
+		for _, table := range tables {
+			if replace {
+				if result := tx.Exec(fmt.Sprintf("DELETE FROM %q", table.name)); result.Error != nil {
+					return result.Error
+				}
+			} else {
+				var rows int64
+				if result := tx.Table(table.name).Count(&rows); result.Error != nil {
+					return result.Error
+				}
+				if rows > 0 {
+					return fmt.Errorf("table %s %w", table.name, errNotEmpty)
+				}
+			}
+
+			rows := doc.Tables[table.name]
+			if len(rows) > 0 {
+				if result := tx.Table(table.name).CreateInBatches(rows, backupBatchSize); result.Error != nil {
+					return fmt.Errorf("table %s: %w", table.name, result.Error)
+				}
+				count += len(rows)
+			}
+
+			// New rows continue after the restored IDs
+			if len(table.primaryKeys) == 1 && table.primaryKeys[0] == "id" {
+				query := fmt.Sprintf(`SELECT setval(pg_get_serial_sequence('%[1]s', 'id'), COALESCE(MAX(id), 1), MAX(id) IS NOT NULL) FROM %[1]q`, table.name)
+				rows, err := tx.Raw(query).Rows()
+				if err != nil {
+					return err
+				}
+				rows.Close()
+			}
+		}
+
+		return nil
+	})
+
+	return count, err
+}
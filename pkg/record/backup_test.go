@@ -0,0 +1,116 @@
+package record
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	mocket "github.com/selvatico/go-mocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackup(t *testing.T) {
+	db := setupTestDB()
+
+	mocket.Catcher.Reset().NewMock().WithQuery(`SELECT * FROM "notes"`).WithReply([]map[string]interface{}{
+		{"id": 1, "title": "Sample note #123", "workspace_id": 1},
+		{"id": 2, "title": "Sample note #234", "workspace_id": 1},
+	})
+	mocket.Catcher.NewMock().WithQuery(`SELECT * FROM`).WithReply([]map[string]interface{}{{"id": 1}})
+
+	tables, err := backupTables(db)
+	assert.Nil(t, err)
+
+	var out bytes.Buffer
+	n, err := backup(db, &out)
+	assert.Nil(t, err)
+	assert.Equal(t, len(tables)+1, n)
+
+	var doc backupDocument
+	assert.Nil(t, json.Unmarshal(out.Bytes(), &doc))
+	assert.Equal(t, backupVersion, doc.Version)
+	assert.Len(t, doc.Tables["notes"], 2)
+	assert.Equal(t, "Sample note #234", doc.Tables["notes"][1]["title"])
+	assert.Contains(t, doc.Tables, "workspaces")
+	assert.NotContains(t, doc.Tables, "sessions")
+}
+
+func TestRestore(t *testing.T) {
+	db := setupTestDB()
+	backup := `{"version": 1, "tables": {"notes": [{"id": 9007199254740993, "title": "Sample note #123"}], "users": []}}`
+
+	t.Run("successful: rows inserted", func(t *testing.T) {
+		var inserted []driver.NamedValue
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`INSERT INTO "notes"`).WithCallback(func(_ string, args []driver.NamedValue) {
+			inserted = args
+		})
+
+		n, err := Restore(db, strings.NewReader(backup), false)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, n)
+
+		// Large IDs are not rounded
+		var values []driver.Value
+		for _, arg := range inserted {
+			values = append(values, arg.Value)
+		}
+		assert.Contains(t, values, "9007199254740993")
+	})
+
+	t.Run("error: table not empty", func(t *testing.T) {
+		mocket.Catcher.Reset().NewMock().WithQuery(`SELECT count(*) FROM "users"`).WithReply([]map[string]interface{}{{"count": 1}})
+
+		_, err := Restore(db, strings.NewReader(backup), false)
+		assert.ErrorIs(t, err, errNotEmpty)
+	})
+
+	t.Run("successful: rows replaced", func(t *testing.T) {
+		var deleted []string
+		mocket.Catcher.Reset().NewMock().WithQuery(`DELETE FROM`).WithCallback(func(query string, _ []driver.NamedValue) {
+			deleted = append(deleted, query)
+		})
+		mocket.Catcher.NewMock().WithQuery(`SELECT count(*) FROM "users"`).WithReply([]map[string]interface{}{{"count": 1}})
+
+		_, err := Restore(db, strings.NewReader(backup), true)
+		assert.Nil(t, err)
+		assert.Contains(t, deleted, `DELETE FROM "sessions"`)
+		assert.Contains(t, deleted, `DELETE FROM "users"`)
+	})
+
+	t.Run("error: unknown table", func(t *testing.T) {
+		_, err := Restore(db, strings.NewReader(`{"version": 1, "tables": {"songs": []}}`), false)
+		assert.ErrorContains(t, err, "unknown table")
+	})
+
+	t.Run("error: unsupported version", func(t *testing.T) {
+		_, err := Restore(db, strings.NewReader(`{"version": 2, "tables": {}}`), false)
+		assert.ErrorContains(t, err, "unsupported backup version")
+	})
+}
+
+func TestCheckSchema(t *testing.T) {
+	db := setupTestDB()
+
+	for name, test := range map[string]struct {
+		version int
+		err     string
+	}{
+		"successful: current version": {SchemaVersion, ""},
+		"not migrated":                {0, "migrate it to version"},
+		"newer schema":                {SchemaVersion + 1, "newer than version"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			mocket.Catcher.Reset().NewMock().WithQuery(`FROM "schema_migrations"`).WithReply([]map[string]interface{}{{"version": test.version}})
+
+			err := CheckSchema(db)
+			if test.err == "" {
+				assert.Nil(t, err)
+			} else {
+				assert.ErrorContains(t, err, test.err)
+			}
+		})
+	}
+}
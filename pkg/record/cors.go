@@ -0,0 +1,86 @@
+package record
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jvmistica/knowledge-base-go/pkg/config"
+)
+
+// corsExposedHeaders are the response headers readable by cross-origin requests
+var corsExposedHeaders = []string{requestIDHeader, "X-Total-Count", "Retry-After"}
+
+// CORSPolicy are the origins allowed to call the API from a browser
+type CORSPolicy struct {
+	// AllowedOrigins are the allowed origins, such as https://app.example.com,
+	// or "*" for any origin
+	AllowedOrigins []string
+	// AllowedMethods and AllowedHeaders are allowed to cross-origin
+	// requests, empty for the defaults
+	AllowedMethods []string
+	AllowedHeaders []string
+	// AllowCredentials lets browsers send cookies and authorization headers
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache the answer to a preflight request
+	MaxAge time.Duration
+}
+
+// allows returns whether an origin is allowed
+func (p CORSPolicy) allows(origin string) bool {
+	return slices.Contains(p.AllowedOrigins, "*") || slices.Contains(p.AllowedOrigins, origin)
+}
+
+// CORS answers the preflight requests of browsers, and lets them read the
+// responses to the allowed origins. Requests of other origins are served
+// without the CORS headers, which browsers then block.
+func CORS(policy CORSPolicy) func(http.Handler) http.Handler {
+	methods := strings.Join(defaultList(policy.AllowedMethods, config.DefaultCORSMethods), ", ")
+	headers := strings.Join(defaultList(policy.AllowedHeaders, config.DefaultCORSHeaders), ", ")
+	exposed := strings.Join(corsExposedHeaders, ", ")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			w.Header().Add("Vary", "Origin")
+			if origin == "" || !policy.allows(origin) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Credentials are never allowed to any origin
+			if slices.Contains(policy.AllowedOrigins, "*") && !policy.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+			if policy.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+				w.Header().Set("Access-Control-Expose-Headers", exposed)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Access-Control-Allow-Methods", methods)
+			w.Header().Set("Access-Control-Allow-Headers", headers)
+			if policy.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(policy.MaxAge.Seconds())))
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// defaultList returns a list, or its default if empty
+func defaultList(list, defaults []string) []string {
+	if len(list) == 0 {
+		return defaults
+	}
+
+	return list
+}
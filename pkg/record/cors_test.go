@@ -0,0 +1,70 @@
+package record
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCORS(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	policy := CORSPolicy{AllowedOrigins: []string{"https://app.example.com"}, AllowCredentials: true, MaxAge: time.Hour}
+	handler := CORS(policy)(ok)
+
+	t.Run("same origin", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Empty(t, rw.Header().Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("unknown origin", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Origin", "https://evil.example.com")
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Empty(t, rw.Header().Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("allowed origin", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, "https://app.example.com", rw.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "true", rw.Header().Get("Access-Control-Allow-Credentials"))
+		assert.Contains(t, rw.Header().Get("Access-Control-Expose-Headers"), "X-Total-Count")
+	})
+
+	t.Run("preflight", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodOptions, "/", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		req.Header.Set("Access-Control-Request-Method", http.MethodDelete)
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+
+		assert.Equal(t, http.StatusNoContent, rw.Code)
+		assert.Contains(t, rw.Header().Get("Access-Control-Allow-Methods"), http.MethodDelete)
+		assert.Contains(t, rw.Header().Get("Access-Control-Allow-Headers"), workspaceHeader)
+		assert.Contains(t, rw.Header().Get("Access-Control-Allow-Headers"), requestIDHeader)
+		assert.Equal(t, "3600", rw.Header().Get("Access-Control-Max-Age"))
+	})
+
+	t.Run("any origin", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Origin", "https://other.example.com")
+		rw := httptest.NewRecorder()
+		CORS(CORSPolicy{AllowedOrigins: []string{"*"}})(ok).ServeHTTP(rw, req)
+
+		assert.Equal(t, "*", rw.Header().Get("Access-Control-Allow-Origin"))
+		assert.Empty(t, rw.Header().Get("Access-Control-Allow-Credentials"))
+	})
+}
@@ -0,0 +1,192 @@
+package record
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"gorm.io/gorm"
+
+	"github.com/jvmistica/knowledge-base-go/pkg/analysis"
+	"github.com/jvmistica/knowledge-base-go/pkg/encryption"
+)
+
+// Encryptable fields, bound with the ID of their record to their sealed values
+const (
+	fieldNoteContent = "note.content"
+	fieldScriptBody  = "script.body"
+)
+
+// rotateBatchSize is the number of records rewrapped per batch by RotateKeys
+const rotateBatchSize = 100
+
+var errEncryptionDisabled = errors.New("Encryption is disabled")
+
+// encryptionOption is the encryption setting of an update, nil when the
+// update keeps the current setting
+type encryptionOption struct {
+	Encrypted *bool `json:"encrypted"`
+}
+
+// boundField returns the additional data binding a sealed value to the
+// field of a specific record, so it cannot be opened from another record
+func boundField(field string, id uint) string {
+	return fmt.Sprintf("%s:%d", field, id)
+}
+
+// checkEncryption returns an error if a field must be encrypted without master keys
+func (re *Record) checkEncryption(encrypted bool) error {
+	if encrypted && re.Keys == nil {
+		return errEncryptionDisabled
+	}
+
+	return nil
+}
+
+// seal returns the stored form of an encryptable field of a record
+func (re *Record) seal(value string, encrypted bool, field string, id uint) (string, error) {
+	if !encrypted {
+		return value, nil
+	}
+
+	if err := re.checkEncryption(encrypted); err != nil {
+		return "", err
+	}
+
+	if value == "" {
+		return "", nil
+	}
+
+	return re.Keys.Seal(value, boundField(field, id))
+}
+
+// sealCreated seals the encryptable field of a record created without it,
+// once the record has the ID its sealed value is bound to
+func (re *Record) sealCreated(model any, column, field string, id uint, plaintext string) (string, error) {
+	sealed, err := re.seal(plaintext, true, field, id)
+	if err != nil {
+		return "", err
+	}
+
+	return sealed, re.DB.Model(model).Where(filterByID, id).UpdateColumn(column, sealed).Error
+}
+
+// open returns the plaintext of a stored encryptable field of a record
+func (re *Record) open(value string, encrypted bool, field string, id uint) (string, error) {
+	if !encrypted || value == "" {
+		return value, nil
+	}
+
+	if re.Keys == nil {
+		return "", errEncryptionDisabled
+	}
+
+	return re.Keys.Open(value, boundField(field, id))
+}
+
+// decryptNote replaces the stored content of a note with its plaintext
+func (re *Record) decryptNote(note *Note) (err error) {
+	note.Content, err = re.open(note.Content, note.Encrypted, fieldNoteContent, note.ID)
+	return err
+}
+
+// decryptScript replaces the stored body of a script with its plaintext
+func (re *Record) decryptScript(script *Script) (err error) {
+	script.Body, err = re.open(script.Body, script.Encrypted, fieldScriptBody, script.ID)
+	return err
+}
+
+// indexable returns the text of a field to extract links from, encrypted fields are never indexed
+func indexable(value string, encrypted bool) string {
+	if encrypted {
+		return ""
+	}
+
+	return value
+}
+
+// redactFindings removes the matched text from the findings of an encrypted script
+func redactFindings(findings []analysis.Finding) {
+	for i := range findings {
+		findings[i].Match = ""
+	}
+}
+
+// writeEncryptionError writes an error sealing or opening a field
+func writeEncryptionError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, errEncryptionDisabled) {
+		status = http.StatusNotImplemented
+	}
+
+	http.Error(w, err.Error(), status)
+}
+
+// rebind seals a value sealed before values were bound to their record,
+// with only its field as additional data, again bound to its record. It
+// reports whether the value changed.
+func rebind(keys *encryption.Keyring, sealed, field string, id uint) (string, bool, error) {
+	if _, err := keys.Open(sealed, boundField(field, id)); err == nil {
+		return sealed, false, nil
+	}
+
+	plaintext, err := keys.Open(sealed, field)
+	if err != nil {
+		return "", false, err
+	}
+
+	sealed, err = keys.Seal(plaintext, boundField(field, id))
+	return sealed, err == nil, err
+}
+
+// RotateKeys rewraps the data keys of all the encrypted fields and secrets
+// with the primary key of a keyring, binding the values sealed before
+// values were bound to their record, and returns the number of rewrapped
+// fields. The keyring needs the previous keys to unwrap fields sealed before
+// the rotation.
+func RotateKeys(db *gorm.DB, keys *encryption.Keyring) (int, error) {
+	fields := []struct{ table, column, sealed, field string }{
+		{"notes", "content", "encrypted = true", fieldNoteContent},
+		{"scripts", "body", "encrypted = true", fieldScriptBody},
+		{"secrets", "value", "true", fieldSecretValue},
+	}
+
+	var rewrapped int
+	for _, field := range fields {
+		var rows []struct {
+			ID     uint
+			Sealed string
+		}
+
+		result := db.Table(field.table).Select("id", field.column+" AS sealed").
+			Where(field.sealed+" AND "+field.column+" <> ''").
+			FindInBatches(&rows, rotateBatchSize, func(tx *gorm.DB, batch int) error {
+				for _, row := range rows {
+					sealed, rebound, err := rebind(keys, row.Sealed, field.field, row.ID)
+					if err != nil {
+						return err
+					}
+
+					sealed, changed, err := keys.Rewrap(sealed)
+					if err != nil {
+						return err
+					}
+
+					if !rebound && !changed {
+						continue
+					}
+
+					if err := db.Table(field.table).Where(filterByID, row.ID).UpdateColumn(field.column, sealed).Error; err != nil {
+						return err
+					}
+					rewrapped++
+				}
+				return nil
+			})
+		if result.Error != nil {
+			return rewrapped, result.Error
+		}
+	}
+
+	return rewrapped, nil
+}
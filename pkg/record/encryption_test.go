@@ -0,0 +1,213 @@
+package record
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	mocket "github.com/selvatico/go-mocket"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jvmistica/knowledge-base-go/pkg/encryption"
+)
+
+// testKeys returns a keyring with a single random master key
+func testKeys(t *testing.T) *encryption.Keyring {
+	key, err := encryption.GenerateKey()
+	assert.Nil(t, err)
+
+	keys, err := encryption.ParseKeys("test=" + key)
+	assert.Nil(t, err)
+	return keys
+}
+
+func TestCreateEncryptedNote(t *testing.T) {
+	db := setupTestDB()
+	body := `{"title": "Database", "content": "password: hunter2, see [[note:2]]", "encrypted": true}`
+
+	t.Run("error: encryption disabled", func(t *testing.T) {
+		r := &Record{DB: db}
+		rw := httptest.NewRecorder()
+		r.CreateNote(rw, withUser(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)), testUser))
+
+		assert.Equal(t, http.StatusNotImplemented, rw.Code)
+	})
+
+	t.Run("sealed content", func(t *testing.T) {
+		r := &Record{DB: db, Keys: testKeys(t)}
+		var values []driver.Value
+		mocket.Catcher.Reset().NewMock().WithQuery(`INSERT INTO "notes"`).WithCallback(func(_ string, args []driver.NamedValue) {
+			for _, a := range args {
+				values = append(values, a.Value)
+			}
+		})
+		var linked bool
+		mocket.Catcher.NewMock().WithQuery(`INSERT INTO "links"`).WithCallback(func(_ string, _ []driver.NamedValue) {
+			linked = true
+		})
+		rw := httptest.NewRecorder()
+		r.CreateNote(rw, withUser(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)), testUser))
+
+		assert.Equal(t, http.StatusCreated, rw.Code)
+		assert.False(t, linked)
+		for _, v := range values {
+			if s, ok := v.(string); ok {
+				assert.NotContains(t, s, "hunter2")
+			}
+		}
+	})
+
+	t.Run("sealed for the new note", func(t *testing.T) {
+		keys := testKeys(t)
+		r := &Record{DB: db, Keys: keys}
+		var sealed string
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`INSERT INTO "notes"`).WithReply([]map[string]interface{}{{"id": 5}})
+		mocket.Catcher.NewMock().WithQuery(`UPDATE "notes" SET "content"`).WithCallback(func(_ string, args []driver.NamedValue) {
+			sealed, _ = args[0].Value.(string)
+		})
+		rw := httptest.NewRecorder()
+		r.CreateNote(rw, withUser(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)), testUser))
+		assert.Equal(t, http.StatusCreated, rw.Code)
+
+		plaintext, err := keys.Open(sealed, boundField(fieldNoteContent, 5))
+		assert.Nil(t, err)
+		assert.Equal(t, "password: hunter2, see [[note:2]]", plaintext)
+		_, err = keys.Open(sealed, fieldNoteContent)
+		assert.NotNil(t, err)
+	})
+}
+
+func TestGetEncryptedNote(t *testing.T) {
+	db := setupTestDB()
+	keys := testKeys(t)
+
+	sealed, err := keys.Seal("password: hunter2", boundField(fieldNoteContent, 1))
+	assert.Nil(t, err)
+	reply := []map[string]interface{}{{"id": 1, "title": "Database", "content": sealed, "encrypted": true}}
+
+	t.Run("error: encryption disabled", func(t *testing.T) {
+		r := &Record{DB: db}
+		mocket.Catcher.Reset().NewMock().WithQuery(`SELECT * FROM "notes"`).WithReply(reply)
+		rw := httptest.NewRecorder()
+		r.GetNote(rw, withUser(httptest.NewRequest(http.MethodGet, "/?id=1", nil), testUser))
+
+		assert.Equal(t, http.StatusNotImplemented, rw.Code)
+		assert.NotContains(t, rw.Body.String(), "hunter2")
+	})
+
+	t.Run("error: sealed for another note", func(t *testing.T) {
+		r := &Record{DB: db, Keys: keys}
+		mocket.Catcher.Reset().NewMock().WithQuery(`SELECT * FROM "notes"`).WithReply([]map[string]interface{}{
+			{"id": 2, "title": "Copy", "content": sealed, "encrypted": true},
+		})
+		rw := httptest.NewRecorder()
+		r.GetNote(rw, withUser(httptest.NewRequest(http.MethodGet, "/?id=2", nil), testUser))
+
+		assert.Equal(t, http.StatusInternalServerError, rw.Code)
+		assert.NotContains(t, rw.Body.String(), "hunter2")
+	})
+
+	t.Run(successRecordFound, func(t *testing.T) {
+		r := &Record{DB: db, Keys: keys}
+		mocket.Catcher.Reset().NewMock().WithQuery(`SELECT * FROM "notes"`).WithReply(reply)
+		rw := httptest.NewRecorder()
+		r.GetNote(rw, withUser(httptest.NewRequest(http.MethodGet, "/?id=1", nil), testUser))
+		assert.Equal(t, http.StatusOK, rw.Code)
+
+		var note Note
+		assert.Nil(t, json.Unmarshal(rw.Body.Bytes(), &note))
+		assert.True(t, note.Encrypted)
+		assert.Equal(t, "password: hunter2", note.Content)
+	})
+}
+
+func TestUpdateEncryptedNote(t *testing.T) {
+	db := setupTestDB()
+	keys := testKeys(t)
+	r := &Record{DB: db, Keys: keys}
+
+	sealed, err := keys.Seal("password: hunter2", boundField(fieldNoteContent, 1))
+	assert.Nil(t, err)
+
+	mocket.Catcher.Reset()
+	mocket.Catcher.NewMock().OneTime().WithQuery(`SELECT * FROM "notes"`).WithReply([]map[string]interface{}{{"id": 1, "title": "Database", "content": "password: hunter2"}})
+	mocket.Catcher.NewMock().WithQuery(`SELECT * FROM "notes"`).WithReply([]map[string]interface{}{{"id": 1, "title": "Database", "content": sealed, "encrypted": true}})
+	mocket.Catcher.NewMock().WithQuery(`UPDATE "notes"`).WithRowsNum(1)
+	var values []driver.Value
+	mocket.Catcher.NewMock().WithQuery(`INSERT INTO "audit_events"`).WithCallback(func(_ string, args []driver.NamedValue) {
+		for _, a := range args {
+			values = append(values, a.Value)
+		}
+	})
+	rw := httptest.NewRecorder()
+	r.UpdateNote(rw, withUser(httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"id": 1, "encrypted": true}`)), testUser))
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.NotEmpty(t, values)
+	for _, v := range values {
+		switch v := v.(type) {
+		case string:
+			assert.NotContains(t, v, "hunter2")
+			assert.NotContains(t, v, sealed)
+		case []byte:
+			assert.NotContains(t, string(v), "hunter2")
+			assert.NotContains(t, string(v), sealed)
+		}
+	}
+}
+
+func TestCreateEncryptedScript(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db, Keys: testKeys(t)}
+
+	var values []driver.Value
+	mocket.Catcher.Reset().NewMock().WithQuery(`INSERT INTO "scripts"`).WithCallback(func(_ string, args []driver.NamedValue) {
+		for _, a := range args {
+			values = append(values, a.Value)
+		}
+	})
+	rw := httptest.NewRecorder()
+	body := `{"name": "Deploy", "language": "bash", "body": "export AWS_SECRET_ACCESS_KEY=wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY", "encrypted": true}`
+	r.CreateScript(rw, withUser(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)), testUser))
+	assert.Equal(t, http.StatusCreated, rw.Code)
+
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			assert.NotContains(t, s, "wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY")
+		}
+	}
+
+	var script Script
+	assert.Nil(t, json.Unmarshal(rw.Body.Bytes(), &script))
+	assert.Contains(t, script.Body, "wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY")
+	assert.NotEmpty(t, script.Findings)
+	for _, f := range script.Findings {
+		assert.Empty(t, f.Match)
+	}
+}
+
+func TestRotateKeys(t *testing.T) {
+	db := setupTestDB()
+	keys := testKeys(t)
+
+	legacy, err := keys.Seal("password: hunter2", fieldNoteContent)
+	assert.Nil(t, err)
+	var sealed string
+	mocket.Catcher.Reset()
+	mocket.Catcher.NewMock().WithQuery(`FROM "notes"`).OneTime().WithReply([]map[string]interface{}{{"id": 3, "sealed": legacy}})
+	mocket.Catcher.NewMock().WithQuery(`UPDATE "notes"`).WithCallback(func(_ string, args []driver.NamedValue) {
+		sealed, _ = args[0].Value.(string)
+	})
+
+	n, err := RotateKeys(db, keys)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	plaintext, err := keys.Open(sealed, boundField(fieldNoteContent, 3))
+	assert.Nil(t, err)
+	assert.Equal(t, "password: hunter2", plaintext)
+}
@@ -0,0 +1,287 @@
+package record
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jvmistica/knowledge-base-go/pkg/runner"
+)
+
+// Statuses of an execution
+const (
+	ExecutionRunning   = "running"
+	ExecutionSucceeded = "succeeded"
+	ExecutionFailed    = "failed"
+	ExecutionTimedOut  = "timed_out"
+	ExecutionCanceled  = "canceled"
+	ExecutionError     = "error"
+)
+
+// Execution is the structure of the executions table, one row per run of a script
+type Execution struct {
+	ID          uint       `json:"id"`
+	ScriptID    uint       `json:"script_id" gorm:"index"`
+	Status      string     `json:"status"`
+	Args        []string   `json:"args" gorm:"serializer:json"`
+	ExitCode    *int       `json:"exit_code"`
+	Stdout      string     `json:"stdout"`
+	Stderr      string     `json:"stderr"`
+	Error       string     `json:"error,omitempty"`
+	StartedAt   time.Time  `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at"`
+	WorkspaceID uint       `json:"-" gorm:"index;not null;default:0"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// RunRequest is the optional body of a run request, with the arguments
+// passed to the script and the values of its template parameters
+type RunRequest struct {
+	Args   []string       `json:"args"`
+	Values map[string]any `json:"values"`
+}
+
+// redact replaces the values of the secrets injected in a run in its output
+func (e *Execution) redact(secrets map[string]string) {
+	e.Stdout = redactSecrets(e.Stdout, secrets)
+	e.Stderr = redactSecrets(e.Stderr, secrets)
+	e.Error = redactSecrets(e.Error, secrets)
+}
+
+// finish records the outcome of a run in the execution
+func (e *Execution) finish(res *runner.Result, err error) {
+	now := time.Now()
+	e.FinishedAt = &now
+
+	if err != nil {
+		e.Status = ExecutionError
+		e.Error = err.Error()
+		return
+	}
+
+	e.Stdout = res.Stdout
+	e.Stderr = res.Stderr
+	e.ExitCode = &res.ExitCode
+	e.FinishedAt = &res.Finished
+
+	switch {
+	case res.TimedOut:
+		e.Status = ExecutionTimedOut
+	case res.Canceled:
+		e.Status = ExecutionCanceled
+	case res.ExitCode != 0:
+		e.Status = ExecutionFailed
+	default:
+		e.Status = ExecutionSucceeded
+	}
+}
+
+// RunScript runs a specific script in the background and returns the pending execution
+func (re *Record) RunScript(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	re = re.inWorkspace(r)
+
+	if re.Runner == nil {
+		http.Error(w, "Script execution is disabled", http.StatusNotImplemented)
+		return
+	}
+
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "Missing path parameter: 'id'", http.StatusBadRequest)
+		return
+	}
+
+	var req RunRequest
+	if r.Body != nil {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer r.Body.Close()
+
+		if len(body) > 0 {
+			if err := json.Unmarshal(body, &req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	var script Script
+	result := re.DB.Scopes(re.authorize(user, TypeScript, ActionEdit)).Where(filterByID, id).Find(&script)
+	if result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	// A script running as the user of the server can read its secrets
+	if !re.Runner.Isolated() {
+		admin, err := re.isServerAdmin(user)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !admin {
+			http.Error(w, "Only administrators can run scripts unless they run as a separate user", http.StatusForbidden)
+			return
+		}
+	}
+
+	if err := re.decryptScript(&script); err != nil {
+		writeEncryptionError(w, err)
+		return
+	}
+
+	if !re.Runner.Allowed(script.Language) {
+		http.Error(w, fmt.Sprintf("Language '%s' is not allowed to run", script.Language), http.StatusUnprocessableEntity)
+		return
+	}
+
+	secrets, err := re.scriptSecrets(r, user, &script)
+	if err != nil {
+		writeEncryptionError(w, err)
+		return
+	}
+
+	body, err := script.Render(req.Values, secrets)
+	if err != nil {
+		writeParameterError(w, err)
+		return
+	}
+
+	execution := Execution{
+		ScriptID:  script.ID,
+		Status:    ExecutionRunning,
+		Args:      req.Args,
+		StartedAt: time.Now(),
+	}
+	if result := re.DB.Create(&execution); result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	details, err := json.Marshal(execution)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// The execution is saved in the workspace of the request once it is over
+	db := re.DB.WithContext(context.WithoutCancel(r.Context()))
+	job := runner.Job{Language: script.Language, Body: body, Args: req.Args}
+	re.Runner.Go(context.Background(), job, func(res *runner.Result, err error) {
+		if err != nil {
+			log.Printf("script %d: execution %d: %s", script.ID, execution.ID, err)
+		}
+
+		execution.finish(res, err)
+		execution.redact(secrets)
+		if result := db.Save(&execution); result.Error != nil {
+			log.Printf("script %d: saving execution %d: %s", script.ID, execution.ID, result.Error)
+		}
+	})
+
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	w.Write(details)
+}
+
+// ListScriptRuns lists the executions of a specific script, most recent first
+func (re *Record) ListScriptRuns(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	re = re.inWorkspace(r)
+
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "Missing path parameter: 'id'", http.StatusBadRequest)
+		return
+	}
+
+	var executions []Execution
+	result := re.DB.Where("script_id = ? AND script_id IN (?)", id, re.authorizedIDs(user, TypeScript, ActionRead)).Order("id desc").Find(&executions)
+	if result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	executionsList, err := json.Marshal(executions)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.Write(executionsList)
+}
+
+// GetScriptRun gets the details of a specific execution
+func (re *Record) GetScriptRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	re = re.inWorkspace(r)
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "Missing query parameter: 'id'", http.StatusBadRequest)
+		return
+	}
+
+	var execution Execution
+	result := re.DB.Where("id = ? AND script_id IN (?)", id, re.authorizedIDs(user, TypeScript, ActionRead)).Find(&execution)
+	if result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	details, err := json.Marshal(execution)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(details)
+}
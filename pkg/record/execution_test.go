@@ -0,0 +1,161 @@
+package record
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	mocket "github.com/selvatico/go-mocket"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jvmistica/knowledge-base-go/pkg/runner"
+)
+
+func TestRunScript(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db, Runner: runner.New(runner.DefaultConfig("sh"))}
+	admin := []map[string]interface{}{{"count": 1}}
+
+	t.Run(errInvalidMethod, func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		r.RunScript(rw, withUser(&http.Request{Method: http.MethodGet}, testUser))
+
+		assert.Equal(t, http.StatusMethodNotAllowed, rw.Code)
+	})
+
+	t.Run("error: execution disabled", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		(&Record{DB: db}).RunScript(rw, withUser(&http.Request{Method: http.MethodPost}, testUser))
+
+		assert.Equal(t, http.StatusNotImplemented, rw.Code)
+	})
+
+	t.Run(errMissingParam, func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		r.RunScript(rw, withUser(&http.Request{Method: http.MethodPost}, testUser))
+
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+
+	t.Run(errRecordNotFound, func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		mocket.Catcher.Reset().NewMock().WithRowsNum(0)
+		req := &http.Request{Method: http.MethodPost}
+		req.SetPathValue("id", "99")
+		r.RunScript(rw, withUser(req, testUser))
+
+		assert.Equal(t, http.StatusNotFound, rw.Code)
+	})
+
+	t.Run("error: not an administrator", func(t *testing.T) {
+		var query string
+		rw := httptest.NewRecorder()
+		records := []map[string]interface{}{{"id": 1, "language": "sh", "body": "echo 1"}}
+		mocket.Catcher.Reset().NewMock().WithQuery(`SELECT count(*) FROM "workspace_members"`).WithCallback(func(q string, _ []driver.NamedValue) {
+			query = q
+		}).WithReply([]map[string]interface{}{{"count": 0}})
+		mocket.Catcher.NewMock().WithReply(records)
+		req := &http.Request{Method: http.MethodPost}
+		req.SetPathValue("id", "1")
+		r.RunScript(rw, withUser(req, testUser))
+
+		assert.Equal(t, http.StatusForbidden, rw.Code)
+		assert.Contains(t, query, `slug = $`)
+	})
+
+	t.Run("error: language not allowed", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		records := []map[string]interface{}{{"id": 1, "language": "python", "body": "print(1)"}}
+		mocket.Catcher.Reset().NewMock().WithQuery(`SELECT count(*) FROM "workspace_members"`).WithReply(admin)
+		mocket.Catcher.NewMock().WithReply(records)
+		req := &http.Request{Method: http.MethodPost}
+		req.SetPathValue("id", "1")
+		r.RunScript(rw, withUser(req, testUser))
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+	})
+
+	t.Run("successful: run started", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		records := []map[string]interface{}{{"id": 1, "language": "sh", "body": "echo \"$1\""}}
+		mocket.Catcher.Reset().NewMock().WithQuery(`SELECT count(*) FROM "workspace_members"`).WithReply(admin)
+		mocket.Catcher.NewMock().WithReply(records)
+		req := &http.Request{
+			Method: http.MethodPost,
+			Body:   io.NopCloser(strings.NewReader(`{"args": ["hello"]}`)),
+		}
+		req.SetPathValue("id", "1")
+		r.RunScript(rw, withUser(req, testUser))
+		r.Runner.Wait()
+
+		assert.Equal(t, http.StatusAccepted, rw.Code)
+
+		var execution Execution
+		err := json.Unmarshal(rw.Body.Bytes(), &execution)
+		assert.Nil(t, err)
+		assert.Equal(t, ExecutionRunning, execution.Status)
+		assert.Equal(t, []string{"hello"}, execution.Args)
+	})
+}
+
+func TestExecutionFinish(t *testing.T) {
+	tests := map[string]struct {
+		result   *runner.Result
+		err      error
+		expected string
+	}{
+		"succeeded": {result: &runner.Result{ExitCode: 0}, expected: ExecutionSucceeded},
+		"failed":    {result: &runner.Result{ExitCode: 2}, expected: ExecutionFailed},
+		"timed out": {result: &runner.Result{ExitCode: -1, TimedOut: true}, expected: ExecutionTimedOut},
+		"error":     {err: runner.ErrLanguageNotAllowed, expected: ExecutionError},
+	}
+
+	for testName, test := range tests {
+		t.Run(testName, func(t *testing.T) {
+			var execution Execution
+			execution.finish(test.result, test.err)
+
+			assert.Equal(t, test.expected, execution.Status)
+			assert.NotNil(t, execution.FinishedAt)
+		})
+	}
+}
+
+func TestGetScriptRun(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db}
+
+	t.Run(errMissingParam, func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		r.GetScriptRun(rw, withUser(&http.Request{
+			Method: http.MethodGet,
+			URL:    &url.URL{},
+		}, testUser))
+
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+
+	t.Run(successRecordFound, func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		records := []map[string]interface{}{{"id": 5, "script_id": 1, "status": ExecutionFailed, "stderr": "boom"}}
+		mocket.Catcher.Reset().NewMock().WithReply(records)
+		r.GetScriptRun(rw, withUser(&http.Request{
+			Method: http.MethodGet,
+			URL: &url.URL{
+				RawQuery: "id=5",
+			},
+		}, testUser))
+		assert.Equal(t, http.StatusOK, rw.Code)
+
+		var execution Execution
+		err := json.Unmarshal(rw.Body.Bytes(), &execution)
+		assert.Nil(t, err)
+		assert.Equal(t, ExecutionFailed, execution.Status)
+		assert.Equal(t, "boom", execution.Stderr)
+	})
+}
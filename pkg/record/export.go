@@ -0,0 +1,147 @@
+package record
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jvmistica/knowledge-base-go/pkg/encryption"
+	"github.com/jvmistica/knowledge-base-go/pkg/tenant"
+	"gorm.io/gorm"
+)
+
+// exportVersion is the version of the format of the exports
+const exportVersion = 1
+
+// Export is the portable document of the notes, recipes and scripts of a
+// workspace. Encrypted fields are exported sealed, and can only be imported
+// with the same master keys.
+type Export struct {
+	Version int      `json:"version"`
+	Notes   []Note   `json:"notes"`
+	Recipes []Recipe `json:"recipes"`
+	Scripts []Script `json:"scripts"`
+}
+
+// ExportRecords returns the notes, recipes and scripts of a workspace
+func ExportRecords(db *gorm.DB, workspace *Workspace) (*Export, error) {
+	db = db.WithContext(tenant.WithWorkspace(context.Background(), workspace.ID))
+
+	export := &Export{Version: exportVersion, Notes: []Note{}, Recipes: []Recipe{}, Scripts: []Script{}}
+	if result := db.Order("id").Find(&export.Notes); result.Error != nil {
+		return nil, result.Error
+	}
+
+	if result := db.Order("id").Find(&export.Recipes); result.Error != nil {
+		return nil, result.Error
+	}
+
+	if result := db.Order("id").Find(&export.Scripts); result.Error != nil {
+		return nil, result.Error
+	}
+
+	return export, nil
+}
+
+// ImportRecords adds the records of an export to a workspace as new
+// records owned by a user, and returns the number of records added. The
+// encrypted fields are sealed again for the IDs of the new records with
+// the master keys, which are only needed by exports with encrypted fields.
+func ImportRecords(db *gorm.DB, keys *encryption.Keyring, workspace *Workspace, owner *User, export *Export) (int, error) {
+	if export.Version != exportVersion {
+		return 0, fmt.Errorf("unsupported export version: %d", export.Version)
+	}
+
+	count := 0
+	err := db.WithContext(tenant.WithWorkspace(context.Background(), workspace.ID)).Transaction(func(tx *gorm.DB) error {
+		re := &Record{DB: tx, Keys: keys}
+
+		owned := func(o *Ownership) error {
+			o.OwnerID, o.WorkspaceID = owner.ID, 0
+			if o.Visibility == "" {
+				o.Visibility = workspace.Settings.DefaultVisibility
+			}
+			return o.validate(true)
+		}
+
+		for i := range export.Notes {
+			note := &export.Notes[i]
+			plaintext, err := re.open(note.Content, note.Encrypted, fieldNoteContent, note.ID)
+			if err != nil {
+				return fmt.Errorf("note '%s': %w", note.Title, err)
+			}
+			note.ID = 0
+			if err := owned(&note.Ownership); err != nil {
+				return fmt.Errorf("note '%s': %w", note.Title, err)
+			}
+			if note.Encrypted {
+				note.Content = ""
+			}
+			if result := tx.Create(note); result.Error != nil {
+				return result.Error
+			}
+			if note.Encrypted && plaintext != "" {
+				if note.Content, err = re.sealCreated(&Note{}, "content", fieldNoteContent, note.ID, plaintext); err != nil {
+					return err
+				}
+			}
+		}
+
+		for i := range export.Recipes {
+			recipe := &export.Recipes[i]
+			recipe.ID = 0
+			if err := owned(&recipe.Ownership); err != nil {
+				return fmt.Errorf("recipe '%s': %w", recipe.Name, err)
+			}
+			if result := tx.Create(recipe); result.Error != nil {
+				return result.Error
+			}
+		}
+
+		for i := range export.Scripts {
+			script := &export.Scripts[i]
+			plaintext, err := re.open(script.Body, script.Encrypted, fieldScriptBody, script.ID)
+			if err != nil {
+				return fmt.Errorf("script '%s': %w", script.Name, err)
+			}
+			script.ID = 0
+			if err := owned(&script.Ownership); err != nil {
+				return fmt.Errorf("script '%s': %w", script.Name, err)
+			}
+			if script.Encrypted {
+				script.Body = ""
+			}
+			if result := tx.Create(script); result.Error != nil {
+				return result.Error
+			}
+			if script.Encrypted && plaintext != "" {
+				if script.Body, err = re.sealCreated(&Script{}, "body", fieldScriptBody, script.ID, plaintext); err != nil {
+					return err
+				}
+			}
+		}
+
+		// Links are resolved once all the records exist
+		for _, note := range export.Notes {
+			if err := re.syncLinks(owner, TypeNote, note.ID, indexable(note.Content, note.Encrypted)); err != nil {
+				return err
+			}
+		}
+
+		for _, recipe := range export.Recipes {
+			if err := re.syncLinks(owner, TypeRecipe, recipe.ID, recipe.Description, recipe.Instruction); err != nil {
+				return err
+			}
+		}
+
+		for _, script := range export.Scripts {
+			if err := re.syncLinks(owner, TypeScript, script.ID, script.Description); err != nil {
+				return err
+			}
+		}
+
+		count = len(export.Notes) + len(export.Recipes) + len(export.Scripts)
+		return nil
+	})
+
+	return count, err
+}
@@ -0,0 +1,96 @@
+package record
+
+import (
+	"database/sql/driver"
+	"testing"
+
+	"github.com/jvmistica/knowledge-base-go/pkg/tenant"
+	mocket "github.com/selvatico/go-mocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportRecords(t *testing.T) {
+	db := setupTestDB()
+	assert.Nil(t, tenant.Register(db, TenantTables...))
+
+	var query string
+	mocket.Catcher.Reset().NewMock().WithQuery(`SELECT * FROM "notes"`).WithReply(testNote).WithCallback(func(q string, _ []driver.NamedValue) {
+		query = q
+	})
+
+	export, err := ExportRecords(db, testWorkspace)
+	assert.Nil(t, err)
+	assert.Equal(t, exportVersion, export.Version)
+	assert.Len(t, export.Notes, 2)
+	assert.Empty(t, export.Recipes)
+	assert.Contains(t, query, `"notes"."workspace_id" = `)
+}
+
+func TestImportRecords(t *testing.T) {
+	db := setupTestDB()
+	assert.Nil(t, tenant.Register(db, TenantTables...))
+
+	t.Run("successful: records added", func(t *testing.T) {
+		var values []driver.Value
+		mocket.Catcher.Reset().NewMock().WithQuery(`INSERT INTO "notes"`).WithCallback(func(_ string, args []driver.NamedValue) {
+			for _, a := range args {
+				values = append(values, a.Value)
+			}
+		})
+
+		export := &Export{Version: exportVersion, Notes: []Note{
+			{ID: 4, Title: "Runbook", Content: "See [[Backup]]", Ownership: Ownership{OwnerID: 9, WorkspaceID: 3}},
+		}}
+		n, err := ImportRecords(db, nil, testWorkspace, testUser, export)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, n)
+
+		// The records belong to the owner and the workspace they are imported in
+		assert.Contains(t, values, int64(testUser.ID))
+		assert.Contains(t, values, int64(testWorkspace.ID))
+		assert.NotContains(t, values, int64(9))
+		assert.NotContains(t, values, int64(3))
+		assert.Equal(t, VisibilityPrivate, export.Notes[0].Visibility)
+	})
+
+	t.Run("successful: encrypted fields sealed for the new records", func(t *testing.T) {
+		keys := testKeys(t)
+		content, err := keys.Seal("password: hunter2", boundField(fieldNoteContent, 4))
+		assert.Nil(t, err)
+		var sealed string
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`INSERT INTO "notes"`).WithReply([]map[string]interface{}{{"id": 9}})
+		mocket.Catcher.NewMock().WithQuery(`UPDATE "notes" SET "content"`).WithCallback(func(_ string, args []driver.NamedValue) {
+			sealed, _ = args[0].Value.(string)
+		})
+
+		export := &Export{Version: exportVersion, Notes: []Note{{ID: 4, Title: "Database", Content: content, Encrypted: true}}}
+		_, err = ImportRecords(db, keys, testWorkspace, testUser, export)
+		assert.Nil(t, err)
+
+		plaintext, err := keys.Open(sealed, boundField(fieldNoteContent, 9))
+		assert.Nil(t, err)
+		assert.Equal(t, "password: hunter2", plaintext)
+	})
+
+	t.Run("error: encrypted fields without keys", func(t *testing.T) {
+		mocket.Catcher.Reset()
+		export := &Export{Version: exportVersion, Notes: []Note{{ID: 4, Title: "Database", Content: "kb1:k:x:y", Encrypted: true}}}
+
+		_, err := ImportRecords(db, nil, testWorkspace, testUser, export)
+		assert.ErrorIs(t, err, errEncryptionDisabled)
+	})
+
+	t.Run("error: invalid visibility", func(t *testing.T) {
+		mocket.Catcher.Reset()
+		export := &Export{Version: exportVersion, Scripts: []Script{{Name: "Backup", Ownership: Ownership{Visibility: "everyone"}}}}
+
+		_, err := ImportRecords(db, nil, testWorkspace, testUser, export)
+		assert.ErrorContains(t, err, "script 'Backup': Invalid visibility")
+	})
+
+	t.Run("error: unsupported version", func(t *testing.T) {
+		_, err := ImportRecords(db, nil, testWorkspace, testUser, &Export{Version: 2})
+		assert.ErrorContains(t, err, "unsupported export version")
+	})
+}
@@ -0,0 +1,62 @@
+package record
+
+import (
+	"sort"
+	"strings"
+)
+
+// Language describes a scripting language supported by the scripts table
+type Language struct {
+	Name        string
+	Extension   string
+	ContentType string
+}
+
+// languages are the supported script languages, indexed by name
+var languages = map[string]Language{
+	"bash":       {Name: "bash", Extension: ".sh", ContentType: "text/x-shellscript"},
+	"sh":         {Name: "sh", Extension: ".sh", ContentType: "text/x-shellscript"},
+	"zsh":        {Name: "zsh", Extension: ".zsh", ContentType: "text/x-shellscript"},
+	"python":     {Name: "python", Extension: ".py", ContentType: "text/x-python"},
+	"ruby":       {Name: "ruby", Extension: ".rb", ContentType: "text/x-ruby"},
+	"perl":       {Name: "perl", Extension: ".pl", ContentType: "text/x-perl"},
+	"javascript": {Name: "javascript", Extension: ".js", ContentType: "text/javascript"},
+	"go":         {Name: "go", Extension: ".go", ContentType: "text/x-go"},
+	"sql":        {Name: "sql", Extension: ".sql", ContentType: "application/sql"},
+	"powershell": {Name: "powershell", Extension: ".ps1", ContentType: "text/plain"},
+	"text":       {Name: "text", Extension: ".txt", ContentType: "text/plain"},
+}
+
+// languageAliases map common alternative names to a supported language
+var languageAliases = map[string]string{
+	"shell":   "bash",
+	"py":      "python",
+	"python3": "python",
+	"js":      "javascript",
+	"node":    "javascript",
+	"pwsh":    "powershell",
+	"ps1":     "powershell",
+	"plain":   "text",
+}
+
+// LookupLanguage returns the supported language with the given name or alias
+func LookupLanguage(name string) (Language, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if alias, ok := languageAliases[name]; ok {
+		name = alias
+	}
+
+	lang, ok := languages[name]
+	return lang, ok
+}
+
+// Languages returns the names of all supported languages
+func Languages() []string {
+	names := make([]string, 0, len(languages))
+	for name := range languages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,436 @@
+package record
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Types of a record
+const (
+	TypeNote   = "note"
+	TypeRecipe = "recipe"
+	TypeScript = "script"
+)
+
+// recordTable is the table and title column of a record type
+type recordTable struct {
+	table string
+	title string
+}
+
+// recordTables are the tables of each record type
+var recordTables = map[string]recordTable{
+	TypeNote:   {table: "notes", title: "title"},
+	TypeRecipe: {table: "recipes", title: "name"},
+	TypeScript: {table: "scripts", title: "name"},
+}
+
+// recordTypes are the record types in the order titles are resolved
+var recordTypes = []string{TypeNote, TypeRecipe, TypeScript}
+
+// Reasons a link is broken
+const (
+	LinkUnresolved = "unresolved"
+	LinkDeleted    = "deleted"
+	LinkRenamed    = "renamed"
+)
+
+// wikiLink matches [[Title]], [[script:42]] and [[recipe:Adobo|label]] links
+var wikiLink = regexp.MustCompile(`\[\[([^\[\]|]+)(?:\|[^\[\]]*)?\]\]`)
+
+// Link is the structure of the links table, one row per wiki-style link
+// found in the content of a record
+type Link struct {
+	ID          uint      `json:"id"`
+	SourceType  string    `json:"source_type" gorm:"index:idx_links_source"`
+	SourceID    uint      `json:"source_id" gorm:"index:idx_links_source"`
+	Ref         string    `json:"ref"`
+	TargetType  string    `json:"target_type" gorm:"index:idx_links_target"`
+	TargetID    uint      `json:"target_id" gorm:"index:idx_links_target"`
+	Title       string    `json:"title"`
+	WorkspaceID uint      `json:"-" gorm:"index;not null;default:0"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// BrokenLink is a link whose target does not exist or was renamed
+type BrokenLink struct {
+	Link
+	Reason       string `json:"reason"`
+	CurrentTitle string `json:"current_title,omitempty"`
+}
+
+// linkRef is a link as written in the content of a record
+type linkRef struct {
+	ref   string
+	typ   string
+	id    uint
+	title string
+}
+
+// parseLinks returns the distinct links found in the given texts
+func parseLinks(texts ...string) []linkRef {
+	var refs []linkRef
+	seen := map[string]bool{}
+
+	for _, text := range texts {
+		for _, m := range wikiLink.FindAllStringSubmatch(text, -1) {
+			ref := strings.TrimSpace(m[1])
+			if ref == "" || seen[ref] {
+				continue
+			}
+			seen[ref] = true
+
+			link := linkRef{ref: ref, title: ref}
+			if typ, rest, ok := strings.Cut(ref, ":"); ok {
+				if _, known := recordTables[strings.ToLower(typ)]; known {
+					link.typ = strings.ToLower(typ)
+					link.title = strings.TrimSpace(rest)
+					if id, err := strconv.ParseUint(link.title, 10, 64); err == nil {
+						link.id = uint(id)
+						link.title = ""
+					}
+				}
+			}
+
+			refs = append(refs, link)
+		}
+	}
+
+	return refs
+}
+
+// findTitle returns the current title of a record, if it exists within the given scopes
+func (re *Record) findTitle(typ string, id uint, scopes ...func(*gorm.DB) *gorm.DB) (string, bool, error) {
+	t, ok := recordTables[typ]
+	if !ok {
+		return "", false, nil
+	}
+
+	var titles []string
+	result := re.DB.Table(t.table).Scopes(scopes...).Where(filterByID, id).Limit(1).Pluck(t.title, &titles)
+	if result.Error != nil {
+		return "", false, result.Error
+	}
+
+	if len(titles) == 0 {
+		return "", false, nil
+	}
+
+	return titles[0], true, nil
+}
+
+// findByTitle returns the ID of the record of the given type with the given
+// title, if it exists within the given scopes
+func (re *Record) findByTitle(typ, title string, scopes ...func(*gorm.DB) *gorm.DB) (uint, bool, error) {
+	t := recordTables[typ]
+
+	var ids []uint
+	result := re.DB.Table(t.table).Scopes(scopes...).Where(t.title+" = ?", title).Order("id").Limit(1).Pluck("id", &ids)
+	if result.Error != nil {
+		return 0, false, result.Error
+	}
+
+	if len(ids) == 0 {
+		return 0, false, nil
+	}
+
+	return ids[0], true, nil
+}
+
+// resolve finds the target of a link among the records a user can read. Links
+// without a type are resolved by title against notes, recipes and scripts in
+// that order.
+func (re *Record) resolve(user *User, ref linkRef) (Link, error) {
+	link := Link{Ref: ref.ref, TargetType: ref.typ}
+
+	if ref.id != 0 {
+		title, ok, err := re.findTitle(ref.typ, ref.id, re.authorize(user, ref.typ, ActionRead))
+		if err != nil || !ok {
+			return link, err
+		}
+		link.TargetID, link.Title = ref.id, title
+		return link, nil
+	}
+
+	types := recordTypes
+	if ref.typ != "" {
+		types = []string{ref.typ}
+	}
+
+	for _, typ := range types {
+		id, ok, err := re.findByTitle(typ, ref.title, re.authorize(user, typ, ActionRead))
+		if err != nil {
+			return link, err
+		}
+		if ok {
+			link.TargetType, link.TargetID, link.Title = typ, id, ref.title
+			return link, nil
+		}
+	}
+
+	return link, nil
+}
+
+// syncLinks replaces the links of a record with the ones found in its texts,
+// resolved against the records the user writing them can read
+func (re *Record) syncLinks(user *User, typ string, id uint, texts ...string) error {
+	if result := re.DB.Where("source_type = ? AND source_id = ?", typ, id).Delete(&Link{}); result.Error != nil {
+		return result.Error
+	}
+
+	refs := parseLinks(texts...)
+	if len(refs) == 0 {
+		return nil
+	}
+
+	links := make([]Link, 0, len(refs))
+	for _, ref := range refs {
+		link, err := re.resolve(user, ref)
+		if err != nil {
+			return err
+		}
+		link.SourceType, link.SourceID = typ, id
+		links = append(links, link)
+	}
+
+	return re.DB.Create(&links).Error
+}
+
+// deleteLinks deletes the outgoing links of a deleted record. Links pointing
+// to it are kept and reported as broken.
+func (re *Record) deleteLinks(typ string, id string) error {
+	return re.DB.Where("source_type = ? AND source_id = ?", typ, id).Delete(&Link{}).Error
+}
+
+// findTitles returns the current titles of the records of a type with the
+// given IDs that exist within the given scopes, by ID
+func (re *Record) findTitles(typ string, ids []uint, scopes ...func(*gorm.DB) *gorm.DB) (map[uint]string, error) {
+	titles := map[uint]string{}
+	t, ok := recordTables[typ]
+	if !ok || len(ids) == 0 {
+		return titles, nil
+	}
+
+	var rows []struct {
+		ID    uint
+		Title string
+	}
+	result := re.DB.Table(t.table).Scopes(scopes...).Select("id", t.title+" AS title").Where("id IN ?", ids).Find(&rows)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	for _, row := range rows {
+		titles[row.ID] = row.Title
+	}
+
+	return titles, nil
+}
+
+// linkTargets are the targets of a set of links, by type and ID
+type linkTargets struct {
+	readable map[string]map[uint]string
+	existing map[string]map[uint]bool
+}
+
+// findTargets looks up the targets of links with one query per record type
+// for the ones a user can read, and one more for the rest
+func (re *Record) findTargets(user *User, links []Link) (linkTargets, error) {
+	targets := linkTargets{readable: map[string]map[uint]string{}, existing: map[string]map[uint]bool{}}
+
+	ids := map[string][]uint{}
+	for _, link := range links {
+		if link.TargetID != 0 {
+			ids[link.TargetType] = append(ids[link.TargetType], link.TargetID)
+		}
+	}
+
+	for _, typ := range recordTypes {
+		readable, err := re.findTitles(typ, ids[typ], re.authorize(user, typ, ActionRead))
+		if err != nil {
+			return targets, err
+		}
+		targets.readable[typ] = readable
+
+		var unreadable []uint
+		for _, id := range ids[typ] {
+			if _, ok := readable[id]; !ok {
+				unreadable = append(unreadable, id)
+			}
+		}
+
+		existing, err := re.findTitles(typ, unreadable)
+		if err != nil {
+			return targets, err
+		}
+		targets.existing[typ] = map[uint]bool{}
+		for id := range existing {
+			targets.existing[typ][id] = true
+		}
+	}
+
+	return targets, nil
+}
+
+// brokenReason returns why a link is broken, and the current title of a
+// renamed target, or an empty reason if the link is intact. A target the
+// user cannot read is unresolved.
+func (targets linkTargets) brokenReason(link Link) (string, string) {
+	if link.TargetID == 0 {
+		return LinkUnresolved, ""
+	}
+
+	title, ok := targets.readable[link.TargetType][link.TargetID]
+	if !ok {
+		if targets.existing[link.TargetType][link.TargetID] {
+			return LinkUnresolved, ""
+		}
+		return LinkDeleted, ""
+	}
+
+	// Links by ID survive renames, links by title do not
+	if refs := parseLinks("[[" + link.Ref + "]]"); len(refs) == 1 && refs[0].id == 0 && title != link.Title {
+		return LinkRenamed, title
+	}
+
+	return "", ""
+}
+
+// NoteBacklinks lists the links pointing to a specific note
+func (re *Record) NoteBacklinks(w http.ResponseWriter, r *http.Request) {
+	re.backlinks(w, r, TypeNote)
+}
+
+// RecipeBacklinks lists the links pointing to a specific recipe
+func (re *Record) RecipeBacklinks(w http.ResponseWriter, r *http.Request) {
+	re.backlinks(w, r, TypeRecipe)
+}
+
+// ScriptBacklinks lists the links pointing to a specific script
+func (re *Record) ScriptBacklinks(w http.ResponseWriter, r *http.Request) {
+	re.backlinks(w, r, TypeScript)
+}
+
+// backlinks lists the links pointing to a specific record of the given type
+// from the records the authenticated user can read
+func (re *Record) backlinks(w http.ResponseWriter, r *http.Request, typ string) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	re = re.inWorkspace(r)
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "Missing query parameter: 'id'", http.StatusBadRequest)
+		return
+	}
+
+	// The links carry the title of their target
+	ok, err := re.can(user, typ, id, ActionRead)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var links []Link
+	result := re.DB.Scopes(re.readableSources(user)).Where("target_type = ? AND target_id = ?", typ, id).Order("id").Find(&links)
+	if result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	linksList, err := json.Marshal(links)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.Write(linksList)
+}
+
+// ListBrokenLinks lists the links of the records the authenticated user can
+// read whose target does not exist, was deleted or was renamed, paginated
+// with page and per_page. The total number of broken links is returned in
+// the X-Total-Count header when paginated.
+func (re *Record) ListBrokenLinks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	re = re.inWorkspace(r)
+
+	page, perPage, err := parsePage(r, defaultPageSize, maxPageSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var links []Link
+	if result := re.DB.Scopes(re.readableSources(user)).Order("id").Find(&links); result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	targets, err := re.findTargets(user, links)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	broken := []BrokenLink{}
+	for _, link := range links {
+		reason, title := targets.brokenReason(link)
+
+		// An unreadable target is reported without its ID and title
+		if reason == LinkUnresolved {
+			link.TargetType, link.TargetID, link.Title = "", 0, ""
+		}
+
+		if reason != "" {
+			broken = append(broken, BrokenLink{Link: link, Reason: reason, CurrentTitle: title})
+		}
+	}
+
+	// Whether a link is broken is only known once its target is looked up,
+	// so the page is cut from the full list
+	if r.URL.Query().Has("page") || r.URL.Query().Has("per_page") {
+		w.Header().Set("X-Total-Count", strconv.Itoa(len(broken)))
+		first := min((page-1)*perPage, len(broken))
+		broken = broken[first:min(first+perPage, len(broken))]
+	}
+
+	brokenList, err := json.Marshal(broken)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.Write(brokenList)
+}
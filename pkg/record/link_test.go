@@ -0,0 +1,206 @@
+package record
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	mocket "github.com/selvatico/go-mocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLinks(t *testing.T) {
+	refs := parseLinks(
+		"See [[Adobo]] and [[script:42]], or [[Recipe:Rice ball|the snack]].",
+		"Unknown [[foo:bar]] and again [[Adobo]] and [[ ]] and [not a link]",
+	)
+
+	assert.Equal(t, []linkRef{
+		{ref: "Adobo", title: "Adobo"},
+		{ref: "script:42", typ: TypeScript, id: 42},
+		{ref: "Recipe:Rice ball", typ: TypeRecipe, title: "Rice ball"},
+		{ref: "foo:bar", title: "foo:bar"},
+	}, refs)
+}
+
+func TestBacklinks(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db}
+
+	t.Run(errInvalidMethod, func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		r.NoteBacklinks(rw, withUser(&http.Request{Method: http.MethodPost}, testUser))
+
+		assert.Equal(t, http.StatusMethodNotAllowed, rw.Code)
+	})
+
+	t.Run(errMissingParam, func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		r.RecipeBacklinks(rw, withUser(&http.Request{
+			Method: http.MethodGet,
+			URL:    &url.URL{},
+		}, testUser))
+
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+
+	t.Run(successMultRecords, func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		records := []map[string]interface{}{
+			{"id": 1, "source_type": TypeNote, "source_id": 3, "ref": "script:7", "target_type": TypeScript, "target_id": 7},
+			{"id": 2, "source_type": TypeRecipe, "source_id": 1, "ref": "Backup", "target_type": TypeScript, "target_id": 7},
+		}
+		mocket.Catcher.Reset().NewMock().WithQuery(`SELECT count(*) FROM "scripts"`).WithReply([]map[string]interface{}{{"count": 1}})
+		mocket.Catcher.NewMock().WithQuery(`FROM "links"`).WithReply(records)
+		r.ScriptBacklinks(rw, withUser(&http.Request{
+			Method: http.MethodGet,
+			URL: &url.URL{
+				RawQuery: "id=7",
+			},
+		}, testUser))
+		assert.Equal(t, http.StatusOK, rw.Code)
+
+		var links []Link
+		err := json.Unmarshal(rw.Body.Bytes(), &links)
+		assert.Nil(t, err)
+		assert.Len(t, links, 2)
+		assert.Equal(t, uint(3), links[0].SourceID)
+	})
+}
+
+func TestListBrokenLinks(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db}
+
+	links := []map[string]interface{}{
+		{"id": 1, "ref": "Missing page", "target_type": "", "target_id": 0, "title": ""},
+		{"id": 2, "ref": "Adobo", "target_type": TypeRecipe, "target_id": 1, "title": "Adobo"},
+		{"id": 3, "ref": "note:2", "target_type": TypeNote, "target_id": 2, "title": "Old title"},
+		{"id": 4, "ref": "Groceries", "target_type": TypeNote, "target_id": 2, "title": "Groceries"},
+		{"id": 5, "ref": "script:9", "target_type": TypeScript, "target_id": 9, "title": ""},
+	}
+
+	mockLinks := func() *int {
+		queries := 0
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`FROM "links"`).WithReply(links)
+		mocket.Catcher.NewMock().WithQuery(`FROM "recipes"`).WithReply([]map[string]interface{}{{"id": 1, "title": "Chicken adobo"}})
+		mocket.Catcher.NewMock().WithQuery(`FROM "notes"`).WithReply([]map[string]interface{}{{"id": 2, "title": "Groceries"}})
+		mocket.Catcher.NewMock().WithQuery(`FROM "scripts"`).WithCallback(func(string, []driver.NamedValue) {
+			queries++
+		})
+		return &queries
+	}
+
+	t.Run("all broken links", func(t *testing.T) {
+		scriptQueries := mockLinks()
+
+		rw := httptest.NewRecorder()
+		r.ListBrokenLinks(rw, withUser(httptest.NewRequest(http.MethodGet, "/", nil), testUser))
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Empty(t, rw.Header().Get("X-Total-Count"))
+
+		var broken []BrokenLink
+		err := json.Unmarshal(rw.Body.Bytes(), &broken)
+		assert.Nil(t, err)
+
+		reasons := map[uint]string{}
+		for _, b := range broken {
+			reasons[b.ID] = b.Reason
+		}
+		assert.Equal(t, map[uint]string{1: LinkUnresolved, 2: LinkRenamed, 5: LinkDeleted}, reasons)
+		assert.Equal(t, "Chicken adobo", broken[1].CurrentTitle)
+
+		// One query for the readable scripts and one for the existing ones
+		assert.Equal(t, 2, *scriptQueries)
+	})
+
+	t.Run("paginated", func(t *testing.T) {
+		mockLinks()
+
+		rw := httptest.NewRecorder()
+		r.ListBrokenLinks(rw, withUser(httptest.NewRequest(http.MethodGet, "/?page=2&per_page=2", nil), testUser))
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, "3", rw.Header().Get("X-Total-Count"))
+
+		var broken []BrokenLink
+		assert.Nil(t, json.Unmarshal(rw.Body.Bytes(), &broken))
+		assert.Len(t, broken, 1)
+		assert.Equal(t, uint(5), broken[0].ID)
+	})
+
+	t.Run("error: invalid page", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		r.ListBrokenLinks(rw, withUser(httptest.NewRequest(http.MethodGet, "/?per_page=0", nil), testUser))
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+}
+
+func TestLinkVisibility(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db}
+
+	// Note 3 is private to testUser
+	other := &User{ID: 2, Username: "other"}
+	diary := []map[string]interface{}{{"title": "Diary"}}
+	exists := `SELECT "title" FROM "notes" WHERE id = $1 LIMIT`
+	existing := `FROM "notes" WHERE id IN ($1)`
+
+	t.Run("resolved for the owner", func(t *testing.T) {
+		mocket.Catcher.Reset().NewMock().WithQuery(`SELECT "title" FROM "notes" WHERE id = $1 AND (owner_id`).WithReply(diary)
+
+		link, err := r.resolve(testUser, linkRef{ref: "note:3", typ: TypeNote, id: 3})
+		assert.Nil(t, err)
+		assert.Equal(t, uint(3), link.TargetID)
+		assert.Equal(t, "Diary", link.Title)
+	})
+
+	t.Run("unresolved for another user", func(t *testing.T) {
+		var args []driver.NamedValue
+		mocket.Catcher.Reset().NewMock().WithQuery(exists).WithReply(diary)
+		mocket.Catcher.NewMock().WithQuery(`SELECT "id" FROM "notes"`).WithCallback(func(_ string, a []driver.NamedValue) {
+			args = a
+		})
+
+		link, err := r.resolve(other, linkRef{ref: "note:3", typ: TypeNote, id: 3})
+		assert.Nil(t, err)
+		assert.Zero(t, link.TargetID)
+		assert.Empty(t, link.Title)
+
+		link, err = r.resolve(other, linkRef{ref: "Diary", title: "Diary"})
+		assert.Nil(t, err)
+		assert.Zero(t, link.TargetID)
+		assert.Equal(t, int64(other.ID), args[1].Value)
+	})
+
+	t.Run("broken for another user", func(t *testing.T) {
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`FROM "links"`).WithReply([]map[string]interface{}{
+			{"id": 1, "ref": "note:3", "target_type": TypeNote, "target_id": 3, "title": "Diary"},
+		})
+		mocket.Catcher.NewMock().WithQuery(existing + " AND (owner_id").WithRowsNum(0)
+		mocket.Catcher.NewMock().WithQuery(existing).WithReply([]map[string]interface{}{{"id": 3, "title": "Diary"}})
+
+		rw := httptest.NewRecorder()
+		r.ListBrokenLinks(rw, withUser(httptest.NewRequest(http.MethodGet, "/", nil), other))
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.NotContains(t, rw.Body.String(), "Diary")
+
+		var broken []BrokenLink
+		assert.Nil(t, json.Unmarshal(rw.Body.Bytes(), &broken))
+		assert.Len(t, broken, 1)
+		assert.Equal(t, LinkUnresolved, broken[0].Reason)
+		assert.Zero(t, broken[0].TargetID)
+	})
+
+	t.Run("no backlinks for another user", func(t *testing.T) {
+		mocket.Catcher.Reset().NewMock().WithQuery(`SELECT count(*) FROM "notes"`).WithReply([]map[string]interface{}{{"count": 0}})
+
+		rw := httptest.NewRecorder()
+		r.NoteBacklinks(rw, withUser(httptest.NewRequest(http.MethodGet, "/?id=3", nil), other))
+		assert.Equal(t, http.StatusNotFound, rw.Code)
+	})
+}
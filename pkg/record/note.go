@@ -6,6 +6,10 @@ import (
 	"io"
 	"net/http"
 	"time"
+
+	"gorm.io/gorm/clause"
+
+	"github.com/jvmistica/knowledge-base-go/pkg/markdown"
 )
 
 const (
@@ -17,8 +21,13 @@ type Note struct {
 	ID        uint      `json:"id"`
 	Title     string    `json:"title"`
 	Content   string    `json:"content"`
+	Encrypted bool      `json:"encrypted" gorm:"not null;default:false"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	Ownership
+
+	Rendered *markdown.Document `json:"rendered,omitempty" gorm:"-"`
 }
 
 // ListNotes lists all the notes in the database
@@ -28,12 +37,31 @@ func (re *Record) ListNotes(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	re = re.inWorkspace(r)
+
+	query, ok := listPage(w, r, re.DB.Scopes(re.authorize(user, TypeNote, ActionRead)), &Note{})
+	if !ok {
+		return
+	}
+
 	var notes []Note
-	if result := re.DB.Find(&notes); result.Error != nil {
+	if result := query.Find(&notes); result.Error != nil {
 		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
 		return
 	}
 
+	for i := range notes {
+		if err := re.decryptNote(&notes[i]); err != nil {
+			writeEncryptionError(w, err)
+			return
+		}
+	}
+
 	notesList, err := json.Marshal(notes)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -51,6 +79,13 @@ func (re *Record) CreateNote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	re = re.inWorkspace(r)
+
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -64,13 +99,54 @@ func (re *Record) CreateNote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result := re.DB.Create(&note)
-	if result.Error != nil {
-		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+	if !re.prepareCreate(w, r, user, TypeNote, &note.Ownership) {
+		return
+	}
+
+	if err := re.checkEncryption(note.Encrypted); err != nil {
+		writeEncryptionError(w, err)
+		return
+	}
+
+	// An encrypted content is sealed once the note has the ID it is bound to
+	plaintext := note.Content
+	if note.Encrypted {
+		note.Content = ""
+	}
+
+	err = re.transaction(func(tx *Record) error {
+		if result := tx.DB.Create(&note); result.Error != nil {
+			return result.Error
+		}
+
+		if note.Encrypted && plaintext != "" {
+			var err error
+			if note.Content, err = tx.sealCreated(&Note{}, "content", fieldNoteContent, note.ID, plaintext); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.syncLinks(user, TypeNote, note.ID, indexable(note.Content, note.Encrypted)); err != nil {
+			return err
+		}
+
+		return tx.audit(r, AuditCreate, TypeNote, note.ID, nil, note)
+	})
+	if err != nil {
+		writeTransactionError(w, err)
 		return
 	}
+	note.Content = plaintext
 
+	details, err := json.Marshal(note)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
 	w.WriteHeader(http.StatusCreated)
+	w.Write(details)
 }
 
 // DeleteNote deletes a note
@@ -80,22 +156,59 @@ func (re *Record) DeleteNote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	re = re.inWorkspace(r)
+
 	id := r.URL.Query().Get("id")
 	if id == "" {
 		http.Error(w, "Missing query parameter: 'id'", http.StatusBadRequest)
 		return
 	}
 
-	result := re.DB.Where(filterByID, id).Delete(Note{})
-	if result.Error != nil {
-		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
-		return
-	}
+	var hashes []string
+	err := re.transaction(func(tx *Record) error {
+		var before Note
+		if result := tx.DB.Where(filterByID, id).Find(&before); result.Error != nil {
+			return result.Error
+		}
 
-	if result.RowsAffected == 0 {
-		w.WriteHeader(http.StatusNotFound)
+		result := tx.DB.Scopes(tx.authorize(user, TypeNote, ActionManage)).Where(filterByID, id).Delete(Note{})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return errNotFound
+		}
+
+		if err := tx.deleteLinks(TypeNote, id); err != nil {
+			return err
+		}
+
+		if err := tx.deleteRelations(TypeNote, id); err != nil {
+			return err
+		}
+
+		var err error
+		if hashes, err = tx.deleteAttachments(TypeNote, id); err != nil {
+			return err
+		}
+
+		if err := tx.deleteShares(TypeNote, id); err != nil {
+			return err
+		}
+
+		return tx.audit(r, AuditDelete, TypeNote, before.ID, before, nil)
+	})
+	if err != nil {
+		writeTransactionError(w, err)
 		return
 	}
+	re.releaseBlobs(r.Context(), hashes)
 
 	w.WriteHeader(http.StatusOK)
 }
@@ -107,14 +220,27 @@ func (re *Record) GetNote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	re = re.inWorkspace(r)
+
 	id := r.URL.Query().Get("id")
 	if id == "" {
 		http.Error(w, "Missing query parameter: 'id'", http.StatusBadRequest)
 		return
 	}
 
+	format, err := parseFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	var note Note
-	result := re.DB.Where(filterByID, id).Find(&note)
+	result := re.DB.Scopes(re.authorize(user, TypeNote, ActionRead)).Where(filterByID, id).Find(&note)
 	if result.Error != nil {
 		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
 		return
@@ -125,6 +251,20 @@ func (re *Record) GetNote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := re.decryptNote(&note); err != nil {
+		writeEncryptionError(w, err)
+		return
+	}
+
+	if format == formatHTML {
+		doc, err := markdown.Render(note.Content)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		note.Rendered = doc
+	}
+
 	details, err := json.Marshal(note)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -142,6 +282,13 @@ func (re *Record) UpdateNote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	re = re.inWorkspace(r)
+
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -150,14 +297,86 @@ func (re *Record) UpdateNote(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
 	var note Note
+	var option encryptionOption
 	if err := json.Unmarshal(body, &note); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if err := json.Unmarshal(body, &option); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-	result := re.DB.Model(&Note{}).Where(filterByID, note.ID).Updates(note)
-	if result.Error != nil {
-		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+	// The owner never changes, and only the owner or a team admin can change the visibility
+	note.OwnerID = 0
+	if err := note.Ownership.validate(false); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	action := ActionEdit
+	if note.Visibility != "" {
+		action = ActionManage
+	}
+
+	err = re.transaction(func(tx *Record) error {
+		// The current version is read and locked with the authorization of the update
+		var before Note
+		result := tx.DB.Clauses(clause.Locking{Strength: "UPDATE"}).Scopes(tx.authorize(user, TypeNote, action)).Where(filterByID, note.ID).Find(&before)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return errNotFound
+		}
+
+		// The content is sealed again when the encryption of the note changes
+		note.Encrypted = before.Encrypted
+		if option.Encrypted != nil {
+			note.Encrypted = *option.Encrypted
+		}
+		var err error
+		if note.Content == "" && note.Encrypted != before.Encrypted {
+			if note.Content, err = tx.open(before.Content, before.Encrypted, fieldNoteContent, before.ID); err != nil {
+				return err
+			}
+		}
+		if note.Content != "" {
+			if note.Content, err = tx.seal(note.Content, note.Encrypted, fieldNoteContent, note.ID); err != nil {
+				return err
+			}
+		}
+
+		result = tx.DB.Model(&Note{}).Where(filterByID, note.ID).Updates(note)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return errNotFound
+		}
+
+		// Updates skips zero values, so turning encryption off is a separate update of the transaction
+		if before.Encrypted && !note.Encrypted {
+			if result := tx.DB.Model(&Note{}).Where(filterByID, note.ID).Update("encrypted", false); result.Error != nil {
+				return result.Error
+			}
+		}
+
+		var stored Note
+		if result := tx.DB.Where(filterByID, note.ID).Find(&stored); result.Error != nil {
+			return result.Error
+		}
+
+		if err := tx.syncLinks(user, TypeNote, note.ID, indexable(stored.Content, stored.Encrypted)); err != nil {
+			return err
+		}
+
+		return tx.audit(r, AuditUpdate, TypeNote, note.ID, before, stored)
+	})
+	if err != nil {
+		writeTransactionError(w, err)
 		return
 	}
 
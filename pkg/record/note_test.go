@@ -1,6 +1,8 @@
 package record
 
 import (
+	"context"
+	"database/sql/driver"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -34,6 +36,14 @@ var (
 	}
 )
 
+// testUser is the user the requests of the tests are authenticated as
+var testUser = &User{ID: 1, Username: "tester"}
+
+// withUser returns a request authenticated as the given user
+func withUser(r *http.Request, user *User) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), userKey, user))
+}
+
 func setupTestDB() *gorm.DB {
 	mocket.Catcher.Register()
 	db, _ := gorm.Open(postgres.New(postgres.Config{
@@ -89,7 +99,7 @@ func TestListNotes(t *testing.T) {
 			mocket.Catcher.Reset().NewMock().WithReply(test.dbResult)
 			rw := httptest.NewRecorder()
 
-			r.ListNotes(rw, &http.Request{Method: test.method})
+			r.ListNotes(rw, withUser(&http.Request{Method: test.method, URL: &url.URL{}}, testUser))
 			assert.Equal(t, test.expectedStatusCode, rw.Code)
 
 			if !test.wantErr {
@@ -110,13 +120,43 @@ func TestListNotes(t *testing.T) {
 	}
 }
 
+func TestListNotesPage(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db}
+
+	t.Run("error: invalid page", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		r.ListNotes(rw, withUser(httptest.NewRequest(http.MethodGet, "/?page=0", nil), testUser))
+
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+
+	t.Run("successful: second page", func(t *testing.T) {
+		var args []driver.NamedValue
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`SELECT count(*) FROM "notes"`).WithReply([]map[string]interface{}{{"count": 3}})
+		mocket.Catcher.NewMock().WithQuery(`SELECT * FROM "notes"`).WithReply(testNote[1:]).WithCallback(func(_ string, a []driver.NamedValue) {
+			args = a
+		})
+		rw := httptest.NewRecorder()
+		r.ListNotes(rw, withUser(httptest.NewRequest(http.MethodGet, "/?page=2&per_page=2", nil), testUser))
+
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, "3", rw.Header().Get("X-Total-Count"))
+		if assert.GreaterOrEqual(t, len(args), 2) {
+			assert.Equal(t, int64(2), args[len(args)-2].Value)
+			assert.Equal(t, int64(2), args[len(args)-1].Value)
+		}
+	})
+}
+
 func TestCreateNote(t *testing.T) {
 	db := setupTestDB()
 	r := &Record{DB: db}
 
 	t.Run(errInvalidMethod, func(t *testing.T) {
 		rw := httptest.NewRecorder()
-		r.CreateNote(rw, &http.Request{Method: http.MethodGet})
+		r.CreateNote(rw, withUser(&http.Request{Method: http.MethodGet}, testUser))
 
 		assert.Equal(t, http.StatusMethodNotAllowed, rw.Code)
 	})
@@ -124,10 +164,10 @@ func TestCreateNote(t *testing.T) {
 	t.Run(successOneRecord, func(t *testing.T) {
 		req := io.NopCloser(strings.NewReader(`{"title": "Sample note #345", "content": "Grocery list"}`))
 		rw := httptest.NewRecorder()
-		r.CreateNote(rw, &http.Request{
+		r.CreateNote(rw, withUser(&http.Request{
 			Method: http.MethodPost,
 			Body:   req,
-		})
+		}, testUser))
 
 		assert.Equal(t, http.StatusCreated, rw.Code)
 	})
@@ -139,17 +179,17 @@ func TestDeleteNote(t *testing.T) {
 
 	t.Run(errInvalidMethod, func(t *testing.T) {
 		rw := httptest.NewRecorder()
-		r.DeleteNote(rw, &http.Request{Method: http.MethodPost})
+		r.DeleteNote(rw, withUser(&http.Request{Method: http.MethodPost}, testUser))
 
 		assert.Equal(t, http.StatusMethodNotAllowed, rw.Code)
 	})
 
 	t.Run(errMissingParam, func(t *testing.T) {
 		rw := httptest.NewRecorder()
-		r.DeleteNote(rw, &http.Request{
+		r.DeleteNote(rw, withUser(&http.Request{
 			Method: http.MethodDelete,
 			URL:    &url.URL{},
-		})
+		}, testUser))
 
 		assert.Equal(t, http.StatusBadRequest, rw.Code)
 	})
@@ -157,12 +197,12 @@ func TestDeleteNote(t *testing.T) {
 	t.Run(errRecordNotFound, func(t *testing.T) {
 		rw := httptest.NewRecorder()
 		mocket.Catcher.Reset().NewMock().WithRowsNum(0)
-		r.DeleteNote(rw, &http.Request{
+		r.DeleteNote(rw, withUser(&http.Request{
 			Method: http.MethodDelete,
 			URL: &url.URL{
 				RawQuery: "id=99",
 			},
-		})
+		}, testUser))
 
 		assert.Equal(t, http.StatusNotFound, rw.Code)
 	})
@@ -170,12 +210,12 @@ func TestDeleteNote(t *testing.T) {
 	t.Run(successRecordDeleted, func(t *testing.T) {
 		rw := httptest.NewRecorder()
 		mocket.Catcher.Reset().NewMock().WithRowsNum(1)
-		r.DeleteNote(rw, &http.Request{
+		r.DeleteNote(rw, withUser(&http.Request{
 			Method: http.MethodDelete,
 			URL: &url.URL{
 				RawQuery: "id=23",
 			},
-		})
+		}, testUser))
 
 		assert.Equal(t, http.StatusOK, rw.Code)
 	})
@@ -187,17 +227,17 @@ func TestGetNote(t *testing.T) {
 
 	t.Run(errInvalidMethod, func(t *testing.T) {
 		rw := httptest.NewRecorder()
-		r.GetNote(rw, &http.Request{Method: http.MethodPost})
+		r.GetNote(rw, withUser(&http.Request{Method: http.MethodPost}, testUser))
 
 		assert.Equal(t, http.StatusMethodNotAllowed, rw.Code)
 	})
 
 	t.Run(errMissingParam, func(t *testing.T) {
 		rw := httptest.NewRecorder()
-		r.GetNote(rw, &http.Request{
+		r.GetNote(rw, withUser(&http.Request{
 			Method: http.MethodGet,
 			URL:    &url.URL{},
-		})
+		}, testUser))
 
 		assert.Equal(t, http.StatusBadRequest, rw.Code)
 	})
@@ -205,12 +245,12 @@ func TestGetNote(t *testing.T) {
 	t.Run(errRecordNotFound, func(t *testing.T) {
 		rw := httptest.NewRecorder()
 		mocket.Catcher.Reset().NewMock().WithRowsNum(0)
-		r.GetNote(rw, &http.Request{
+		r.GetNote(rw, withUser(&http.Request{
 			Method: http.MethodGet,
 			URL: &url.URL{
 				RawQuery: "id=99",
 			},
-		})
+		}, testUser))
 
 		assert.Equal(t, http.StatusNotFound, rw.Code)
 	})
@@ -219,12 +259,12 @@ func TestGetNote(t *testing.T) {
 		rw := httptest.NewRecorder()
 		records := []map[string]interface{}{testNote[0]}
 		mocket.Catcher.Reset().NewMock().WithReply(records)
-		r.GetNote(rw, &http.Request{
+		r.GetNote(rw, withUser(&http.Request{
 			Method: http.MethodGet,
 			URL: &url.URL{
 				RawQuery: "id=123",
 			},
-		})
+		}, testUser))
 		assert.Equal(t, http.StatusOK, rw.Code)
 
 		res, err := io.ReadAll(rw.Body)
@@ -238,3 +278,41 @@ func TestGetNote(t *testing.T) {
 		assert.Equal(t, "A reminder to buy a list of grocery items", note.Content)
 	})
 }
+
+func TestGetNoteHTML(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db}
+
+	t.Run("error: invalid format", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		r.GetNote(rw, withUser(&http.Request{
+			Method: http.MethodGet,
+			URL: &url.URL{
+				RawQuery: "id=123&format=pdf",
+			},
+		}, testUser))
+
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+
+	t.Run(successRecordFound, func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		records := []map[string]interface{}{{"title": "Groceries", "content": "# List\n\n- [ ] Eggs"}}
+		mocket.Catcher.Reset().NewMock().WithReply(records)
+		r.GetNote(rw, withUser(&http.Request{
+			Method: http.MethodGet,
+			URL: &url.URL{
+				RawQuery: "id=123&format=html",
+			},
+		}, testUser))
+		assert.Equal(t, http.StatusOK, rw.Code)
+
+		var note Note
+		err := json.Unmarshal(rw.Body.Bytes(), &note)
+		assert.Nil(t, err)
+
+		assert.Equal(t, "# List\n\n- [ ] Eggs", note.Content)
+		assert.Contains(t, note.Rendered.HTML, `<h1 id="list">List</h1>`)
+		assert.Equal(t, "list", note.Rendered.TOC[0].ID)
+	})
+}
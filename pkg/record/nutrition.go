@@ -0,0 +1,143 @@
+package record
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/jvmistica/knowledge-base-go/pkg/nutrition"
+)
+
+// IngredientMapping is the structure of the ingredient_mappings table, which
+// links an ingredient that could not be matched automatically to a food
+type IngredientMapping struct {
+	ID          uint      `json:"id"`
+	Ingredient  string    `json:"ingredient" gorm:"uniqueIndex:idx_ingredient_mappings_workspace"`
+	Food        string    `json:"food"`
+	WorkspaceID uint      `json:"-" gorm:"uniqueIndex:idx_ingredient_mappings_workspace;not null;default:0"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// recipeNutrition computes the nutrition facts of a recipe
+func (re *Record) recipeNutrition(recipe Recipe) (*nutrition.Facts, error) {
+	var mappings []IngredientMapping
+	if result := re.DB.Find(&mappings); result.Error != nil {
+		return nil, result.Error
+	}
+
+	overrides := make(map[string]string, len(mappings))
+	for _, m := range mappings {
+		overrides[m.Ingredient] = m.Food
+	}
+
+	return re.Nutrition.Compute(recipe.Ingredients, recipe.Servings, overrides), nil
+}
+
+// ListIngredientMappings lists all the manual ingredient mappings
+func (re *Record) ListIngredientMappings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	re = re.inWorkspace(r)
+
+	var mappings []IngredientMapping
+	if result := re.DB.Find(&mappings); result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	mappingsList, err := json.Marshal(mappings)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.Write(mappingsList)
+}
+
+// MapIngredient maps an unmatched ingredient to a food of the food
+// composition database, replacing any existing mapping of the ingredient
+func (re *Record) MapIngredient(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if re.Nutrition == nil {
+		http.Error(w, "Nutrition module is disabled", http.StatusNotImplemented)
+		return
+	}
+
+	re = re.inWorkspace(r)
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer r.Body.Close()
+
+	var mapping IngredientMapping
+	if err := json.Unmarshal(body, &mapping); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	mapping.Ingredient = nutrition.Normalize(mapping.Ingredient)
+	if mapping.Ingredient == "" {
+		http.Error(w, "Missing field: 'ingredient'", http.StatusBadRequest)
+		return
+	}
+
+	food, ok := re.Nutrition.Food(mapping.Food)
+	if !ok {
+		http.Error(w, fmt.Sprintf("Unknown food: '%s'", mapping.Food), http.StatusBadRequest)
+		return
+	}
+	mapping.Food = food.Name
+
+	result := re.DB.Where("ingredient = ?", mapping.Ingredient).
+		Assign(IngredientMapping{Food: mapping.Food}).
+		FirstOrCreate(&mapping)
+	if result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+// DeleteIngredientMapping deletes a manual ingredient mapping
+func (re *Record) DeleteIngredientMapping(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	re = re.inWorkspace(r)
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "Missing query parameter: 'id'", http.StatusBadRequest)
+		return
+	}
+
+	result := re.DB.Where(filterByID, id).Delete(IngredientMapping{})
+	if result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,58 @@
+package record
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	mocket "github.com/selvatico/go-mocket"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jvmistica/knowledge-base-go/pkg/nutrition"
+)
+
+func TestMapIngredient(t *testing.T) {
+	db := setupTestDB()
+	foods, err := nutrition.LoadBundled()
+	assert.Nil(t, err)
+	r := &Record{DB: db, Nutrition: foods}
+
+	t.Run(errInvalidMethod, func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		r.MapIngredient(rw, withUser(&http.Request{Method: http.MethodGet}, testUser))
+
+		assert.Equal(t, http.StatusMethodNotAllowed, rw.Code)
+	})
+
+	t.Run("error: nutrition disabled", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		(&Record{DB: db}).MapIngredient(rw, withUser(&http.Request{Method: http.MethodPost}, testUser))
+
+		assert.Equal(t, http.StatusNotImplemented, rw.Code)
+	})
+
+	t.Run("error: unknown food", func(t *testing.T) {
+		req := io.NopCloser(strings.NewReader(`{"ingredient": "calamansi", "food": "dragon fruit"}`))
+		rw := httptest.NewRecorder()
+		r.MapIngredient(rw, withUser(&http.Request{
+			Method: http.MethodPost,
+			Body:   req,
+		}, testUser))
+
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+
+	t.Run(successOneRecord, func(t *testing.T) {
+		mocket.Catcher.Reset()
+		req := io.NopCloser(strings.NewReader(`{"ingredient": "2 pcs Calamansi", "food": "lemon"}`))
+		rw := httptest.NewRecorder()
+		r.MapIngredient(rw, withUser(&http.Request{
+			Method: http.MethodPost,
+			Body:   req,
+		}, testUser))
+
+		assert.Equal(t, http.StatusCreated, rw.Code)
+	})
+}
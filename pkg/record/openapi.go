@@ -0,0 +1,167 @@
+package record
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// openAPIPaths is the OpenAPI document of the API without its schemas
+//
+//go:embed data/openapi.json
+var openAPIPaths []byte
+
+// apiDocs is the page rendering the OpenAPI document
+//
+//go:embed data/docs.html
+var apiDocs []byte
+
+// schemaTypes are the types whose schemas are derived from their structs
+var schemaTypes = []any{
+	Note{}, Recipe{}, Script{}, Execution{}, ParameterError{}, RenderRequest{},
+	RunRequest{}, Attachment{}, Link{}, IngredientMapping{},
+}
+
+// openAPIDocument returns the OpenAPI document of the API, built once
+var openAPIDocument = sync.OnceValues(func() ([]byte, error) {
+	doc, err := OpenAPIDocument()
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(doc, "", "  ")
+})
+
+// OpenAPIDocument returns the OpenAPI document of the API, with the schemas
+// of its types derived from their Go structs
+func OpenAPIDocument() (map[string]any, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(openAPIPaths, &doc); err != nil {
+		return nil, err
+	}
+
+	components, ok := doc["components"].(map[string]any)
+	if !ok {
+		components = map[string]any{}
+		doc["components"] = components
+	}
+
+	schemas := map[string]any{}
+	for _, v := range schemaTypes {
+		schemaOf(reflect.TypeOf(v), schemas)
+	}
+	components["schemas"] = schemas
+
+	return doc, nil
+}
+
+// schemaOf returns the JSON schema of a type. Named structs are added to
+// schemas and referenced.
+func schemaOf(t reflect.Type, schemas map[string]any) map[string]any {
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schemaOf(t.Elem(), schemas)
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]any{"type": "array", "items": schemaOf(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaOf(t.Elem(), schemas)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return objectSchema(t, schemas)
+		}
+
+		if _, ok := schemas[t.Name()]; !ok {
+			// Reserve the name first so recursive types terminate
+			schemas[t.Name()] = map[string]any{}
+			schemas[t.Name()] = objectSchema(t, schemas)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	}
+
+	return map[string]any{}
+}
+
+// objectSchema returns the JSON schema of the fields of a struct as encoded
+// by encoding/json, with the fields of embedded structs inlined
+func objectSchema(t reflect.Type, schemas map[string]any) map[string]any {
+	properties := map[string]any{}
+	addProperties(t, schemas, properties)
+
+	return map[string]any{"type": "object", "properties": properties}
+}
+
+// addProperties adds the JSON properties of the fields of a struct
+func addProperties(t reflect.Type, schemas map[string]any, properties map[string]any) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			addProperties(field.Type, schemas, properties)
+			continue
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = schemaOf(field.Type, schemas)
+	}
+}
+
+// OpenAPI serves the OpenAPI document of the API
+func (re *Record) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	doc, err := openAPIDocument()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(doc)
+}
+
+// APIDocs serves a page documenting the API from its OpenAPI document
+func (re *Record) APIDocs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Add("content-type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(apiDocs)
+}
@@ -0,0 +1,108 @@
+package record
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// documentedResources are the resources whose routes the OpenAPI document describes
+var documentedResources = []string{"notes", "recipes", "scripts"}
+
+func TestOpenAPIRoutes(t *testing.T) {
+	doc, err := OpenAPIDocument()
+	assert.Nil(t, err)
+
+	var documented []string
+	for path, item := range doc["paths"].(map[string]any) {
+		for method := range item.(map[string]any) {
+			documented = append(documented, strings.ToUpper(method)+" "+path)
+		}
+	}
+	sort.Strings(documented)
+
+	var routed []string
+	for _, route := range (&Record{}).Routes() {
+		path := strings.TrimPrefix(route.Pattern, apiPrefix)
+		resource, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+		if slices.Contains(documentedResources, resource) {
+			routed = append(routed, route.Method+" "+path)
+		}
+	}
+	sort.Strings(routed)
+
+	assert.Equal(t, routed, documented, "the routes and the OpenAPI document drifted apart")
+}
+
+func TestOpenAPISchemas(t *testing.T) {
+	doc, err := OpenAPIDocument()
+	assert.Nil(t, err)
+
+	data, err := json.Marshal(doc)
+	assert.Nil(t, err)
+
+	// Every reference resolves
+	var refs []string
+	var collect func(v any)
+	collect = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			if ref, ok := v["$ref"].(string); ok {
+				refs = append(refs, ref)
+			}
+			for _, child := range v {
+				collect(child)
+			}
+		case []any:
+			for _, child := range v {
+				collect(child)
+			}
+		}
+	}
+	collect(doc)
+	assert.NotEmpty(t, refs)
+
+	for _, ref := range refs {
+		var node any = doc
+		for _, key := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+			m, ok := node.(map[string]any)
+			if !assert.True(t, ok, ref) {
+				break
+			}
+			node, ok = m[key]
+			assert.True(t, ok, ref)
+		}
+	}
+
+	// The schemas follow the JSON encoding of the structs
+	note := doc["components"].(map[string]any)["schemas"].(map[string]any)["Note"].(map[string]any)["properties"].(map[string]any)
+	assert.Contains(t, note, "content")
+	assert.Contains(t, note, "encrypted")
+	assert.Contains(t, note, "visibility")
+	assert.NotContains(t, note, "WorkspaceID")
+	assert.Equal(t, map[string]any{"type": "string", "format": "date-time"}, note["created_at"])
+	assert.Contains(t, string(data), `"#/components/schemas/Finding"`)
+}
+
+func TestOpenAPI(t *testing.T) {
+	r := &Record{}
+
+	rw := httptest.NewRecorder()
+	r.OpenAPI(rw, httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	var doc map[string]any
+	assert.Nil(t, json.Unmarshal(rw.Body.Bytes(), &doc))
+	assert.Equal(t, "3.1.0", doc["openapi"])
+
+	rw = httptest.NewRecorder()
+	r.APIDocs(rw, httptest.NewRequest(http.MethodGet, "/api/v1/docs", nil))
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Contains(t, rw.Body.String(), "openapi.json")
+}
@@ -0,0 +1,259 @@
+package record
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Visibilities of a record
+const (
+	VisibilityPrivate = "private"
+	VisibilityTeam    = "team"
+	VisibilityPublic  = "public"
+)
+
+// visibilities are the supported visibilities
+var visibilities = []string{VisibilityPrivate, VisibilityTeam, VisibilityPublic}
+
+// Access levels of a share
+const (
+	AccessRead = "read"
+	AccessEdit = "edit"
+)
+
+// accessLevels are the supported access levels
+var accessLevels = []string{AccessRead, AccessEdit}
+
+// Ownership is the owner and visibility of a record. Private records are
+// only visible to their owner, team records to the members of the owner's
+// teams according to their role and public records to everyone. Records
+// created before ownership was introduced have no owner and are visible to
+// everyone.
+type Ownership struct {
+	OwnerID     uint   `json:"owner_id" gorm:"index"`
+	Visibility  string `json:"visibility" gorm:"not null;default:private"`
+	WorkspaceID uint   `json:"-" gorm:"index;not null;default:0"`
+}
+
+// Share is the structure of the shares table, read or edit access to a
+// record given to a specific user or to every member of a team
+type Share struct {
+	ID          uint      `json:"id"`
+	RecordType  string    `json:"record_type" gorm:"index:idx_shares_record"`
+	RecordID    uint      `json:"record_id" gorm:"index:idx_shares_record"`
+	UserID      *uint     `json:"user_id,omitempty" gorm:"index"`
+	TeamID      *uint     `json:"team_id,omitempty" gorm:"index"`
+	Level       string    `json:"level"`
+	WorkspaceID uint      `json:"-" gorm:"index;not null;default:0"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// validate checks the visibility of a new or updated record, defaulting to private
+func (o *Ownership) validate(create bool) error {
+	if o.Visibility == "" && create {
+		o.Visibility = VisibilityPrivate
+	}
+
+	if o.Visibility != "" && !slices.Contains(visibilities, o.Visibility) {
+		return fmt.Errorf("Invalid visibility: '%s', supported visibilities are %s",
+			o.Visibility, strings.Join(visibilities, ", "))
+	}
+
+	return nil
+}
+
+// ShareInput is the body of a request creating a share
+type ShareInput struct {
+	RecordType string `json:"record_type"`
+	RecordID   uint   `json:"record_id"`
+	UserID     *uint  `json:"user_id"`
+	TeamID     *uint  `json:"team_id"`
+	Level      string `json:"level"`
+}
+
+// validate checks the record, grantee and level of a new share
+func (s *ShareInput) validate() error {
+	if _, ok := recordTables[s.RecordType]; !ok {
+		return fmt.Errorf("Invalid record type: '%s'", s.RecordType)
+	}
+
+	if (s.UserID == nil) == (s.TeamID == nil) {
+		return errors.New("A share needs either a user_id or a team_id")
+	}
+
+	if !slices.Contains(accessLevels, s.Level) {
+		return fmt.Errorf("Invalid level: '%s', supported levels are %s", s.Level, strings.Join(accessLevels, ", "))
+	}
+
+	return nil
+}
+
+// currentUser returns the authenticated user of a request, or writes an
+// Unauthorized response if there is none
+func currentUser(w http.ResponseWriter, r *http.Request) (*User, bool) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		unauthorized(w, "Not logged in")
+	}
+
+	return user, ok
+}
+
+// deleteShares deletes the shares of a deleted record
+func (re *Record) deleteShares(typ string, id string) error {
+	return re.DB.Where("record_type = ? AND record_id = ?", typ, id).Delete(&Share{}).Error
+}
+
+// CreateShare shares a record managed by the authenticated user with a user or a team
+func (re *Record) CreateShare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	re = re.inWorkspace(r)
+
+	var input ShareInput
+	if err := decodeBody(r, &input); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := input.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	allowed, err := re.can(user, input.RecordType, input.RecordID, ActionManage)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !allowed {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	share := Share{RecordType: input.RecordType, RecordID: input.RecordID, UserID: input.UserID, TeamID: input.TeamID, Level: input.Level}
+	err = re.transaction(func(tx *Record) error {
+		if result := tx.DB.Create(&share); result.Error != nil {
+			return result.Error
+		}
+		return tx.audit(r, AuditCreate, resourceShare, share.ID, nil, share)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, share)
+}
+
+// ListShares lists the shares of a specific record managed by the authenticated user
+func (re *Record) ListShares(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	re = re.inWorkspace(r)
+
+	query := r.URL.Query()
+	typ, id := query.Get("type"), query.Get("id")
+	if typ == "" || id == "" {
+		http.Error(w, "Missing query parameters: 'type' and 'id'", http.StatusBadRequest)
+		return
+	}
+
+	allowed, err := re.can(user, typ, id, ActionManage)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !allowed {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var shares []Share
+	result := re.DB.Where("record_type = ? AND record_id = ?", typ, id).Order("id").Find(&shares)
+	if result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, shares)
+}
+
+// DeleteShare deletes a share of a record managed by the authenticated user
+func (re *Record) DeleteShare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	re = re.inWorkspace(r)
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "Missing query parameter: 'id'", http.StatusBadRequest)
+		return
+	}
+
+	var share Share
+	result := re.DB.Where(filterByID, id).Find(&share)
+	if result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	allowed, err := re.can(user, share.RecordType, share.RecordID, ActionManage)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !allowed {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	err = re.transaction(func(tx *Record) error {
+		if result := tx.DB.Where(filterByID, id).Delete(&Share{}); result.Error != nil {
+			return result.Error
+		}
+		return tx.audit(r, AuditDelete, resourceShare, share.ID, share, nil)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
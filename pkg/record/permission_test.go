@@ -0,0 +1,200 @@
+package record
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	mocket "github.com/selvatico/go-mocket"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestOwnershipValidate(t *testing.T) {
+	o := Ownership{}
+	assert.Nil(t, o.validate(true))
+	assert.Equal(t, VisibilityPrivate, o.Visibility)
+
+	o = Ownership{}
+	assert.Nil(t, o.validate(false))
+	assert.Equal(t, "", o.Visibility)
+
+	o = Ownership{Visibility: "everyone"}
+	assert.NotNil(t, o.validate(true))
+}
+
+func TestShareValidate(t *testing.T) {
+	user, team := uint(2), uint(3)
+
+	assert.Nil(t, (&ShareInput{RecordType: TypeNote, RecordID: 1, UserID: &user, Level: AccessRead}).validate())
+	assert.Nil(t, (&ShareInput{RecordType: TypeScript, RecordID: 1, TeamID: &team, Level: AccessEdit}).validate())
+	assert.NotNil(t, (&ShareInput{RecordType: "page", RecordID: 1, UserID: &user, Level: AccessRead}).validate())
+	assert.NotNil(t, (&ShareInput{RecordType: TypeNote, RecordID: 1, Level: AccessRead}).validate())
+	assert.NotNil(t, (&ShareInput{RecordType: TypeNote, RecordID: 1, UserID: &user, TeamID: &team, Level: AccessRead}).validate())
+	assert.NotNil(t, (&ShareInput{RecordType: TypeNote, RecordID: 1, UserID: &user, Level: "admin"}).validate())
+}
+
+func TestAuthorize(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db}
+	dry := db.Session(&gorm.Session{DryRun: true})
+
+	t.Run("read", func(t *testing.T) {
+		stmt := dry.Scopes(r.authorize(testUser, TypeRecipe, ActionRead)).Find(&[]Recipe{}).Statement
+		sql := stmt.SQL.String()
+
+		assert.Contains(t, sql, `owner_id = $1 OR owner_id = 0 OR visibility = $2`)
+		assert.Contains(t, sql, `SELECT "record_id" FROM "shares"`)
+		assert.Contains(t, stmt.Vars, VisibilityPublic)
+		assert.Contains(t, stmt.Vars, RoleViewer)
+	})
+
+	t.Run("edit", func(t *testing.T) {
+		stmt := dry.Scopes(r.authorize(testUser, TypeRecipe, ActionEdit)).Find(&[]Recipe{}).Statement
+		sql := stmt.SQL.String()
+
+		assert.NotContains(t, sql, `owner_id = 0 OR`)
+		assert.Contains(t, sql, `owner_id = 0 AND workspace_id IN (SELECT "workspace_id" FROM "workspace_members"`)
+		assert.Contains(t, sql, `SELECT "record_id" FROM "shares"`)
+		assert.NotContains(t, stmt.Vars, RoleViewer)
+		assert.NotContains(t, stmt.Vars, AccessRead)
+		assert.Contains(t, stmt.Vars, RoleEditor)
+	})
+
+	t.Run("manage", func(t *testing.T) {
+		stmt := dry.Scopes(r.authorize(testUser, TypeRecipe, ActionManage)).Find(&[]Recipe{}).Statement
+		sql := stmt.SQL.String()
+
+		assert.NotContains(t, sql, `"shares"`)
+		assert.Contains(t, sql, `owner_id = 0 AND workspace_id IN (SELECT "workspace_id" FROM "workspace_members"`)
+		assert.NotContains(t, stmt.Vars, RoleEditor)
+		assert.Contains(t, stmt.Vars, RoleAdmin)
+	})
+}
+
+func TestReadableSources(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db}
+
+	sql := db.Session(&gorm.Session{DryRun: true}).Scopes(r.readableSources(testUser)).Find(&[]Link{}).Statement.SQL.String()
+	for _, table := range []string{`"notes"`, `"recipes"`, `"scripts"`} {
+		assert.Contains(t, sql, table)
+	}
+}
+
+func TestRecordOwnership(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db}
+
+	t.Run("not logged in", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		r.ListNotes(rw, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		assert.Equal(t, http.StatusUnauthorized, rw.Code)
+	})
+
+	t.Run("owner is set on create", func(t *testing.T) {
+		var args []driver.NamedValue
+		mocket.Catcher.Reset().NewMock().WithQuery(`INSERT INTO "notes"`).WithCallback(func(_ string, a []driver.NamedValue) {
+			args = a
+		})
+		rw := httptest.NewRecorder()
+		r.CreateNote(rw, withUser(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"title": "Mine", "owner_id": 7}`)), testUser))
+		assert.Equal(t, http.StatusCreated, rw.Code)
+
+		values := make([]driver.Value, len(args))
+		for i, a := range args {
+			values[i] = a.Value
+		}
+		assert.Contains(t, values, int64(testUser.ID))
+		assert.NotContains(t, values, int64(7))
+		assert.Contains(t, values, VisibilityPrivate)
+	})
+
+	t.Run("invalid visibility", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		r.CreateScript(rw, withUser(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name": "x", "visibility": "world"}`)), testUser))
+
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+
+	t.Run("update without access", func(t *testing.T) {
+		var query string
+		mocket.Catcher.Reset().NewMock().WithQuery(`SELECT * FROM "recipes"`).WithRowsNum(0).WithCallback(func(q string, _ []driver.NamedValue) {
+			query = q
+		})
+		var updated bool
+		mocket.Catcher.NewMock().WithQuery(`UPDATE "recipes"`).WithCallback(func(_ string, _ []driver.NamedValue) {
+			updated = true
+		})
+		rw := httptest.NewRecorder()
+		r.UpdateRecipe(rw, withUser(httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"id": 4, "name": "Adobo"}`)), testUser))
+
+		assert.Equal(t, http.StatusNotFound, rw.Code)
+		assert.Contains(t, query, `SELECT "record_id" FROM "shares"`)
+		assert.Contains(t, query, "FOR UPDATE")
+		assert.False(t, updated)
+	})
+
+	t.Run("only the owner changes the visibility", func(t *testing.T) {
+		var query string
+		mocket.Catcher.Reset().NewMock().WithQuery(`SELECT * FROM "notes"`).WithRowsNum(0).WithCallback(func(q string, _ []driver.NamedValue) {
+			query = q
+		})
+		rw := httptest.NewRecorder()
+		r.UpdateNote(rw, withUser(httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"id": 4, "visibility": "public"}`)), testUser))
+
+		assert.Equal(t, http.StatusNotFound, rw.Code)
+		assert.Contains(t, query, "owner_id = ")
+		assert.NotContains(t, query, `"shares"`)
+	})
+}
+
+func TestCreateShare(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db}
+
+	t.Run("invalid share", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		r.CreateShare(rw, withUser(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"record_type": "note", "record_id": 1, "level": "read"}`)), testUser))
+
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+
+	t.Run("not the owner", func(t *testing.T) {
+		mocket.Catcher.Reset().NewMock().WithQuery(`SELECT count(*) FROM "notes"`).WithReply([]map[string]interface{}{{"count": 0}})
+		rw := httptest.NewRecorder()
+		r.CreateShare(rw, withUser(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"record_type": "note", "record_id": 1, "user_id": 2, "level": "read"}`)), testUser))
+
+		assert.Equal(t, http.StatusNotFound, rw.Code)
+	})
+
+	t.Run(successOneRecord, func(t *testing.T) {
+		mocket.Catcher.Reset().NewMock().WithQuery(`SELECT count(*) FROM "notes"`).WithReply([]map[string]interface{}{{"count": 1}})
+		rw := httptest.NewRecorder()
+		r.CreateShare(rw, withUser(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"record_type": "note", "record_id": 1, "team_id": 3, "level": "edit"}`)), testUser))
+
+		assert.Equal(t, http.StatusCreated, rw.Code)
+	})
+
+	t.Run("server fields ignored", func(t *testing.T) {
+		var values []driver.Value
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`SELECT count(*) FROM "notes"`).WithReply([]map[string]interface{}{{"count": 1}})
+		mocket.Catcher.NewMock().WithQuery(`INSERT INTO "shares"`).WithCallback(func(_ string, args []driver.NamedValue) {
+			for _, a := range args {
+				values = append(values, a.Value)
+			}
+		})
+		rw := httptest.NewRecorder()
+		body := `{"id": 42, "record_type": "note", "record_id": 1, "user_id": 2, "level": "read", "created_at": "2001-01-01T00:00:00Z"}`
+		r.CreateShare(rw, withUser(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)), testUser))
+
+		assert.Equal(t, http.StatusCreated, rw.Code)
+		assert.NotContains(t, values, int64(42))
+		assert.NotContains(t, rw.Body.String(), `"id":42`)
+		assert.NotContains(t, rw.Body.String(), "2001")
+	})
+}
@@ -6,6 +6,11 @@ import (
 	"io"
 	"net/http"
 	"time"
+
+	"gorm.io/gorm/clause"
+
+	"github.com/jvmistica/knowledge-base-go/pkg/markdown"
+	"github.com/jvmistica/knowledge-base-go/pkg/nutrition"
 )
 
 // Recipe is the structure of the recipes table
@@ -15,8 +20,16 @@ type Recipe struct {
 	Description string    `json:"description"`
 	Instruction string    `json:"instruction"`
 	Category    string    `json:"category"`
+	Ingredients string    `json:"ingredients"`
+	Servings    int       `json:"servings"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
+
+	Ownership
+
+	Nutrition           *nutrition.Facts   `json:"nutrition,omitempty" gorm:"-"`
+	RenderedInstruction *markdown.Document `json:"rendered_instruction,omitempty" gorm:"-"`
+	Photos              []Photo            `json:"photos,omitempty" gorm:"-"`
 }
 
 // ListRecipes lists all the recipes in the database
@@ -26,12 +39,41 @@ func (re *Record) ListRecipes(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	re = re.inWorkspace(r)
+
+	query, ok := listPage(w, r, re.DB.Scopes(re.authorize(user, TypeRecipe, ActionRead)), &Recipe{})
+	if !ok {
+		return
+	}
+
 	var recipes []Recipe
-	if result := re.DB.Find(&recipes); result.Error != nil {
+	if result := query.Find(&recipes); result.Error != nil {
 		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
 		return
 	}
 
+	if re.Blobs != nil && len(recipes) > 0 {
+		ids := make([]uint, len(recipes))
+		for i, recipe := range recipes {
+			ids[i] = recipe.ID
+		}
+
+		photos, err := re.recipePhotos(ids...)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		for i := range recipes {
+			recipes[i].Photos = photos[recipes[i].ID]
+		}
+	}
+
 	recipesList, err := json.Marshal(recipes)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -49,6 +91,13 @@ func (re *Record) CreateRecipe(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	re = re.inWorkspace(r)
+
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -62,13 +111,35 @@ func (re *Record) CreateRecipe(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result := re.DB.Create(&recipe)
-	if result.Error != nil {
-		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+	if !re.prepareCreate(w, r, user, TypeRecipe, &recipe.Ownership) {
 		return
 	}
 
+	err = re.transaction(func(tx *Record) error {
+		if result := tx.DB.Create(&recipe); result.Error != nil {
+			return result.Error
+		}
+
+		if err := tx.syncLinks(user, TypeRecipe, recipe.ID, recipe.Description, recipe.Instruction); err != nil {
+			return err
+		}
+
+		return tx.audit(r, AuditCreate, TypeRecipe, recipe.ID, nil, recipe)
+	})
+	if err != nil {
+		writeTransactionError(w, err)
+		return
+	}
+
+	details, err := json.Marshal(recipe)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
 	w.WriteHeader(http.StatusCreated)
+	w.Write(details)
 }
 
 // DeleteRecipe deletes a recipe
@@ -78,22 +149,59 @@ func (re *Record) DeleteRecipe(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	re = re.inWorkspace(r)
+
 	id := r.URL.Query().Get("id")
 	if id == "" {
 		http.Error(w, "Missing query parameter: 'id'", http.StatusBadRequest)
 		return
 	}
 
-	result := re.DB.Where(filterByID, id).Delete(Recipe{})
-	if result.Error != nil {
-		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
-		return
-	}
+	var hashes []string
+	err := re.transaction(func(tx *Record) error {
+		var before Recipe
+		if result := tx.DB.Where(filterByID, id).Find(&before); result.Error != nil {
+			return result.Error
+		}
 
-	if result.RowsAffected == 0 {
-		w.WriteHeader(http.StatusNotFound)
+		result := tx.DB.Scopes(tx.authorize(user, TypeRecipe, ActionManage)).Where(filterByID, id).Delete(Recipe{})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return errNotFound
+		}
+
+		if err := tx.deleteLinks(TypeRecipe, id); err != nil {
+			return err
+		}
+
+		if err := tx.deleteRelations(TypeRecipe, id); err != nil {
+			return err
+		}
+
+		var err error
+		if hashes, err = tx.deleteAttachments(TypeRecipe, id); err != nil {
+			return err
+		}
+
+		if err := tx.deleteShares(TypeRecipe, id); err != nil {
+			return err
+		}
+
+		return tx.audit(r, AuditDelete, TypeRecipe, before.ID, before, nil)
+	})
+	if err != nil {
+		writeTransactionError(w, err)
 		return
 	}
+	re.releaseBlobs(r.Context(), hashes)
 
 	w.WriteHeader(http.StatusOK)
 }
@@ -105,14 +213,27 @@ func (re *Record) GetRecipe(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	re = re.inWorkspace(r)
+
 	id := r.URL.Query().Get("id")
 	if id == "" {
 		http.Error(w, "Missing query parameter: 'id'", http.StatusBadRequest)
 		return
 	}
 
+	format, err := parseFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	var recipe Recipe
-	result := re.DB.Where(filterByID, id).Find(&recipe)
+	result := re.DB.Scopes(re.authorize(user, TypeRecipe, ActionRead)).Where(filterByID, id).Find(&recipe)
 	if result.Error != nil {
 		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
 		return
@@ -123,6 +244,33 @@ func (re *Record) GetRecipe(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if re.Nutrition != nil {
+		facts, err := re.recipeNutrition(recipe)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		recipe.Nutrition = facts
+	}
+
+	if re.Blobs != nil {
+		photos, err := re.recipePhotos(recipe.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		recipe.Photos = photos[recipe.ID]
+	}
+
+	if format == formatHTML {
+		doc, err := markdown.Render(recipe.Instruction)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		recipe.RenderedInstruction = doc
+	}
+
 	details, err := json.Marshal(recipe)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -140,6 +288,13 @@ func (re *Record) UpdateRecipe(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	re = re.inWorkspace(r)
+
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -153,9 +308,52 @@ func (re *Record) UpdateRecipe(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result := re.DB.Model(&Recipe{}).Where(filterByID, recipe.ID).Updates(recipe)
-	if result.Error != nil {
-		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+	// The owner never changes, and only the owner or a team admin can change the visibility
+	recipe.OwnerID = 0
+	if err := recipe.Ownership.validate(false); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	action := ActionEdit
+	if recipe.Visibility != "" {
+		action = ActionManage
+	}
+
+	err = re.transaction(func(tx *Record) error {
+		// The current version is read and locked with the authorization of the update
+		var before Recipe
+		result := tx.DB.Clauses(clause.Locking{Strength: "UPDATE"}).Scopes(tx.authorize(user, TypeRecipe, action)).Where(filterByID, recipe.ID).Find(&before)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return errNotFound
+		}
+
+		result = tx.DB.Model(&Recipe{}).Where(filterByID, recipe.ID).Updates(recipe)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return errNotFound
+		}
+
+		var stored Recipe
+		if result := tx.DB.Where(filterByID, recipe.ID).Find(&stored); result.Error != nil {
+			return result.Error
+		}
+
+		if err := tx.syncLinks(user, TypeRecipe, recipe.ID, stored.Description, stored.Instruction); err != nil {
+			return err
+		}
+
+		return tx.audit(r, AuditUpdate, TypeRecipe, recipe.ID, before, stored)
+	})
+	if err != nil {
+		writeTransactionError(w, err)
 		return
 	}
 
@@ -11,6 +11,8 @@ import (
 
 	mocket "github.com/selvatico/go-mocket"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/jvmistica/knowledge-base-go/pkg/nutrition"
 )
 
 var (
@@ -66,7 +68,7 @@ func TestListRecipes(t *testing.T) {
 			mocket.Catcher.Reset().NewMock().WithReply(test.dbResult)
 			rw := httptest.NewRecorder()
 
-			r.ListRecipes(rw, &http.Request{Method: test.method})
+			r.ListRecipes(rw, withUser(&http.Request{Method: test.method, URL: &url.URL{}}, testUser))
 			assert.Equal(t, test.expectedStatusCode, rw.Code)
 
 			if !test.wantErr {
@@ -94,7 +96,7 @@ func TestCreateRecipe(t *testing.T) {
 
 	t.Run(errInvalidMethod, func(t *testing.T) {
 		rw := httptest.NewRecorder()
-		r.CreateRecipe(rw, &http.Request{Method: http.MethodGet})
+		r.CreateRecipe(rw, withUser(&http.Request{Method: http.MethodGet}, testUser))
 
 		assert.Equal(t, http.StatusMethodNotAllowed, rw.Code)
 	})
@@ -102,10 +104,10 @@ func TestCreateRecipe(t *testing.T) {
 	t.Run(successOneRecord, func(t *testing.T) {
 		req := io.NopCloser(strings.NewReader(`{"name": "Sample recipe #345", "description": "A soup dish"}`))
 		rw := httptest.NewRecorder()
-		r.CreateRecipe(rw, &http.Request{
+		r.CreateRecipe(rw, withUser(&http.Request{
 			Method: http.MethodPost,
 			Body:   req,
-		})
+		}, testUser))
 
 		assert.Equal(t, http.StatusCreated, rw.Code)
 	})
@@ -117,17 +119,17 @@ func TestDeleteRecipe(t *testing.T) {
 
 	t.Run(errInvalidMethod, func(t *testing.T) {
 		rw := httptest.NewRecorder()
-		r.DeleteRecipe(rw, &http.Request{Method: http.MethodPost})
+		r.DeleteRecipe(rw, withUser(&http.Request{Method: http.MethodPost}, testUser))
 
 		assert.Equal(t, http.StatusMethodNotAllowed, rw.Code)
 	})
 
 	t.Run(errMissingParam, func(t *testing.T) {
 		rw := httptest.NewRecorder()
-		r.DeleteRecipe(rw, &http.Request{
+		r.DeleteRecipe(rw, withUser(&http.Request{
 			Method: http.MethodDelete,
 			URL:    &url.URL{},
-		})
+		}, testUser))
 
 		assert.Equal(t, http.StatusBadRequest, rw.Code)
 	})
@@ -135,12 +137,12 @@ func TestDeleteRecipe(t *testing.T) {
 	t.Run(errRecordNotFound, func(t *testing.T) {
 		rw := httptest.NewRecorder()
 		mocket.Catcher.Reset().NewMock().WithRowsNum(0)
-		r.DeleteRecipe(rw, &http.Request{
+		r.DeleteRecipe(rw, withUser(&http.Request{
 			Method: http.MethodDelete,
 			URL: &url.URL{
 				RawQuery: "id=99",
 			},
-		})
+		}, testUser))
 
 		assert.Equal(t, http.StatusNotFound, rw.Code)
 	})
@@ -148,12 +150,12 @@ func TestDeleteRecipe(t *testing.T) {
 	t.Run(successRecordDeleted, func(t *testing.T) {
 		rw := httptest.NewRecorder()
 		mocket.Catcher.Reset().NewMock().WithRowsNum(1)
-		r.DeleteRecipe(rw, &http.Request{
+		r.DeleteRecipe(rw, withUser(&http.Request{
 			Method: http.MethodDelete,
 			URL: &url.URL{
 				RawQuery: "id=23",
 			},
-		})
+		}, testUser))
 
 		assert.Equal(t, http.StatusOK, rw.Code)
 	})
@@ -165,17 +167,17 @@ func TestGetRecipe(t *testing.T) {
 
 	t.Run(errInvalidMethod, func(t *testing.T) {
 		rw := httptest.NewRecorder()
-		r.GetRecipe(rw, &http.Request{Method: http.MethodPost})
+		r.GetRecipe(rw, withUser(&http.Request{Method: http.MethodPost}, testUser))
 
 		assert.Equal(t, http.StatusMethodNotAllowed, rw.Code)
 	})
 
 	t.Run(errMissingParam, func(t *testing.T) {
 		rw := httptest.NewRecorder()
-		r.GetRecipe(rw, &http.Request{
+		r.GetRecipe(rw, withUser(&http.Request{
 			Method: http.MethodGet,
 			URL:    &url.URL{},
-		})
+		}, testUser))
 
 		assert.Equal(t, http.StatusBadRequest, rw.Code)
 	})
@@ -183,12 +185,12 @@ func TestGetRecipe(t *testing.T) {
 	t.Run(errRecordNotFound, func(t *testing.T) {
 		rw := httptest.NewRecorder()
 		mocket.Catcher.Reset().NewMock().WithRowsNum(0)
-		r.GetRecipe(rw, &http.Request{
+		r.GetRecipe(rw, withUser(&http.Request{
 			Method: http.MethodGet,
 			URL: &url.URL{
 				RawQuery: "id=99",
 			},
-		})
+		}, testUser))
 
 		assert.Equal(t, http.StatusNotFound, rw.Code)
 	})
@@ -197,12 +199,12 @@ func TestGetRecipe(t *testing.T) {
 		rw := httptest.NewRecorder()
 		records := []map[string]interface{}{testRecipe[0]}
 		mocket.Catcher.Reset().NewMock().WithReply(records)
-		r.GetRecipe(rw, &http.Request{
+		r.GetRecipe(rw, withUser(&http.Request{
 			Method: http.MethodGet,
 			URL: &url.URL{
 				RawQuery: "id=123",
 			},
-		})
+		}, testUser))
 		assert.Equal(t, http.StatusOK, rw.Code)
 
 		res, err := io.ReadAll(rw.Body)
@@ -216,3 +218,33 @@ func TestGetRecipe(t *testing.T) {
 		assert.Equal(t, "A very delicious dish", recipe.Description)
 	})
 }
+
+func TestGetRecipeNutrition(t *testing.T) {
+	db := setupTestDB()
+	foods, err := nutrition.LoadBundled()
+	assert.Nil(t, err)
+	r := &Record{DB: db, Nutrition: foods}
+
+	rw := httptest.NewRecorder()
+	records := []map[string]interface{}{
+		{"name": "Rice ball", "ingredients": "3 cups cooked rice\n4 sheets nori\nsalt to taste", "servings": 2},
+	}
+	mocket.Catcher.Reset().NewMock().WithReply(records)
+	r.GetRecipe(rw, withUser(&http.Request{
+		Method: http.MethodGet,
+		URL: &url.URL{
+			RawQuery: "id=123",
+		},
+	}, testUser))
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	var recipe Recipe
+	err = json.Unmarshal(rw.Body.Bytes(), &recipe)
+	assert.Nil(t, err)
+
+	assert.NotNil(t, recipe.Nutrition)
+	assert.Equal(t, 2, recipe.Nutrition.Servings)
+	assert.Len(t, recipe.Nutrition.Matched, 2)
+	assert.Len(t, recipe.Nutrition.Unmatched, 1)
+	assert.Greater(t, recipe.Nutrition.PerServing.Calories, 0.0)
+}
@@ -1,17 +1,125 @@
 package record
 
 import (
+	"fmt"
+	"net/http"
+	"strconv"
+
 	"gorm.io/gorm"
+
+	"github.com/jvmistica/knowledge-base-go/pkg/blob"
+	"github.com/jvmistica/knowledge-base-go/pkg/config"
+	"github.com/jvmistica/knowledge-base-go/pkg/encryption"
+	"github.com/jvmistica/knowledge-base-go/pkg/nutrition"
+	"github.com/jvmistica/knowledge-base-go/pkg/runner"
 )
 
 // Record is the record structure
 type Record struct {
 	DB *gorm.DB
+
+	// Nutrition is the food composition database used to compute the
+	// nutrition facts of recipes, nil if the nutrition module is disabled
+	Nutrition *nutrition.Database
+
+	// Runner runs scripts in sandboxed subprocesses, nil if script
+	// execution is disabled
+	Runner *runner.Runner
+
+	// Blobs stores the content of attachments, nil if attachments are disabled
+	Blobs blob.Store
+
+	// Uploads are the limits applied to uploaded attachments
+	Uploads UploadLimits
+
+	// Auth are the settings of the sessions and the registration of users
+	Auth AuthSettings
+
+	// TrustProxy takes the client IP of audit events from the
+	// X-Forwarded-For header set by a reverse proxy
+	TrustProxy bool
+
+	// Keys are the master keys sealing encrypted notes and scripts, nil if
+	// encryption is disabled
+	Keys *encryption.Keyring
 }
 
 // NewRecord returns a record
 func NewRecord(db *gorm.DB) *Record {
 	return &Record{
 		DB: db,
+		Uploads: UploadLimits{
+			MaxSize: config.DefaultMaxUploadSize,
+			Types:   config.DefaultUploadTypes,
+		},
+	}
+}
+
+// apiPrefix is the path the API is served under
+const apiPrefix = "/api/v1"
+
+// Response formats of the Get endpoints
+const (
+	formatJSON = "json"
+	formatHTML = "html"
+)
+
+// parseFormat returns the response format requested with the format query parameter
+func parseFormat(r *http.Request) (string, error) {
+	format := r.URL.Query().Get("format")
+	switch format {
+	case "", formatJSON:
+		return formatJSON, nil
+	case formatHTML:
+		return formatHTML, nil
 	}
+
+	return "", fmt.Errorf("Invalid format: '%s', supported formats are %s, %s", format, formatJSON, formatHTML)
+}
+
+// Page sizes of the paginated record lists
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// parsePage returns the page and page size requested with the page and
+// per_page query parameters
+func parsePage(r *http.Request, perPage, maxPerPage int) (int, int, error) {
+	page := 1
+	for param, value := range map[string]*int{"page": &page, "per_page": &perPage} {
+		if v := r.URL.Query().Get(param); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || (param == "per_page" && n > maxPerPage) {
+				return 0, 0, fmt.Errorf("Invalid %s: '%s'", param, v)
+			}
+			*value = n
+		}
+	}
+
+	return page, perPage, nil
+}
+
+// listPage limits a list query to the page requested with the page and
+// per_page query parameters and writes the total number of records in the
+// X-Total-Count header. Lists are not paginated without these parameters.
+func listPage(w http.ResponseWriter, r *http.Request, query *gorm.DB, model any) (*gorm.DB, bool) {
+	if !r.URL.Query().Has("page") && !r.URL.Query().Has("per_page") {
+		return query, true
+	}
+
+	page, perPage, err := parsePage(r, defaultPageSize, maxPageSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	var total int64
+	if result := query.Session(&gorm.Session{}).Model(model).Count(&total); result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+	return query.Order("id").Limit(perPage).Offset((page - 1) * perPage), true
 }
@@ -0,0 +1,483 @@
+package record
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Types of a relation
+const (
+	RelationUses      = "uses"
+	RelationDependsOn = "depends-on"
+	RelationSeeAlso   = "see-also"
+	RelationVariantOf = "variant-of"
+)
+
+// relationTypes are the supported relation types
+var relationTypes = []string{RelationUses, RelationDependsOn, RelationSeeAlso, RelationVariantOf}
+
+// errDuplicateRelation is returned when the same relation between two records already exists
+var errDuplicateRelation = errors.New("Relation already exists")
+
+const (
+	defaultDepth = 1
+	maxDepth     = 5
+)
+
+// Relation is the structure of the relations table, an explicit typed
+// relationship from one record to another
+type Relation struct {
+	ID          uint      `json:"id"`
+	SourceType  string    `json:"source_type" gorm:"uniqueIndex:idx_relations_unique;index:idx_relations_source"`
+	SourceID    uint      `json:"source_id" gorm:"uniqueIndex:idx_relations_unique;index:idx_relations_source"`
+	Type        string    `json:"type" gorm:"uniqueIndex:idx_relations_unique"`
+	TargetType  string    `json:"target_type" gorm:"uniqueIndex:idx_relations_unique;index:idx_relations_target"`
+	TargetID    uint      `json:"target_id" gorm:"uniqueIndex:idx_relations_unique;index:idx_relations_target"`
+	WorkspaceID uint      `json:"-" gorm:"index;not null;default:0"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Node is a record in the relation graph
+type Node struct {
+	Key   string `json:"key"`
+	Type  string `json:"type"`
+	ID    uint   `json:"id"`
+	Title string `json:"title"`
+}
+
+// Edge is a relation in the relation graph
+type Edge struct {
+	ID     uint   `json:"id"`
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Type   string `json:"type"`
+}
+
+// Graph is a set of records and the relations between them
+type Graph struct {
+	Nodes []Node `json:"nodes"`
+	Edges []Edge `json:"edges"`
+}
+
+// nodeKey returns the key of a record in the graph, such as "note:1"
+func nodeKey(typ string, id uint) string {
+	return typ + ":" + strconv.FormatUint(uint64(id), 10)
+}
+
+// validate checks the types of a relation and that it does not point to its source
+func (rel *Relation) validate() error {
+	if _, ok := recordTables[rel.SourceType]; !ok {
+		return fmt.Errorf("Invalid source type: '%s'", rel.SourceType)
+	}
+
+	if _, ok := recordTables[rel.TargetType]; !ok {
+		return fmt.Errorf("Invalid target type: '%s'", rel.TargetType)
+	}
+
+	if !slices.Contains(relationTypes, rel.Type) {
+		return fmt.Errorf("Invalid relation type: '%s', supported types are %s",
+			rel.Type, strings.Join(relationTypes, ", "))
+	}
+
+	if rel.SourceType == rel.TargetType && rel.SourceID == rel.TargetID {
+		return errors.New("A record cannot be related to itself")
+	}
+
+	return nil
+}
+
+// CreateRelation creates a new relation from a record the authenticated user
+// can edit to a record they can read
+func (re *Record) CreateRelation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	re = re.inWorkspace(r)
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer r.Body.Close()
+
+	var relation Relation
+	if err := json.Unmarshal(body, &relation); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := relation.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for _, end := range []struct {
+		typ    string
+		id     uint
+		action string
+	}{{relation.SourceType, relation.SourceID, ActionEdit}, {relation.TargetType, relation.TargetID, ActionRead}} {
+		ok, err := re.can(user, end.typ, end.id, end.action)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, fmt.Sprintf("Record not found: '%s'", nodeKey(end.typ, end.id)), http.StatusNotFound)
+			return
+		}
+	}
+
+	err = re.transaction(func(tx *Record) error {
+		var count int64
+		result := tx.DB.Model(&Relation{}).Where(&Relation{SourceType: relation.SourceType, SourceID: relation.SourceID,
+			Type: relation.Type, TargetType: relation.TargetType, TargetID: relation.TargetID}).Count(&count)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if count > 0 {
+			return errDuplicateRelation
+		}
+
+		if result := tx.DB.Create(&relation); result.Error != nil {
+			return result.Error
+		}
+		return tx.audit(r, AuditCreate, resourceRelation, relation.ID, nil, relation)
+	})
+	if errors.Is(err, errDuplicateRelation) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+// DeleteRelation deletes a relation from a record the authenticated user can edit
+func (re *Record) DeleteRelation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	re = re.inWorkspace(r)
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "Missing query parameter: 'id'", http.StatusBadRequest)
+		return
+	}
+
+	var relation Relation
+	result := re.DB.Where(filterByID, id).Find(&relation)
+	if result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	allowed, err := re.can(user, relation.SourceType, relation.SourceID, ActionEdit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !allowed {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	err = re.transaction(func(tx *Record) error {
+		result := tx.DB.Where(filterByID, id).Delete(Relation{})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return errNotFound
+		}
+
+		return tx.audit(r, AuditDelete, resourceRelation, relation.ID, relation, nil)
+	})
+	if err != nil {
+		writeTransactionError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// deleteRelations deletes the relations from and to a deleted record
+func (re *Record) deleteRelations(typ string, id string) error {
+	return re.DB.Where("(source_type = ? AND source_id = ?) OR (target_type = ? AND target_id = ?)",
+		typ, id, typ, id).Delete(&Relation{}).Error
+}
+
+// GetNeighbourhood gets the records related to a specific record, in either
+// direction, up to the given depth. Records the authenticated user cannot
+// read are left out.
+func (re *Record) GetNeighbourhood(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	re = re.inWorkspace(r)
+
+	query := r.URL.Query()
+	typ, id := query.Get("type"), query.Get("id")
+	if typ == "" || id == "" {
+		http.Error(w, "Missing query parameters: 'type' and 'id'", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := recordTables[typ]; !ok {
+		http.Error(w, fmt.Sprintf("Invalid type: '%s'", typ), http.StatusBadRequest)
+		return
+	}
+
+	recordID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid id: '%s'", id), http.StatusBadRequest)
+		return
+	}
+
+	depth := defaultDepth
+	if d := query.Get("depth"); d != "" {
+		depth, err = strconv.Atoi(d)
+		if err != nil || depth < 1 || depth > maxDepth {
+			http.Error(w, fmt.Sprintf("Invalid depth: '%s', must be between 1 and %d", d, maxDepth), http.StatusBadRequest)
+			return
+		}
+	}
+
+	title, ok, err := re.findTitle(typ, uint(recordID), re.authorize(user, typ, ActionRead))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	graph, err := re.neighbourhood(user, Node{Key: nodeKey(typ, uint(recordID)), Type: typ, ID: uint(recordID), Title: title}, depth)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	details, err := json.Marshal(graph)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.Write(details)
+}
+
+// neighbourhood walks the relations breadth-first from a record up to the
+// given depth, skipping the records a user cannot read
+func (re *Record) neighbourhood(user *User, start Node, depth int) (*Graph, error) {
+	graph := &Graph{Nodes: []Node{start}, Edges: []Edge{}}
+	visited := map[string]bool{start.Key: true}
+	hidden := map[string]bool{}
+	seenEdges := map[uint]bool{}
+	frontier := []Node{start}
+
+	for level := 0; level < depth && len(frontier) > 0; level++ {
+		var next []Node
+		for _, node := range frontier {
+			var relations []Relation
+			result := re.DB.Where("(source_type = ? AND source_id = ?) OR (target_type = ? AND target_id = ?)",
+				node.Type, node.ID, node.Type, node.ID).Order("id").Find(&relations)
+			if result.Error != nil {
+				return nil, result.Error
+			}
+
+			for _, rel := range relations {
+				other := Node{Type: rel.TargetType, ID: rel.TargetID}
+				if rel.TargetType == node.Type && rel.TargetID == node.ID {
+					other = Node{Type: rel.SourceType, ID: rel.SourceID}
+				}
+				other.Key = nodeKey(other.Type, other.ID)
+				if hidden[other.Key] {
+					continue
+				}
+
+				if !visited[other.Key] {
+					title, ok, err := re.findTitle(other.Type, other.ID, re.authorize(user, other.Type, ActionRead))
+					if err != nil {
+						return nil, err
+					}
+
+					if !ok {
+						hidden[other.Key] = true
+						continue
+					}
+
+					visited[other.Key] = true
+					other.Title = title
+					graph.Nodes = append(graph.Nodes, other)
+					next = append(next, other)
+				}
+
+				if !seenEdges[rel.ID] {
+					seenEdges[rel.ID] = true
+					graph.Edges = append(graph.Edges, Edge{
+						ID:     rel.ID,
+						Source: nodeKey(rel.SourceType, rel.SourceID),
+						Target: nodeKey(rel.TargetType, rel.TargetID),
+						Type:   rel.Type,
+					})
+				}
+			}
+		}
+		frontier = next
+	}
+
+	return graph, nil
+}
+
+// graph builds the graph of the records a user can read and the relations between them
+func (re *Record) graph(user *User) (*Graph, error) {
+	graph := &Graph{Nodes: []Node{}, Edges: []Edge{}}
+
+	for _, typ := range recordTypes {
+		t := recordTables[typ]
+
+		var rows []struct {
+			ID    uint
+			Title string
+		}
+		result := re.DB.Table(t.table).Select("id, " + t.title + " AS title").
+			Scopes(re.authorize(user, typ, ActionRead)).Order("id").Scan(&rows)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+
+		for _, row := range rows {
+			graph.Nodes = append(graph.Nodes, Node{Key: nodeKey(typ, row.ID), Type: typ, ID: row.ID, Title: row.Title})
+		}
+	}
+
+	var relations []Relation
+	if result := re.DB.Order("id").Find(&relations); result.Error != nil {
+		return nil, result.Error
+	}
+
+	nodes := make(map[string]bool, len(graph.Nodes))
+	for _, n := range graph.Nodes {
+		nodes[n.Key] = true
+	}
+
+	for _, rel := range relations {
+		source, target := nodeKey(rel.SourceType, rel.SourceID), nodeKey(rel.TargetType, rel.TargetID)
+		if !nodes[source] || !nodes[target] {
+			continue
+		}
+
+		graph.Edges = append(graph.Edges, Edge{ID: rel.ID, Source: source, Target: target, Type: rel.Type})
+	}
+
+	return graph, nil
+}
+
+// DOT returns the graph in Graphviz DOT format
+func (g *Graph) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph knowledge_base {\n")
+	b.WriteString("  node [shape=box];\n")
+
+	shapes := map[string]string{TypeNote: "note", TypeRecipe: "box", TypeScript: "component"}
+	nodes := slices.Clone(g.Nodes)
+	sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].Key < nodes[j].Key })
+	for _, n := range nodes {
+		fmt.Fprintf(&b, "  %s [label=%s, shape=%s];\n", strconv.Quote(n.Key), strconv.Quote(n.Title), shapes[n.Type])
+	}
+
+	for _, e := range g.Edges {
+		fmt.Fprintf(&b, "  %s -> %s [label=%s];\n", strconv.Quote(e.Source), strconv.Quote(e.Target), strconv.Quote(e.Type))
+	}
+
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// ExportGraph exports the records the authenticated user can read and their
+// relations as JSON or, with format=dot, in Graphviz DOT format
+func (re *Record) ExportGraph(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	re = re.inWorkspace(r)
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "dot" {
+		http.Error(w, fmt.Sprintf("Invalid format: '%s', supported formats are json, dot", format), http.StatusBadRequest)
+		return
+	}
+
+	graph, err := re.graph(user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if format == "dot" {
+		w.Header().Add("content-type", "text/vnd.graphviz; charset=utf-8")
+		io.WriteString(w, graph.DOT())
+		return
+	}
+
+	details, err := json.Marshal(graph)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.Write(details)
+}
@@ -0,0 +1,223 @@
+package record
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	mocket "github.com/selvatico/go-mocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateRelation(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db}
+
+	t.Run(errInvalidMethod, func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		r.CreateRelation(rw, withUser(&http.Request{Method: http.MethodGet}, testUser))
+
+		assert.Equal(t, http.StatusMethodNotAllowed, rw.Code)
+	})
+
+	tests := map[string]string{
+		"error: invalid relation type": `{"source_type": "note", "source_id": 1, "type": "likes", "target_type": "script", "target_id": 2}`,
+		"error: invalid record type":   `{"source_type": "page", "source_id": 1, "type": "uses", "target_type": "script", "target_id": 2}`,
+		"error: self relation":         `{"source_type": "note", "source_id": 1, "type": "see-also", "target_type": "note", "target_id": 1}`,
+	}
+
+	for testName, body := range tests {
+		t.Run(testName, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			r.CreateRelation(rw, withUser(&http.Request{
+				Method: http.MethodPost,
+				Body:   io.NopCloser(strings.NewReader(body)),
+			}, testUser))
+
+			assert.Equal(t, http.StatusBadRequest, rw.Code)
+		})
+	}
+
+	t.Run(errRecordNotFound, func(t *testing.T) {
+		mocket.Catcher.Reset().NewMock().WithRowsNum(0)
+		rw := httptest.NewRecorder()
+		r.CreateRelation(rw, withUser(&http.Request{
+			Method: http.MethodPost,
+			Body:   io.NopCloser(strings.NewReader(`{"source_type": "note", "source_id": 1, "type": "uses", "target_type": "script", "target_id": 99}`)),
+		}, testUser))
+
+		assert.Equal(t, http.StatusNotFound, rw.Code)
+	})
+
+	t.Run(successOneRecord, func(t *testing.T) {
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`SELECT count(*) FROM "notes"`).WithReply([]map[string]interface{}{{"count": 1}})
+		mocket.Catcher.NewMock().WithQuery(`SELECT count(*) FROM "scripts"`).WithReply([]map[string]interface{}{{"count": 1}})
+		rw := httptest.NewRecorder()
+		r.CreateRelation(rw, withUser(&http.Request{
+			Method: http.MethodPost,
+			Body:   io.NopCloser(strings.NewReader(`{"source_type": "note", "source_id": 1, "type": "uses", "target_type": "script", "target_id": 2}`)),
+		}, testUser))
+
+		assert.Equal(t, http.StatusCreated, rw.Code)
+	})
+
+	t.Run("error: duplicate relation", func(t *testing.T) {
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`SELECT count(*) FROM "notes"`).WithReply([]map[string]interface{}{{"count": 1}})
+		mocket.Catcher.NewMock().WithQuery(`SELECT count(*) FROM "scripts"`).WithReply([]map[string]interface{}{{"count": 1}})
+		mocket.Catcher.NewMock().WithQuery(`SELECT count(*) FROM "relations"`).WithReply([]map[string]interface{}{{"count": 1}})
+		var created bool
+		mocket.Catcher.NewMock().WithQuery(`INSERT INTO "relations"`).WithCallback(func(_ string, _ []driver.NamedValue) {
+			created = true
+		})
+		rw := httptest.NewRecorder()
+		r.CreateRelation(rw, withUser(&http.Request{
+			Method: http.MethodPost,
+			Body:   io.NopCloser(strings.NewReader(`{"source_type": "note", "source_id": 1, "type": "uses", "target_type": "script", "target_id": 2}`)),
+		}, testUser))
+
+		assert.Equal(t, http.StatusConflict, rw.Code)
+		assert.False(t, created)
+	})
+}
+
+func TestDeleteRelation(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db}
+
+	t.Run(errMissingParam, func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		r.DeleteRelation(rw, withUser(httptest.NewRequest(http.MethodDelete, "/", nil), testUser))
+
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+
+	relation := []map[string]interface{}{{"id": 1, "source_type": "note", "source_id": 1, "type": "uses", "target_type": "script", "target_id": 2}}
+
+	t.Run("source not editable", func(t *testing.T) {
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`SELECT * FROM "relations"`).WithReply(relation)
+		mocket.Catcher.NewMock().WithQuery(`SELECT count(*) FROM "notes"`).WithReply([]map[string]interface{}{{"count": 0}})
+		mocket.Catcher.NewMock().WithQuery(`DELETE FROM "relations"`).WithRowsNum(1)
+		rw := httptest.NewRecorder()
+		r.DeleteRelation(rw, withUser(httptest.NewRequest(http.MethodDelete, "/?id=1", nil), testUser))
+
+		assert.Equal(t, http.StatusNotFound, rw.Code)
+	})
+
+	t.Run(successRecordDeleted, func(t *testing.T) {
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`SELECT * FROM "relations"`).WithReply(relation)
+		mocket.Catcher.NewMock().WithQuery(`SELECT count(*) FROM "notes"`).WithReply([]map[string]interface{}{{"count": 1}})
+		mocket.Catcher.NewMock().WithQuery(`DELETE FROM "relations"`).WithRowsNum(1)
+		rw := httptest.NewRecorder()
+		r.DeleteRelation(rw, withUser(httptest.NewRequest(http.MethodDelete, "/?id=1", nil), testUser))
+
+		assert.Equal(t, http.StatusOK, rw.Code)
+	})
+}
+
+func TestGetNeighbourhood(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db}
+
+	t.Run(errMissingParam, func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		r.GetNeighbourhood(rw, withUser(&http.Request{
+			Method: http.MethodGet,
+			URL:    &url.URL{RawQuery: "id=1"},
+		}, testUser))
+
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+
+	t.Run("error: invalid depth", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		r.GetNeighbourhood(rw, withUser(&http.Request{
+			Method: http.MethodGet,
+			URL:    &url.URL{RawQuery: "type=note&id=1&depth=10"},
+		}, testUser))
+
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+
+	t.Run(successRecordFound, func(t *testing.T) {
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`SELECT "title" FROM "notes"`).WithReply([]map[string]interface{}{{"title": "Runbook"}})
+		mocket.Catcher.NewMock().WithQuery(`SELECT "name" FROM "scripts"`).WithReply([]map[string]interface{}{{"name": "Restart"}})
+		mocket.Catcher.NewMock().WithQuery(`FROM "relations"`).WithReply([]map[string]interface{}{
+			{"id": 4, "source_type": TypeNote, "source_id": 1, "type": RelationUses, "target_type": TypeScript, "target_id": 2},
+		})
+
+		rw := httptest.NewRecorder()
+		r.GetNeighbourhood(rw, withUser(&http.Request{
+			Method: http.MethodGet,
+			URL:    &url.URL{RawQuery: "type=note&id=1&depth=3"},
+		}, testUser))
+		assert.Equal(t, http.StatusOK, rw.Code)
+
+		var graph Graph
+		err := json.Unmarshal(rw.Body.Bytes(), &graph)
+		assert.Nil(t, err)
+		assert.Equal(t, []Node{
+			{Key: "note:1", Type: TypeNote, ID: 1, Title: "Runbook"},
+			{Key: "script:2", Type: TypeScript, ID: 2, Title: "Restart"},
+		}, graph.Nodes)
+		assert.Equal(t, []Edge{{ID: 4, Source: "note:1", Target: "script:2", Type: RelationUses}}, graph.Edges)
+	})
+}
+
+func TestGraphDOT(t *testing.T) {
+	graph := Graph{
+		Nodes: []Node{
+			{Key: "script:2", Type: TypeScript, ID: 2, Title: "Restart \"api\""},
+			{Key: "note:1", Type: TypeNote, ID: 1, Title: "Runbook"},
+		},
+		Edges: []Edge{{ID: 4, Source: "note:1", Target: "script:2", Type: RelationUses}},
+	}
+
+	expected := `digraph knowledge_base {
+  node [shape=box];
+  "note:1" [label="Runbook", shape=note];
+  "script:2" [label="Restart \"api\"", shape=component];
+  "note:1" -> "script:2" [label="uses"];
+}
+`
+	assert.Equal(t, expected, graph.DOT())
+}
+
+func TestExportGraph(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db}
+
+	t.Run("error: invalid format", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		r.ExportGraph(rw, withUser(&http.Request{
+			Method: http.MethodGet,
+			URL:    &url.URL{RawQuery: "format=svg"},
+		}, testUser))
+
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+
+	t.Run("successful: dot format", func(t *testing.T) {
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`FROM "notes"`).WithReply([]map[string]interface{}{{"id": 1, "title": "Runbook"}})
+		mocket.Catcher.NewMock().WithQuery(`FROM "relations"`).WithRowsNum(0)
+
+		rw := httptest.NewRecorder()
+		r.ExportGraph(rw, withUser(&http.Request{
+			Method: http.MethodGet,
+			URL:    &url.URL{RawQuery: "format=dot"},
+		}, testUser))
+
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Contains(t, rw.Body.String(), `"note:1" [label="Runbook", shape=note];`)
+	})
+}
@@ -0,0 +1,108 @@
+package record
+
+import "net/http"
+
+// Route is a route of the API, with the method its handler accepts
+type Route struct {
+	Method  string
+	Pattern string
+	Handler http.HandlerFunc
+}
+
+// Routes returns the routes of the API that need an authenticated user
+func (re *Record) Routes() []Route {
+	return []Route{
+		{http.MethodGet, apiPrefix + "/notes/list", re.ListNotes},
+		{http.MethodGet, apiPrefix + "/recipes/list", re.ListRecipes},
+		{http.MethodGet, apiPrefix + "/scripts/list", re.ListScripts},
+
+		{http.MethodPost, apiPrefix + "/notes/new", re.CreateNote},
+		{http.MethodPost, apiPrefix + "/recipes/new", re.CreateRecipe},
+		{http.MethodPost, apiPrefix + "/scripts/new", re.CreateScript},
+
+		{http.MethodDelete, apiPrefix + "/notes/delete", re.DeleteNote},
+		{http.MethodDelete, apiPrefix + "/recipes/delete", re.DeleteRecipe},
+		{http.MethodDelete, apiPrefix + "/scripts/delete", re.DeleteScript},
+
+		{http.MethodGet, apiPrefix + "/notes", re.GetNote},
+		{http.MethodGet, apiPrefix + "/recipes", re.GetRecipe},
+		{http.MethodGet, apiPrefix + "/scripts", re.GetScript},
+		{http.MethodGet, apiPrefix + "/scripts/{id}/raw", re.GetScriptRaw},
+		{http.MethodPost, apiPrefix + "/scripts/{id}/render", re.RenderScript},
+		{http.MethodPost, apiPrefix + "/scripts/{id}/run", re.RunScript},
+		{http.MethodGet, apiPrefix + "/scripts/{id}/runs", re.ListScriptRuns},
+		{http.MethodGet, apiPrefix + "/scripts/runs", re.GetScriptRun},
+		{http.MethodPost, apiPrefix + "/secrets/new", re.CreateSecret},
+		{http.MethodGet, apiPrefix + "/secrets/list", re.ListSecrets},
+		{http.MethodPut, apiPrefix + "/secrets/update", re.UpdateSecret},
+		{http.MethodDelete, apiPrefix + "/secrets/delete", re.DeleteSecret},
+
+		{http.MethodPut, apiPrefix + "/notes/update", re.UpdateNote},
+		{http.MethodPut, apiPrefix + "/recipes/update", re.UpdateRecipe},
+		{http.MethodPut, apiPrefix + "/scripts/update", re.UpdateScript},
+
+		{http.MethodGet, apiPrefix + "/notes/backlinks", re.NoteBacklinks},
+		{http.MethodGet, apiPrefix + "/recipes/backlinks", re.RecipeBacklinks},
+		{http.MethodGet, apiPrefix + "/scripts/backlinks", re.ScriptBacklinks},
+		{http.MethodGet, apiPrefix + "/links/broken", re.ListBrokenLinks},
+
+		{http.MethodGet, apiPrefix + "/notes/attachments", re.ListNoteAttachments},
+		{http.MethodGet, apiPrefix + "/recipes/attachments", re.ListRecipeAttachments},
+		{http.MethodGet, apiPrefix + "/scripts/attachments", re.ListScriptAttachments},
+		{http.MethodPost, apiPrefix + "/notes/attachments/new", re.UploadNoteAttachment},
+		{http.MethodPost, apiPrefix + "/recipes/attachments/new", re.UploadRecipeAttachment},
+		{http.MethodPost, apiPrefix + "/scripts/attachments/new", re.UploadScriptAttachment},
+		{http.MethodGet, apiPrefix + "/attachments", re.GetAttachment},
+		{http.MethodGet, apiPrefix + "/attachments/thumbnail", re.GetThumbnail},
+		{http.MethodDelete, apiPrefix + "/attachments/delete", re.DeleteAttachment},
+
+		{http.MethodPost, apiPrefix + "/shares/new", re.CreateShare},
+		{http.MethodGet, apiPrefix + "/shares/list", re.ListShares},
+		{http.MethodDelete, apiPrefix + "/shares/delete", re.DeleteShare},
+
+		{http.MethodPost, apiPrefix + "/teams/new", re.CreateTeam},
+		{http.MethodGet, apiPrefix + "/teams/list", re.ListTeams},
+		{http.MethodGet, apiPrefix + "/teams/members", re.ListTeamMembers},
+		{http.MethodPost, apiPrefix + "/teams/members/add", re.AddTeamMember},
+		{http.MethodPut, apiPrefix + "/teams/members/update", re.UpdateTeamMember},
+		{http.MethodDelete, apiPrefix + "/teams/members/delete", re.RemoveTeamMember},
+
+		{http.MethodPost, apiPrefix + "/relations/new", re.CreateRelation},
+		{http.MethodDelete, apiPrefix + "/relations/delete", re.DeleteRelation},
+		{http.MethodGet, apiPrefix + "/relations/neighbourhood", re.GetNeighbourhood},
+		{http.MethodGet, apiPrefix + "/relations/graph", re.ExportGraph},
+
+		{http.MethodGet, apiPrefix + "/recipes/ingredients/mappings", re.ListIngredientMappings},
+		{http.MethodPost, apiPrefix + "/recipes/ingredients/map", re.MapIngredient},
+		{http.MethodDelete, apiPrefix + "/recipes/ingredients/mappings/delete", re.DeleteIngredientMapping},
+
+		{http.MethodPost, apiPrefix + "/auth/logout", re.Logout},
+		{http.MethodGet, apiPrefix + "/auth/me", re.GetCurrentUser},
+		{http.MethodPost, apiPrefix + "/apikeys/new", re.CreateAPIKey},
+		{http.MethodGet, apiPrefix + "/apikeys/list", re.ListAPIKeys},
+		{http.MethodDelete, apiPrefix + "/apikeys/delete", re.RevokeAPIKey},
+
+		{http.MethodPost, apiPrefix + "/workspaces/new", re.CreateWorkspace},
+		{http.MethodGet, apiPrefix + "/workspaces/list", re.ListWorkspaces},
+		{http.MethodGet, apiPrefix + "/workspace", re.GetWorkspace},
+		{http.MethodPut, apiPrefix + "/workspace/update", re.UpdateWorkspace},
+		{http.MethodGet, apiPrefix + "/workspace/members", re.ListWorkspaceMembers},
+		{http.MethodPost, apiPrefix + "/workspace/members/add", re.AddWorkspaceMember},
+		{http.MethodDelete, apiPrefix + "/workspace/members/delete", re.RemoveWorkspaceMember},
+
+		{http.MethodGet, apiPrefix + "/audit", re.ListAuditEvents},
+		{http.MethodGet, apiPrefix + "/audit/export", re.ExportAuditEvents},
+	}
+}
+
+// PublicRoutes returns the routes of the API open to anonymous users
+func (re *Record) PublicRoutes() []Route {
+	return []Route{
+		{http.MethodPost, apiPrefix + "/auth/register", re.Register},
+		{http.MethodPost, apiPrefix + "/auth/login", re.Login},
+		{http.MethodPost, apiPrefix + "/auth/refresh", re.RefreshSession},
+
+		{http.MethodGet, apiPrefix + "/openapi.json", re.OpenAPI},
+		{http.MethodGet, apiPrefix + "/docs", re.APIDocs},
+	}
+}
@@ -4,17 +4,95 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"regexp"
+	"strings"
 	"time"
+
+	"gorm.io/gorm/clause"
+
+	"github.com/jvmistica/knowledge-base-go/pkg/analysis"
 )
 
 // Script is the structure of the scripts table
 type Script struct {
-	ID          uint      `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          uint               `json:"id"`
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Body        string             `json:"body"`
+	Encrypted   bool               `json:"encrypted" gorm:"not null;default:false"`
+	Language    string             `json:"language"`
+	Version     string             `json:"version"`
+	Parameters  []ScriptParameter  `json:"parameters" gorm:"serializer:json"`
+	Findings    []analysis.Finding `json:"findings" gorm:"serializer:json"`
+	CreatedAt   time.Time          `json:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at"`
+
+	Ownership
+}
+
+var unsafeFilename = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// validate normalizes the language of a script and checks its parameters
+func (s *Script) validate() error {
+	if s.Language != "" {
+		lang, ok := LookupLanguage(s.Language)
+		if !ok {
+			return fmt.Errorf("Unsupported language: '%s', supported languages are %s",
+				s.Language, strings.Join(Languages(), ", "))
+		}
+		s.Language = lang.Name
+	}
+
+	return s.validateParameters()
+}
+
+// analyze runs the static analysis of a script's body and stores the
+// findings. The stored script fills in the name and language when they are
+// not part of an update. The detected language is used if none is declared.
+func (s *Script) analyze(stored Script) {
+	name, language := s.Name, s.Language
+	if name == "" {
+		name = stored.Name
+	}
+	if language == "" {
+		language = stored.Language
+	}
+
+	report := analysis.Analyze(name, language, s.Body)
+	if language == "" {
+		s.Language = report.Language
+	}
+	s.Findings = report.Findings
+}
+
+// filename returns the download filename of a script
+func (s *Script) filename() string {
+	name := strings.Trim(unsafeFilename.ReplaceAllString(s.Name, "_"), "_.")
+	if name == "" {
+		name = fmt.Sprintf("script-%d", s.ID)
+	}
+
+	ext := ".txt"
+	if lang, ok := LookupLanguage(s.Language); ok {
+		ext = lang.Extension
+	}
+	if !strings.HasSuffix(strings.ToLower(name), ext) {
+		name += ext
+	}
+
+	return name
+}
+
+// contentType returns the MIME type used to serve the body of a script
+func (s *Script) contentType() string {
+	contentType := "text/plain"
+	if lang, ok := LookupLanguage(s.Language); ok {
+		contentType = lang.ContentType
+	}
+
+	return mime.FormatMediaType(contentType, map[string]string{"charset": "utf-8"})
 }
 
 // ListScripts lists all the scripts in the database
@@ -24,12 +102,31 @@ func (re *Record) ListScripts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	re = re.inWorkspace(r)
+
+	query, ok := listPage(w, r, re.DB.Scopes(re.authorize(user, TypeScript, ActionRead)), &Script{})
+	if !ok {
+		return
+	}
+
 	var scripts []Script
-	if result := re.DB.Find(&scripts); result.Error != nil {
+	if result := query.Find(&scripts); result.Error != nil {
 		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
 		return
 	}
 
+	for i := range scripts {
+		if err := re.decryptScript(&scripts[i]); err != nil {
+			writeEncryptionError(w, err)
+			return
+		}
+	}
+
 	scriptsList, err := json.Marshal(scripts)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -40,13 +137,20 @@ func (re *Record) ListScripts(w http.ResponseWriter, r *http.Request) {
 	w.Write(scriptsList)
 }
 
-// CreateScript creates a new recipe
+// CreateScript creates a new script
 func (re *Record) CreateScript(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
 
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	re = re.inWorkspace(r)
+
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -60,13 +164,63 @@ func (re *Record) CreateScript(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result := re.DB.Create(&script)
-	if result.Error != nil {
-		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+	if !re.prepareCreate(w, r, user, TypeScript, &script.Ownership) {
+		return
+	}
+
+	if err := script.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	script.analyze(Script{})
+	if script.Encrypted {
+		redactFindings(script.Findings)
+	}
+
+	if err := re.checkEncryption(script.Encrypted); err != nil {
+		writeEncryptionError(w, err)
+		return
+	}
+
+	// An encrypted body is sealed once the script has the ID it is bound to
+	plaintext := script.Body
+	if script.Encrypted {
+		script.Body = ""
+	}
+
+	err = re.transaction(func(tx *Record) error {
+		if result := tx.DB.Create(&script); result.Error != nil {
+			return result.Error
+		}
+
+		if script.Encrypted && plaintext != "" {
+			var err error
+			if script.Body, err = tx.sealCreated(&Script{}, "body", fieldScriptBody, script.ID, plaintext); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.syncLinks(user, TypeScript, script.ID, script.Description); err != nil {
+			return err
+		}
+
+		return tx.audit(r, AuditCreate, TypeScript, script.ID, nil, script)
+	})
+	if err != nil {
+		writeTransactionError(w, err)
+		return
+	}
+	script.Body = plaintext
+
+	details, err := json.Marshal(script)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
+	w.Header().Add("content-type", "application/json")
 	w.WriteHeader(http.StatusCreated)
+	w.Write(details)
 }
 
 // DeleteScript deletes a script
@@ -76,22 +230,63 @@ func (re *Record) DeleteScript(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	re = re.inWorkspace(r)
+
 	id := r.URL.Query().Get("id")
 	if id == "" {
 		http.Error(w, "Missing query parameter: 'id'", http.StatusBadRequest)
 		return
 	}
 
-	result := re.DB.Where(filterByID, id).Delete(Script{})
-	if result.Error != nil {
-		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
-		return
-	}
+	var hashes []string
+	err := re.transaction(func(tx *Record) error {
+		var before Script
+		if result := tx.DB.Where(filterByID, id).Find(&before); result.Error != nil {
+			return result.Error
+		}
 
-	if result.RowsAffected == 0 {
-		w.WriteHeader(http.StatusNotFound)
+		result := tx.DB.Scopes(tx.authorize(user, TypeScript, ActionManage)).Where(filterByID, id).Delete(Script{})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return errNotFound
+		}
+
+		if err := tx.deleteLinks(TypeScript, id); err != nil {
+			return err
+		}
+
+		if err := tx.deleteRelations(TypeScript, id); err != nil {
+			return err
+		}
+
+		var err error
+		if hashes, err = tx.deleteAttachments(TypeScript, id); err != nil {
+			return err
+		}
+
+		if err := tx.deleteShares(TypeScript, id); err != nil {
+			return err
+		}
+
+		if err := tx.deleteSecrets(id); err != nil {
+			return err
+		}
+
+		return tx.audit(r, AuditDelete, TypeScript, before.ID, before, nil)
+	})
+	if err != nil {
+		writeTransactionError(w, err)
 		return
 	}
+	re.releaseBlobs(r.Context(), hashes)
 
 	w.WriteHeader(http.StatusOK)
 }
@@ -103,6 +298,13 @@ func (re *Record) GetScript(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	re = re.inWorkspace(r)
+
 	id := r.URL.Query().Get("id")
 	if id == "" {
 		http.Error(w, "Missing query parameter: 'id'", http.StatusBadRequest)
@@ -110,7 +312,7 @@ func (re *Record) GetScript(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var script Script
-	result := re.DB.Where(filterByID, id).Find(&script)
+	result := re.DB.Scopes(re.authorize(user, TypeScript, ActionRead)).Where(filterByID, id).Find(&script)
 	if result.Error != nil {
 		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
 		return
@@ -121,6 +323,11 @@ func (re *Record) GetScript(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := re.decryptScript(&script); err != nil {
+		writeEncryptionError(w, err)
+		return
+	}
+
 	details, err := json.Marshal(script)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -138,6 +345,13 @@ func (re *Record) UpdateScript(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	re = re.inWorkspace(r)
+
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -146,16 +360,157 @@ func (re *Record) UpdateScript(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
 	var script Script
+	var option encryptionOption
 	if err := json.Unmarshal(body, &script); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if err := json.Unmarshal(body, &option); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The owner never changes, and only the owner or a team admin can change the visibility
+	script.OwnerID = 0
+	if err := script.Ownership.validate(false); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	action := ActionEdit
+	if script.Visibility != "" {
+		action = ActionManage
+	}
+
+	if err := script.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var plaintext string
+	err = re.transaction(func(tx *Record) error {
+		// The current version is read and locked with the authorization of the update
+		var before Script
+		result := tx.DB.Clauses(clause.Locking{Strength: "UPDATE"}).Scopes(tx.authorize(user, TypeScript, action)).Where(filterByID, script.ID).Find(&before)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return errNotFound
+		}
+
+		// A body changing encryption or language is analyzed and sealed again like a new body
+		script.Encrypted = before.Encrypted
+		if option.Encrypted != nil {
+			script.Encrypted = *option.Encrypted
+		}
+		var err error
+		languageChanged := script.Language != "" && script.Language != before.Language
+		if script.Body == "" && (script.Encrypted != before.Encrypted || languageChanged) {
+			if script.Body, err = tx.open(before.Body, before.Encrypted, fieldScriptBody, before.ID); err != nil {
+				return err
+			}
+		}
+
+		// Findings are only ever set by the analysis of a body
+		script.Findings = nil
+		plaintext = script.Body
+		if script.Body != "" {
+			script.analyze(before)
+			if script.Encrypted {
+				redactFindings(script.Findings)
+			}
+
+			if script.Body, err = tx.seal(script.Body, script.Encrypted, fieldScriptBody, script.ID); err != nil {
+				return err
+			}
+		}
+
+		result = tx.DB.Model(&Script{}).Where(filterByID, script.ID).Updates(script)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return errNotFound
+		}
+
+		// Updates skips zero values, so turning encryption off is a separate update of the transaction
+		if before.Encrypted && !script.Encrypted {
+			if result := tx.DB.Model(&Script{}).Where(filterByID, script.ID).Update("encrypted", false); result.Error != nil {
+				return result.Error
+			}
+		}
+
+		var stored Script
+		if result := tx.DB.Where(filterByID, script.ID).Find(&stored); result.Error != nil {
+			return result.Error
+		}
+
+		if err := tx.syncLinks(user, TypeScript, script.ID, stored.Description); err != nil {
+			return err
+		}
 
-	result := re.DB.Model(&Script{}).Where(filterByID, script.ID).Updates(script)
+		return tx.audit(r, AuditUpdate, TypeScript, script.ID, before, stored)
+	})
+	if err != nil {
+		writeTransactionError(w, err)
+		return
+	}
+	script.Body = plaintext
+
+	details, err := json.Marshal(script)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(details)
+}
+
+// GetScriptRaw serves the body of a specific script as a file download
+func (re *Record) GetScriptRaw(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	re = re.inWorkspace(r)
+
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "Missing path parameter: 'id'", http.StatusBadRequest)
+		return
+	}
+
+	var script Script
+	result := re.DB.Scopes(re.authorize(user, TypeScript, ActionRead)).Where(filterByID, id).Find(&script)
 	if result.Error != nil {
 		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
 		return
 	}
 
+	if result.RowsAffected == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if err := re.decryptScript(&script); err != nil {
+		writeEncryptionError(w, err)
+		return
+	}
+
+	w.Header().Set("content-type", script.contentType())
+	w.Header().Set("content-disposition", mime.FormatMediaType("attachment", map[string]string{"filename": script.filename()}))
+	w.Header().Set("x-content-type-options", "nosniff")
 	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, script.Body)
 }
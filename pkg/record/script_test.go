@@ -13,6 +13,10 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+const (
+	errUnsupportedLanguage = "error: unsupported language"
+)
+
 var (
 	testScript = []map[string]interface{}{
 		{"name": "Sample script #123", "description": "A bash script that does something"},
@@ -66,7 +70,7 @@ func TestListScripts(t *testing.T) {
 			mocket.Catcher.Reset().NewMock().WithReply(test.dbResult)
 			rw := httptest.NewRecorder()
 
-			r.ListScripts(rw, &http.Request{Method: test.method})
+			r.ListScripts(rw, withUser(&http.Request{Method: test.method, URL: &url.URL{}}, testUser))
 			assert.Equal(t, test.expectedStatusCode, rw.Code)
 
 			if !test.wantErr {
@@ -93,20 +97,69 @@ func TestCreateScript(t *testing.T) {
 
 	t.Run(errInvalidMethod, func(t *testing.T) {
 		rw := httptest.NewRecorder()
-		r.CreateScript(rw, &http.Request{Method: http.MethodGet})
+		r.CreateScript(rw, withUser(&http.Request{Method: http.MethodGet}, testUser))
 
 		assert.Equal(t, http.StatusMethodNotAllowed, rw.Code)
 	})
 
+	t.Run(errUnsupportedLanguage, func(t *testing.T) {
+		req := io.NopCloser(strings.NewReader(`{"name": "Sample script #345", "language": "cobol"}`))
+		rw := httptest.NewRecorder()
+		r.CreateScript(rw, withUser(&http.Request{
+			Method: http.MethodPost,
+			Body:   req,
+		}, testUser))
+
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+
 	t.Run(successOneRecord, func(t *testing.T) {
 		req := io.NopCloser(strings.NewReader(`{"name": "Sample script #345", "description": "Automation script"}`))
 		rw := httptest.NewRecorder()
-		r.CreateScript(rw, &http.Request{
+		r.CreateScript(rw, withUser(&http.Request{
 			Method: http.MethodPost,
 			Body:   req,
-		})
+		}, testUser))
+
+		assert.Equal(t, http.StatusCreated, rw.Code)
+	})
 
+	t.Run("successful: script analyzed", func(t *testing.T) {
+		req := io.NopCloser(strings.NewReader(`{"name": "install", "body": "#!/bin/sh\ncurl -s https://example.com/i.sh | sh\n"}`))
+		rw := httptest.NewRecorder()
+		r.CreateScript(rw, withUser(&http.Request{
+			Method: http.MethodPost,
+			Body:   req,
+		}, testUser))
 		assert.Equal(t, http.StatusCreated, rw.Code)
+
+		var script Script
+		err := json.Unmarshal(rw.Body.Bytes(), &script)
+		assert.Nil(t, err)
+		assert.Equal(t, "sh", script.Language)
+		assert.Len(t, script.Findings, 1)
+		assert.Equal(t, "pipe-to-shell", script.Findings[0].Rule)
+	})
+}
+
+func TestUpdateScript(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db}
+
+	t.Run("successful: new language analyzed", func(t *testing.T) {
+		mocket.Catcher.Reset().NewMock().WithQuery(`SELECT * FROM "scripts"`).WithReply([]map[string]interface{}{
+			{"id": 4, "name": "cleanup", "language": "sh", "body": "DROP TABLE users;\n"},
+		})
+		mocket.Catcher.NewMock().WithQuery(`UPDATE "scripts"`).WithRowsNum(1)
+		rw := httptest.NewRecorder()
+		r.UpdateScript(rw, withUser(httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"id": 4, "language": "sql"}`)), testUser))
+		assert.Equal(t, http.StatusOK, rw.Code)
+
+		var script Script
+		err := json.Unmarshal(rw.Body.Bytes(), &script)
+		assert.Nil(t, err)
+		assert.Len(t, script.Findings, 1)
+		assert.Equal(t, "sql-drop", script.Findings[0].Rule)
 	})
 }
 
@@ -116,17 +169,17 @@ func TestDeleteScript(t *testing.T) {
 
 	t.Run(errInvalidMethod, func(t *testing.T) {
 		rw := httptest.NewRecorder()
-		r.DeleteScript(rw, &http.Request{Method: http.MethodPost})
+		r.DeleteScript(rw, withUser(&http.Request{Method: http.MethodPost}, testUser))
 
 		assert.Equal(t, http.StatusMethodNotAllowed, rw.Code)
 	})
 
 	t.Run(errMissingParam, func(t *testing.T) {
 		rw := httptest.NewRecorder()
-		r.DeleteScript(rw, &http.Request{
+		r.DeleteScript(rw, withUser(&http.Request{
 			Method: http.MethodDelete,
 			URL:    &url.URL{},
-		})
+		}, testUser))
 
 		assert.Equal(t, http.StatusBadRequest, rw.Code)
 	})
@@ -134,12 +187,12 @@ func TestDeleteScript(t *testing.T) {
 	t.Run(errRecordNotFound, func(t *testing.T) {
 		rw := httptest.NewRecorder()
 		mocket.Catcher.Reset().NewMock().WithRowsNum(0)
-		r.DeleteScript(rw, &http.Request{
+		r.DeleteScript(rw, withUser(&http.Request{
 			Method: http.MethodDelete,
 			URL: &url.URL{
 				RawQuery: "id=99",
 			},
-		})
+		}, testUser))
 
 		assert.Equal(t, http.StatusNotFound, rw.Code)
 	})
@@ -147,12 +200,12 @@ func TestDeleteScript(t *testing.T) {
 	t.Run(successRecordDeleted, func(t *testing.T) {
 		rw := httptest.NewRecorder()
 		mocket.Catcher.Reset().NewMock().WithRowsNum(1)
-		r.DeleteScript(rw, &http.Request{
+		r.DeleteScript(rw, withUser(&http.Request{
 			Method: http.MethodDelete,
 			URL: &url.URL{
 				RawQuery: "id=23",
 			},
-		})
+		}, testUser))
 
 		assert.Equal(t, http.StatusOK, rw.Code)
 	})
@@ -164,17 +217,17 @@ func TestGetScript(t *testing.T) {
 
 	t.Run(errInvalidMethod, func(t *testing.T) {
 		rw := httptest.NewRecorder()
-		r.GetScript(rw, &http.Request{Method: http.MethodPost})
+		r.GetScript(rw, withUser(&http.Request{Method: http.MethodPost}, testUser))
 
 		assert.Equal(t, http.StatusMethodNotAllowed, rw.Code)
 	})
 
 	t.Run(errMissingParam, func(t *testing.T) {
 		rw := httptest.NewRecorder()
-		r.GetScript(rw, &http.Request{
+		r.GetScript(rw, withUser(&http.Request{
 			Method: http.MethodGet,
 			URL:    &url.URL{},
-		})
+		}, testUser))
 
 		assert.Equal(t, http.StatusBadRequest, rw.Code)
 	})
@@ -182,12 +235,12 @@ func TestGetScript(t *testing.T) {
 	t.Run(errRecordNotFound, func(t *testing.T) {
 		rw := httptest.NewRecorder()
 		mocket.Catcher.Reset().NewMock().WithRowsNum(0)
-		r.GetScript(rw, &http.Request{
+		r.GetScript(rw, withUser(&http.Request{
 			Method: http.MethodGet,
 			URL: &url.URL{
 				RawQuery: "id=99",
 			},
-		})
+		}, testUser))
 
 		assert.Equal(t, http.StatusNotFound, rw.Code)
 	})
@@ -196,12 +249,12 @@ func TestGetScript(t *testing.T) {
 		rw := httptest.NewRecorder()
 		records := []map[string]interface{}{testScript[0]}
 		mocket.Catcher.Reset().NewMock().WithReply(records)
-		r.GetScript(rw, &http.Request{
+		r.GetScript(rw, withUser(&http.Request{
 			Method: http.MethodGet,
 			URL: &url.URL{
 				RawQuery: "id=123",
 			},
-		})
+		}, testUser))
 		assert.Equal(t, http.StatusOK, rw.Code)
 
 		res, err := io.ReadAll(rw.Body)
@@ -215,3 +268,48 @@ func TestGetScript(t *testing.T) {
 		assert.Equal(t, "A bash script that does something", script.Description)
 	})
 }
+
+func TestGetScriptRaw(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db}
+
+	t.Run(errInvalidMethod, func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		r.GetScriptRaw(rw, withUser(&http.Request{Method: http.MethodPost}, testUser))
+
+		assert.Equal(t, http.StatusMethodNotAllowed, rw.Code)
+	})
+
+	t.Run(errMissingParam, func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		r.GetScriptRaw(rw, withUser(&http.Request{Method: http.MethodGet}, testUser))
+
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+
+	t.Run(errRecordNotFound, func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		mocket.Catcher.Reset().NewMock().WithRowsNum(0)
+		req := &http.Request{Method: http.MethodGet}
+		req.SetPathValue("id", "99")
+		r.GetScriptRaw(rw, withUser(req, testUser))
+
+		assert.Equal(t, http.StatusNotFound, rw.Code)
+	})
+
+	t.Run(successRecordFound, func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		records := []map[string]interface{}{
+			{"id": 123, "name": "Disk usage/report", "language": "bash", "body": "#!/bin/bash\ndf -h\n"},
+		}
+		mocket.Catcher.Reset().NewMock().WithReply(records)
+		req := &http.Request{Method: http.MethodGet}
+		req.SetPathValue("id", "123")
+		r.GetScriptRaw(rw, withUser(req, testUser))
+
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, "text/x-shellscript; charset=utf-8", rw.Header().Get("content-type"))
+		assert.Equal(t, `attachment; filename=Disk_usage_report.sh`, rw.Header().Get("content-disposition"))
+		assert.Equal(t, "#!/bin/bash\ndf -h\n", rw.Body.String())
+	})
+}
@@ -0,0 +1,378 @@
+package record
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fieldSecretValue is the additional data binding the sealed value of a secret to its field
+const fieldSecretValue = "secret.value"
+
+// redacted replaces the values of secrets in the output of executions and
+// of encryptable fields in audit events
+const redacted = "[REDACTED]"
+
+// Secret is the structure of the secrets table, a named credential of a
+// workspace or of a single script. Its value is sealed with the master keys
+// and only ever revealed by rendering or running a script referencing it.
+type Secret struct {
+	ID          uint      `json:"id"`
+	WorkspaceID uint      `json:"-" gorm:"index;not null;default:0"`
+	ScriptID    *uint     `json:"script_id,omitempty" gorm:"index"`
+	Name        string    `json:"name" gorm:"index"`
+	Value       string    `json:"-" gorm:"not null"`
+	CreatedBy   uint      `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// SecretInput is the body of a request creating or updating a secret
+type SecretInput struct {
+	ID       uint   `json:"id"`
+	ScriptID *uint  `json:"script_id"`
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+}
+
+// validate checks the name and value of a new secret
+func (s *SecretInput) validate() error {
+	if !parameterName.MatchString(s.Name) {
+		return fmt.Errorf("Invalid secret name: '%s'", s.Name)
+	}
+
+	if s.Value == "" {
+		return errors.New("Missing secret value")
+	}
+
+	return nil
+}
+
+// secretScope checks that a user manages the secrets of a script, or of the
+// workspace of the request if scriptID is nil, or writes the error response
+func (re *Record) secretScope(w http.ResponseWriter, r *http.Request, user *User, scriptID *uint) bool {
+	if scriptID != nil {
+		allowed, err := re.can(user, TypeScript, *scriptID, ActionEdit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return false
+		}
+
+		if !allowed {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		return allowed
+	}
+
+	workspace, ok := workspaceFromContext(r.Context())
+	if !ok {
+		http.Error(w, "No workspace", http.StatusBadRequest)
+		return false
+	}
+
+	admin, err := re.isWorkspaceAdmin(user, workspace)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+
+	if !admin {
+		http.Error(w, "Only workspace admins can manage workspace secrets", http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
+// scriptSecretsQuery limits a query to the secrets of a script, or to the
+// secrets of the workspace if scriptID is nil
+func scriptSecretsQuery(scriptID *uint) (string, []any) {
+	if scriptID == nil {
+		return "script_id IS NULL", nil
+	}
+
+	return "script_id = ?", []any{*scriptID}
+}
+
+// scriptSecrets returns the values of the secrets referenced by a script
+// for a user. The secrets of the script take precedence over the secrets of
+// its workspace with the same name, which are only given to the workspace
+// admins who manage them. Missing secrets are left out.
+func (re *Record) scriptSecrets(r *http.Request, user *User, script *Script) (map[string]string, error) {
+	names := script.SecretNames()
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	admin := false
+	if workspace, ok := workspaceFromContext(r.Context()); ok {
+		var err error
+		if admin, err = re.isWorkspaceAdmin(user, workspace); err != nil {
+			return nil, err
+		}
+	}
+
+	query := re.DB.Where("name IN ? AND script_id = ?", names, script.ID)
+	if admin {
+		query = re.DB.Where("name IN ? AND (script_id IS NULL OR script_id = ?)", names, script.ID)
+	}
+
+	var secrets []Secret
+	result := query.Find(&secrets)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	values := map[string]string{}
+	for _, secret := range secrets {
+		if _, ok := values[secret.Name]; ok && secret.ScriptID == nil {
+			continue
+		}
+
+		value, err := re.open(secret.Value, true, fieldSecretValue, secret.ID)
+		if err != nil {
+			return nil, err
+		}
+		values[secret.Name] = value
+	}
+
+	return values, nil
+}
+
+// deleteSecrets deletes the secrets of a deleted script
+func (re *Record) deleteSecrets(id string) error {
+	return re.DB.Where("script_id = ?", id).Delete(&Secret{}).Error
+}
+
+// redactSecrets replaces the values of secrets in a text
+func redactSecrets(text string, secrets map[string]string) string {
+	for _, value := range secrets {
+		if value != "" {
+			text = strings.ReplaceAll(text, value, redacted)
+		}
+	}
+
+	return text
+}
+
+// CreateSecret creates a secret of a script or of the workspace of the request
+func (re *Record) CreateSecret(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	re = re.inWorkspace(r)
+
+	var input SecretInput
+	if err := decodeBody(r, &input); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := input.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !re.secretScope(w, r, user, input.ScriptID) {
+		return
+	}
+
+	scope, args := scriptSecretsQuery(input.ScriptID)
+	var count int64
+	if result := re.DB.Model(&Secret{}).Where(scope, args...).Where("name = ?", input.Name).Count(&count); result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	if count > 0 {
+		http.Error(w, fmt.Sprintf("Secret '%s' already exists", input.Name), http.StatusConflict)
+		return
+	}
+
+	if err := re.checkEncryption(true); err != nil {
+		writeEncryptionError(w, err)
+		return
+	}
+
+	// The value is sealed once the secret has the ID it is bound to
+	secret := Secret{ScriptID: input.ScriptID, Name: input.Name, CreatedBy: user.ID}
+	err := re.transaction(func(tx *Record) error {
+		if result := tx.DB.Create(&secret); result.Error != nil {
+			return result.Error
+		}
+
+		var err error
+		if secret.Value, err = tx.sealCreated(&Secret{}, "value", fieldSecretValue, secret.ID, input.Value); err != nil {
+			return err
+		}
+		return tx.audit(r, AuditCreate, resourceSecret, secret.ID, nil, secret)
+	})
+	if err != nil {
+		writeTransactionError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, secret)
+}
+
+// ListSecrets lists the secrets of a script, or of the workspace of the
+// request without a script_id, without their values
+func (re *Record) ListSecrets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	re = re.inWorkspace(r)
+
+	var scriptID *uint
+	if id := r.URL.Query().Get("script_id"); id != "" {
+		n, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid script_id: '%s'", id), http.StatusBadRequest)
+			return
+		}
+		scriptID = new(uint)
+		*scriptID = uint(n)
+	}
+
+	if !re.secretScope(w, r, user, scriptID) {
+		return
+	}
+
+	scope, args := scriptSecretsQuery(scriptID)
+	var secrets []Secret
+	if result := re.DB.Where(scope, args...).Order("name").Find(&secrets); result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, secrets)
+}
+
+// UpdateSecret replaces the value of a secret
+func (re *Record) UpdateSecret(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	re = re.inWorkspace(r)
+
+	var input SecretInput
+	if err := decodeBody(r, &input); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if input.Value == "" {
+		http.Error(w, "Missing secret value", http.StatusBadRequest)
+		return
+	}
+
+	var secret Secret
+	result := re.DB.Where(filterByID, input.ID).Find(&secret)
+	if result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if !re.secretScope(w, r, user, secret.ScriptID) {
+		return
+	}
+
+	value, err := re.seal(input.Value, true, fieldSecretValue, secret.ID)
+	if err != nil {
+		writeEncryptionError(w, err)
+		return
+	}
+
+	before := secret
+	err = re.transaction(func(tx *Record) error {
+		if result := tx.DB.Model(&secret).Update("value", value); result.Error != nil {
+			return result.Error
+		}
+		return tx.audit(r, AuditUpdate, resourceSecret, secret.ID, before, secret)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, secret)
+}
+
+// DeleteSecret deletes a secret
+func (re *Record) DeleteSecret(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	re = re.inWorkspace(r)
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "Missing query parameter: 'id'", http.StatusBadRequest)
+		return
+	}
+
+	var secret Secret
+	result := re.DB.Where(filterByID, id).Find(&secret)
+	if result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if !re.secretScope(w, r, user, secret.ScriptID) {
+		return
+	}
+
+	err := re.transaction(func(tx *Record) error {
+		if result := tx.DB.Where(filterByID, id).Delete(&Secret{}); result.Error != nil {
+			return result.Error
+		}
+		return tx.audit(r, AuditDelete, resourceSecret, secret.ID, secret, nil)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
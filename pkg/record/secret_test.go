@@ -0,0 +1,190 @@
+package record
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	mocket "github.com/selvatico/go-mocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderSecrets(t *testing.T) {
+	script := Script{
+		Body:       "curl -u {{ user }}:{{ secrets.api_token }} {{secrets.url}}",
+		Parameters: []ScriptParameter{{Name: "user", Required: true}},
+	}
+	assert.Equal(t, []string{"api_token", "url"}, script.SecretNames())
+	assert.Nil(t, script.validateParameters())
+
+	t.Run("secrets injected", func(t *testing.T) {
+		body, err := script.Render(map[string]any{"user": "bot"}, map[string]string{"api_token": "s3cr3t", "url": "https://example.com"})
+		assert.Nil(t, err)
+		assert.Equal(t, "curl -u bot:s3cr3t https://example.com", body)
+	})
+
+	t.Run("values cannot reference secrets", func(t *testing.T) {
+		body, err := script.Render(map[string]any{"user": "{{ secrets.api_token }}"}, map[string]string{"api_token": "s3cr3t", "url": "u"})
+		assert.Nil(t, err)
+		assert.Equal(t, "curl -u {{ secrets.api_token }}:s3cr3t u", body)
+	})
+
+	t.Run("missing secret", func(t *testing.T) {
+		_, err := script.Render(map[string]any{"user": "bot"}, map[string]string{"api_token": "s3cr3t"})
+
+		paramErr, ok := err.(*ParameterError)
+		assert.True(t, ok)
+		assert.Equal(t, map[string]string{"secrets.url": "unknown secret"}, paramErr.Problems)
+	})
+}
+
+func TestRedactSecrets(t *testing.T) {
+	execution := Execution{Stdout: "token is s3cr3t\n", Stderr: "auth failed for s3cr3t", Error: ""}
+	execution.redact(map[string]string{"api_token": "s3cr3t", "empty": ""})
+
+	assert.Equal(t, "token is [REDACTED]\n", execution.Stdout)
+	assert.Equal(t, "auth failed for [REDACTED]", execution.Stderr)
+}
+
+func TestScriptSecrets(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db, Keys: testKeys(t)}
+
+	workspaceToken, _ := r.Keys.Seal("workspace", boundField(fieldSecretValue, 1))
+	scriptToken, _ := r.Keys.Seal("script", boundField(fieldSecretValue, 2))
+	script := &Script{ID: 7, Body: "{{ secrets.api_token }}"}
+	req := withWorkspace(withUser(httptest.NewRequest(http.MethodPost, "/", nil), testUser), testWorkspace)
+
+	t.Run("workspace admin", func(t *testing.T) {
+		var query string
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`FROM "workspace_members"`).WithReply([]map[string]interface{}{{"user_id": 1, "role": WorkspaceRoleAdmin}})
+		mocket.Catcher.NewMock().WithQuery(`SELECT * FROM "secrets"`).WithCallback(func(q string, _ []driver.NamedValue) {
+			query = q
+		}).WithReply([]map[string]interface{}{
+			{"id": 2, "script_id": 7, "name": "api_token", "value": scriptToken},
+			{"id": 1, "name": "api_token", "value": workspaceToken},
+		})
+
+		secrets, err := r.scriptSecrets(req, testUser, script)
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]string{"api_token": "script"}, secrets)
+		assert.Contains(t, query, "script_id IS NULL")
+	})
+
+	t.Run("workspace member", func(t *testing.T) {
+		var query string
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`FROM "workspace_members"`).WithReply([]map[string]interface{}{{"user_id": 1, "role": WorkspaceRoleMember}})
+		mocket.Catcher.NewMock().WithQuery(`SELECT * FROM "secrets"`).WithCallback(func(q string, _ []driver.NamedValue) {
+			query = q
+		})
+
+		secrets, err := r.scriptSecrets(req, testUser, script)
+		assert.Nil(t, err)
+		assert.Empty(t, secrets)
+		assert.NotContains(t, query, "script_id IS NULL")
+	})
+}
+
+func TestCreateSecret(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db, Keys: testKeys(t)}
+
+	t.Run("error: invalid name", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		r.CreateSecret(rw, withUser(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name": "api-token", "value": "x"}`)), testUser))
+
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+
+	t.Run("error: not a workspace admin", func(t *testing.T) {
+		mocket.Catcher.Reset()
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name": "api_token", "value": "s3cr3t"}`))
+		r.CreateSecret(rw, withWorkspace(withUser(req, testUser), testWorkspace))
+
+		assert.Equal(t, http.StatusForbidden, rw.Code)
+	})
+
+	t.Run("error: encryption disabled", func(t *testing.T) {
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`SELECT count(*) FROM "scripts"`).WithReply([]map[string]interface{}{{"count": 1}})
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"script_id": 7, "name": "api_token", "value": "s3cr3t"}`))
+		(&Record{DB: db}).CreateSecret(rw, withUser(req, testUser))
+
+		assert.Equal(t, http.StatusNotImplemented, rw.Code)
+	})
+
+	t.Run("successful: script secret", func(t *testing.T) {
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`SELECT count(*) FROM "scripts"`).WithReply([]map[string]interface{}{{"count": 1}})
+		var values []driver.Value
+		mocket.Catcher.NewMock().WithQuery(`INSERT INTO "secrets"`).WithCallback(func(_ string, args []driver.NamedValue) {
+			for _, a := range args {
+				values = append(values, a.Value)
+			}
+		})
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"script_id": 7, "name": "api_token", "value": "s3cr3t"}`))
+		r.CreateSecret(rw, withUser(req, testUser))
+
+		assert.Equal(t, http.StatusCreated, rw.Code)
+		assert.NotContains(t, rw.Body.String(), "s3cr3t")
+		assert.NotContains(t, values, "s3cr3t")
+		assert.Contains(t, values, "api_token")
+	})
+}
+
+func TestRenderScriptSecrets(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db, Keys: testKeys(t)}
+	records := []map[string]interface{}{{"id": 7, "language": "bash", "body": "echo {{ secrets.api_token }}"}}
+
+	t.Run("error: read access only", func(t *testing.T) {
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`SELECT * FROM "scripts"`).WithReply(records)
+		mocket.Catcher.NewMock().WithQuery(`SELECT count(*) FROM "scripts"`).WithReply([]map[string]interface{}{{"count": 0}})
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.SetPathValue("id", "7")
+		r.RenderScript(rw, withUser(req, testUser))
+
+		assert.Equal(t, http.StatusForbidden, rw.Code)
+	})
+
+	t.Run("successful: secret injected", func(t *testing.T) {
+		token, _ := r.Keys.Seal("s3cr3t", boundField(fieldSecretValue, 1))
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`SELECT * FROM "scripts"`).WithReply(records)
+		mocket.Catcher.NewMock().WithQuery(`SELECT count(*) FROM "scripts"`).WithReply([]map[string]interface{}{{"count": 1}})
+		mocket.Catcher.NewMock().WithQuery(`SELECT * FROM "secrets"`).WithReply([]map[string]interface{}{{"id": 1, "script_id": 7, "name": "api_token", "value": token}})
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.SetPathValue("id", "7")
+		r.RenderScript(rw, withUser(req, testUser))
+
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, "echo s3cr3t", rw.Body.String())
+	})
+
+	t.Run("successful: secret redacted for a read-only API key", func(t *testing.T) {
+		token, _ := r.Keys.Seal("s3cr3t", boundField(fieldSecretValue, 1))
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`SELECT * FROM "scripts"`).WithReply(records)
+		mocket.Catcher.NewMock().WithQuery(`SELECT count(*) FROM "scripts"`).WithReply([]map[string]interface{}{{"count": 1}})
+		mocket.Catcher.NewMock().WithQuery(`SELECT * FROM "secrets"`).WithReply([]map[string]interface{}{{"id": 1, "script_id": 7, "name": "api_token", "value": token}})
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.SetPathValue("id", "7")
+		req = withUser(req, testUser)
+		r.RenderScript(rw, req.WithContext(context.WithValue(req.Context(), apiKeyKey, &APIKey{ID: 1, Scopes: []string{"scripts:read"}})))
+
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, "echo "+redacted, rw.Body.String())
+	})
+}
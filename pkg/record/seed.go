@@ -19,14 +19,20 @@ var Recipes = []Recipe{
 	{
 		Name:        "Adobo",
 		Description: "A meat dish with soy sauce, vinegar, garlic, and peppercorns.",
+		Ingredients: "1 kg chicken thigh\n1/2 cup soy sauce\n1/3 cup vinegar\n6 cloves garlic\n1 tsp peppercorns\n3 bay leaves\n1 cup water",
+		Servings:    4,
 	},
 	{
 		Name:        "Rice ball",
 		Description: "A simple snack made of rice, seaweed, and fillings.",
+		Ingredients: "3 cups cooked rice\n4 sheets nori\n150 g canned tuna\nsalt to taste",
+		Servings:    4,
 	},
 	{
 		Name:        "Chicken curry",
 		Description: "A chicken dish with potatoes, carrots, and breaded fried chicken.",
+		Ingredients: "500 g chicken breast\n2 potatoes\n1 carrot\n1 onion\n100 g curry roux\n1 cup panko\n1 egg\n3 cups water\n2 tbsp vegetable oil",
+		Servings:    4,
 	},
 }
 
@@ -34,13 +40,22 @@ var Scripts = []Script{
 	{
 		Name:        "Sample script 1",
 		Description: "Some description about sample script 1",
+		Language:    "bash",
+		Version:     "1.0.0",
+		Body:        "#!/usr/bin/env bash\nset -euo pipefail\n\ndf -h /\n",
 	},
 	{
 		Name:        "Sample script 2",
 		Description: "Some description about sample script 2",
+		Language:    "python",
+		Version:     "1.0.0",
+		Body:        "#!/usr/bin/env python3\nimport platform\n\nprint(platform.platform())\n",
 	},
 	{
 		Name:        "Sample script 3",
 		Description: "Some description about sample script 3",
+		Language:    "sql",
+		Version:     "1.0.0",
+		Body:        "SELECT table_name\nFROM information_schema.tables\nWHERE table_schema = 'public';\n",
 	},
 }
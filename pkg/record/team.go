@@ -0,0 +1,359 @@
+package record
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Team is the structure of the teams table, a group of users records can be
+// shared with. OwnerID is the user who created the team.
+type Team struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name" gorm:"uniqueIndex"`
+	OwnerID   uint      `json:"owner_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TeamMember is the structure of the team_members table, the role of a user in a team
+type TeamMember struct {
+	TeamID    uint      `json:"team_id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"primaryKey;index"`
+	Role      string    `json:"role" gorm:"not null;default:viewer"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// errLastAdmin is returned when the only admin of a team would be removed or demoted
+const errLastAdmin = "A team needs at least one admin"
+
+// validate checks the team, user and role of a member, defaulting to viewer
+func (m *TeamMember) validate() error {
+	if m.TeamID == 0 || m.UserID == 0 {
+		return errors.New("Missing team_id or user_id")
+	}
+
+	if m.Role == "" {
+		m.Role = RoleViewer
+	}
+
+	if !validRole(m.Role) {
+		return fmt.Errorf("Invalid role: '%s', supported roles are %s", m.Role, strings.Join(roles, ", "))
+	}
+
+	return nil
+}
+
+// teamMember returns the membership of a user in a team, if any
+func (re *Record) teamMember(teamID, userID any) (TeamMember, bool, error) {
+	var member TeamMember
+	result := re.DB.Where("team_id = ? AND user_id = ?", teamID, userID).Find(&member)
+	return member, result.RowsAffected > 0, result.Error
+}
+
+// isTeamAdmin reports whether a user is an admin of a team
+func (re *Record) isTeamAdmin(user *User, teamID any) (bool, error) {
+	member, ok, err := re.teamMember(teamID, user.ID)
+	return ok && member.Role == RoleAdmin, err
+}
+
+// isLastAdmin reports whether a member is the only admin of their team
+func (re *Record) isLastAdmin(member TeamMember) (bool, error) {
+	if member.Role != RoleAdmin {
+		return false, nil
+	}
+
+	var count int64
+	result := re.DB.Model(&TeamMember{}).Where("team_id = ? AND role = ? AND user_id <> ?",
+		member.TeamID, RoleAdmin, member.UserID).Count(&count)
+	return count == 0, result.Error
+}
+
+// CreateTeam creates a new team with the authenticated user as its first admin
+func (re *Record) CreateTeam(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var team Team
+	if err := decodeBody(r, &team); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if strings.TrimSpace(team.Name) == "" {
+		http.Error(w, "Missing team name", http.StatusBadRequest)
+		return
+	}
+
+	team = Team{Name: team.Name, OwnerID: user.ID}
+	if result := re.DB.Create(&team); result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	if result := re.DB.Create(&TeamMember{TeamID: team.ID, UserID: user.ID, Role: RoleAdmin}); result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, team)
+}
+
+// ListTeams lists the teams the authenticated user is a member of
+func (re *Record) ListTeams(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var teams []Team
+	if result := re.DB.Where("id IN (?)", re.memberTeams(user)).Order("id").Find(&teams); result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, teams)
+}
+
+// ListTeamMembers lists the members of a team the authenticated user is a member of
+func (re *Record) ListTeamMembers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	teamID := r.URL.Query().Get("team_id")
+	if teamID == "" {
+		http.Error(w, "Missing query parameter: 'team_id'", http.StatusBadRequest)
+		return
+	}
+
+	_, member, err := re.teamMember(teamID, user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !member {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var members []TeamMember
+	if result := re.DB.Where("team_id = ?", teamID).Order("user_id").Find(&members); result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, members)
+}
+
+// AddTeamMember adds a user to a team administered by the authenticated user
+func (re *Record) AddTeamMember(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var member TeamMember
+	if err := decodeBody(r, &member); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := member.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	admin, err := re.isTeamAdmin(user, member.TeamID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !admin {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	_, exists, err := re.teamMember(member.TeamID, member.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if exists {
+		http.Error(w, "User is already a member of the team", http.StatusConflict)
+		return
+	}
+
+	if result := re.DB.Create(&member); result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, member)
+}
+
+// UpdateTeamMember changes the role of a member of a team administered by the authenticated user
+func (re *Record) UpdateTeamMember(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var update TeamMember
+	if err := decodeBody(r, &update); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if update.Role == "" {
+		http.Error(w, "Missing role", http.StatusBadRequest)
+		return
+	}
+
+	if err := update.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	admin, err := re.isTeamAdmin(user, update.TeamID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !admin {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	member, ok, err := re.teamMember(update.TeamID, update.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if update.Role != RoleAdmin {
+		last, err := re.isLastAdmin(member)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if last {
+			http.Error(w, errLastAdmin, http.StatusConflict)
+			return
+		}
+	}
+
+	result := re.DB.Model(&TeamMember{}).Where("team_id = ? AND user_id = ?", member.TeamID, member.UserID).
+		Update("role", update.Role)
+	if result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	member.Role = update.Role
+	writeJSON(w, http.StatusOK, member)
+}
+
+// RemoveTeamMember removes a user from a team administered by the
+// authenticated user. Any member can leave a team.
+func (re *Record) RemoveTeamMember(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	teamID, userID := query.Get("team_id"), query.Get("user_id")
+	if teamID == "" || userID == "" {
+		http.Error(w, "Missing query parameters: 'team_id' and 'user_id'", http.StatusBadRequest)
+		return
+	}
+
+	if userID != strconv.FormatUint(uint64(user.ID), 10) {
+		admin, err := re.isTeamAdmin(user, teamID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if !admin {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+	}
+
+	member, ok, err := re.teamMember(teamID, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	last, err := re.isLastAdmin(member)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if last {
+		http.Error(w, errLastAdmin, http.StatusConflict)
+		return
+	}
+
+	result := re.DB.Where("team_id = ? AND user_id = ?", teamID, userID).Delete(&TeamMember{})
+	if result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
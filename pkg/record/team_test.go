@@ -0,0 +1,198 @@
+package record
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	mocket "github.com/selvatico/go-mocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// adminMember is the reply of a membership query for a team admin
+var adminMember = []map[string]interface{}{{"team_id": 3, "user_id": 1, "role": RoleAdmin}}
+
+func TestTeamMemberValidate(t *testing.T) {
+	member := TeamMember{TeamID: 3, UserID: 2}
+	assert.Nil(t, member.validate())
+	assert.Equal(t, RoleViewer, member.Role)
+
+	assert.NotNil(t, (&TeamMember{TeamID: 3}).validate())
+	assert.NotNil(t, (&TeamMember{TeamID: 3, UserID: 2, Role: "owner"}).validate())
+}
+
+func TestCreateTeam(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db}
+
+	t.Run(errMissingParam, func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		r.CreateTeam(rw, withUser(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name": " "}`)), testUser))
+
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+
+	t.Run(successOneRecord, func(t *testing.T) {
+		var role string
+		mocket.Catcher.Reset().NewMock().WithQuery(`INSERT INTO "team_members"`).WithCallback(func(_ string, args []driver.NamedValue) {
+			for _, a := range args {
+				if v, ok := a.Value.(string); ok {
+					role = v
+				}
+			}
+		})
+		rw := httptest.NewRecorder()
+		r.CreateTeam(rw, withUser(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name": "ops", "owner_id": 9}`)), testUser))
+
+		assert.Equal(t, http.StatusCreated, rw.Code)
+		assert.Contains(t, rw.Body.String(), `"owner_id":1`)
+		assert.Equal(t, RoleAdmin, role)
+	})
+}
+
+func TestListTeamMembers(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db}
+
+	t.Run(errMissingParam, func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		r.ListTeamMembers(rw, withUser(httptest.NewRequest(http.MethodGet, "/", nil), testUser))
+
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+
+	t.Run("not a member", func(t *testing.T) {
+		mocket.Catcher.Reset()
+		rw := httptest.NewRecorder()
+		r.ListTeamMembers(rw, withUser(httptest.NewRequest(http.MethodGet, "/?team_id=3", nil), testUser))
+
+		assert.Equal(t, http.StatusNotFound, rw.Code)
+	})
+
+	t.Run(successMultRecords, func(t *testing.T) {
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`"team_members" WHERE team_id = $1 AND user_id = $2`).WithReply(adminMember)
+		mocket.Catcher.NewMock().WithQuery(`"team_members" WHERE team_id = $1 ORDER BY`).WithReply([]map[string]interface{}{
+			{"team_id": 3, "user_id": 1, "role": RoleAdmin},
+			{"team_id": 3, "user_id": 2, "role": RoleViewer},
+		})
+		rw := httptest.NewRecorder()
+		r.ListTeamMembers(rw, withUser(httptest.NewRequest(http.MethodGet, "/?team_id=3", nil), testUser))
+
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Contains(t, rw.Body.String(), `"role":"viewer"`)
+	})
+}
+
+func TestAddTeamMember(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db}
+
+	t.Run("invalid role", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		r.AddTeamMember(rw, withUser(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"team_id": 3, "user_id": 2, "role": "owner"}`)), testUser))
+
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+
+	t.Run("not an admin", func(t *testing.T) {
+		mocket.Catcher.Reset().NewMock().WithQuery(`"team_members"`).WithReply([]map[string]interface{}{{"team_id": 3, "user_id": 1, "role": RoleEditor}})
+		rw := httptest.NewRecorder()
+		r.AddTeamMember(rw, withUser(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"team_id": 3, "user_id": 2}`)), testUser))
+
+		assert.Equal(t, http.StatusNotFound, rw.Code)
+	})
+
+	t.Run("already a member", func(t *testing.T) {
+		mocket.Catcher.Reset().NewMock().WithQuery(`"team_members"`).WithReply(adminMember)
+		rw := httptest.NewRecorder()
+		r.AddTeamMember(rw, withUser(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"team_id": 3, "user_id": 2}`)), testUser))
+
+		assert.Equal(t, http.StatusConflict, rw.Code)
+	})
+
+	t.Run(successOneRecord, func(t *testing.T) {
+		mocket.Catcher.Reset().NewMock().WithQuery(`SELECT * FROM "team_members"`).WithReply(adminMember).OneTime()
+		rw := httptest.NewRecorder()
+		r.AddTeamMember(rw, withUser(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"team_id": 3, "user_id": 2, "role": "editor"}`)), testUser))
+
+		assert.Equal(t, http.StatusCreated, rw.Code)
+		assert.Contains(t, rw.Body.String(), `"role":"editor"`)
+	})
+}
+
+func TestUpdateTeamMember(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db}
+
+	t.Run("missing role", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		r.UpdateTeamMember(rw, withUser(httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"team_id": 3, "user_id": 2}`)), testUser))
+
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+
+	t.Run("last admin", func(t *testing.T) {
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`SELECT count(*) FROM "team_members"`).WithReply([]map[string]interface{}{{"count": 0}})
+		mocket.Catcher.NewMock().WithQuery(`SELECT * FROM "team_members"`).WithReply(adminMember)
+		rw := httptest.NewRecorder()
+		r.UpdateTeamMember(rw, withUser(httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"team_id": 3, "user_id": 1, "role": "viewer"}`)), testUser))
+
+		assert.Equal(t, http.StatusConflict, rw.Code)
+	})
+
+	t.Run(successOneRecord, func(t *testing.T) {
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`SELECT * FROM "team_members"`).WithReply(adminMember).OneTime()
+		mocket.Catcher.NewMock().WithQuery(`SELECT * FROM "team_members"`).WithReply([]map[string]interface{}{{"team_id": 3, "user_id": 2, "role": RoleViewer}})
+		rw := httptest.NewRecorder()
+		r.UpdateTeamMember(rw, withUser(httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"team_id": 3, "user_id": 2, "role": "editor"}`)), testUser))
+
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Contains(t, rw.Body.String(), `"role":"editor"`)
+	})
+}
+
+func TestRemoveTeamMember(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db}
+
+	t.Run(errMissingParam, func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		r.RemoveTeamMember(rw, withUser(httptest.NewRequest(http.MethodDelete, "/?team_id=3", nil), testUser))
+
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+
+	t.Run("not an admin", func(t *testing.T) {
+		mocket.Catcher.Reset()
+		rw := httptest.NewRecorder()
+		r.RemoveTeamMember(rw, withUser(httptest.NewRequest(http.MethodDelete, "/?team_id=3&user_id=2", nil), testUser))
+
+		assert.Equal(t, http.StatusNotFound, rw.Code)
+	})
+
+	t.Run("leave the team", func(t *testing.T) {
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`SELECT * FROM "team_members"`).WithReply([]map[string]interface{}{{"team_id": 3, "user_id": 1, "role": RoleViewer}})
+		mocket.Catcher.NewMock().WithQuery(`DELETE FROM "team_members"`).WithRowsNum(1)
+		rw := httptest.NewRecorder()
+		r.RemoveTeamMember(rw, withUser(httptest.NewRequest(http.MethodDelete, "/?team_id=3&user_id=1", nil), testUser))
+
+		assert.Equal(t, http.StatusOK, rw.Code)
+	})
+
+	t.Run(successRecordDeleted, func(t *testing.T) {
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`SELECT * FROM "team_members"`).WithReply(adminMember).OneTime()
+		mocket.Catcher.NewMock().WithQuery(`SELECT * FROM "team_members"`).WithReply([]map[string]interface{}{{"team_id": 3, "user_id": 2, "role": RoleEditor}})
+		mocket.Catcher.NewMock().WithQuery(`DELETE FROM "team_members"`).WithRowsNum(1)
+		rw := httptest.NewRecorder()
+		r.RemoveTeamMember(rw, withUser(httptest.NewRequest(http.MethodDelete, "/?team_id=3&user_id=2", nil), testUser))
+
+		assert.Equal(t, http.StatusOK, rw.Code)
+	})
+}
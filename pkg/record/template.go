@@ -0,0 +1,399 @@
+package record
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Types of a script parameter
+const (
+	ParamString = "string"
+	ParamInt    = "int"
+	ParamBool   = "bool"
+	ParamEnum   = "enum"
+)
+
+// placeholder matches template placeholders such as {{ host }} in a script body
+var placeholder = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// secretReference matches references to secrets such as {{ secrets.api_token }} in a script body
+var secretReference = regexp.MustCompile(`\{\{\s*secrets\.([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// reference matches both placeholders and references to secrets
+var reference = regexp.MustCompile(placeholder.String() + "|" + secretReference.String())
+
+// parameterName matches valid parameter names
+var parameterName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ScriptParameter is a typed parameter declared by a script and referenced
+// from its body as {{ name }}
+type ScriptParameter struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Type        string   `json:"type,omitempty"`
+	Required    bool     `json:"required,omitempty"`
+	Default     string   `json:"default,omitempty"`
+	Options     []string `json:"options,omitempty"`
+	Pattern     string   `json:"pattern,omitempty"`
+	Min         *int64   `json:"min,omitempty"`
+	Max         *int64   `json:"max,omitempty"`
+}
+
+// RenderRequest is the body of a render request
+type RenderRequest struct {
+	Values map[string]any `json:"values"`
+}
+
+// ParameterError lists the problems found with the values given for a
+// script's parameters
+type ParameterError struct {
+	Problems map[string]string `json:"errors"`
+}
+
+// Error implements the error interface
+func (e *ParameterError) Error() string {
+	names := make([]string, 0, len(e.Problems))
+	for name := range e.Problems {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	problems := make([]string, len(names))
+	for i, name := range names {
+		problems[i] = fmt.Sprintf("%s: %s", name, e.Problems[name])
+	}
+
+	return "invalid parameters: " + strings.Join(problems, "; ")
+}
+
+// validateParameters checks the parameter declarations of a script and that
+// every placeholder of its body refers to a declared parameter. Scripts
+// without parameters are not templates, so their bodies are left unchecked.
+func (s *Script) validateParameters() error {
+	declared := map[string]bool{}
+	for i := range s.Parameters {
+		p := &s.Parameters[i]
+		if p.Name == "" {
+			return errors.New("Missing parameter name")
+		}
+		if !parameterName.MatchString(p.Name) {
+			return fmt.Errorf("Invalid parameter name: '%s'", p.Name)
+		}
+		if declared[p.Name] {
+			return fmt.Errorf("Duplicate parameter: '%s'", p.Name)
+		}
+		declared[p.Name] = true
+
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("Invalid parameter '%s': %s", p.Name, err)
+		}
+	}
+
+	if len(s.Parameters) == 0 {
+		return nil
+	}
+
+	for _, name := range s.Placeholders() {
+		if !declared[name] {
+			return fmt.Errorf("Undeclared parameter in body: '%s'", name)
+		}
+	}
+
+	return nil
+}
+
+// validate normalizes the type of a parameter declaration and checks its default
+func (p *ScriptParameter) validate() error {
+	if p.Type == "" {
+		p.Type = ParamString
+	}
+
+	switch p.Type {
+	case ParamString:
+		if p.Pattern != "" {
+			if _, err := regexp.Compile(p.Pattern); err != nil {
+				return fmt.Errorf("invalid pattern: %w", err)
+			}
+		}
+	case ParamInt:
+		if p.Min != nil && p.Max != nil && *p.Min > *p.Max {
+			return errors.New("min is greater than max")
+		}
+	case ParamBool:
+	case ParamEnum:
+		if len(p.Options) == 0 {
+			return errors.New("enum without options")
+		}
+	default:
+		return fmt.Errorf("unsupported type '%s'", p.Type)
+	}
+
+	if p.Default != "" {
+		if _, err := p.resolve(p.Default); err != nil {
+			return fmt.Errorf("invalid default: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// resolve validates a value given for the parameter and returns its textual form
+func (p *ScriptParameter) resolve(value any) (string, error) {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case bool:
+		s = strconv.FormatBool(v)
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	case json.Number:
+		s = v.String()
+	default:
+		return "", fmt.Errorf("unsupported value %v", value)
+	}
+
+	switch p.Type {
+	case ParamInt:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("'%s' is not an integer", s)
+		}
+		if p.Min != nil && n < *p.Min {
+			return "", fmt.Errorf("%d is less than %d", n, *p.Min)
+		}
+		if p.Max != nil && n > *p.Max {
+			return "", fmt.Errorf("%d is greater than %d", n, *p.Max)
+		}
+		return strconv.FormatInt(n, 10), nil
+	case ParamBool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return "", fmt.Errorf("'%s' is not a boolean", s)
+		}
+		return strconv.FormatBool(b), nil
+	case ParamEnum:
+		if !slices.Contains(p.Options, s) {
+			return "", fmt.Errorf("'%s' is not one of %s", s, strings.Join(p.Options, ", "))
+		}
+		return s, nil
+	default:
+		if p.Pattern != "" {
+			if ok, _ := regexp.MatchString(p.Pattern, s); !ok {
+				return "", fmt.Errorf("'%s' does not match %s", s, p.Pattern)
+			}
+		}
+		return s, nil
+	}
+}
+
+// Placeholders returns the distinct parameter names referenced in the body of
+// a script, in order of first appearance
+func (s *Script) Placeholders() []string {
+	var names []string
+	for _, m := range placeholder.FindAllStringSubmatch(s.Body, -1) {
+		if !slices.Contains(names, m[1]) {
+			names = append(names, m[1])
+		}
+	}
+
+	return names
+}
+
+// SecretNames returns the distinct secret names referenced in the body of a
+// script, in order of first appearance
+func (s *Script) SecretNames() []string {
+	var names []string
+	for _, m := range secretReference.FindAllStringSubmatch(s.Body, -1) {
+		if !slices.Contains(names, m[1]) {
+			names = append(names, m[1])
+		}
+	}
+
+	return names
+}
+
+// Render fills in the placeholders of a script's body with the given values,
+// falling back to the parameters' defaults, and the references to secrets
+// with the given secrets. A *ParameterError is returned if a required value
+// is missing, a value is invalid, an unknown parameter is given or a
+// referenced secret is missing.
+func (s *Script) Render(values map[string]any, secrets map[string]string) (string, error) {
+	problems := map[string]string{}
+	resolved := map[string]string{}
+
+	for i := range s.Parameters {
+		p := &s.Parameters[i]
+		if p.Type == "" {
+			p.Type = ParamString
+		}
+
+		value, ok := values[p.Name]
+		if !ok || value == nil {
+			if p.Default == "" {
+				if p.Required {
+					problems[p.Name] = "missing required value"
+				} else {
+					resolved[p.Name] = ""
+				}
+				continue
+			}
+			value = p.Default
+		}
+
+		v, err := p.resolve(value)
+		if err != nil {
+			problems[p.Name] = err.Error()
+			continue
+		}
+		resolved[p.Name] = v
+	}
+
+	for name := range values {
+		if !slices.ContainsFunc(s.Parameters, func(p ScriptParameter) bool { return p.Name == name }) {
+			problems[name] = "unknown parameter"
+		}
+	}
+
+	for _, name := range s.SecretNames() {
+		if _, ok := secrets[name]; !ok {
+			problems["secrets."+name] = "unknown secret"
+		}
+	}
+
+	if len(problems) > 0 {
+		return "", &ParameterError{Problems: problems}
+	}
+
+	// A single pass keeps parameter values from injecting references to secrets
+	return reference.ReplaceAllStringFunc(s.Body, func(m string) string {
+		sub := reference.FindStringSubmatch(m)
+		if sub[1] != "" {
+			if v, ok := resolved[sub[1]]; ok {
+				return v
+			}
+			return m
+		}
+		return secrets[sub[2]]
+	}), nil
+}
+
+// RenderScript returns the body of a specific script with its placeholders
+// filled in from the given parameter values
+func (re *Record) RenderScript(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	re = re.inWorkspace(r)
+
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "Missing path parameter: 'id'", http.StatusBadRequest)
+		return
+	}
+
+	var req RenderRequest
+	if r.Body != nil {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer r.Body.Close()
+
+		if len(body) > 0 {
+			if err := json.Unmarshal(body, &req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	var script Script
+	result := re.DB.Scopes(re.authorize(user, TypeScript, ActionRead)).Where(filterByID, id).Find(&script)
+	if result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if err := re.decryptScript(&script); err != nil {
+		writeEncryptionError(w, err)
+		return
+	}
+
+	// Revealing secrets takes the same access as running the script
+	var secrets map[string]string
+	if len(script.SecretNames()) > 0 {
+		allowed, err := re.can(user, TypeScript, script.ID, ActionEdit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if !allowed {
+			http.Error(w, "Rendering secrets needs edit access to the script", http.StatusForbidden)
+			return
+		}
+
+		if secrets, err = re.scriptSecrets(r, user, &script); err != nil {
+			writeEncryptionError(w, err)
+			return
+		}
+
+		// API keys that cannot run the script only render placeholders
+		if key, ok := apiKeyFromContext(r.Context()); ok && !key.allows("scripts:"+ScopeRun) {
+			for name := range secrets {
+				secrets[name] = redacted
+			}
+		}
+	}
+
+	rendered, err := script.Render(req.Values, secrets)
+	if err != nil {
+		writeParameterError(w, err)
+		return
+	}
+
+	w.Header().Set("content-type", script.contentType())
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, rendered)
+}
+
+// writeParameterError writes a parameter error as a JSON bad request
+func writeParameterError(w http.ResponseWriter, err error) {
+	var paramErr *ParameterError
+	if !errors.As(err, &paramErr) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	details, err := json.Marshal(paramErr)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write(details)
+}
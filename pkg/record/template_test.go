@@ -0,0 +1,155 @@
+package record
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	mocket "github.com/selvatico/go-mocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func int64Ptr(n int64) *int64 {
+	return &n
+}
+
+var testTemplate = Script{
+	Name:     "Backup",
+	Language: "bash",
+	Body:     "rsync -a {{ path }} {{host}}:/backup --port={{ port }} --dry-run={{dry_run}} --mode={{ mode }}\n",
+	Parameters: []ScriptParameter{
+		{Name: "host", Required: true, Pattern: `^[a-z0-9.-]+$`},
+		{Name: "path", Default: "/srv"},
+		{Name: "port", Type: ParamInt, Default: "22", Min: int64Ptr(1), Max: int64Ptr(65535)},
+		{Name: "dry_run", Type: ParamBool, Default: "false"},
+		{Name: "mode", Type: ParamEnum, Options: []string{"full", "incremental"}, Default: "full"},
+	},
+}
+
+func TestValidateParameters(t *testing.T) {
+	tests := map[string]struct {
+		script  Script
+		wantErr bool
+	}{
+		"valid template":         {script: testTemplate},
+		"no parameters":          {script: Script{Body: "echo {{ not_a_template }}"}},
+		"undeclared placeholder": {script: Script{Body: "{{ a }} {{ b }}", Parameters: []ScriptParameter{{Name: "a"}}}, wantErr: true},
+		"invalid name":           {script: Script{Parameters: []ScriptParameter{{Name: "my-host"}}}, wantErr: true},
+		"duplicate name":         {script: Script{Parameters: []ScriptParameter{{Name: "a"}, {Name: "a"}}}, wantErr: true},
+		"unsupported type":       {script: Script{Parameters: []ScriptParameter{{Name: "a", Type: "float"}}}, wantErr: true},
+		"enum without options":   {script: Script{Parameters: []ScriptParameter{{Name: "a", Type: ParamEnum}}}, wantErr: true},
+		"invalid default":        {script: Script{Parameters: []ScriptParameter{{Name: "a", Type: ParamInt, Default: "abc"}}}, wantErr: true},
+		"invalid pattern":        {script: Script{Parameters: []ScriptParameter{{Name: "a", Pattern: "("}}}, wantErr: true},
+	}
+
+	for testName, test := range tests {
+		t.Run(testName, func(t *testing.T) {
+			err := test.script.validateParameters()
+			assert.Equal(t, test.wantErr, err != nil)
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		body, err := testTemplate.Render(map[string]any{"host": "db1.example.com"}, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, "rsync -a /srv db1.example.com:/backup --port=22 --dry-run=false --mode=full\n", body)
+	})
+
+	t.Run("typed values", func(t *testing.T) {
+		body, err := testTemplate.Render(map[string]any{
+			"host":    "db2",
+			"path":    "/var/lib",
+			"port":    float64(2222),
+			"dry_run": true,
+			"mode":    "incremental",
+		}, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, "rsync -a /var/lib db2:/backup --port=2222 --dry-run=true --mode=incremental\n", body)
+	})
+
+	t.Run("invalid values", func(t *testing.T) {
+		_, err := testTemplate.Render(map[string]any{
+			"host":    "db1; rm -rf /",
+			"port":    "70000",
+			"dry_run": "maybe",
+			"mode":    "partial",
+			"user":    "root",
+		}, nil)
+
+		paramErr, ok := err.(*ParameterError)
+		assert.True(t, ok)
+		assert.Len(t, paramErr.Problems, 5)
+		assert.Equal(t, "unknown parameter", paramErr.Problems["user"])
+	})
+
+	t.Run("missing required value", func(t *testing.T) {
+		_, err := testTemplate.Render(nil, nil)
+
+		paramErr, ok := err.(*ParameterError)
+		assert.True(t, ok)
+		assert.Equal(t, map[string]string{"host": "missing required value"}, paramErr.Problems)
+	})
+}
+
+func TestRenderScript(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db}
+
+	params, err := json.Marshal(testTemplate.Parameters)
+	assert.Nil(t, err)
+	records := []map[string]interface{}{
+		{"id": 7, "language": "bash", "body": testTemplate.Body, "parameters": string(params)},
+	}
+
+	t.Run(errInvalidMethod, func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		r.RenderScript(rw, withUser(&http.Request{Method: http.MethodGet}, testUser))
+
+		assert.Equal(t, http.StatusMethodNotAllowed, rw.Code)
+	})
+
+	t.Run(errMissingParam, func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		r.RenderScript(rw, withUser(&http.Request{Method: http.MethodPost}, testUser))
+
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+
+	t.Run("error: invalid values", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		mocket.Catcher.Reset().NewMock().WithReply(records)
+		req := &http.Request{
+			Method: http.MethodPost,
+			Body:   io.NopCloser(strings.NewReader(`{"values": {"port": "ssh"}}`)),
+		}
+		req.SetPathValue("id", "7")
+		r.RenderScript(rw, withUser(req, testUser))
+
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+
+		var paramErr ParameterError
+		err := json.Unmarshal(rw.Body.Bytes(), &paramErr)
+		assert.Nil(t, err)
+		assert.Contains(t, paramErr.Problems, "host")
+		assert.Contains(t, paramErr.Problems, "port")
+	})
+
+	t.Run("successful: script rendered", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		mocket.Catcher.Reset().NewMock().WithReply(records)
+		req := &http.Request{
+			Method: http.MethodPost,
+			Body:   io.NopCloser(strings.NewReader(`{"values": {"host": "db1", "port": 2200}}`)),
+		}
+		req.SetPathValue("id", "7")
+		r.RenderScript(rw, withUser(req, testUser))
+
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, "rsync -a /srv db1:/backup --port=2200 --dry-run=false --mode=full\n", rw.Body.String())
+	})
+}
@@ -0,0 +1,332 @@
+package record
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/jvmistica/knowledge-base-go/pkg/config"
+)
+
+// sessionPrefix is the prefix of the tokens of a session
+const sessionPrefix = "kbs_"
+
+// AuthSettings are the settings of the sessions and the registration of users
+type AuthSettings struct {
+	// AccessTokenTTL and RefreshTokenTTL are the lifetimes of the tokens of
+	// a session, zero for the defaults
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// DisableRegistration rejects new users, which are then added by other means
+	DisableRegistration bool
+}
+
+// Limits of a password; bcrypt ignores anything after 72 bytes
+const (
+	minPasswordLen = 8
+	maxPasswordLen = 72
+)
+
+// username matches valid usernames
+var username = regexp.MustCompile(`^[A-Za-z0-9_.-]{3,64}$`)
+
+// dummyHash is compared against when logging in as an unknown user, so that
+// unknown users cannot be told apart by the response time
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("knowledge-base"), bcrypt.DefaultCost)
+
+// User is the structure of the users table
+type User struct {
+	ID           uint      `json:"id"`
+	Username     string    `json:"username" gorm:"uniqueIndex"`
+	PasswordHash string    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Session is the structure of the sessions table, a login of a user. Only
+// the hashes of its tokens are stored.
+type Session struct {
+	ID               uint      `json:"id"`
+	UserID           uint      `json:"user_id" gorm:"index"`
+	TokenHash        string    `json:"-" gorm:"uniqueIndex"`
+	RefreshHash      string    `json:"-" gorm:"uniqueIndex"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// Credentials is the body of a register or login request
+type Credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// RefreshRequest is the body of a refresh request
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// TokenResponse is the response of a login or refresh request
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// validate checks the username and password of new credentials
+func (c *Credentials) validate() error {
+	if !username.MatchString(c.Username) {
+		return errors.New("Invalid username: must be 3 to 64 letters, digits, '_', '.' or '-'")
+	}
+
+	if len(c.Password) < minPasswordLen || len(c.Password) > maxPasswordLen {
+		return fmt.Errorf("Invalid password: must be %d to %d bytes long", minPasswordLen, maxPasswordLen)
+	}
+
+	return nil
+}
+
+// issueTokens sets new tokens on a session and returns them
+func (s *Session) issueTokens(settings AuthSettings) (*TokenResponse, error) {
+	access, err := newToken(sessionPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	refresh, err := newToken(sessionPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	accessTTL := cmp.Or(settings.AccessTokenTTL, config.DefaultAccessTokenTTL)
+	refreshTTL := cmp.Or(settings.RefreshTokenTTL, config.DefaultRefreshTokenTTL)
+
+	now := time.Now()
+	s.TokenHash, s.ExpiresAt = hashToken(access), now.Add(accessTTL)
+	s.RefreshHash, s.RefreshExpiresAt = hashToken(refresh), now.Add(refreshTTL)
+
+	return &TokenResponse{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(accessTTL.Seconds()),
+	}, nil
+}
+
+// decodeBody decodes the JSON body of a request
+func decodeBody(r *http.Request, v any) error {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+
+	return json.Unmarshal(body, v)
+}
+
+// writeJSON writes a value as a JSON response with the given status
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	details, err := json.Marshal(v)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(status)
+	w.Write(details)
+}
+
+// Register creates a new user
+func (re *Record) Register(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if re.Auth.DisableRegistration {
+		http.Error(w, "Registration is disabled", http.StatusForbidden)
+		return
+	}
+
+	var credentials Credentials
+	if err := decodeBody(r, &credentials); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := credentials.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var count int64
+	if result := re.DB.Model(&User{}).Where("username = ?", credentials.Username).Count(&count); result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	if count > 0 {
+		http.Error(w, fmt.Sprintf("Username already taken: '%s'", credentials.Username), http.StatusConflict)
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(credentials.Password), bcrypt.DefaultCost)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	user := User{Username: credentials.Username, PasswordHash: string(hash)}
+	if result := re.DB.Create(&user); result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, user)
+}
+
+// Login starts a session for a user with a valid username and password
+func (re *Record) Login(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var credentials Credentials
+	if err := decodeBody(r, &credentials); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var user User
+	result := re.DB.Where("username = ?", credentials.Username).Limit(1).Find(&user)
+	if result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	hash := dummyHash
+	if result.RowsAffected > 0 {
+		hash = []byte(user.PasswordHash)
+	}
+
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(credentials.Password)); err != nil || result.RowsAffected == 0 {
+		unauthorized(w, "Invalid username or password")
+		return
+	}
+
+	session := Session{UserID: user.ID}
+	tokens, err := session.issueTokens(re.Auth)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if result := re.DB.Create(&session); result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tokens)
+}
+
+// RefreshSession replaces the tokens of a session given its refresh token.
+// The refresh token can only be used once.
+func (re *Record) RefreshSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req RefreshRequest
+	if err := decodeBody(r, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.RefreshToken == "" {
+		http.Error(w, "Missing refresh token", http.StatusBadRequest)
+		return
+	}
+
+	var session Session
+	result := re.DB.Where("refresh_hash = ? AND refresh_expires_at > ?", hashToken(req.RefreshToken), time.Now()).
+		Limit(1).Find(&session)
+	if result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		unauthorized(w, "Invalid or expired refresh token")
+		return
+	}
+
+	used := session.RefreshHash
+	tokens, err := session.issueTokens(re.Auth)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The refresh token is replaced only if no concurrent refresh used it first
+	result = re.DB.Model(&Session{}).Where("id = ? AND refresh_hash = ?", session.ID, used).
+		Select("token_hash", "expires_at", "refresh_hash", "refresh_expires_at").Updates(&session)
+	if result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	if result.RowsAffected != 1 {
+		unauthorized(w, "Invalid or expired refresh token")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tokens)
+}
+
+// Logout ends the session of the authenticated user
+func (re *Record) Logout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	session, ok := sessionFromContext(r.Context())
+	if !ok {
+		unauthorized(w, "Not logged in")
+		return
+	}
+
+	if result := re.DB.Where(filterByID, session.ID).Delete(&Session{}); result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// GetCurrentUser gets the details of the authenticated user
+func (re *Record) GetCurrentUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		unauthorized(w, "Not logged in")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, user)
+}
@@ -0,0 +1,224 @@
+package record
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	mocket "github.com/selvatico/go-mocket"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestRegister(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db}
+
+	t.Run(errInvalidMethod, func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		r.Register(rw, &http.Request{Method: http.MethodGet})
+
+		assert.Equal(t, http.StatusMethodNotAllowed, rw.Code)
+	})
+
+	t.Run("registration disabled", func(t *testing.T) {
+		r := &Record{DB: db, Auth: AuthSettings{DisableRegistration: true}}
+		rw := httptest.NewRecorder()
+		r.Register(rw, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"username": "alice", "password": "correct horse"}`)))
+
+		assert.Equal(t, http.StatusForbidden, rw.Code)
+	})
+
+	for name, body := range map[string]string{
+		"invalid username": `{"username": "a b", "password": "correct horse"}`,
+		"short password":   `{"username": "alice", "password": "short"}`,
+		"long password":    `{"username": "alice", "password": "` + strings.Repeat("x", 73) + `"}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			r.Register(rw, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+
+			assert.Equal(t, http.StatusBadRequest, rw.Code)
+		})
+	}
+
+	t.Run("username taken", func(t *testing.T) {
+		mocket.Catcher.Reset().NewMock().WithQuery(`SELECT count(*) FROM "users"`).WithReply([]map[string]interface{}{{"count": 1}})
+		rw := httptest.NewRecorder()
+		r.Register(rw, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"username": "alice", "password": "correct horse"}`)))
+
+		assert.Equal(t, http.StatusConflict, rw.Code)
+	})
+
+	t.Run(successOneRecord, func(t *testing.T) {
+		mocket.Catcher.Reset()
+		rw := httptest.NewRecorder()
+		r.Register(rw, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"username": "alice", "password": "correct horse"}`)))
+		assert.Equal(t, http.StatusCreated, rw.Code)
+		assert.NotContains(t, rw.Body.String(), "password")
+
+		var user User
+		assert.Nil(t, json.Unmarshal(rw.Body.Bytes(), &user))
+		assert.Equal(t, "alice", user.Username)
+	})
+}
+
+func TestLogin(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	assert.Nil(t, err)
+	users := []map[string]interface{}{{"id": 1, "username": "alice", "password_hash": string(hash)}}
+
+	t.Run("unknown user", func(t *testing.T) {
+		mocket.Catcher.Reset().NewMock().WithQuery(`FROM "users"`).WithRowsNum(0)
+		rw := httptest.NewRecorder()
+		r.Login(rw, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"username": "bob", "password": "correct horse"}`)))
+
+		assert.Equal(t, http.StatusUnauthorized, rw.Code)
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		mocket.Catcher.Reset().NewMock().WithQuery(`FROM "users"`).WithReply(users)
+		rw := httptest.NewRecorder()
+		r.Login(rw, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"username": "alice", "password": "battery staple"}`)))
+
+		assert.Equal(t, http.StatusUnauthorized, rw.Code)
+		assert.NotEmpty(t, rw.Header().Get("www-authenticate"))
+	})
+
+	t.Run(successRecordFound, func(t *testing.T) {
+		mocket.Catcher.Reset().NewMock().WithQuery(`FROM "users"`).WithReply(users)
+		rw := httptest.NewRecorder()
+		r.Login(rw, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"username": "alice", "password": "correct horse"}`)))
+		assert.Equal(t, http.StatusOK, rw.Code)
+
+		var tokens TokenResponse
+		assert.Nil(t, json.Unmarshal(rw.Body.Bytes(), &tokens))
+		assert.NotEmpty(t, tokens.AccessToken)
+		assert.NotEmpty(t, tokens.RefreshToken)
+		assert.NotEqual(t, tokens.AccessToken, tokens.RefreshToken)
+		assert.Equal(t, "Bearer", tokens.TokenType)
+		assert.Equal(t, 3600, tokens.ExpiresIn)
+	})
+
+	t.Run("token lifetime", func(t *testing.T) {
+		mocket.Catcher.Reset().NewMock().WithQuery(`FROM "users"`).WithReply(users)
+		r := &Record{DB: db, Auth: AuthSettings{AccessTokenTTL: 15 * time.Minute}}
+		rw := httptest.NewRecorder()
+		r.Login(rw, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"username": "alice", "password": "correct horse"}`)))
+		assert.Equal(t, http.StatusOK, rw.Code)
+
+		var tokens TokenResponse
+		assert.Nil(t, json.Unmarshal(rw.Body.Bytes(), &tokens))
+		assert.Equal(t, 900, tokens.ExpiresIn)
+	})
+}
+
+func TestRefreshSession(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db}
+
+	t.Run(errMissingParam, func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		r.RefreshSession(rw, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{}`)))
+
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		mocket.Catcher.Reset().NewMock().WithQuery(`FROM "sessions"`).WithRowsNum(0)
+		rw := httptest.NewRecorder()
+		r.RefreshSession(rw, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"refresh_token": "nope"}`)))
+
+		assert.Equal(t, http.StatusUnauthorized, rw.Code)
+	})
+
+	t.Run(successRecordFound, func(t *testing.T) {
+		mocket.Catcher.Reset().NewMock().WithQuery(`FROM "sessions"`).WithReply([]map[string]interface{}{
+			{"id": 4, "user_id": 1, "refresh_expires_at": time.Now().Add(time.Hour)},
+		})
+		mocket.Catcher.NewMock().WithQuery(`UPDATE "sessions"`).WithRowsNum(1)
+		rw := httptest.NewRecorder()
+		r.RefreshSession(rw, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"refresh_token": "valid"}`)))
+		assert.Equal(t, http.StatusOK, rw.Code)
+
+		var tokens TokenResponse
+		assert.Nil(t, json.Unmarshal(rw.Body.Bytes(), &tokens))
+		assert.NotEmpty(t, tokens.AccessToken)
+	})
+
+	t.Run("replayed token", func(t *testing.T) {
+		// The concurrent refresh replaced the token between the lookup and the update
+		var query string
+		var args []driver.NamedValue
+		mocket.Catcher.Reset().NewMock().WithQuery(`FROM "sessions"`).WithReply([]map[string]interface{}{
+			{"id": 4, "user_id": 1, "refresh_hash": hashToken("valid"), "refresh_expires_at": time.Now().Add(time.Hour)},
+		})
+		mocket.Catcher.NewMock().WithQuery(`UPDATE "sessions"`).WithRowsNum(0).WithCallback(func(q string, a []driver.NamedValue) {
+			query, args = q, a
+		})
+		rw := httptest.NewRecorder()
+		r.RefreshSession(rw, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"refresh_token": "valid"}`)))
+
+		assert.Equal(t, http.StatusUnauthorized, rw.Code)
+		assert.Contains(t, query, "refresh_hash = $")
+		assert.Equal(t, hashToken("valid"), args[len(args)-1].Value)
+	})
+}
+
+func TestAuthenticate(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db}
+
+	handler := r.Authenticate(http.HandlerFunc(r.GetCurrentUser))
+
+	t.Run("missing token", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/api/v1/auth/me", nil))
+
+		assert.Equal(t, http.StatusUnauthorized, rw.Code)
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		mocket.Catcher.Reset().NewMock().WithQuery(`FROM "sessions"`).WithRowsNum(0)
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/me", nil)
+		req.Header.Set("Authorization", "Bearer nope")
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rw.Code)
+	})
+
+	t.Run(successRecordFound, func(t *testing.T) {
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`FROM "sessions"`).WithReply([]map[string]interface{}{{"id": 4, "user_id": 1}})
+		mocket.Catcher.NewMock().WithQuery(`FROM "users"`).WithReply([]map[string]interface{}{{"id": 1, "username": "alice"}})
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/me", nil)
+		req.Header.Set("Authorization", "Bearer valid")
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+		assert.Equal(t, http.StatusOK, rw.Code)
+
+		var user User
+		assert.Nil(t, json.Unmarshal(rw.Body.Bytes(), &user))
+		assert.Equal(t, "alice", user.Username)
+	})
+
+	t.Run("logout", func(t *testing.T) {
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`FROM "sessions"`).WithReply([]map[string]interface{}{{"id": 4, "user_id": 1}})
+		mocket.Catcher.NewMock().WithQuery(`FROM "users"`).WithReply([]map[string]interface{}{{"id": 1, "username": "alice"}})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/logout", nil)
+		req.Header.Set("Authorization", "Bearer valid")
+		rw := httptest.NewRecorder()
+		r.Authenticate(http.HandlerFunc(r.Logout)).ServeHTTP(rw, req)
+
+		assert.Equal(t, http.StatusOK, rw.Code)
+	})
+}
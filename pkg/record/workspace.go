@@ -0,0 +1,662 @@
+package record
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jvmistica/knowledge-base-go/pkg/tenant"
+	"gorm.io/gorm"
+)
+
+// DefaultWorkspace is the slug of the workspace of the requests that do not
+// select one, open to every user
+const DefaultWorkspace = "default"
+
+const (
+	workspaceHeader     = "X-Workspace"
+	workspacePathPrefix = apiPrefix + "/w/"
+)
+
+// Roles of a workspace member
+const (
+	WorkspaceRoleMember = "member"
+	WorkspaceRoleAdmin  = "admin"
+)
+
+// TenantTables are the tables whose rows belong to a workspace, the tables
+// of the records first
+var TenantTables = []string{
+	"notes", "recipes", "scripts", "secrets", "audit_events", "ingredient_mappings",
+	"links", "relations", "attachments", "shares", "executions",
+}
+
+// recordRefs are the type and ID columns of the tenant tables whose rows
+// belong to the workspace of a record. Executions only refer to scripts.
+var recordRefs = map[string]struct{ typ, id string }{
+	"links":       {"source_type", "source_id"},
+	"relations":   {"source_type", "source_id"},
+	"attachments": {"record_type", "record_id"},
+	"shares":      {"record_type", "record_id"},
+	"executions":  {"", "script_id"},
+}
+
+// errLastWorkspaceAdmin is returned when the only admin of a workspace would be removed or demoted
+const errLastWorkspaceAdmin = "A workspace needs at least one admin"
+
+// validSlug matches the slugs of workspaces
+var validSlug = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,62}$`)
+
+// errQuotaExceeded is returned when a workspace has reached one of its quotas
+var errQuotaExceeded = errors.New("Workspace quota exceeded")
+
+// WorkspaceSettings are the settings and quotas of a workspace. A zero
+// quota is unlimited.
+type WorkspaceSettings struct {
+	DefaultVisibility string `json:"default_visibility,omitempty"`
+	MaxNotes          int    `json:"max_notes,omitempty"`
+	MaxRecipes        int    `json:"max_recipes,omitempty"`
+	MaxScripts        int    `json:"max_scripts,omitempty"`
+	MaxStorage        int64  `json:"max_storage,omitempty"`
+}
+
+// Workspace is the structure of the workspaces table, a tenant whose notes,
+// recipes and scripts are isolated from the other workspaces
+type Workspace struct {
+	ID        uint              `json:"id"`
+	Slug      string            `json:"slug" gorm:"uniqueIndex"`
+	Name      string            `json:"name"`
+	Settings  WorkspaceSettings `json:"settings" gorm:"serializer:json"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// WorkspaceMember is the structure of the workspace_members table
+type WorkspaceMember struct {
+	WorkspaceID uint      `json:"workspace_id" gorm:"primaryKey"`
+	UserID      uint      `json:"user_id" gorm:"primaryKey;index"`
+	Role        string    `json:"role" gorm:"not null;default:member"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Usage is the number of records and the attachment storage of a workspace
+type Usage struct {
+	Notes   int64 `json:"notes"`
+	Recipes int64 `json:"recipes"`
+	Scripts int64 `json:"scripts"`
+	Storage int64 `json:"storage"`
+}
+
+// WorkspaceDetails is a workspace with its usage
+type WorkspaceDetails struct {
+	Workspace
+	Usage Usage `json:"usage"`
+}
+
+// validate checks the default visibility and quotas of workspace settings
+func (s WorkspaceSettings) validate() error {
+	if s.DefaultVisibility != "" && !slices.Contains(visibilities, s.DefaultVisibility) {
+		return fmt.Errorf("Invalid default visibility: '%s', supported visibilities are %s",
+			s.DefaultVisibility, strings.Join(visibilities, ", "))
+	}
+
+	if s.MaxNotes < 0 || s.MaxRecipes < 0 || s.MaxScripts < 0 || s.MaxStorage < 0 {
+		return errors.New("Invalid quota: must not be negative")
+	}
+
+	return nil
+}
+
+// limit returns the quota of records of a type
+func (s WorkspaceSettings) limit(typ string) int {
+	switch typ {
+	case TypeNote:
+		return s.MaxNotes
+	case TypeRecipe:
+		return s.MaxRecipes
+	case TypeScript:
+		return s.MaxScripts
+	}
+
+	return 0
+}
+
+// EnsureDefaultWorkspace creates the default workspace and moves the records
+// without a workspace, created before workspaces were introduced or seeded,
+// into it
+func EnsureDefaultWorkspace(db *gorm.DB) (*Workspace, error) {
+	workspace := Workspace{Slug: DefaultWorkspace, Name: "Default"}
+	if result := db.Where(Workspace{Slug: DefaultWorkspace}).FirstOrCreate(&workspace); result.Error != nil {
+		return nil, result.Error
+	}
+
+	for _, table := range TenantTables {
+		// Rows referring to a record move to the workspace of the record
+		if ref, ok := recordRefs[table]; ok {
+			for _, typ := range recordTypes {
+				if ref.typ == "" && typ != TypeScript {
+					continue
+				}
+
+				query := db.Table(table).Where(tenant.Column + " = 0")
+				if ref.typ != "" {
+					query = query.Where(ref.typ+" = ?", typ)
+				}
+
+				records := recordTables[typ].table
+				workspaceOf := gorm.Expr(fmt.Sprintf("COALESCE((SELECT %s FROM %s WHERE %s.id = %s.%s), ?)",
+					tenant.Column, records, records, table, ref.id), workspace.ID)
+				if result := query.Update(tenant.Column, workspaceOf); result.Error != nil {
+					return nil, result.Error
+				}
+			}
+		}
+
+		if result := db.Table(table).Where(tenant.Column+" = 0").Update(tenant.Column, workspace.ID); result.Error != nil {
+			return nil, result.Error
+		}
+	}
+
+	return &workspace, nil
+}
+
+// AddDefaultAdmin makes a registered user an admin of the default workspace,
+// which is open to every user but only administered by the users added here
+func AddDefaultAdmin(db *gorm.DB, username string) error {
+	var user User
+	result := db.Where("username = ?", username).Find(&user)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("unknown user '%s'", username)
+	}
+
+	workspace, err := EnsureDefaultWorkspace(db)
+	if err != nil {
+		return err
+	}
+
+	member := WorkspaceMember{WorkspaceID: workspace.ID, UserID: user.ID, Role: WorkspaceRoleAdmin}
+	return db.Where(WorkspaceMember{WorkspaceID: member.WorkspaceID, UserID: member.UserID}).
+		Assign(WorkspaceMember{Role: member.Role}).FirstOrCreate(&member).Error
+}
+
+// workspaceFromContext returns the workspace of a request context
+func workspaceFromContext(ctx context.Context) (*Workspace, bool) {
+	workspace, ok := ctx.Value(workspaceKey).(*Workspace)
+	return workspace, ok
+}
+
+// splitWorkspacePath returns the workspace selected by the /w/{slug} prefix
+// of a path, if any, and the path without it
+func splitWorkspacePath(path string) (string, string) {
+	rest, ok := strings.CutPrefix(path, workspacePathPrefix)
+	if !ok {
+		return "", path
+	}
+
+	slug, tail, _ := strings.Cut(rest, "/")
+	return slug, apiPrefix + "/" + tail
+}
+
+// inWorkspace returns a copy of the record whose queries carry the context
+// of a request, limiting them to its workspace
+func (re *Record) inWorkspace(r *http.Request) *Record {
+	c := *re
+	c.DB = re.DB.WithContext(r.Context())
+	return &c
+}
+
+// isWorkspaceMember returns whether a user can use a workspace, and their role in it
+func (re *Record) isWorkspaceMember(user *User, workspace *Workspace) (bool, string, error) {
+	var member WorkspaceMember
+	result := re.DB.Where("workspace_id = ? AND user_id = ?", workspace.ID, user.ID).Find(&member)
+	if result.Error != nil {
+		return false, "", result.Error
+	}
+
+	return result.RowsAffected > 0 || workspace.Slug == DefaultWorkspace, member.Role, nil
+}
+
+// isWorkspaceAdmin reports whether a user is an admin of a workspace
+func (re *Record) isWorkspaceAdmin(user *User, workspace *Workspace) (bool, error) {
+	_, role, err := re.isWorkspaceMember(user, workspace)
+	return role == WorkspaceRoleAdmin, err
+}
+
+// isServerAdmin reports whether a user is an admin of the default workspace,
+// which only the operator or another such admin can make them
+func (re *Record) isServerAdmin(user *User) (bool, error) {
+	defaultWorkspace := re.DB.Session(&gorm.Session{NewDB: true}).Model(&Workspace{}).Select("id").Where("slug = ?", DefaultWorkspace)
+
+	var count int64
+	result := re.DB.Model(&WorkspaceMember{}).
+		Where("user_id = ? AND role = ? AND workspace_id IN (?)", user.ID, WorkspaceRoleAdmin, defaultWorkspace).Count(&count)
+	return count > 0, result.Error
+}
+
+// Workspace resolves the workspace of a request from the /w/{slug} path
+// prefix, the X-Workspace header or the API key it was authenticated with,
+// and limits the queries of the handlers to it. Requests without a
+// workspace use the default workspace, and the other workspaces are only
+// available to their members.
+func (re *Record) Workspace(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+
+		slug, path := splitWorkspacePath(r.URL.Path)
+		if slug == "" {
+			slug = r.Header.Get(workspaceHeader)
+		}
+
+		var workspace Workspace
+		var result *gorm.DB
+		if key, ok := apiKeyFromContext(r.Context()); ok && key.WorkspaceID != 0 {
+			result = re.DB.Where(filterByID, key.WorkspaceID).Find(&workspace)
+			if result.Error == nil && slug != "" && slug != workspace.Slug {
+				http.Error(w, fmt.Sprintf("API key is limited to workspace '%s'", workspace.Slug), http.StatusForbidden)
+				return
+			}
+		} else {
+			if slug == "" {
+				slug = DefaultWorkspace
+			}
+			result = re.DB.Where("slug = ?", slug).Find(&workspace)
+		}
+
+		if result.Error != nil {
+			http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+			return
+		}
+
+		member := false
+		if result.RowsAffected > 0 {
+			var err error
+			if member, _, err = re.isWorkspaceMember(user, &workspace); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if !member {
+			http.Error(w, fmt.Sprintf("Workspace not found: '%s'", slug), http.StatusNotFound)
+			return
+		}
+
+		ctx := context.WithValue(tenant.WithWorkspace(r.Context(), workspace.ID), workspaceKey, &workspace)
+		r = r.WithContext(ctx)
+		if path != r.URL.Path {
+			u := *r.URL
+			u.Path, u.RawPath = path, ""
+			r.URL = &u
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// prepareCreate assigns a new record to the authenticated user, applies the
+// default visibility of the workspace and checks its quota, writing the
+// error response if the record cannot be created
+func (re *Record) prepareCreate(w http.ResponseWriter, r *http.Request, user *User, typ string, o *Ownership) bool {
+	o.OwnerID = user.ID
+
+	workspace, ok := workspaceFromContext(r.Context())
+	if ok && o.Visibility == "" {
+		o.Visibility = workspace.Settings.DefaultVisibility
+	}
+
+	if err := o.validate(true); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+
+	if !ok || workspace.Settings.limit(typ) == 0 {
+		return true
+	}
+
+	var count int64
+	if result := re.DB.Table(recordTables[typ].table).Count(&count); result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return false
+	}
+
+	if count >= int64(workspace.Settings.limit(typ)) {
+		http.Error(w, fmt.Sprintf("%s: at most %d %ss", errQuotaExceeded, workspace.Settings.limit(typ), typ), http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
+// storageUsed returns the size of the attachments of the records of the workspace
+func (re *Record) storageUsed() (int64, error) {
+	var used int64
+	result := re.DB.Model(&Attachment{}).Select("COALESCE(SUM(size), 0)").Scan(&used)
+	return used, result.Error
+}
+
+// usage returns the usage of the workspace
+func (re *Record) usage() (Usage, error) {
+	var usage Usage
+	for typ, count := range map[string]*int64{TypeNote: &usage.Notes, TypeRecipe: &usage.Recipes, TypeScript: &usage.Scripts} {
+		if result := re.DB.Table(recordTables[typ].table).Count(count); result.Error != nil {
+			return usage, result.Error
+		}
+	}
+
+	storage, err := re.storageUsed()
+	usage.Storage = storage
+	return usage, err
+}
+
+// otherWorkspaceAdmins returns the number of admins of a workspace besides a user. As
+// only admins manage members, none means the user is the last admin.
+func (re *Record) otherWorkspaceAdmins(workspaceID uint, userID any) (int64, error) {
+	var admins int64
+	result := re.DB.Model(&WorkspaceMember{}).Where("workspace_id = ? AND role = ? AND user_id <> ?",
+		workspaceID, WorkspaceRoleAdmin, userID).Count(&admins)
+	return admins, result.Error
+}
+
+// CreateWorkspace creates a new workspace with the authenticated user as its admin
+func (re *Record) CreateWorkspace(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var workspace Workspace
+	if err := decodeBody(r, &workspace); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !validSlug.MatchString(workspace.Slug) {
+		http.Error(w, "Invalid slug: must be 2 to 63 lowercase letters, digits or dashes", http.StatusBadRequest)
+		return
+	}
+
+	if err := workspace.Settings.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var count int64
+	if result := re.DB.Model(&Workspace{}).Where("slug = ?", workspace.Slug).Count(&count); result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	if count > 0 {
+		http.Error(w, "Slug already taken", http.StatusConflict)
+		return
+	}
+
+	workspace = Workspace{Slug: workspace.Slug, Name: workspace.Name, Settings: workspace.Settings}
+	if result := re.DB.Create(&workspace); result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	member := WorkspaceMember{WorkspaceID: workspace.ID, UserID: user.ID, Role: WorkspaceRoleAdmin}
+	if result := re.DB.Create(&member); result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, workspace)
+}
+
+// ListWorkspaces lists the workspaces the authenticated user can use
+func (re *Record) ListWorkspaces(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	members := re.DB.Session(&gorm.Session{NewDB: true}).Model(&WorkspaceMember{}).Select("workspace_id").
+		Where("user_id = ?", user.ID)
+
+	var workspaces []Workspace
+	result := re.DB.Where("slug = ? OR id IN (?)", DefaultWorkspace, members).Order("id").Find(&workspaces)
+	if result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, workspaces)
+}
+
+// GetWorkspace gets the details and usage of the workspace of the request
+func (re *Record) GetWorkspace(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	re = re.inWorkspace(r)
+	workspace, ok := workspaceFromContext(r.Context())
+	if !ok {
+		http.Error(w, "No workspace", http.StatusBadRequest)
+		return
+	}
+
+	usage, err := re.usage()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, WorkspaceDetails{Workspace: *workspace, Usage: usage})
+}
+
+// workspaceAdmin returns the workspace of a request if the authenticated
+// user administers it, or writes the error response
+func (re *Record) workspaceAdmin(w http.ResponseWriter, r *http.Request) (*Workspace, bool) {
+	user, ok := currentUser(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	workspace, ok := workspaceFromContext(r.Context())
+	if !ok {
+		http.Error(w, "No workspace", http.StatusBadRequest)
+		return nil, false
+	}
+
+	admin, err := re.isWorkspaceAdmin(user, workspace)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if !admin {
+		http.Error(w, "Only workspace admins can do this", http.StatusForbidden)
+		return nil, false
+	}
+
+	return workspace, true
+}
+
+// UpdateWorkspace updates the name and settings of the workspace of the request
+func (re *Record) UpdateWorkspace(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	workspace, ok := re.workspaceAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	var update Workspace
+	if err := decodeBody(r, &update); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := update.Settings.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	updated := *workspace
+	updated.Settings = update.Settings
+	if strings.TrimSpace(update.Name) != "" {
+		updated.Name = update.Name
+	}
+
+	// A map update would skip the serializer of the settings
+	result := re.DB.Model(&Workspace{}).Where(filterByID, workspace.ID).Select("name", "settings").Updates(&updated)
+	if result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// ListWorkspaceMembers lists the members of the workspace of the request
+func (re *Record) ListWorkspaceMembers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	workspace, ok := workspaceFromContext(r.Context())
+	if !ok {
+		http.Error(w, "No workspace", http.StatusBadRequest)
+		return
+	}
+
+	var members []WorkspaceMember
+	result := re.DB.Where("workspace_id = ?", workspace.ID).Order("user_id").Find(&members)
+	if result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, members)
+}
+
+// AddWorkspaceMember adds a user to the workspace of the request, or changes their role
+func (re *Record) AddWorkspaceMember(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	workspace, ok := re.workspaceAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	var member WorkspaceMember
+	if err := decodeBody(r, &member); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if member.UserID == 0 {
+		http.Error(w, "Missing user_id", http.StatusBadRequest)
+		return
+	}
+
+	if member.Role == "" {
+		member.Role = WorkspaceRoleMember
+	}
+
+	if member.Role != WorkspaceRoleMember && member.Role != WorkspaceRoleAdmin {
+		http.Error(w, fmt.Sprintf("Invalid role: '%s', supported roles are %s, %s",
+			member.Role, WorkspaceRoleMember, WorkspaceRoleAdmin), http.StatusBadRequest)
+		return
+	}
+
+	if member.Role != WorkspaceRoleAdmin {
+		admins, err := re.otherWorkspaceAdmins(workspace.ID, member.UserID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if admins == 0 {
+			http.Error(w, errLastWorkspaceAdmin, http.StatusConflict)
+			return
+		}
+	}
+
+	member = WorkspaceMember{WorkspaceID: workspace.ID, UserID: member.UserID, Role: member.Role}
+	result := re.DB.Where(WorkspaceMember{WorkspaceID: member.WorkspaceID, UserID: member.UserID}).
+		Assign(WorkspaceMember{Role: member.Role}).FirstOrCreate(&member)
+	if result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, member)
+}
+
+// RemoveWorkspaceMember removes a user from the workspace of the request
+func (re *Record) RemoveWorkspaceMember(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	workspace, ok := re.workspaceAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		http.Error(w, "Missing query parameter: 'user_id'", http.StatusBadRequest)
+		return
+	}
+
+	admins, err := re.otherWorkspaceAdmins(workspace.ID, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if admins == 0 {
+		http.Error(w, errLastWorkspaceAdmin, http.StatusConflict)
+		return
+	}
+
+	result := re.DB.Where("workspace_id = ? AND user_id = ?", workspace.ID, userID).Delete(&WorkspaceMember{})
+	if result.Error != nil {
+		http.Error(w, fmt.Sprintf("%s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
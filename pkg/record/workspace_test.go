@@ -0,0 +1,351 @@
+package record
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	mocket "github.com/selvatico/go-mocket"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jvmistica/knowledge-base-go/pkg/blob"
+	"github.com/jvmistica/knowledge-base-go/pkg/config"
+	"github.com/jvmistica/knowledge-base-go/pkg/tenant"
+)
+
+// testWorkspace is the workspace of the workspace tests
+var testWorkspace = &Workspace{ID: 7, Slug: "acme", Name: "Acme"}
+
+// withWorkspace returns a request limited to a workspace
+func withWorkspace(r *http.Request, workspace *Workspace) *http.Request {
+	ctx := context.WithValue(tenant.WithWorkspace(r.Context(), workspace.ID), workspaceKey, workspace)
+	return r.WithContext(ctx)
+}
+
+func TestSplitWorkspacePath(t *testing.T) {
+	tests := map[string][2]string{
+		"/api/v1/notes/list":        {"", "/api/v1/notes/list"},
+		"/api/v1/w/acme/notes/list": {"acme", "/api/v1/notes/list"},
+		"/api/v1/w/acme":            {"acme", "/api/v1/"},
+	}
+
+	for path, want := range tests {
+		slug, rest := splitWorkspacePath(path)
+		assert.Equal(t, want, [2]string{slug, rest}, path)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/w/acme/scripts/1/run", nil)
+	req.Method = http.MethodPost
+	assert.Equal(t, "scripts:run", requiredScope(req))
+}
+
+func TestWorkspaceMiddleware(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db}
+
+	var gotPath string
+	var gotWorkspace uint
+	handler := r.Workspace(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		gotPath = req.URL.Path
+		gotWorkspace, _ = tenant.FromContext(req.Context())
+	}))
+
+	t.Run("not logged in", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/api/v1/notes/list", nil))
+
+		assert.Equal(t, http.StatusUnauthorized, rw.Code)
+	})
+
+	t.Run("default workspace", func(t *testing.T) {
+		mocket.Catcher.Reset().NewMock().WithQuery(`FROM "workspaces"`).WithReply([]map[string]interface{}{{"id": 1, "slug": DefaultWorkspace}})
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, withUser(httptest.NewRequest(http.MethodGet, "/api/v1/notes/list", nil), testUser))
+
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, uint(1), gotWorkspace)
+		assert.Equal(t, "/api/v1/notes/list", gotPath)
+	})
+
+	t.Run("path prefix", func(t *testing.T) {
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`FROM "workspaces"`).WithArgs("acme").WithReply([]map[string]interface{}{{"id": 7, "slug": "acme"}})
+		mocket.Catcher.NewMock().WithQuery(`FROM "workspace_members"`).WithReply([]map[string]interface{}{{"workspace_id": 7, "user_id": 1, "role": "member"}})
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, withUser(httptest.NewRequest(http.MethodGet, "/api/v1/w/acme/notes/list", nil), testUser))
+
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, uint(7), gotWorkspace)
+		assert.Equal(t, "/api/v1/notes/list", gotPath)
+	})
+
+	t.Run("not a member", func(t *testing.T) {
+		mocket.Catcher.Reset().NewMock().WithQuery(`FROM "workspaces"`).WithReply([]map[string]interface{}{{"id": 7, "slug": "acme"}})
+		req := withUser(httptest.NewRequest(http.MethodGet, "/api/v1/notes/list", nil), testUser)
+		req.Header.Set(workspaceHeader, "acme")
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+
+		assert.Equal(t, http.StatusNotFound, rw.Code)
+	})
+
+	t.Run("unknown workspace", func(t *testing.T) {
+		mocket.Catcher.Reset()
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, withUser(httptest.NewRequest(http.MethodGet, "/api/v1/w/nope/notes/list", nil), testUser))
+
+		assert.Equal(t, http.StatusNotFound, rw.Code)
+	})
+
+	t.Run("API key of another workspace", func(t *testing.T) {
+		mocket.Catcher.Reset().NewMock().WithQuery(`FROM "workspaces"`).WithReply([]map[string]interface{}{{"id": 7, "slug": "acme"}})
+		req := withUser(httptest.NewRequest(http.MethodGet, "/api/v1/w/other/notes/list", nil), testUser)
+		req = req.WithContext(context.WithValue(req.Context(), apiKeyKey, &APIKey{ID: 1, WorkspaceID: 7}))
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+
+		assert.Equal(t, http.StatusForbidden, rw.Code)
+	})
+}
+
+func TestWorkspaceIsolation(t *testing.T) {
+	db := setupTestDB()
+	assert.Nil(t, tenant.Register(db, TenantTables...))
+	r := &Record{DB: db}
+
+	t.Run("queries", func(t *testing.T) {
+		var query string
+		mocket.Catcher.Reset().NewMock().WithQuery(`SELECT * FROM "notes"`).WithCallback(func(q string, _ []driver.NamedValue) {
+			query = q
+		})
+		rw := httptest.NewRecorder()
+		r.ListNotes(rw, withWorkspace(withUser(httptest.NewRequest(http.MethodGet, "/", nil), testUser), testWorkspace))
+
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Contains(t, query, `"notes"."workspace_id" = `)
+	})
+
+	t.Run("created records", func(t *testing.T) {
+		var values []driver.Value
+		mocket.Catcher.Reset().NewMock().WithQuery(`INSERT INTO "notes"`).WithCallback(func(_ string, args []driver.NamedValue) {
+			for _, a := range args {
+				values = append(values, a.Value)
+			}
+		})
+		rw := httptest.NewRecorder()
+		r.CreateNote(rw, withWorkspace(withUser(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"title": "Runbook", "workspace_id": 3}`)), testUser), testWorkspace))
+
+		assert.Equal(t, http.StatusCreated, rw.Code)
+		assert.Contains(t, values, int64(testWorkspace.ID))
+		assert.NotContains(t, values, int64(3))
+	})
+
+	t.Run("related tables", func(t *testing.T) {
+		queries := map[string]string{}
+		mocket.Catcher.Reset()
+		for _, table := range []string{"notes", "relations", "ingredient_mappings"} {
+			mocket.Catcher.NewMock().WithQuery(`FROM "` + table + `"`).WithCallback(func(q string, _ []driver.NamedValue) {
+				queries[table] = q
+			})
+		}
+
+		rw := httptest.NewRecorder()
+		r.ExportGraph(rw, withWorkspace(withUser(httptest.NewRequest(http.MethodGet, "/", nil), testUser), testWorkspace))
+		assert.Equal(t, http.StatusOK, rw.Code)
+
+		rw = httptest.NewRecorder()
+		r.ListIngredientMappings(rw, withWorkspace(withUser(httptest.NewRequest(http.MethodGet, "/", nil), testUser), testWorkspace))
+		assert.Equal(t, http.StatusOK, rw.Code)
+
+		for _, table := range []string{"relations", "ingredient_mappings"} {
+			assert.Contains(t, queries[table], `"`+table+`"."workspace_id" = `, table)
+		}
+	})
+
+	t.Run("created relations", func(t *testing.T) {
+		var values []driver.Value
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`SELECT count(*) FROM "notes"`).WithReply([]map[string]interface{}{{"count": 1}})
+		mocket.Catcher.NewMock().WithQuery(`SELECT count(*) FROM "scripts"`).WithReply([]map[string]interface{}{{"count": 1}})
+		mocket.Catcher.NewMock().WithQuery(`INSERT INTO "relations"`).WithCallback(func(_ string, args []driver.NamedValue) {
+			for _, a := range args {
+				values = append(values, a.Value)
+			}
+		})
+		rw := httptest.NewRecorder()
+		r.CreateRelation(rw, withWorkspace(withUser(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"source_type": "note", "source_id": 1, "type": "uses", "target_type": "script", "target_id": 2}`)), testUser), testWorkspace))
+
+		assert.Equal(t, http.StatusCreated, rw.Code)
+		assert.Contains(t, values, int64(testWorkspace.ID))
+	})
+}
+
+func TestWorkspaceSettings(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db}
+	workspace := &Workspace{ID: 7, Slug: "acme", Settings: WorkspaceSettings{DefaultVisibility: VisibilityTeam, MaxScripts: 2, MaxStorage: 100}}
+
+	t.Run("validate", func(t *testing.T) {
+		assert.Nil(t, workspace.Settings.validate())
+		assert.NotNil(t, WorkspaceSettings{DefaultVisibility: "world"}.validate())
+		assert.NotNil(t, WorkspaceSettings{MaxNotes: -1}.validate())
+	})
+
+	t.Run("default visibility", func(t *testing.T) {
+		var values []driver.Value
+		mocket.Catcher.Reset().NewMock().WithQuery(`INSERT INTO "notes"`).WithCallback(func(_ string, args []driver.NamedValue) {
+			for _, a := range args {
+				values = append(values, a.Value)
+			}
+		})
+		rw := httptest.NewRecorder()
+		r.CreateNote(rw, withWorkspace(withUser(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"title": "Runbook"}`)), testUser), workspace))
+
+		assert.Equal(t, http.StatusCreated, rw.Code)
+		assert.Contains(t, values, VisibilityTeam)
+	})
+
+	t.Run("record quota", func(t *testing.T) {
+		mocket.Catcher.Reset().NewMock().WithQuery(`SELECT count(*) FROM "scripts"`).WithReply([]map[string]interface{}{{"count": 2}})
+		rw := httptest.NewRecorder()
+		r.CreateScript(rw, withWorkspace(withUser(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name": "Restart"}`)), testUser), workspace))
+
+		assert.Equal(t, http.StatusForbidden, rw.Code)
+		assert.Contains(t, rw.Body.String(), errQuotaExceeded.Error())
+	})
+
+	t.Run("storage quota", func(t *testing.T) {
+		store, err := blob.NewFileStore(t.TempDir())
+		assert.Nil(t, err)
+		r := &Record{DB: db, Blobs: store, Uploads: UploadLimits{MaxSize: config.DefaultMaxUploadSize, Types: config.DefaultUploadTypes}}
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`SELECT count(*) FROM "notes"`).WithReply([]map[string]interface{}{{"count": 1}})
+		mocket.Catcher.NewMock().WithQuery(`SUM(size)`).WithReply([]map[string]interface{}{{"coalesce": 100}})
+
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		part, _ := mw.CreateFormFile("file", "notes.txt")
+		part.Write([]byte("hello"))
+		mw.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/?id=1", &body)
+		req.Header.Set("content-type", mw.FormDataContentType())
+		rw := httptest.NewRecorder()
+		r.UploadNoteAttachment(rw, withWorkspace(withUser(req, testUser), workspace))
+
+		assert.Equal(t, http.StatusForbidden, rw.Code)
+	})
+}
+
+func TestCreateWorkspace(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db}
+
+	t.Run("invalid slug", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		r.CreateWorkspace(rw, withUser(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"slug": "Acme Inc"}`)), testUser))
+
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+
+	t.Run("slug taken", func(t *testing.T) {
+		mocket.Catcher.Reset().NewMock().WithQuery(`SELECT count(*) FROM "workspaces"`).WithReply([]map[string]interface{}{{"count": 1}})
+		rw := httptest.NewRecorder()
+		r.CreateWorkspace(rw, withUser(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"slug": "acme"}`)), testUser))
+
+		assert.Equal(t, http.StatusConflict, rw.Code)
+	})
+
+	t.Run(successOneRecord, func(t *testing.T) {
+		mocket.Catcher.Reset()
+		rw := httptest.NewRecorder()
+		r.CreateWorkspace(rw, withUser(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"slug": "acme", "name": "Acme", "settings": {"max_notes": 100}}`)), testUser))
+
+		assert.Equal(t, http.StatusCreated, rw.Code)
+		assert.Contains(t, rw.Body.String(), `"max_notes":100`)
+	})
+}
+
+func TestWorkspaceMembers(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db}
+
+	t.Run("not an admin", func(t *testing.T) {
+		mocket.Catcher.Reset().NewMock().WithQuery(`FROM "workspace_members"`).WithReply([]map[string]interface{}{{"workspace_id": 7, "user_id": 1, "role": "member"}})
+		rw := httptest.NewRecorder()
+		r.AddWorkspaceMember(rw, withWorkspace(withUser(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"user_id": 2}`)), testUser), testWorkspace))
+
+		assert.Equal(t, http.StatusForbidden, rw.Code)
+	})
+
+	t.Run(successOneRecord, func(t *testing.T) {
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`SELECT * FROM "workspace_members"`).WithReply([]map[string]interface{}{{"workspace_id": 7, "user_id": 1, "role": "admin"}}).OneTime()
+		mocket.Catcher.NewMock().WithQuery(`SELECT count(*) FROM "workspace_members"`).WithReply([]map[string]interface{}{{"count": 1}})
+		rw := httptest.NewRecorder()
+		r.AddWorkspaceMember(rw, withWorkspace(withUser(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"user_id": 2}`)), testUser), testWorkspace))
+
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Contains(t, rw.Body.String(), `"role":"member"`)
+	})
+
+	t.Run("last admin", func(t *testing.T) {
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`SELECT * FROM "workspace_members"`).WithReply([]map[string]interface{}{{"workspace_id": 7, "user_id": 1, "role": "admin"}})
+		mocket.Catcher.NewMock().WithQuery(`SELECT count(*) FROM "workspace_members"`).WithReply([]map[string]interface{}{{"count": 0}})
+		rw := httptest.NewRecorder()
+		r.RemoveWorkspaceMember(rw, withWorkspace(withUser(httptest.NewRequest(http.MethodDelete, "/?user_id=1", nil), testUser), testWorkspace))
+
+		assert.Equal(t, http.StatusConflict, rw.Code)
+	})
+}
+
+func TestDefaultWorkspaceAdmin(t *testing.T) {
+	db := setupTestDB()
+	r := &Record{DB: db}
+	workspace := &Workspace{ID: 1, Slug: DefaultWorkspace, Name: "Default"}
+
+	t.Run("unknown user", func(t *testing.T) {
+		mocket.Catcher.Reset()
+		assert.ErrorContains(t, AddDefaultAdmin(db, "alice"), "unknown user")
+	})
+
+	t.Run("admin added", func(t *testing.T) {
+		var values []driver.Value
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`FROM "users"`).WithReply([]map[string]interface{}{{"id": 3, "username": "alice"}})
+		mocket.Catcher.NewMock().WithQuery(`FROM "workspaces"`).WithReply([]map[string]interface{}{{"id": 1, "slug": DefaultWorkspace}})
+		mocket.Catcher.NewMock().WithQuery(`INSERT INTO "workspace_members"`).WithCallback(func(_ string, args []driver.NamedValue) {
+			for _, a := range args {
+				values = append(values, a.Value)
+			}
+		})
+
+		assert.Nil(t, AddDefaultAdmin(db, "alice"))
+		assert.Equal(t, []driver.Value{int64(1), int64(3), WorkspaceRoleAdmin}, values[:3])
+	})
+
+	t.Run("settings updated by the admin", func(t *testing.T) {
+		mocket.Catcher.Reset()
+		mocket.Catcher.NewMock().WithQuery(`FROM "workspace_members"`).WithReply([]map[string]interface{}{{"workspace_id": 1, "user_id": 1, "role": WorkspaceRoleAdmin}})
+		mocket.Catcher.NewMock().WithQuery(`UPDATE "workspaces"`).WithRowsNum(1)
+		rw := httptest.NewRecorder()
+		r.UpdateWorkspace(rw, withWorkspace(withUser(httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"settings": {"max_notes": 100}}`)), testUser), workspace))
+
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Contains(t, rw.Body.String(), `"max_notes":100`)
+	})
+
+	t.Run("settings not updated by other users", func(t *testing.T) {
+		mocket.Catcher.Reset()
+		rw := httptest.NewRecorder()
+		r.UpdateWorkspace(rw, withWorkspace(withUser(httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"settings": {"max_notes": 100}}`)), testUser), workspace))
+
+		assert.Equal(t, http.StatusForbidden, rw.Code)
+	})
+}
@@ -0,0 +1,319 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jvmistica/knowledge-base-go/pkg/config"
+)
+
+// ErrLanguageNotAllowed is returned when a script's language has no allowed interpreter
+var ErrLanguageNotAllowed = errors.New("language is not allowed to run")
+
+// ErrStopped is returned for the background runs started after the runner is shut down
+var ErrStopped = errors.New("runner is shut down")
+
+// Config is the configuration of the runner
+type Config struct {
+	// Interpreters are the allowed languages and the commands used to run them
+	Interpreters map[string][]string
+	// Env are the names of the environment variables passed through to scripts
+	Env []string
+	// Timeout is the maximum wall-clock duration of a run
+	Timeout time.Duration
+	// MaxOutput is the maximum number of bytes kept of stdout and stderr each
+	MaxOutput int
+	// MaxMemory is the maximum virtual memory of a run in bytes, 0 for no limit
+	MaxMemory int64
+	// MaxCPU is the maximum CPU time of a run, 0 for no limit
+	MaxCPU time.Duration
+	// MaxFileSize is the maximum size of files written by a run in bytes, 0 for no limit
+	MaxFileSize int64
+	// UID and GID are the unprivileged user and group scripts run as, 0 to
+	// run them as the user of the server
+	UID, GID uint32
+}
+
+// DefaultConfig returns the default configuration, allowing the given
+// languages or all the default interpreters if none are given
+func DefaultConfig(languages ...string) Config {
+	interpreters := map[string][]string{}
+	for lang, cmd := range config.DefaultInterpreters {
+		interpreters[lang] = cmd
+	}
+
+	if len(languages) > 0 {
+		allowed := map[string][]string{}
+		for _, lang := range languages {
+			if cmd, ok := interpreters[lang]; ok {
+				allowed[lang] = cmd
+			}
+		}
+		interpreters = allowed
+	}
+
+	return Config{
+		Interpreters: interpreters,
+		Env:          config.DefaultEnv,
+		Timeout:      30 * time.Second,
+		MaxOutput:    1 << 20,
+		MaxMemory:    512 << 20,
+		MaxCPU:       30 * time.Second,
+		MaxFileSize:  10 << 20,
+	}
+}
+
+// Job is a script to run
+type Job struct {
+	Language string
+	Body     string
+	Args     []string
+	Env      map[string]string
+}
+
+// Result is the outcome of a run
+type Result struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+	TimedOut bool
+	// Canceled is set when the run was killed by the cancellation of its context
+	Canceled bool
+	Started  time.Time
+	Finished time.Time
+}
+
+// Runner runs scripts in sandboxed subprocesses
+type Runner struct {
+	config Config
+
+	// ctx is canceled to kill the background runs on shutdown
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+// New returns a runner with the given configuration
+func New(config Config) *Runner {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Runner{config: config, ctx: ctx, cancel: cancel}
+}
+
+// Languages returns the languages the runner is allowed to run
+func (ru *Runner) Languages() []string {
+	langs := make([]string, 0, len(ru.config.Interpreters))
+	for lang := range ru.config.Interpreters {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+
+	return langs
+}
+
+// Allowed reports whether scripts of the given language can be run
+func (ru *Runner) Allowed(language string) bool {
+	_, ok := ru.config.Interpreters[language]
+	return ok
+}
+
+// Go runs the job in the background and passes the result to done. Use Wait
+// to block until all background runs have finished. Once the runner is shut
+// down, done is called at once with ErrStopped.
+func (ru *Runner) Go(ctx context.Context, job Job, done func(*Result, error)) {
+	ru.mu.Lock()
+	if ru.stopped {
+		ru.mu.Unlock()
+		done(nil, ErrStopped)
+		return
+	}
+	ru.wg.Add(1)
+	ru.mu.Unlock()
+
+	go func() {
+		defer ru.wg.Done()
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		defer context.AfterFunc(ru.ctx, cancel)()
+
+		done(ru.Run(ctx, job))
+	}()
+}
+
+// Wait blocks until all background runs have finished
+func (ru *Runner) Wait() {
+	ru.wg.Wait()
+}
+
+// Stopped reports whether the runner is shut down
+func (ru *Runner) Stopped() bool {
+	ru.mu.Lock()
+	defer ru.mu.Unlock()
+
+	return ru.stopped
+}
+
+// Shutdown stops accepting background runs and waits for the running ones
+// to finish. If ctx is done first, the runs are killed, and Shutdown returns
+// the error of ctx once their results are passed to done.
+func (ru *Runner) Shutdown(ctx context.Context) error {
+	ru.mu.Lock()
+	ru.stopped = true
+	ru.mu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		ru.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		ru.cancel()
+		<-finished
+		return ctx.Err()
+	}
+}
+
+// Run runs the job in a temporary directory and waits for it to finish. A
+// non-zero exit code is reported in the result, not as an error.
+func (ru *Runner) Run(ctx context.Context, job Job) (*Result, error) {
+	interpreter, ok := ru.config.Interpreters[job.Language]
+	if !ok || len(interpreter) == 0 {
+		return nil, fmt.Errorf("%w: '%s'", ErrLanguageNotAllowed, job.Language)
+	}
+
+	dir, err := os.MkdirTemp("", "kb-run-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	script := filepath.Join(dir, "script")
+	if err := os.WriteFile(script, []byte(job.Body), 0o600); err != nil {
+		return nil, err
+	}
+
+	// The user the script runs as owns its directory, and nothing else
+	if ru.Isolated() {
+		for _, path := range []string{dir, script} {
+			if err := os.Chown(path, int(ru.config.UID), int(ru.config.GID)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if ru.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ru.config.Timeout)
+		defer cancel()
+	}
+
+	args := append([]string{}, interpreter[1:]...)
+	args = append(args, script)
+	args = append(args, job.Args...)
+	cmd := ru.command(ctx, interpreter[0], args)
+	cmd.Dir = dir
+	cmd.Env = ru.env(dir, job.Env)
+	cmd.WaitDelay = time.Second
+
+	stdout := &limitedBuffer{limit: ru.config.MaxOutput}
+	stderr := &limitedBuffer{limit: ru.config.MaxOutput}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	result := &Result{Started: time.Now()}
+	err = cmd.Run()
+	result.Finished = time.Now()
+	result.Stdout = stdout.String()
+	result.Stderr = stderr.String()
+	result.TimedOut = errors.Is(ctx.Err(), context.DeadlineExceeded)
+	result.Canceled = errors.Is(ctx.Err(), context.Canceled)
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		result.ExitCode = 0
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+	case result.TimedOut || result.Canceled:
+		result.ExitCode = -1
+	default:
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// env builds the environment of a run from the whitelist and the job's variables
+func (ru *Runner) env(dir string, vars map[string]string) []string {
+	env := []string{"HOME=" + dir, "TMPDIR=" + dir}
+	for _, name := range ru.config.Env {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		env = append(env, name+"="+vars[name])
+	}
+
+	return env
+}
+
+// limitedBuffer is a buffer that discards writes beyond its limit
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+// Write implements io.Writer, always reporting the full length as written so
+// that the subprocess is not interrupted once the limit is reached
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if b.limit > 0 {
+		remaining := b.limit - b.buf.Len()
+		if remaining <= 0 {
+			b.truncated = true
+			return n, nil
+		}
+		if len(p) > remaining {
+			p = p[:remaining]
+			b.truncated = true
+		}
+	}
+
+	b.buf.Write(p)
+	return n, nil
+}
+
+// String returns the buffered output, marking it if it was truncated
+func (b *limitedBuffer) String() string {
+	s := strings.ToValidUTF8(b.buf.String(), "�")
+	if b.truncated {
+		s += "\n[output truncated]"
+	}
+
+	return s
+}
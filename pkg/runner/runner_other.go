@@ -0,0 +1,19 @@
+//go:build !unix
+
+package runner
+
+import (
+	"context"
+	"os/exec"
+)
+
+// command builds the subprocess of a run. Resource limits other than the
+// timeout and running as another user are not supported on this platform.
+func (ru *Runner) command(ctx context.Context, name string, args []string) *exec.Cmd {
+	return exec.CommandContext(ctx, name, args...)
+}
+
+// Isolated reports whether scripts run as a different user than the server
+func (ru *Runner) Isolated() bool {
+	return false
+}
@@ -0,0 +1,165 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	ru := New(DefaultConfig("sh"))
+
+	t.Run("success", func(t *testing.T) {
+		res, err := ru.Run(context.Background(), Job{
+			Language: "sh",
+			Body:     "echo hello \"$1\"\necho oops >&2\n",
+			Args:     []string{"world"},
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, 0, res.ExitCode)
+		assert.Equal(t, "hello world\n", res.Stdout)
+		assert.Equal(t, "oops\n", res.Stderr)
+		assert.False(t, res.TimedOut)
+	})
+
+	t.Run("exit code", func(t *testing.T) {
+		res, err := ru.Run(context.Background(), Job{Language: "sh", Body: "exit 3"})
+		assert.Nil(t, err)
+		assert.Equal(t, 3, res.ExitCode)
+	})
+
+	t.Run("language not allowed", func(t *testing.T) {
+		_, err := ru.Run(context.Background(), Job{Language: "python", Body: "print(1)"})
+		assert.True(t, errors.Is(err, ErrLanguageNotAllowed))
+	})
+
+	t.Run("environment whitelist", func(t *testing.T) {
+		t.Setenv("KB_RUNNER_SECRET", "hunter2")
+		res, err := ru.Run(context.Background(), Job{
+			Language: "sh",
+			Body:     "echo \"$KB_RUNNER_SECRET\"\necho \"$GREETING\"\npwd\necho \"$HOME\"\n",
+			Env:      map[string]string{"GREETING": "hi"},
+		})
+		assert.Nil(t, err)
+
+		lines := strings.Split(res.Stdout, "\n")
+		assert.Equal(t, "", lines[0])
+		assert.Equal(t, "hi", lines[1])
+		assert.Equal(t, lines[2], lines[3])
+	})
+}
+
+func TestRunIsolated(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("running as another user requires root")
+	}
+
+	config := DefaultConfig("sh")
+	config.UID, config.GID = 65534, 65534
+	ru := New(config)
+	assert.True(t, ru.Isolated())
+
+	t.Setenv("KB_RUNNER_SECRET", "hunter2")
+	res, err := ru.Run(context.Background(), Job{
+		Language: "sh",
+		Body:     "id -u\nid -g\ntouch out && echo written\ncat /proc/$PPID/environ\n",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "65534\n65534\nwritten\n", res.Stdout)
+	assert.NotContains(t, res.Stdout+res.Stderr, "hunter2")
+}
+
+func TestRunLimits(t *testing.T) {
+	t.Run("timeout", func(t *testing.T) {
+		config := DefaultConfig("sh")
+		config.Timeout = 200 * time.Millisecond
+		ru := New(config)
+
+		start := time.Now()
+		res, err := ru.Run(context.Background(), Job{Language: "sh", Body: "sleep 10 & sleep 10"})
+		assert.Nil(t, err)
+		assert.True(t, res.TimedOut)
+		assert.Less(t, time.Since(start), 5*time.Second)
+	})
+
+	t.Run("output limit", func(t *testing.T) {
+		config := DefaultConfig("sh")
+		config.MaxOutput = 10
+		ru := New(config)
+
+		res, err := ru.Run(context.Background(), Job{Language: "sh", Body: "echo 0123456789abcdef"})
+		assert.Nil(t, err)
+		assert.Equal(t, "0123456789\n[output truncated]", res.Stdout)
+	})
+
+	t.Run("file size limit", func(t *testing.T) {
+		config := DefaultConfig("sh")
+		config.MaxFileSize = 4096
+		ru := New(config)
+
+		res, err := ru.Run(context.Background(), Job{
+			Language: "sh",
+			Body:     "head -c 100000 /dev/zero > big || exit 7",
+		})
+		assert.Nil(t, err)
+		assert.NotEqual(t, 0, res.ExitCode)
+	})
+}
+
+func TestGo(t *testing.T) {
+	ru := New(DefaultConfig("sh"))
+
+	var got *Result
+	ru.Go(context.Background(), Job{Language: "sh", Body: "echo done"}, func(res *Result, err error) {
+		assert.Nil(t, err)
+		got = res
+	})
+	ru.Wait()
+
+	assert.Equal(t, "done\n", got.Stdout)
+}
+
+func TestShutdown(t *testing.T) {
+	t.Run("waits for runs", func(t *testing.T) {
+		ru := New(DefaultConfig("sh"))
+
+		var got *Result
+		ru.Go(context.Background(), Job{Language: "sh", Body: "sleep 0.2; echo done"}, func(res *Result, err error) {
+			assert.Nil(t, err)
+			got = res
+		})
+
+		assert.False(t, ru.Stopped())
+		assert.Nil(t, ru.Shutdown(context.Background()))
+		assert.True(t, ru.Stopped())
+		assert.Equal(t, "done\n", got.Stdout)
+
+		ru.Go(context.Background(), Job{Language: "sh", Body: "echo late"}, func(res *Result, err error) {
+			assert.ErrorIs(t, err, ErrStopped)
+		})
+	})
+
+	t.Run("kills runs past the deadline", func(t *testing.T) {
+		ru := New(DefaultConfig("sh"))
+
+		var got *Result
+		ru.Go(context.Background(), Job{Language: "sh", Body: "sleep 10"}, func(res *Result, err error) {
+			assert.Nil(t, err)
+			got = res
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		assert.ErrorIs(t, ru.Shutdown(ctx), context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), 5*time.Second)
+		assert.True(t, got.Canceled)
+		assert.False(t, got.TimedOut)
+	})
+}
@@ -0,0 +1,48 @@
+//go:build unix
+
+package runner
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// command builds the subprocess of a run. The interpreter is started through
+// /bin/sh so that resource limits can be applied with ulimit before it is
+// exec'd, and in its own process group so that a timeout kills every process
+// the script has spawned. With a UID set, it runs as that user and group
+// without supplementary groups, so that it cannot read the environment of the
+// server or the files only the server can read.
+func (ru *Runner) command(ctx context.Context, name string, args []string) *exec.Cmd {
+	var limits []string
+	if ru.config.MaxCPU > 0 {
+		limits = append(limits, fmt.Sprintf("ulimit -t %d", int64(ru.config.MaxCPU.Seconds()+0.5)))
+	}
+	if ru.config.MaxMemory > 0 {
+		limits = append(limits, fmt.Sprintf("ulimit -v %d", ru.config.MaxMemory/1024))
+	}
+	if ru.config.MaxFileSize > 0 {
+		limits = append(limits, fmt.Sprintf("ulimit -f %d", ru.config.MaxFileSize/512))
+	}
+	limits = append(limits, `exec "$@"`)
+
+	shArgs := append([]string{"-c", strings.Join(limits, " && "), "sh", name}, args...)
+	cmd := exec.CommandContext(ctx, "/bin/sh", shArgs...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if ru.Isolated() {
+		cmd.SysProcAttr.Credential = &syscall.Credential{Uid: ru.config.UID, Gid: ru.config.GID, Groups: []uint32{}}
+	}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+
+	return cmd
+}
+
+// Isolated reports whether scripts run as a different user than the server
+func (ru *Runner) Isolated() bool {
+	return ru.config.UID != 0
+}
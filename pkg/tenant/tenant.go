@@ -0,0 +1,106 @@
+// Package tenant isolates the data of workspaces at the storage layer. Once
+// registered on a database, every query, update and deletion on a tenant
+// table is limited to the workspace of its context, and every row created
+// is assigned to it.
+package tenant
+
+import (
+	"context"
+	"reflect"
+	"slices"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Column is the column of a tenant table holding the workspace of a row
+const Column = "workspace_id"
+
+// key is the key of the workspace stored in a context
+type key struct{}
+
+// WithWorkspace returns a context whose queries are limited to a workspace
+func WithWorkspace(ctx context.Context, id uint) context.Context {
+	return context.WithValue(ctx, key{}, id)
+}
+
+// FromContext returns the workspace of a context
+func FromContext(ctx context.Context) (uint, bool) {
+	id, ok := ctx.Value(key{}).(uint)
+	return id, ok
+}
+
+// Register registers the callbacks isolating the given tables on a database
+func Register(db *gorm.DB, tables ...string) error {
+	p := &plugin{tables: tables}
+	cb := db.Callback()
+
+	if err := cb.Create().Before("gorm:create").Register("tenant:create", p.assign); err != nil {
+		return err
+	}
+
+	if err := cb.Query().Before("gorm:query").Register("tenant:query", p.filter); err != nil {
+		return err
+	}
+
+	if err := cb.Row().Before("gorm:row").Register("tenant:row", p.filter); err != nil {
+		return err
+	}
+
+	if err := cb.Update().Before("gorm:update").Register("tenant:update", p.filter); err != nil {
+		return err
+	}
+
+	return cb.Delete().Before("gorm:delete").Register("tenant:delete", p.filter)
+}
+
+// plugin holds the tenant tables of a database
+type plugin struct {
+	tables []string
+}
+
+// workspace returns the workspace a statement is limited to, if it is on a
+// tenant table and its context has one
+func (p *plugin) workspace(db *gorm.DB) (uint, bool) {
+	if db.Statement.Context == nil || !slices.Contains(p.tables, db.Statement.Table) {
+		return 0, false
+	}
+
+	return FromContext(db.Statement.Context)
+}
+
+// filter adds the workspace to the conditions of a statement
+func (p *plugin) filter(db *gorm.DB) {
+	id, ok := p.workspace(db)
+	if !ok {
+		return
+	}
+
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: db.Statement.Table, Name: Column}, Value: id},
+	}})
+}
+
+// assign sets the workspace of the rows created by a statement
+func (p *plugin) assign(db *gorm.DB) {
+	id, ok := p.workspace(db)
+	if !ok || db.Statement.Schema == nil {
+		return
+	}
+
+	field := db.Statement.Schema.LookUpField(Column)
+	if field == nil {
+		db.AddError(gorm.ErrInvalidField)
+		return
+	}
+
+	rv := db.Statement.ReflectValue
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			db.AddError(field.Set(db.Statement.Context, reflect.Indirect(rv.Index(i)), id))
+		}
+	case reflect.Struct:
+		db.AddError(field.Set(db.Statement.Context, rv, id))
+	}
+}
@@ -0,0 +1,104 @@
+package tenant
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	mocket "github.com/selvatico/go-mocket"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+type note struct {
+	ID          uint
+	Title       string
+	WorkspaceID uint
+}
+
+type tag struct {
+	ID   uint
+	Name string
+}
+
+func setupTestDB(t *testing.T) *gorm.DB {
+	mocket.Catcher.Register()
+	db, err := gorm.Open(postgres.New(postgres.Config{
+		DriverName: mocket.DriverName,
+		DSN:        "user:test@tcp(127.0.0.1:3306)",
+	}), &gorm.Config{})
+	assert.Nil(t, err)
+	assert.Nil(t, Register(db, "notes"))
+	return db
+}
+
+// capture records the statements run against the database
+func capture() *[]string {
+	var queries []string
+	mocket.Catcher.Reset().NewMock().WithCallback(func(q string, _ []driver.NamedValue) {
+		queries = append(queries, q)
+	})
+	return &queries
+}
+
+func TestFilter(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := WithWorkspace(context.Background(), 7)
+
+	tests := map[string]func(*gorm.DB){
+		"query":    func(db *gorm.DB) { db.Where("title = ?", "a").Find(&[]note{}) },
+		"count":    func(db *gorm.DB) { var n int64; db.Table("notes").Count(&n) },
+		"scan":     func(db *gorm.DB) { db.Table("notes").Select("id").Scan(&[]struct{ ID uint }{}) },
+		"update":   func(db *gorm.DB) { db.Model(&note{}).Where("id = ?", 1).Update("title", "b") },
+		"delete":   func(db *gorm.DB) { db.Where("id = ?", 1).Delete(&note{}) },
+		"subquery": func(db *gorm.DB) { db.Table("tags").Where("id IN (?)", db.Table("notes").Select("id")).Find(&[]tag{}) },
+	}
+
+	for name, run := range tests {
+		t.Run(name, func(t *testing.T) {
+			queries := capture()
+			run(db.WithContext(ctx))
+
+			if assert.Len(t, *queries, 1) {
+				assert.Contains(t, (*queries)[0], `"notes"."workspace_id" = `)
+			}
+		})
+	}
+
+	t.Run("without a workspace", func(t *testing.T) {
+		queries := capture()
+		db.Find(&[]note{})
+
+		if assert.Len(t, *queries, 1) {
+			assert.NotContains(t, (*queries)[0], "workspace_id")
+		}
+	})
+
+	t.Run("other tables", func(t *testing.T) {
+		queries := capture()
+		db.WithContext(ctx).Find(&[]tag{})
+
+		if assert.Len(t, *queries, 1) {
+			assert.NotContains(t, (*queries)[0], "workspace_id")
+		}
+	})
+}
+
+func TestAssign(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := WithWorkspace(context.Background(), 7)
+	mocket.Catcher.Reset()
+
+	n := note{Title: "a", WorkspaceID: 3}
+	assert.Nil(t, db.WithContext(ctx).Create(&n).Error)
+	assert.Equal(t, uint(7), n.WorkspaceID)
+
+	notes := []note{{Title: "a"}, {Title: "b"}}
+	assert.Nil(t, db.WithContext(ctx).Create(&notes).Error)
+	assert.Equal(t, uint(7), notes[1].WorkspaceID)
+
+	n = note{Title: "c"}
+	assert.Nil(t, db.Create(&n).Error)
+	assert.Equal(t, uint(0), n.WorkspaceID)
+}
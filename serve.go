@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/jvmistica/knowledge-base-go/pkg/blob"
+	"github.com/jvmistica/knowledge-base-go/pkg/config"
+	"github.com/jvmistica/knowledge-base-go/pkg/encryption"
+	"github.com/jvmistica/knowledge-base-go/pkg/health"
+	"github.com/jvmistica/knowledge-base-go/pkg/nutrition"
+	"github.com/jvmistica/knowledge-base-go/pkg/record"
+	"github.com/jvmistica/knowledge-base-go/pkg/runner"
+)
+
+// loadKeys loads the master keys from a keyfile or the inline keys,
+// returning nil when encryption is disabled
+func loadKeys(settings config.Encryption) (*encryption.Keyring, error) {
+	switch {
+	case settings.Keyfile != "":
+		return encryption.LoadKeyfile(settings.Keyfile)
+	case settings.Keys != "":
+		return encryption.ParseKeys(settings.Keys)
+	}
+
+	return nil, nil
+}
+
+// configureRecord returns the record serving the API from a database, with
+// the features enabled by the configuration, without touching the filesystem
+func configureRecord(db *gorm.DB, cfg *config.Config) (*record.Record, error) {
+	var err error
+	r := record.NewRecord(db)
+	r.TrustProxy = cfg.Server.TrustProxy
+	r.Auth = record.AuthSettings{
+		AccessTokenTTL:      cfg.Auth.AccessTokenTTL,
+		RefreshTokenTTL:     cfg.Auth.RefreshTokenTTL,
+		DisableRegistration: !cfg.Auth.AllowRegistration,
+	}
+
+	// Load the master keys
+	if r.Keys, err = loadKeys(cfg.Features.Encryption); err != nil {
+		return nil, err
+	}
+	if r.Keys != nil {
+		log.Printf("encryption enabled with primary key %s", r.Keys.Primary())
+	}
+
+	// Load the food composition database
+	if cfg.Features.Nutrition.Enabled {
+		var foodDB *nutrition.Database
+		if foods := cfg.Features.Nutrition.Foods; foods != "" {
+			foodDB, err = nutrition.LoadFile(foods)
+		} else {
+			foodDB, err = nutrition.LoadBundled()
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		r.Nutrition = foodDB
+		log.Printf("loaded %d foods for nutrition facts", foodDB.Len())
+	}
+
+	// Enable script execution
+	if scripts := cfg.Features.Scripts; scripts.Run {
+		runnerConfig := runner.DefaultConfig(scripts.Languages...)
+		runnerConfig.Timeout = scripts.Timeout
+		runnerConfig.Env = scripts.Env
+		runnerConfig.UID, runnerConfig.GID = uint32(scripts.UID), uint32(scripts.GID)
+
+		r.Runner = runner.New(runnerConfig)
+		log.Printf("script execution enabled for %s", strings.Join(r.Runner.Languages(), ", "))
+		if !r.Runner.Isolated() {
+			log.Printf("scripts run as the user of the server, only administrators can run them")
+		}
+	}
+
+	// Enable attachments stored in S3
+	attachments := cfg.Features.Attachments
+	r.Uploads = record.UploadLimits{MaxSize: attachments.MaxUploadSize, Types: attachments.UploadTypes}
+	if attachments.S3.Endpoint != "" {
+		r.Blobs, err = blob.NewS3Store(blob.S3Config{
+			Endpoint:  attachments.S3.Endpoint,
+			Region:    attachments.S3.Region,
+			Bucket:    attachments.S3.Bucket,
+			AccessKey: attachments.S3.AccessKey,
+			SecretKey: attachments.S3.SecretKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("attachments stored in bucket %s", attachments.S3.Bucket)
+	}
+
+	return r, nil
+}
+
+// newRecord returns the configured record serving the API from a database,
+// creating the attachments directory if attachments are stored in one
+func newRecord(db *gorm.DB, cfg *config.Config) (*record.Record, error) {
+	r, err := configureRecord(db, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Enable attachments stored in a directory
+	if dir := cfg.Features.Attachments.Dir; r.Blobs == nil && dir != "" {
+		if r.Blobs, err = blob.NewFileStore(dir); err != nil {
+			return nil, err
+		}
+		log.Printf("attachments stored in %s", dir)
+	}
+
+	return r, nil
+}
+
+// serve migrates the database and serves the API
+func serve(args []string) error {
+	fs := newFlagSet("serve", "")
+	loader := config.NewLoader(fs)
+	loader.RegisterFlags()
+	var skipMigrate = fs.Bool("skip-migrate", false, "set to true to start without migrating the database")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(loader)
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB(cfg.Database)
+	if err != nil {
+		return err
+	}
+
+	if !*skipMigrate {
+		if err := record.Migrate(db); err != nil {
+			return err
+		}
+	}
+
+	r, err := newRecord(db, cfg)
+	if err != nil {
+		return err
+	}
+
+	status := health.New(readinessChecks(r, db)...)
+	server, err := newServer(r, status, cfg)
+	if err != nil {
+		return err
+	}
+
+	return run(server, r, db, status, cfg.Server)
+}
+
+// readinessChecks returns the dependencies the server needs to serve requests
+func readinessChecks(r *record.Record, db *gorm.DB) []health.Check {
+	checks := []health.Check{
+		{Name: "database", Run: func(ctx context.Context) error {
+			sqlDB, err := db.DB()
+			if err != nil {
+				return err
+			}
+			return sqlDB.PingContext(ctx)
+		}},
+		{Name: "migrations", Run: func(ctx context.Context) error {
+			return record.CheckSchema(db.WithContext(ctx))
+		}},
+	}
+
+	if r.Runner != nil {
+		checks = append(checks, health.Check{Name: "scripts", Run: func(context.Context) error {
+			if r.Runner.Stopped() {
+				return runner.ErrStopped
+			}
+			return nil
+		}})
+	}
+
+	return checks
+}
+
+// newServer returns the server handling all the requests to the APIs and
+// the probes of the server
+func newServer(r *record.Record, status *health.Health, cfg *config.Config) (*http.Server, error) {
+	// Routes that require an authenticated user
+	api := http.NewServeMux()
+	for _, route := range r.Routes() {
+		api.HandleFunc(route.Pattern, route.Handler)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(apiVersion+"/", r.Authenticate(r.Workspace(api)))
+	for _, route := range r.PublicRoutes() {
+		mux.HandleFunc(route.Pattern, route.Handler)
+	}
+
+	mux.HandleFunc("/healthz", status.Live)
+	mux.HandleFunc("/readyz", status.Ready)
+	mux.HandleFunc("/version", health.Version)
+
+	var handler http.Handler = mux
+	if origins := cfg.CORS.AllowedOrigins; len(origins) > 0 {
+		handler = record.CORS(record.CORSPolicy{
+			AllowedOrigins:   origins,
+			AllowedMethods:   cfg.CORS.AllowedMethods,
+			AllowedHeaders:   cfg.CORS.AllowedHeaders,
+			AllowCredentials: cfg.CORS.AllowCredentials,
+			MaxAge:           cfg.CORS.MaxAge,
+		})(handler)
+		log.Printf("cross-origin requests allowed from %s", strings.Join(origins, ", "))
+	}
+
+	tlsConfig, err := cfg.TLS.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Server{
+		Addr:              cfg.Server.Listen,
+		Handler:           record.RequestID(handler),
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}, nil
+}
+
+// run serves the API until the process is interrupted or terminated, then
+// fails the readiness probe for the shutdown delay, stops accepting
+// requests, waits for the requests in flight and the script runs within the
+// shutdown timeout, and closes the database
+func run(server *http.Server, r *record.Record, db *gorm.DB, status *health.Health, settings config.Server) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	served := make(chan error, 1)
+	go func() {
+		if server.TLSConfig != nil {
+			log.Printf("serving HTTPS on %s", server.Addr)
+			served <- server.ListenAndServeTLS("", "")
+		} else {
+			log.Printf("serving HTTP on %s", server.Addr)
+			served <- server.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+
+	// A second signal kills the process
+	stop()
+	status.Shutdown()
+	if settings.ShutdownDelay > 0 {
+		log.Printf("shutting down in %s", settings.ShutdownDelay)
+		time.Sleep(settings.ShutdownDelay)
+	}
+	log.Printf("shutting down, waiting up to %s for requests and script runs", settings.ShutdownTimeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), settings.ShutdownTimeout)
+	defer cancel()
+
+	var errs []error
+	if err := server.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("draining requests: %w", err))
+	}
+
+	if r.Runner != nil {
+		if err := r.Runner.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("stopping script runs: %w", err))
+		}
+	}
+
+	sqlDB, err := db.DB()
+	if err == nil {
+		err = sqlDB.Close()
+	}
+	if err != nil {
+		errs = append(errs, fmt.Errorf("closing the database: %w", err))
+	}
+
+	if len(errs) == 0 {
+		log.Print("shut down")
+	}
+	return errors.Join(errs...)
+}